@@ -0,0 +1,142 @@
+// Package attrs sets and gets typed values as message attributes, with a
+// single encoding shared by publishers and receivers, instead of ad-hoc
+// conversions disagreeing on formats:
+//
+//	attrs.SetInt(*w.Attributes(), "Schema-Version", 2)
+//	attrs.SetTime(*w.Attributes(), "Created-At", order.CreatedAt)
+//
+//	version, err := attrs.GetInt(m.Attributes, "Schema-Version")
+//
+// Integers and floats are encoded in base 10, booleans as "true" or
+// "false", times in RFC 3339 format with nanoseconds, in UTC, and durations
+// as returned by time.Duration.String.
+package attrs
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// ErrMissing is matched by the errors returned by the getters when the
+// attribute is not set.
+var ErrMissing = errors.New("missing attribute")
+
+// SetInt sets the attribute `key` of `a` to `v`.
+func SetInt(a msg.Attributes, key string, v int64) {
+	a.Set(key, strconv.FormatInt(v, 10))
+}
+
+// GetInt returns the integer value of the attribute `key` of `a`.
+func GetInt(a msg.Attributes, key string) (int64, error) {
+	s, err := get(a, key)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, parseError(key, err)
+	}
+
+	return v, nil
+}
+
+// SetFloat sets the attribute `key` of `a` to `v`.
+func SetFloat(a msg.Attributes, key string, v float64) {
+	a.Set(key, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// GetFloat returns the floating-point value of the attribute `key` of `a`.
+func GetFloat(a msg.Attributes, key string) (float64, error) {
+	s, err := get(a, key)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, parseError(key, err)
+	}
+
+	return v, nil
+}
+
+// SetBool sets the attribute `key` of `a` to `v`.
+func SetBool(a msg.Attributes, key string, v bool) {
+	a.Set(key, strconv.FormatBool(v))
+}
+
+// GetBool returns the boolean value of the attribute `key` of `a`.
+func GetBool(a msg.Attributes, key string) (bool, error) {
+	s, err := get(a, key)
+	if err != nil {
+		return false, err
+	}
+
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, parseError(key, err)
+	}
+
+	return v, nil
+}
+
+// SetTime sets the attribute `key` of `a` to `v`.
+func SetTime(a msg.Attributes, key string, v time.Time) {
+	a.Set(key, v.UTC().Format(time.RFC3339Nano))
+}
+
+// GetTime returns the time value of the attribute `key` of `a`, in UTC.
+func GetTime(a msg.Attributes, key string) (time.Time, error) {
+	s, err := get(a, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	v, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, parseError(key, err)
+	}
+
+	return v.UTC(), nil
+}
+
+// SetDuration sets the attribute `key` of `a` to `v`.
+func SetDuration(a msg.Attributes, key string, v time.Duration) {
+	a.Set(key, v.String())
+}
+
+// GetDuration returns the duration value of the attribute `key` of `a`.
+func GetDuration(a msg.Attributes, key string) (time.Duration, error) {
+	s, err := get(a, key)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, parseError(key, err)
+	}
+
+	return v, nil
+}
+
+// get returns the value of the attribute `key` of `a`, or an error
+// matching ErrMissing if it is not set.
+func get(a msg.Attributes, key string) (string, error) {
+	if len(a[textproto.CanonicalMIMEHeaderKey(key)]) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrMissing, key)
+	}
+
+	return a.Get(key), nil
+}
+
+// parseError returns the error of the parsing of the attribute `key`.
+func parseError(key string, err error) error {
+	return fmt.Errorf("cannot parse attribute %s: %w", key, err)
+}
@@ -0,0 +1,55 @@
+package attrs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+func TestRoundTrip(t *testing.T) {
+	a := msg.Attributes{}
+	created := time.Date(2021, 1, 2, 3, 4, 5, 6, time.FixedZone("EST", -5*3600))
+
+	SetInt(a, "schema-version", -2)
+	SetFloat(a, "Price", 12.5)
+	SetBool(a, "Replay", true)
+	SetTime(a, "Created-At", created)
+	SetDuration(a, "Timeout", 90*time.Second)
+
+	if v, err := GetInt(a, "Schema-Version"); err != nil || v != -2 {
+		t.Errorf("Expected -2, got %d (%v)", v, err)
+	}
+	if v, err := GetFloat(a, "Price"); err != nil || v != 12.5 {
+		t.Errorf("Expected 12.5, got %v (%v)", v, err)
+	}
+	if v, err := GetBool(a, "Replay"); err != nil || !v {
+		t.Errorf("Expected true, got %v (%v)", v, err)
+	}
+	if v, err := GetTime(a, "Created-At"); err != nil || !v.Equal(created) || v.Location() != time.UTC {
+		t.Errorf("Expected %s in UTC, got %s (%v)", created, v, err)
+	}
+	if v, err := GetDuration(a, "Timeout"); err != nil || v != 90*time.Second {
+		t.Errorf("Expected 1m30s, got %s (%v)", v, err)
+	}
+
+	if s := a.Get("Created-At"); s != "2021-01-02T08:04:05.000000006Z" {
+		t.Errorf("Unexpected encoding of time: %q", s)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	a := msg.Attributes{}
+	a.Set("Count", "many")
+
+	if _, err := GetInt(a, "Missing"); !errors.Is(err, ErrMissing) {
+		t.Errorf("Expected ErrMissing, got %v", err)
+	}
+	if _, err := GetInt(a, "Count"); err == nil || errors.Is(err, ErrMissing) {
+		t.Errorf("Expected a parse error, got %v", err)
+	}
+	if _, err := GetTime(a, "Count"); err == nil {
+		t.Errorf("Expected a parse error, got nil")
+	}
+}
@@ -0,0 +1,314 @@
+// Package awstest runs integration tests against LocalStack or ElasticMQ,
+// creating ephemeral queues and topics which are deleted once the test
+// completes:
+//
+//	func TestOrders(t *testing.T) {
+//		env := awstest.Start(t)
+//		defer env.Close()
+//
+//		queueURL := env.Queue(nil)
+//		topic, err := sqs.NewTopic(queueURL, sqs.WithTopicSession(env.Session))
+//		// ...
+//	}
+//
+// Start connects to the endpoint in the AWSTEST_ENDPOINT environment
+// variable, e.g. "http://localhost:4566" in CI pipelines running LocalStack
+// as a service. Otherwise, it starts a LocalStack container with Docker,
+// which is stopped by Close. Tests are skipped when there is neither an
+// endpoint nor Docker.
+package awstest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+const (
+	// EndpointEnv is the environment variable holding the endpoint of a
+	// running LocalStack or ElasticMQ.
+	EndpointEnv = "AWSTEST_ENDPOINT"
+
+	// LocalStackImage is the Docker image started by default, and the port
+	// of its endpoint.
+	LocalStackImage = "localstack/localstack"
+	LocalStackPort  = 4566
+
+	// ElasticMQImage is the Docker image of ElasticMQ, which only emulates
+	// SQS, and the port of its endpoint.
+	ElasticMQImage = "softwaremill/elasticmq-native"
+	ElasticMQPort  = 9324
+
+	// Region is the region of the session of an Env.
+	Region = "us-east-1"
+
+	// readyTimeout is how long Start waits for the endpoint to be ready.
+	readyTimeout = 2 * time.Minute
+)
+
+// Env is a LocalStack or ElasticMQ environment.
+type Env struct {
+	// Endpoint is the URL of the environment.
+	Endpoint string
+	// Session is configured to send requests to Endpoint.
+	Session *session.Session
+	// SQS and SNS are clients created from Session.
+	SQS sqsiface.SQSAPI
+	SNS snsiface.SNSAPI
+
+	image     string // Docker image started when there is no endpoint
+	port      int    // port of the endpoint of image
+	container string // ID of the container started by Start, if any
+
+	t      testing.TB
+	mux    sync.Mutex
+	queues []string // URLs of the queues created by Queue
+	topics []string // ARNs of the topics created by Topic
+}
+
+// Option is the signature that modifies an `Env` to set some configuration
+type Option func(*Env) error
+
+// WithEndpoint makes Start connect to `url` instead of the endpoint in
+// AWSTEST_ENDPOINT.
+func WithEndpoint(url string) Option {
+	return func(e *Env) error {
+		if url == "" {
+			return errors.New("endpoint must not be empty")
+		}
+
+		e.Endpoint = url
+
+		return nil
+	}
+}
+
+// WithImage makes Start run `image`, exposing its endpoint on `port`,
+// instead of LocalStack when there is no endpoint, e.g.
+// WithImage(ElasticMQImage, ElasticMQPort) or a pinned LocalStack version.
+func WithImage(image string, port int) Option {
+	return func(e *Env) error {
+		if image == "" || port <= 0 {
+			return errors.New("image and port must be set")
+		}
+
+		e.image = image
+		e.port = port
+
+		return nil
+	}
+}
+
+// Start returns an Env connected to the endpoint in AWSTEST_ENDPOINT, or
+// running in a container started with Docker. It skips the test when there
+// is neither, and fails it when the environment cannot be started.
+//
+// The Env must be closed once the test completes.
+func Start(t testing.TB, opts ...Option) *Env {
+	t.Helper()
+
+	e := &Env{
+		Endpoint: os.Getenv(EndpointEnv),
+		image:    LocalStackImage,
+		port:     LocalStackPort,
+		t:        t,
+	}
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			t.Fatalf("awstest: cannot set option: %s", err)
+		}
+	}
+
+	if e.Endpoint == "" {
+		if _, err := exec.LookPath("docker"); err != nil {
+			t.Skipf("awstest: %s is not set and docker is not available", EndpointEnv)
+		}
+		if err := e.startContainer(); err != nil {
+			t.Fatalf("awstest: cannot start %s: %s", e.image, err)
+		}
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(e.Endpoint),
+		Region:      aws.String(Region),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+	})
+	if err != nil {
+		e.Close()
+		t.Fatalf("awstest: cannot create session: %s", err)
+	}
+	e.Session = sess
+	e.SQS = sqs.New(sess)
+	e.SNS = sns.New(sess)
+
+	if err := e.waitReady(); err != nil {
+		e.Close()
+		t.Fatalf("awstest: %s is not ready: %s", e.Endpoint, err)
+	}
+
+	return e
+}
+
+// startContainer runs the image of the Env, and sets its Endpoint.
+func (e *Env) startContainer() error {
+	out, err := docker("run", "-d", "--rm", "-p", fmt.Sprintf("127.0.0.1::%d", e.port), e.image)
+	if err != nil {
+		return err
+	}
+	e.container = strings.TrimSpace(out)
+
+	out, err = docker("port", e.container, fmt.Sprintf("%d/tcp", e.port))
+	if err != nil {
+		return err
+	}
+	addr, err := parsePort(out)
+	if err != nil {
+		return err
+	}
+	e.Endpoint = "http://" + addr
+
+	return nil
+}
+
+// waitReady waits for the SQS endpoint of the Env to answer requests.
+func (e *Env) waitReady() error {
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		_, err := e.SQS.ListQueues(&sqs.ListQueuesInput{})
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Queue creates a queue with a unique name and `attributes`, and returns
+// its URL. The name of the queue ends with ".fifo" if the FifoQueue
+// attribute is "true". The queue is deleted by Close.
+func (e *Env) Queue(attributes map[string]string) string {
+	e.t.Helper()
+
+	name := uniqueName()
+	if attributes[sqs.QueueAttributeNameFifoQueue] == "true" {
+		name += ".fifo"
+	}
+
+	out, err := e.SQS.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: aws.StringMap(attributes),
+	})
+	if err != nil {
+		e.t.Fatalf("awstest: cannot create queue %s: %s", name, err)
+	}
+
+	e.mux.Lock()
+	e.queues = append(e.queues, aws.StringValue(out.QueueUrl))
+	e.mux.Unlock()
+
+	return aws.StringValue(out.QueueUrl)
+}
+
+// Topic creates an SNS topic with a unique name and `attributes`, and
+// returns its ARN. The topic is deleted by Close.
+func (e *Env) Topic(attributes map[string]string) string {
+	e.t.Helper()
+
+	name := uniqueName()
+	if attributes["FifoTopic"] == "true" {
+		name += ".fifo"
+	}
+
+	out, err := e.SNS.CreateTopic(&sns.CreateTopicInput{
+		Name:       aws.String(name),
+		Attributes: aws.StringMap(attributes),
+	})
+	if err != nil {
+		e.t.Fatalf("awstest: cannot create topic %s: %s", name, err)
+	}
+
+	e.mux.Lock()
+	e.topics = append(e.topics, aws.StringValue(out.TopicArn))
+	e.mux.Unlock()
+
+	return aws.StringValue(out.TopicArn)
+}
+
+// Close deletes the queues and topics of the Env, and stops the container
+// started by Start, if any. Failures are logged, as the resources die with
+// the environment anyway.
+func (e *Env) Close() {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	for _, url := range e.queues {
+		if _, err := e.SQS.DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: aws.String(url)}); err != nil {
+			e.t.Logf("awstest: cannot delete queue %s: %s", url, err)
+		}
+	}
+	for _, arn := range e.topics {
+		if _, err := e.SNS.DeleteTopic(&sns.DeleteTopicInput{TopicArn: aws.String(arn)}); err != nil {
+			e.t.Logf("awstest: cannot delete topic %s: %s", arn, err)
+		}
+	}
+	e.queues, e.topics = nil, nil
+
+	if e.container != "" {
+		if _, err := docker("stop", e.container); err != nil {
+			e.t.Logf("awstest: cannot stop container %s: %s", e.container, err)
+		}
+		e.container = ""
+	}
+}
+
+// docker runs the docker command with `args`, returning its output.
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// parsePort returns the first IPv4 address of the output of docker port,
+// e.g. "127.0.0.1:49153".
+func parsePort(out string) (string, error) {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "[") {
+			return line, nil
+		}
+	}
+
+	return "", fmt.Errorf("unexpected docker port output %q", out)
+}
+
+// uniqueName returns a unique name for a queue or topic.
+func uniqueName() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return "awstest-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,69 @@
+package awstest
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+func TestParsePort(t *testing.T) {
+	outputs := map[string]string{
+		"127.0.0.1:49153\n":           "127.0.0.1:49153",
+		"[::]:49153\n0.0.0.0:49153\n": "0.0.0.0:49153",
+		"0.0.0.0:49153\n[::]:49153\n": "0.0.0.0:49153",
+	}
+	for out, addr := range outputs {
+		if got, err := parsePort(out); err != nil || got != addr {
+			t.Errorf("Expected %q for %q, got %q, %v", addr, out, got, err)
+		}
+	}
+
+	if _, err := parsePort("\n"); err == nil {
+		t.Errorf("Expected an error for an empty output")
+	}
+}
+
+// Tests that a message sent to a queue of the environment is received.
+// It is skipped without LocalStack or Docker.
+func TestEnv(t *testing.T) {
+	env := Start(t)
+	defer env.Close()
+
+	queueURL := env.Queue(nil)
+	topic, err := sqs.NewTopic(queueURL, sqs.WithTopicSession(env.Session))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	srv, err := sqs.NewServer(queueURL, 1, 30, sqs.WithSession(env.Session), sqs.WithLogger(logger.Nop))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	received := make(chan string, 1)
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b, _ := ioutil.ReadAll(m.Body)
+		received <- string(b)
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case body := <-received:
+		if body != "hello" {
+			t.Errorf("Expected hello, got %q", body)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Timed out waiting for the message")
+	}
+}
@@ -0,0 +1,319 @@
+// Package circuitbreaker stops sending messages to a Topic while it is
+// failing, e.g. during an SQS outage, so that producers fail fast instead of
+// piling up requests waiting on SendMessage calls and their retries.
+//
+// A Breaker opens after a number of consecutive failures of the Close
+// method of the MessageWriters of the Topics it wraps. While it is open,
+// Close returns an *OpenError without sending the message. Once the open
+// timeout elapsed, it lets a few probe messages through: it closes again if
+// they are sent, and reopens if one of them fails.
+//
+//	topic, _ := sqs.NewTopic(queueURL)
+//	topic = circuitbreaker.Topic(topic, circuitbreaker.WithFailureThreshold(10))
+//
+//	if err := w.Close(); errors.Is(err, circuitbreaker.ErrOpen) {
+//		// The message was not sent, e.g. store it to send it later.
+//	}
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/clock"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// ErrOpen is matched by the *OpenError returned by MessageWriter.Close while
+// the Breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// OpenError is returned by MessageWriter.Close, without sending the message,
+// while the Breaker is open. It matches ErrOpen with errors.Is.
+type OpenError struct {
+	// RetryAt is when the Breaker lets probe messages through.
+	RetryAt time.Time
+	// Err is the failure which opened the Breaker.
+	Err error
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s until %s: %s", ErrOpen, e.RetryAt.Format(time.RFC3339), e.Err)
+}
+
+// Is reports whether target is ErrOpen.
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// Unwrap returns the failure which opened the Breaker.
+func (e *OpenError) Unwrap() error {
+	return e.Err
+}
+
+// State is the state of a Breaker.
+type State int
+
+const (
+	// Closed is the state of a Breaker sending every message.
+	Closed State = iota
+	// Open is the state of a Breaker failing every message.
+	Open
+	// HalfOpen is the state of a Breaker sending probe messages.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Option configures a Breaker.
+type Option func(*Breaker)
+
+// WithFailureThreshold makes the Breaker open after `n` consecutive
+// failures, instead of 5.
+func WithFailureThreshold(n int) Option {
+	return func(b *Breaker) {
+		b.threshold = n
+	}
+}
+
+// WithOpenTimeout makes the Breaker stay open for `d` before sending probe
+// messages, instead of 30 seconds.
+func WithOpenTimeout(d time.Duration) Option {
+	return func(b *Breaker) {
+		b.openTimeout = d
+	}
+}
+
+// WithProbes makes the half-open Breaker send up to `n` probe messages at a
+// time, and close once `n` of them were sent, instead of 1. Other messages
+// fail with an *OpenError meanwhile.
+func WithProbes(n int) Option {
+	return func(b *Breaker) {
+		b.probes = n
+	}
+}
+
+// WithIsFailure sets the function reporting whether an error returned by
+// MessageWriter.Close counts as a failure of the Topic, instead of every
+// error but context cancellations and msg.ErrClosedMessageWriter, e.g.
+// sqs.IsRetryablePublishError to ignore errors caused by the message.
+func WithIsFailure(f func(err error) bool) Option {
+	return func(b *Breaker) {
+		b.isFailure = f
+	}
+}
+
+// WithClock sets the Clock the Breaker tells the time with, instead of
+// clock.Real, e.g. a clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(b *Breaker) {
+		b.clock = c
+	}
+}
+
+// WithLogger sets the Logger the Breaker logs its state changes to, instead
+// of logger.Default.
+func WithLogger(l logger.Logger) Option {
+	return func(b *Breaker) {
+		b.logger = l
+	}
+}
+
+// Breaker tracks the failures of the Topics it wraps, see the package
+// documentation. It is safe for concurrent use.
+type Breaker struct {
+	threshold   int
+	openTimeout time.Duration
+	probes      int
+	isFailure   func(error) bool
+	clock       clock.Clock
+	logger      logger.Logger
+
+	mux      sync.Mutex
+	state    State
+	failures int       // consecutive failures while Closed
+	lastErr  error     // the failure which opened the Breaker
+	retryAt  time.Time // when the Open Breaker becomes HalfOpen
+	inFlight int       // probe messages being sent while HalfOpen
+	probed   int       // probe messages sent while HalfOpen
+}
+
+// New returns a closed Breaker.
+func New(opts ...Option) *Breaker {
+	b := &Breaker{
+		threshold:   5,
+		openTimeout: 30 * time.Second,
+		probes:      1,
+		isFailure:   isFailure,
+		clock:       clock.Real,
+		logger:      logger.Default,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Topic wraps `next` with a new Breaker configured by `opts`.
+func Topic(next msg.Topic, opts ...Option) msg.Topic {
+	return New(opts...).Topic(next)
+}
+
+// Topic wraps `next` so that the Breaker tracks the failures of its
+// MessageWriters, and fails them fast while it is open. Topics wrapped by
+// the same Breaker open and close together.
+func (b *Breaker) Topic(next msg.Topic) msg.Topic {
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &breakerWriter{
+			MessageWriter: next.NewWriter(ctx),
+			breaker:       b,
+		}
+	})
+}
+
+// State returns the current state of the Breaker, e.g. for a health check.
+func (b *Breaker) State() State {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.refresh()
+
+	return b.state
+}
+
+// isFailure is the default function reporting whether err is a failure.
+func isFailure(err error) bool {
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, msg.ErrClosedMessageWriter)
+}
+
+// refresh moves the Breaker from Open to HalfOpen once the open timeout
+// elapsed. It must be called with b.mux held.
+func (b *Breaker) refresh() {
+	if b.state == Open && !b.clock.Now().Before(b.retryAt) {
+		b.setState(HalfOpen)
+		b.inFlight, b.probed = 0, 0
+	}
+}
+
+// setState moves the Breaker to `s`. It must be called with b.mux held.
+func (b *Breaker) setState(s State) {
+	b.logger.Logf(logger.Info, "circuit breaker %s, was %s", s, b.state)
+	b.state = s
+}
+
+// allow reports whether a message may be sent, and whether it is a probe.
+// It returns an *OpenError when it may not.
+func (b *Breaker) allow() (probe bool, err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.refresh()
+
+	switch b.state {
+	case Closed:
+		return false, nil
+	case HalfOpen:
+		if b.inFlight+b.probed < b.probes {
+			b.inFlight++
+			return true, nil
+		}
+	}
+
+	return false, &OpenError{RetryAt: b.retryAt, Err: b.lastErr}
+}
+
+// done records the result `err` of the sending of a message.
+func (b *Breaker) done(probe bool, err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	failed := err != nil && b.isFailure(err)
+
+	if probe {
+		b.inFlight--
+		if b.state != HalfOpen {
+			return
+		}
+		switch {
+		case failed:
+			b.open(err)
+		case err == nil:
+			b.probed++
+			if b.probed >= b.probes {
+				b.failures = 0
+				b.setState(Closed)
+			}
+		}
+		return
+	}
+
+	if b.state != Closed {
+		return
+	}
+	if !failed {
+		if err == nil {
+			b.failures = 0
+		}
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.open(err)
+	}
+}
+
+// open opens the Breaker after the failure `err`. It must be called with
+// b.mux held.
+func (b *Breaker) open(err error) {
+	b.lastErr = err
+	b.retryAt = b.clock.Now().Add(b.openTimeout)
+	b.setState(Open)
+}
+
+// breakerWriter is the msg.MessageWriter of a Topic wrapped by a Breaker.
+type breakerWriter struct {
+	msg.MessageWriter
+
+	breaker *Breaker
+}
+
+// Close closes the wrapped MessageWriter, sending the message, unless the
+// Breaker is open, in which case it returns an *OpenError.
+func (w *breakerWriter) Close() error {
+	probe, err := w.breaker.allow()
+	if err != nil {
+		return err
+	}
+
+	err = w.MessageWriter.Close()
+	w.breaker.done(probe, err)
+
+	return err
+}
+
+// SetDelay sets a delay on the message if the wrapped MessageWriter
+// supports it, e.g. an sqs.MessageWriter.
+func (w *breakerWriter) SetDelay(delay time.Duration) {
+	if d, ok := w.MessageWriter.(interface{ SetDelay(time.Duration) }); ok {
+		d.SetDelay(delay)
+	}
+}
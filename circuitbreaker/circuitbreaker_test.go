@@ -0,0 +1,143 @@
+package circuitbreaker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/clock"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// failingWriter returns the error of its topic from Close.
+type failingWriter struct {
+	bytes.Buffer
+
+	topic *failingTopic
+}
+
+func (w *failingWriter) Attributes() *msg.Attributes {
+	return &msg.Attributes{}
+}
+
+func (w *failingWriter) Close() error {
+	w.topic.calls++
+	return w.topic.err
+}
+
+// failingTopic is a Topic whose writers fail with err.
+type failingTopic struct {
+	err   error
+	calls int
+}
+
+func (t *failingTopic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &failingWriter{topic: t}
+}
+
+func send(topic msg.Topic) error {
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("hello"))
+	return w.Close()
+}
+
+func TestBreaker(t *testing.T) {
+	outage := errors.New("service unavailable")
+	next := &failingTopic{err: outage}
+	c := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := New(WithFailureThreshold(3), WithOpenTimeout(time.Minute), WithClock(c), WithLogger(logger.Nop))
+	topic := b.Topic(next)
+
+	// The Breaker opens after 3 consecutive failures.
+	for i := 0; i < 3; i++ {
+		if err := send(topic); err != outage {
+			t.Fatalf("Expected error %v, got %v", outage, err)
+		}
+	}
+	if s := b.State(); s != Open {
+		t.Fatalf("Expected the breaker to be %s, got %s", Open, s)
+	}
+
+	// Messages fail fast while it is open.
+	err := send(topic)
+	var openErr *OpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, ErrOpen) || !errors.Is(err, outage) {
+		t.Fatalf("Expected an *OpenError wrapping %v, got %v", outage, err)
+	}
+	if want := c.Now().Add(time.Minute); !openErr.RetryAt.Equal(want) {
+		t.Errorf("Expected RetryAt %s, got %s", want, openErr.RetryAt)
+	}
+	if next.calls != 3 {
+		t.Errorf("Expected 3 calls to the topic, got %d", next.calls)
+	}
+
+	// A failed probe reopens it.
+	c.Advance(time.Minute)
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("Expected the breaker to be %s, got %s", HalfOpen, s)
+	}
+	if err := send(topic); err != outage {
+		t.Fatalf("Expected error %v, got %v", outage, err)
+	}
+	if s := b.State(); s != Open {
+		t.Fatalf("Expected the breaker to be %s, got %s", Open, s)
+	}
+
+	// A successful probe closes it.
+	c.Advance(time.Minute)
+	next.err = nil
+	if err := send(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if s := b.State(); s != Closed {
+		t.Fatalf("Expected the breaker to be %s, got %s", Closed, s)
+	}
+}
+
+// Tests that only the configured number of probes are sent at a time while
+// the Breaker is half-open.
+func TestBreaker_Probes(t *testing.T) {
+	c := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := New(WithFailureThreshold(1), WithProbes(2), WithClock(c), WithLogger(logger.Nop))
+
+	b.done(false, errors.New("boom"))
+	c.Advance(30 * time.Second)
+
+	for i := 0; i < 2; i++ {
+		if probe, err := b.allow(); !probe || err != nil {
+			t.Fatalf("Expected probe %d to be allowed, got %v", i, err)
+		}
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Expected a third probe to fail with %v, got %v", ErrOpen, err)
+	}
+
+	b.done(true, nil)
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("Expected the breaker to be %s, got %s", HalfOpen, s)
+	}
+	b.done(true, nil)
+	if s := b.State(); s != Closed {
+		t.Fatalf("Expected the breaker to be %s, got %s", Closed, s)
+	}
+}
+
+// Tests that errors which are not failures neither open the Breaker nor
+// reset its count of consecutive failures.
+func TestBreaker_IsFailure(t *testing.T) {
+	b := New(WithFailureThreshold(2), WithLogger(logger.Nop))
+
+	b.done(false, errors.New("boom"))
+	b.done(false, context.Canceled)
+	if s := b.State(); s != Closed {
+		t.Fatalf("Expected the breaker to be %s, got %s", Closed, s)
+	}
+
+	b.done(false, errors.New("boom"))
+	if s := b.State(); s != Open {
+		t.Fatalf("Expected the breaker to be %s, got %s", Open, s)
+	}
+}
@@ -0,0 +1,155 @@
+// Package clock abstracts the passing of time, so that the delays of
+// retries, backoffs and shutdowns can be tested deterministically by
+// advancing a Fake clock instead of sleeping.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits for durations to elapse.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a Timer sending the time on its channel once `d`
+	// elapsed.
+	NewTimer(d time.Duration) Timer
+	// Sleep blocks until `d` elapsed.
+	Sleep(d time.Duration)
+}
+
+// Timer is a single event, as a time.Timer.
+type Timer interface {
+	// C returns the channel the time is sent on once the Timer fires.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing, returning false if it already
+	// fired or was stopped.
+	Stop() bool
+}
+
+// Real is the Clock of the time package.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+
+func (t realTimer) Stop() bool { return t.t.Stop() }
+
+// Fake is a Clock whose time only passes when it is advanced. Its zero value
+// is a Fake at the zero time.
+type Fake struct {
+	mux     sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer  // pending timers
+	changed chan struct{} // closed, then replaced, when timers are added
+}
+
+// NewFake returns a Fake at `now`.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time of the Fake.
+func (f *Fake) Now() time.Time {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return f.now
+}
+
+// NewTimer returns a Timer firing once the Fake was advanced by `d`.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	t := &fakeTimer{fake: f, at: f.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- f.now
+		return t
+	}
+
+	f.timers = append(f.timers, t)
+	if f.changed != nil {
+		close(f.changed)
+		f.changed = nil
+	}
+
+	return t
+}
+
+// Sleep blocks until the Fake was advanced by `d`.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.NewTimer(d).C()
+}
+
+// Advance advances the time of the Fake by `d`, firing the timers due.
+func (f *Fake) Advance(d time.Duration) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.now = f.now.Add(d)
+
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		if t.at.After(f.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- f.now
+	}
+	f.timers = pending
+}
+
+// WaitForTimers blocks until at least `n` timers are pending, e.g. until
+// the goroutine under test sleeps, so that advancing the Fake fires them.
+func (f *Fake) WaitForTimers(n int) {
+	for {
+		f.mux.Lock()
+		if len(f.timers) >= n {
+			f.mux.Unlock()
+			return
+		}
+		if f.changed == nil {
+			f.changed = make(chan struct{})
+		}
+		changed := f.changed
+		f.mux.Unlock()
+
+		<-changed
+	}
+}
+
+// fakeTimer is a Timer of a Fake.
+type fakeTimer struct {
+	fake *Fake
+	at   time.Time
+	c    chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.fake.mux.Lock()
+	defer t.fake.mux.Unlock()
+
+	for i, other := range t.fake.timers {
+		if other == t {
+			t.fake.timers = append(t.fake.timers[:i], t.fake.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
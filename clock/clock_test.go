@@ -0,0 +1,47 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that the timers of a Fake fire once it was advanced past them.
+func TestFake(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	slept := make(chan struct{})
+	go func() {
+		f.Sleep(time.Minute)
+		close(slept)
+	}()
+
+	stopped := f.NewTimer(30 * time.Second)
+	f.WaitForTimers(2)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Errorf("Expected the timer to be stopped once")
+	}
+
+	f.Advance(59 * time.Second)
+	select {
+	case <-slept:
+		t.Fatalf("Expected Sleep to block until a minute elapsed")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	f.Advance(time.Second)
+	select {
+	case <-slept:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Sleep to return once a minute elapsed")
+	}
+
+	select {
+	case <-stopped.C():
+		t.Errorf("Expected the stopped timer not to fire")
+	default:
+	}
+	if !f.Now().Equal(start.Add(time.Minute)) {
+		t.Errorf("Unexpected time %s", f.Now())
+	}
+}
@@ -0,0 +1,118 @@
+// Package cloudevents wraps messages in CloudEvents 1.0 envelopes, so that
+// they can be exchanged with EventBridge and other CloudEvents tooling.
+//
+// Topic wraps a Topic so that each message is sent as an event, either in
+// structured mode, as a JSON envelope holding the attributes and data of the
+// event, or in binary mode, as the data of the event with its attributes
+// carried by message attributes. Receiver wraps a Receiver so that the
+// attributes of the events are available as message attributes in both
+// modes, and the body is the data of the event:
+//
+//	topic = cloudevents.Topic(topic, "/orders", cloudevents.WithType("com.example.order.created"))
+//
+//	srv.Serve(ctx, cloudevents.Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+//		id := m.Attributes.Get(cloudevents.IDAttribute)
+//		// ...
+//	})))
+package cloudevents
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SpecVersion is the version of the CloudEvents specification
+	// implemented by this package.
+	SpecVersion = "1.0"
+
+	// StructuredContentType is the Content-Type attribute of messages
+	// holding a structured event.
+	StructuredContentType = "application/cloudevents+json"
+
+	// AttributePrefix prefixes the message attributes holding the
+	// attributes of an event, including its extension attributes.
+	AttributePrefix = "ce-"
+
+	// The message attributes holding the standard attributes of an event.
+	SpecVersionAttribute = AttributePrefix + "specversion"
+	IDAttribute          = AttributePrefix + "id"
+	SourceAttribute      = AttributePrefix + "source"
+	TypeAttribute        = AttributePrefix + "type"
+	TimeAttribute        = AttributePrefix + "time"
+	SubjectAttribute     = AttributePrefix + "subject"
+
+	// contentTypeAttribute is the message attribute holding the media type
+	// of the body, the datacontenttype of an event.
+	contentTypeAttribute = "Content-Type"
+)
+
+// ErrMissingType is returned by MessageWriter.Close when a message has no
+// TypeAttribute and the Topic has no default type.
+var ErrMissingType = errors.New("cloudevents: missing event type")
+
+// Option configures a Topic.
+type Option func(*config)
+
+type config struct {
+	eventType string
+	binary    bool
+}
+
+// WithType sets the type of the events whose TypeAttribute is not set,
+// e.g. "com.example.order.created".
+func WithType(eventType string) Option {
+	return func(c *config) {
+		c.eventType = eventType
+	}
+}
+
+// WithBinaryMode makes the Topic send events in binary mode, the attributes
+// of the events being sent as message attributes and the body as is,
+// instead of in a JSON envelope.
+func WithBinaryMode() Option {
+	return func(c *config) {
+		c.binary = true
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// isEventAttribute reports whether the message attribute `name` holds an
+// attribute of an event, returning the name of the event attribute.
+// Message attributes may have been canonicalized, e.g. to "Ce-Id".
+func isEventAttribute(name string) (string, bool) {
+	if len(name) <= len(AttributePrefix) || !strings.EqualFold(name[:len(AttributePrefix)], AttributePrefix) {
+		return "", false
+	}
+
+	return strings.ToLower(name[len(AttributePrefix):]), true
+}
+
+// isJSON reports whether the media type `contentType` is JSON.
+func isJSON(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// newID returns a random UUID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
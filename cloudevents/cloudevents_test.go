@@ -0,0 +1,172 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// recordingWriter is a msg.MessageWriter recording the message
+// it was closed with.
+type recordingWriter struct {
+	bytes.Buffer
+
+	attributes msg.Attributes
+	closed     *msg.Message
+}
+
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed = &msg.Message{Attributes: w.attributes, Body: &w.Buffer}
+	return nil
+}
+
+// send writes `body` with the Content-Type `contentType` to a Topic created
+// with `opts`, returning the message it sent.
+func send(t *testing.T, body []byte, contentType string, opts ...Option) *msg.Message {
+	rw := &recordingWriter{attributes: msg.Attributes{}}
+	topic := Topic(msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return rw
+	}), "/orders", opts...)
+
+	w := topic.NewWriter(context.Background())
+	if contentType != "" {
+		w.Attributes().Set(contentTypeAttribute, contentType)
+	}
+	w.Attributes().Set(AttributePrefix+"tenant", "acme")
+	w.Write(body)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	return rw.closed
+}
+
+// receive returns the message received by a Receiver for `m`.
+func receive(t *testing.T, m *msg.Message) (*msg.Message, []byte) {
+	var received *msg.Message
+	var body []byte
+	r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received = m
+		body, _ = ioutil.ReadAll(m.Body)
+		return nil
+	}))
+	if err := r.Receive(context.Background(), m); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	return received, body
+}
+
+// Tests that structured events are received with their attributes and
+// data, whatever their content.
+func TestTopicAndReceiver_Structured(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		dataField   string
+	}{
+		{"json", []byte(`{"id":42}`), "application/json", "data"},
+		{"text", []byte("hello"), "text/plain", "data"},
+		{"binary", []byte{0xff, 0x00, 0xfe}, "", "data_base64"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := send(t, tc.body, tc.contentType, WithType("com.example.order.created"))
+
+			if ct := m.Attributes.Get(contentTypeAttribute); ct != StructuredContentType {
+				t.Errorf("Expected Content-Type %s, got %s", StructuredContentType, ct)
+			}
+			if len(m.Attributes) != 1 {
+				t.Errorf("Expected the event attributes to be moved to the envelope, got %v", m.Attributes)
+			}
+
+			var event map[string]json.RawMessage
+			if err := json.Unmarshal(m.Body.(*bytes.Buffer).Bytes(), &event); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			for _, field := range []string{"specversion", "id", "source", "type", "time", "tenant", tc.dataField} {
+				if _, ok := event[field]; !ok {
+					t.Errorf("Expected the envelope to have a %s, got %v", field, event)
+				}
+			}
+
+			received, body := receive(t, m)
+			if !bytes.Equal(body, tc.body) {
+				t.Errorf("Expected body %q, got %q", tc.body, body)
+			}
+			if ct := received.Attributes.Get(contentTypeAttribute); ct != tc.contentType {
+				t.Errorf("Expected Content-Type %q, got %q", tc.contentType, ct)
+			}
+			if typ := received.Attributes.Get(TypeAttribute); typ != "com.example.order.created" {
+				t.Errorf("Expected the type to be set, got %q", typ)
+			}
+			if received.Attributes.Get(IDAttribute) == "" || received.Attributes.Get(TimeAttribute) == "" {
+				t.Errorf("Expected the id and time to be set, got %v", received.Attributes)
+			}
+			if src := received.Attributes.Get(SourceAttribute); src != "/orders" {
+				t.Errorf("Expected source /orders, got %q", src)
+			}
+			if tenant := received.Attributes.Get(AttributePrefix + "tenant"); tenant != "acme" {
+				t.Errorf("Expected the extension attribute to be set, got %q", tenant)
+			}
+		})
+	}
+}
+
+// Tests that binary events carry their attributes as message attributes,
+// and are received as is.
+func TestTopicAndReceiver_Binary(t *testing.T) {
+	m := send(t, []byte("hello"), "text/plain", WithType("com.example.order.created"), WithBinaryMode())
+
+	if m.Attributes.Get(SpecVersionAttribute) != SpecVersion || m.Attributes.Get(IDAttribute) == "" {
+		t.Errorf("Expected the event attributes to be set, got %v", m.Attributes)
+	}
+
+	received, body := receive(t, m)
+	if string(body) != "hello" {
+		t.Errorf("Expected body hello, got %q", body)
+	}
+	if typ := received.Attributes.Get(TypeAttribute); typ != "com.example.order.created" {
+		t.Errorf("Expected the type to be set, got %q", typ)
+	}
+}
+
+func TestTopic_MissingType(t *testing.T) {
+	topic := Topic(msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &recordingWriter{attributes: msg.Attributes{}}
+	}), "/orders")
+
+	if err := topic.NewWriter(context.Background()).Close(); !errors.Is(err, ErrMissingType) {
+		t.Errorf("Expected ErrMissingType, got %v", err)
+	}
+}
+
+// Tests that structured events without a Content-Type attribute are parsed,
+// and that other messages are received as is.
+func TestReceiver_WithoutContentType(t *testing.T) {
+	event := `{"specversion":"1.0","id":"1","source":"aws.events","type":"Scheduled Event","data":{"ok":true}}`
+	received, body := receive(t, &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(event)})
+	if string(body) != `{"ok":true}` {
+		t.Errorf("Expected the data of the event, got %s", body)
+	}
+	if src := received.Attributes.Get(SourceAttribute); src != "aws.events" {
+		t.Errorf("Expected source aws.events, got %q", src)
+	}
+
+	_, body = receive(t, &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(`{"id":1}`)})
+	if string(body) != `{"id":1}` {
+		t.Errorf("Expected the message to be received as is, got %s", body)
+	}
+}
@@ -0,0 +1,109 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Receiver wraps a msg.Receiver with the parsing of structured events,
+// whose attributes are set as message attributes, e.g. IDAttribute and
+// TypeAttribute, and whose data replaces the body of the message. The
+// datacontenttype of the event, if any, is set as its Content-Type
+// attribute. Events in binary mode and other messages are received as is.
+//
+// Messages without a Content-Type attribute whose body is a structured
+// event, as sent by tooling which does not set message attributes, are
+// parsed too.
+//
+// Messages which are not valid events are not received and the error is
+// returned.
+func Receiver(next msg.Receiver) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		contentType := m.Attributes.Get(contentTypeAttribute)
+		structured := strings.HasPrefix(strings.ToLower(contentType), StructuredContentType)
+		if !structured && contentType != "" {
+			return next.Receive(ctx, m)
+		}
+
+		body, err := ioutil.ReadAll(m.Body)
+		if err != nil {
+			return err
+		}
+		m.Body = bytes.NewReader(body)
+
+		var event map[string]json.RawMessage
+		if err := json.Unmarshal(body, &event); err != nil || event["specversion"] == nil {
+			if !structured {
+				return next.Receive(ctx, m)
+			}
+			return fmt.Errorf("cloudevents: invalid structured event: %v", err)
+		}
+
+		data, err := parseEnvelope(event, m.Attributes)
+		if err != nil {
+			return err
+		}
+		m.Body = bytes.NewReader(data)
+
+		return next.Receive(ctx, m)
+	})
+}
+
+// parseEnvelope sets the attributes of `event` in `attrs`, returning its data.
+func parseEnvelope(event map[string]json.RawMessage, attrs msg.Attributes) ([]byte, error) {
+	delete(attrs, contentTypeAttribute)
+	for k := range attrs {
+		if _, ok := isEventAttribute(k); ok {
+			delete(attrs, k)
+		}
+	}
+
+	var contentType string
+	for name, raw := range event {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			// extension attributes may be numbers or booleans
+			s = string(raw)
+		}
+
+		switch name {
+		case "data", "data_base64":
+		case "datacontenttype":
+			contentType = s
+			attrs.Set(contentTypeAttribute, s)
+		default:
+			attrs.Set(AttributePrefix+name, s)
+		}
+	}
+
+	if raw, ok := event["data_base64"]; ok {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("cloudevents: invalid data_base64: %w", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("cloudevents: invalid data_base64: %w", err)
+		}
+		return data, nil
+	}
+
+	raw, ok := event["data"]
+	if !ok {
+		return nil, nil
+	}
+
+	// data is a JSON value when the content is JSON, a string otherwise
+	var s string
+	if !(contentType == "" || isJSON(contentType)) && json.Unmarshal(raw, &s) == nil {
+		return []byte(s), nil
+	}
+	return raw, nil
+}
@@ -0,0 +1,140 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Topic wraps a topic with another which sends each Message as an event
+// from `source`, e.g. "/orders" or "urn:example:orders".
+//
+// The attributes of an event are taken from the message attributes with the
+// AttributePrefix, e.g. TypeAttribute, which must be set unless the Topic
+// has a default type. The ID, source, time and spec version of an event are
+// set unless the message already has the corresponding attributes. The
+// Content-Type attribute of the message, if any, is the datacontenttype of
+// the event.
+func Topic(next msg.Topic, source string, opts ...Option) msg.Topic {
+	c := newConfig(opts)
+
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &eventWriter{
+			Next:      next.NewWriter(ctx),
+			source:    source,
+			eventType: c.eventType,
+			binary:    c.binary,
+		}
+	})
+}
+
+type eventWriter struct {
+	Next msg.MessageWriter
+
+	source    string
+	eventType string
+	binary    bool
+
+	buf    bytes.Buffer
+	closed bool
+	mux    sync.Mutex
+}
+
+// Attributes returns the attributes associated with the MessageWriter.
+func (w *eventWriter) Attributes() *msg.Attributes {
+	return w.Next.Attributes()
+}
+
+// Close sets the attributes of the event, and writes it to the next
+// MessageWriter, in a JSON envelope unless the Topic is in binary mode.
+func (w *eventWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	attrs := w.Attributes()
+	if attrs.Get(TypeAttribute) == "" {
+		if w.eventType == "" {
+			return ErrMissingType
+		}
+		attrs.Set(TypeAttribute, w.eventType)
+	}
+	if attrs.Get(IDAttribute) == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		attrs.Set(IDAttribute, id)
+	}
+	if attrs.Get(SourceAttribute) == "" {
+		attrs.Set(SourceAttribute, w.source)
+	}
+	if attrs.Get(TimeAttribute) == "" {
+		attrs.Set(TimeAttribute, time.Now().UTC().Format(time.RFC3339Nano))
+	}
+	attrs.Set(SpecVersionAttribute, SpecVersion)
+
+	body := w.buf.Bytes()
+	if !w.binary {
+		var err error
+		if body, err = w.envelope(body); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Next.Write(body); err != nil {
+		return err
+	}
+	return w.Next.Close()
+}
+
+// envelope moves the attributes of the event from the message attributes to
+// a structured event holding `data`, which it returns.
+func (w *eventWriter) envelope(data []byte) ([]byte, error) {
+	attrs := w.Attributes()
+
+	event := map[string]interface{}{}
+	for k, v := range *attrs {
+		if name, ok := isEventAttribute(k); ok && len(v) > 0 {
+			event[name] = v[0]
+			delete(*attrs, k)
+		}
+	}
+
+	contentType := attrs.Get(contentTypeAttribute)
+	switch {
+	case isJSON(contentType) && json.Valid(data):
+		event["data"] = json.RawMessage(data)
+	case contentType != "" && utf8.Valid(data):
+		event["data"] = string(data)
+	case len(data) > 0:
+		event["data_base64"] = base64.StdEncoding.EncodeToString(data)
+	}
+	if contentType != "" {
+		event["datacontenttype"] = contentType
+	}
+	attrs.Set(contentTypeAttribute, StructuredContentType)
+
+	return json.Marshal(event)
+}
+
+// Write writes bytes to an internal buffer.
+func (w *eventWriter) Write(b []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(b)
+}
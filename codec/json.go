@@ -0,0 +1,104 @@
+// Package codec marshals Go values into message bodies and unmarshals them
+// back, so that publishers and receivers exchange typed values instead of
+// handling bytes:
+//
+//	err := codec.WriteJSON(topic.NewWriter(ctx), Order{ID: 42})
+//
+//	srv.Serve(ctx, codec.JSONReceiver(func(ctx context.Context, o *Order) error {
+//		// ...
+//	}))
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+const (
+	// ContentTypeAttribute is the message attribute holding the media type
+	// of the body of a message.
+	ContentTypeAttribute = "Content-Type"
+
+	// JSONContentType is the ContentTypeAttribute of JSON messages.
+	JSONContentType = "application/json"
+)
+
+// WriteJSON writes `v`, marshaled to JSON, to `w` with its Content-Type
+// attribute set to "application/json", then closes `w` to publish it.
+// Other attributes must be set on `w` before calling WriteJSON.
+func WriteJSON(w msg.MessageWriter, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Attributes().Set(ContentTypeAttribute, JSONContentType)
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// ReadJSON unmarshals the JSON body of `m` into `v`.
+func ReadJSON(m *msg.Message, v interface{}) error {
+	if err := json.NewDecoder(m.Body).Decode(v); err != nil {
+		return fmt.Errorf("cannot decode JSON message: %w", err)
+	}
+
+	return nil
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// JSONReceiver returns a msg.Receiver unmarshaling the JSON body of each
+// message into a new value, and calling `fn` with it. `fn` must be a func
+// with the signature
+//
+//	func(ctx context.Context, v *T) error
+//
+// for some type T, otherwise JSONReceiver panics. The Message is available
+// to `fn` with MessageFromContext, e.g. to read its attributes.
+//
+// Messages which cannot be unmarshaled are not passed to `fn`, and the error
+// of ReadJSON is returned.
+func JSONReceiver(fn interface{}) msg.Receiver {
+	f := reflect.ValueOf(fn)
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 ||
+		t.In(0) != contextType || t.In(1).Kind() != reflect.Ptr || t.Out(0) != errorType {
+		panic(fmt.Sprintf("codec: JSONReceiver requires a func(context.Context, *T) error, got %T", fn))
+	}
+	valueType := t.In(1).Elem()
+
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		v := reflect.New(valueType)
+		if err := ReadJSON(m, v.Interface()); err != nil {
+			return err
+		}
+
+		ctx = context.WithValue(ctx, messageKey{}, m)
+		out := f.Call([]reflect.Value{reflect.ValueOf(ctx), v})
+		if err, _ := out[0].Interface().(error); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+type messageKey struct{}
+
+// MessageFromContext returns the Message whose decoded body is being
+// received by a JSONReceiver, or nil.
+func MessageFromContext(ctx context.Context) *msg.Message {
+	m, _ := ctx.Value(messageKey{}).(*msg.Message)
+	return m
+}
@@ -0,0 +1,102 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+type order struct {
+	ID    int    `json:"id"`
+	Buyer string `json:"buyer"`
+}
+
+// recordingWriter is a msg.MessageWriter recording the message
+// it was closed with.
+type recordingWriter struct {
+	bytes.Buffer
+
+	attributes msg.Attributes
+	closed     *msg.Message
+}
+
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed = &msg.Message{Attributes: w.attributes, Body: &w.Buffer}
+	return nil
+}
+
+// Tests that a value written by WriteJSON is received by a JSONReceiver.
+func TestWriteJSONAndJSONReceiver(t *testing.T) {
+	w := &recordingWriter{attributes: msg.Attributes{}}
+	w.Attributes().Set("Tenant", "acme")
+	if err := WriteJSON(w, order{ID: 42, Buyer: "alice"}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if w.closed == nil {
+		t.Fatal("Expected the MessageWriter to be closed")
+	}
+	if ct := w.closed.Attributes.Get(ContentTypeAttribute); ct != JSONContentType {
+		t.Errorf("Expected Content-Type %s, got %s", JSONContentType, ct)
+	}
+
+	var received order
+	var tenant string
+	r := JSONReceiver(func(ctx context.Context, o *order) error {
+		received = *o
+		tenant = MessageFromContext(ctx).Attributes.Get("Tenant")
+		return nil
+	})
+	if err := r.Receive(context.Background(), w.closed); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if received != (order{ID: 42, Buyer: "alice"}) || tenant != "acme" {
+		t.Errorf("Unexpected order %+v from tenant %q", received, tenant)
+	}
+}
+
+// Tests that JSONReceiver returns the error of its func, and of ReadJSON
+// without calling its func.
+func TestJSONReceiver_Errors(t *testing.T) {
+	calls := 0
+	failure := errors.New("failed")
+	r := JSONReceiver(func(ctx context.Context, o *order) error {
+		calls++
+		return failure
+	})
+
+	m := &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(`{"id": 1}`)}
+	if err := r.Receive(context.Background(), m); err != failure {
+		t.Errorf("Expected the error of the func, got %v", err)
+	}
+
+	m = &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(`not json`)}
+	if err := r.Receive(context.Background(), m); err == nil || calls != 1 {
+		t.Errorf("Expected a decoding error without calling the func, got %v", err)
+	}
+}
+
+func TestJSONReceiver_PanicsOnInvalidFunc(t *testing.T) {
+	for _, fn := range []interface{}{
+		nil,
+		func(o *order) error { return nil },
+		func(ctx context.Context, o order) error { return nil },
+		func(ctx context.Context, o *order) {},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected JSONReceiver to panic for %T", fn)
+				}
+			}()
+			JSONReceiver(fn)
+		}()
+	}
+}
@@ -0,0 +1,105 @@
+package codec
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	msg "github.com/hdtradeservices/go-msg"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// ProtoContentType is the ContentTypeAttribute of protobuf messages.
+	ProtoContentType = "application/x-protobuf"
+
+	// MessageTypeAttribute is the message attribute holding the full name
+	// of the protobuf message type of the body, e.g. "orders.v1.Order".
+	MessageTypeAttribute = "Message-Type"
+)
+
+// WriteProto writes `v`, marshaled to the protobuf wire format and
+// base64-encoded so that SQS and SNS can carry it, to `w`, with its
+// Content-Type attribute set to "application/x-protobuf" and its
+// Message-Type attribute to the full name of the type of `v`. It then closes
+// `w` to publish it. Other attributes must be set on `w` before calling
+// WriteProto.
+//
+// Messages too large for SQS can be offloaded to S3 by the largepayload
+// package.
+func WriteProto(w msg.MessageWriter, v proto.Message) error {
+	body, err := proto.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Attributes().Set(ContentTypeAttribute, ProtoContentType)
+	w.Attributes().Set(MessageTypeAttribute, string(v.ProtoReflect().Descriptor().FullName()))
+
+	if _, err := w.Write([]byte(base64.StdEncoding.EncodeToString(body))); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// ReadProto unmarshals the body of `m`, written by WriteProto, into `v`.
+// It returns an error if the Message-Type attribute of `m` is set to
+// another type than the type of `v`.
+func ReadProto(m *msg.Message, v proto.Message) error {
+	name := string(v.ProtoReflect().Descriptor().FullName())
+	if typ := m.Attributes.Get(MessageTypeAttribute); typ != "" && typ != name {
+		return fmt.Errorf("cannot decode protobuf message: got a %s, expected a %s", typ, name)
+	}
+
+	body, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, m.Body))
+	if err != nil {
+		return fmt.Errorf("cannot decode protobuf message: %w", err)
+	}
+	if err := proto.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("cannot decode protobuf message: %w", err)
+	}
+
+	return nil
+}
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// ProtoReceiver returns a msg.Receiver unmarshaling the protobuf body of
+// each message into a new value, and calling `fn` with it. `fn` must be a
+// func with the signature
+//
+//	func(ctx context.Context, v *T) error
+//
+// for some generated protobuf message type T, otherwise ProtoReceiver
+// panics. The Message is available to `fn` with MessageFromContext.
+//
+// Messages which cannot be unmarshaled are not passed to `fn`, and the error
+// of ReadProto is returned.
+func ProtoReceiver(fn interface{}) msg.Receiver {
+	f := reflect.ValueOf(fn)
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 ||
+		t.In(0) != contextType || t.In(1).Kind() != reflect.Ptr ||
+		!t.In(1).Implements(protoMessageType) || t.Out(0) != errorType {
+		panic(fmt.Sprintf("codec: ProtoReceiver requires a func(context.Context, *T) error with *T a proto.Message, got %T", fn))
+	}
+	valueType := t.In(1).Elem()
+
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		v := reflect.New(valueType)
+		if err := ReadProto(m, v.Interface().(proto.Message)); err != nil {
+			return err
+		}
+
+		ctx = context.WithValue(ctx, messageKey{}, m)
+		out := f.Call([]reflect.Value{reflect.ValueOf(ctx), v})
+		if err, _ := out[0].Interface().(error); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+package codec
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	msg "github.com/hdtradeservices/go-msg"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Tests that a value written by WriteProto is received by a ProtoReceiver.
+func TestWriteProtoAndProtoReceiver(t *testing.T) {
+	w := &recordingWriter{attributes: msg.Attributes{}}
+	if err := WriteProto(w, wrapperspb.String("hello\x00world")); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if w.closed == nil {
+		t.Fatal("Expected the MessageWriter to be closed")
+	}
+	if typ := w.closed.Attributes.Get(MessageTypeAttribute); typ != "google.protobuf.StringValue" {
+		t.Errorf("Expected the message type to be set, got %q", typ)
+	}
+	if ct := w.closed.Attributes.Get(ContentTypeAttribute); ct != ProtoContentType {
+		t.Errorf("Expected Content-Type %s, got %s", ProtoContentType, ct)
+	}
+
+	var received string
+	r := ProtoReceiver(func(ctx context.Context, v *wrapperspb.StringValue) error {
+		received = v.GetValue()
+		return nil
+	})
+	if err := r.Receive(context.Background(), w.closed); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if received != "hello\x00world" {
+		t.Errorf("Expected the value to be received, got %q", received)
+	}
+}
+
+// Tests that ReadProto rejects messages of another type.
+func TestReadProto_TypeMismatch(t *testing.T) {
+	m := &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader("")}
+	m.Attributes.Set(MessageTypeAttribute, "google.protobuf.Int64Value")
+
+	if err := ReadProto(m, &wrapperspb.StringValue{}); err == nil {
+		t.Errorf("Expected an error, got nil")
+	}
+}
+
+func TestProtoReceiver_PanicsOnInvalidFunc(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected ProtoReceiver to panic")
+		}
+	}()
+	ProtoReceiver(func(ctx context.Context, o *order) error { return nil })
+}
@@ -0,0 +1,123 @@
+// Package dedup makes receivers idempotent, so that messages delivered more
+// than once, as SQS may do, do not have their side effects applied twice.
+//
+// A Receiver records the key of each message it processed successfully in a
+// Store, and acknowledges messages whose key was already recorded without
+// processing them again:
+//
+//	store, _ := dedup.NewMemoryStore(10000, time.Hour)
+//	srv, _ := sqs.NewServer(queueURL, 10, 30, sqs.WithMiddleware(dedup.Middleware(store)))
+//
+// Keys are only recorded once processing succeeded, so duplicates delivered
+// while the original message is being processed are not detected.
+package dedup
+
+import (
+	"context"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Store records the keys of processed messages.
+//
+// Its methods are called concurrently by the receivers of a Server,
+// so they must be safe for concurrent use.
+type Store interface {
+	// Seen reports whether key was recorded and has not expired.
+	Seen(ctx context.Context, key string) (bool, error)
+
+	// Record records key, marking its message as processed.
+	Record(ctx context.Context, key string) error
+}
+
+// KeyFunc returns the key identifying a message, or "" if the message
+// cannot be identified, in which case it is always processed.
+type KeyFunc func(ctx context.Context, m *msg.Message) string
+
+// MessageID is the default KeyFunc, identifying messages by their SQS
+// MessageId. Publishers which may send the same message more than once
+// should rather set an attribute identifying it, see Attribute.
+func MessageID(ctx context.Context, m *msg.Message) string {
+	return sqs.MessageIDFromContext(ctx)
+}
+
+// Attribute returns a KeyFunc identifying messages by their attribute
+// called name, e.g. "Idempotency-Key".
+func Attribute(name string) KeyFunc {
+	return func(ctx context.Context, m *msg.Message) string {
+		return m.Attributes.Get(name)
+	}
+}
+
+type options struct {
+	key    KeyFunc
+	logger logger.Logger
+}
+
+// Option configures a Receiver.
+type Option func(*options)
+
+// WithKeyFunc sets how messages are identified, instead of MessageID.
+func WithKeyFunc(f KeyFunc) Option {
+	return func(o *options) {
+		o.key = f
+	}
+}
+
+// WithLogger sets the Logger a Receiver logs to, instead of logger.Default.
+func WithLogger(l logger.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// Receiver wraps another msg.Receiver, skipping the messages whose key was
+// recorded in store, and recording the key of the messages it processed
+// successfully.
+//
+// If store cannot be read, the error is returned so that the message is
+// retried later. If it cannot be written, the error is logged but not
+// returned, as the message was processed.
+func Receiver(next msg.Receiver, store Store, opts ...Option) msg.Receiver {
+	o := &options{key: MessageID, logger: logger.Default}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		key := o.key(ctx, m)
+		if key == "" {
+			return next.Receive(ctx, m)
+		}
+
+		seen, err := store.Seen(ctx, key)
+		if err != nil {
+			return err
+		}
+		if seen {
+			o.logger.Logf(logger.Debug, "skipping duplicate message %s", key)
+
+			return nil
+		}
+
+		if err := next.Receive(ctx, m); err != nil {
+			return err
+		}
+
+		if err := store.Record(ctx, key); err != nil {
+			o.logger.Logf(logger.Error, "cannot record message %s as processed: %s", key, err)
+		}
+
+		return nil
+	})
+}
+
+// Middleware returns a function wrapping receivers with Receiver,
+// to be used with sqs.WithMiddleware.
+func Middleware(store Store, opts ...Option) func(msg.Receiver) msg.Receiver {
+	return func(next msg.Receiver) msg.Receiver {
+		return Receiver(next, store, opts...)
+	}
+}
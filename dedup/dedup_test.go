@@ -0,0 +1,73 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that a Receiver processes each key once, only recording
+// the keys of messages processed successfully.
+func TestReceiver(t *testing.T) {
+	store, err := NewMemoryStore(10, time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	calls := map[string]int{}
+	fail := true
+	next := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		key := m.Attributes.Get("Idempotency-Key")
+		calls[key]++
+		if key == "b" && fail {
+			fail = false
+			return errors.New("failed")
+		}
+		return nil
+	})
+	r := Receiver(next, store, WithKeyFunc(Attribute("Idempotency-Key")))
+
+	for _, key := range []string{"a", "a", "b", "b", "b", ""} {
+		m := &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader("")}
+		if key != "" {
+			m.Attributes.Set("Idempotency-Key", key)
+		}
+		r.Receive(context.Background(), m)
+	}
+
+	expected := map[string]int{"a": 1, "b": 2, "": 1}
+	for key, n := range expected {
+		if calls[key] != n {
+			t.Errorf("Expected message %q to be processed %d times, got %d", key, n, calls[key])
+		}
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Seen(ctx context.Context, key string) (bool, error) {
+	return false, errors.New("unavailable")
+}
+
+func (failingStore) Record(ctx context.Context, key string) error {
+	return errors.New("unavailable")
+}
+
+// Tests that messages are not processed when the store cannot be read.
+func TestReceiver_StoreError(t *testing.T) {
+	next := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		t.Errorf("Expected the message not to be processed")
+		return nil
+	})
+	r := Receiver(next, failingStore{}, WithKeyFunc(func(ctx context.Context, m *msg.Message) string {
+		return "key"
+	}))
+
+	if err := r.Receive(context.Background(), &msg.Message{}); err == nil {
+		t.Errorf("Expected the store error to be returned")
+	}
+}
@@ -0,0 +1,89 @@
+// Package dynamodb provides a dedup.Store backed by a DynamoDB table, to
+// deduplicate the messages processed by several processes.
+//
+// The table must have a string partition key called KeyAttribute, and
+// should have Time To Live enabled on ExpiresAtAttribute so that DynamoDB
+// deletes expired keys.
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/hdtradeservices/go-aws-msg/dedup"
+)
+
+const (
+	// KeyAttribute is the partition key of the table, holding message keys.
+	KeyAttribute = "MessageKey"
+
+	// ExpiresAtAttribute holds when keys expire, in seconds since the epoch.
+	ExpiresAtAttribute = "ExpiresAt"
+)
+
+// Store is a dedup.Store recording keys in a DynamoDB table.
+type Store struct {
+	svc   dynamodbiface.DynamoDBAPI
+	table string
+	ttl   time.Duration
+
+	now func() time.Time
+}
+
+var _ dedup.Store = (*Store)(nil)
+
+// New returns a Store recording keys in table, which expire after ttl,
+// or never if ttl is 0.
+func New(svc dynamodbiface.DynamoDBAPI, table string, ttl time.Duration) *Store {
+	return &Store{
+		svc:   svc,
+		table: table,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// Seen reports whether key was recorded and has not expired. Keys are read
+// consistently, and expired keys not deleted by DynamoDB yet are ignored.
+func (s *Store) Seen(ctx context.Context, key string) (bool, error) {
+	resp, err := s.svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]*dynamodb.AttributeValue{KeyAttribute: {S: aws.String(key)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	if resp.Item == nil {
+		return false, nil
+	}
+
+	if v, ok := resp.Item[ExpiresAtAttribute]; ok && v.N != nil {
+		expiresAt, err := strconv.ParseInt(*v.N, 10, 64)
+		if err == nil && s.now().Unix() >= expiresAt {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Record records key, with its expiration time if the Store has a ttl.
+func (s *Store) Record(ctx context.Context, key string) error {
+	item := map[string]*dynamodb.AttributeValue{KeyAttribute: {S: aws.String(key)}}
+	if s.ttl > 0 {
+		expiresAt := s.now().Add(s.ttl).Unix()
+		item[ExpiresAtAttribute] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(expiresAt, 10))}
+	}
+
+	_, err := s.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	})
+
+	return err
+}
@@ -0,0 +1,64 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// mockDynamoDBAPI stores items in memory, by key.
+type mockDynamoDBAPI struct {
+	dynamodbiface.DynamoDBAPI
+
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (m *mockDynamoDBAPI) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	if !aws.BoolValue(input.ConsistentRead) {
+		return nil, errors.New("expected a consistent read")
+	}
+
+	return &dynamodb.GetItemOutput{Item: m.items[aws.StringValue(input.Key[KeyAttribute].S)]}, nil
+}
+
+func (m *mockDynamoDBAPI) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	m.items[aws.StringValue(input.Item[KeyAttribute].S)] = input.Item
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	svc := &mockDynamoDBAPI{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	s := New(svc, "processed-messages", time.Hour)
+	s.now = func() time.Time { return now }
+
+	if seen, err := s.Seen(ctx, "msg0"); err != nil || seen {
+		t.Fatalf("Expected msg0 not to be seen, got %v, %v", seen, err)
+	}
+
+	if err := s.Record(ctx, "msg0"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if expiresAt := aws.StringValue(svc.items["msg0"][ExpiresAtAttribute].N); expiresAt != "1700003600" {
+		t.Errorf("Expected msg0 to expire at 1700003600, got %s", expiresAt)
+	}
+
+	if seen, err := s.Seen(ctx, "msg0"); err != nil || !seen {
+		t.Errorf("Expected msg0 to be seen, got %v, %v", seen, err)
+	}
+
+	// expired items may not have been deleted by DynamoDB yet
+	now = now.Add(time.Hour)
+	if seen, err := s.Seen(ctx, "msg0"); err != nil || seen {
+		t.Errorf("Expected msg0 to have expired, got %v, %v", seen, err)
+	}
+}
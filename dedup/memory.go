@@ -0,0 +1,109 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store keeping the most recently recorded keys in memory.
+// It is only suitable for deduplicating the messages of a single process.
+type MemoryStore struct {
+	mux   sync.Mutex
+	size  int
+	ttl   time.Duration
+	keys  map[string]*list.Element
+	order *list.List // recorded keys, most recent first
+
+	now func() time.Time
+}
+
+type memoryEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a MemoryStore keeping up to size keys, evicting the
+// least recently recorded ones first. Keys expire after ttl, or never if ttl
+// is 0.
+func NewMemoryStore(size int, ttl time.Duration) (*MemoryStore, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("invalid size: %d. Must be at least 1", size)
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("invalid ttl: %s. Must not be negative", ttl)
+	}
+
+	return &MemoryStore{
+		size:  size,
+		ttl:   ttl,
+		keys:  make(map[string]*list.Element, size),
+		order: list.New(),
+		now:   time.Now,
+	}, nil
+}
+
+// Seen reports whether key was recorded and has not expired nor been evicted.
+func (s *MemoryStore) Seen(ctx context.Context, key string) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	e, ok := s.keys[key]
+	if !ok {
+		return false, nil
+	}
+
+	if s.expired(e.Value.(*memoryEntry)) {
+		s.order.Remove(e)
+		delete(s.keys, key)
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Record records key, evicting the least recently recorded key if the
+// store is full.
+func (s *MemoryStore) Record(ctx context.Context, key string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entry := &memoryEntry{key: key}
+	if s.ttl > 0 {
+		entry.expiresAt = s.now().Add(s.ttl)
+	}
+
+	if e, ok := s.keys[key]; ok {
+		e.Value = entry
+		s.order.MoveToFront(e)
+
+		return nil
+	}
+
+	s.keys[key] = s.order.PushFront(entry)
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(*memoryEntry).key)
+	}
+
+	return nil
+}
+
+// Len returns the number of keys in the store, including expired ones
+// which have not been evicted yet.
+func (s *MemoryStore) Len() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.order.Len()
+}
+
+func (s *MemoryStore) expired(e *memoryEntry) bool {
+	return !e.expiresAt.IsZero() && !s.now().Before(e.expiresAt)
+}
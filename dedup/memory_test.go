@@ -0,0 +1,41 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	s, err := NewMemoryStore(2, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	s.now = func() time.Time { return now }
+
+	s.Record(ctx, "a")
+	s.Record(ctx, "b")
+	s.Record(ctx, "a")
+	s.Record(ctx, "c") // evicts b, the least recently recorded
+
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if seen, _ := s.Seen(ctx, key); seen != expected {
+			t.Errorf("Expected Seen(%q) to be %v", key, expected)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if seen, _ := s.Seen(ctx, "a"); seen {
+		t.Errorf("Expected a to have expired")
+	}
+	if n := s.Len(); n != 1 {
+		t.Errorf("Expected the expired key to be evicted, got %d keys", n)
+	}
+
+	if _, err := NewMemoryStore(0, 0); err == nil {
+		t.Errorf("Expected error for a size of 0")
+	}
+}
@@ -0,0 +1,251 @@
+package dynamodbstreams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	streams "github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/hdtradeservices/go-aws-msg/kinesis"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// mockStreamsAPI serves the records of shards from memory, one shard per
+// DescribeStream page. The iterator of a shard is its ID and the index of
+// its next record. Shards in `closed` have no iterator once their records
+// were read.
+type mockStreamsAPI struct {
+	dynamodbstreamsiface.DynamoDBStreamsAPI
+
+	shards  []*streams.Shard
+	records map[string][]*streams.Record
+	closed  map[string]bool
+}
+
+func (s *mockStreamsAPI) DescribeStreamWithContext(ctx aws.Context, input *streams.DescribeStreamInput, opts ...request.Option) (*streams.DescribeStreamOutput, error) {
+	i := 0
+	if input.ExclusiveStartShardId != nil {
+		for j, shard := range s.shards {
+			if *shard.ShardId == *input.ExclusiveStartShardId {
+				i = j + 1
+			}
+		}
+	}
+
+	desc := &streams.StreamDescription{Shards: s.shards[i : i+1]}
+	if i+1 < len(s.shards) {
+		desc.LastEvaluatedShardId = s.shards[i].ShardId
+	}
+	return &streams.DescribeStreamOutput{StreamDescription: desc}, nil
+}
+
+func (s *mockStreamsAPI) GetShardIteratorWithContext(ctx aws.Context, input *streams.GetShardIteratorInput, opts ...request.Option) (*streams.GetShardIteratorOutput, error) {
+	next := 0
+	if aws.StringValue(input.ShardIteratorType) == streams.ShardIteratorTypeAfterSequenceNumber {
+		for i, r := range s.records[*input.ShardId] {
+			if *r.Dynamodb.SequenceNumber == *input.SequenceNumber {
+				next = i + 1
+			}
+		}
+	}
+	return &streams.GetShardIteratorOutput{ShardIterator: aws.String(*input.ShardId + "/" + strconv.Itoa(next))}, nil
+}
+
+func (s *mockStreamsAPI) GetRecordsWithContext(ctx aws.Context, input *streams.GetRecordsInput, opts ...request.Option) (*streams.GetRecordsOutput, error) {
+	parts := strings.Split(*input.ShardIterator, "/")
+	shardID := parts[0]
+	next, _ := strconv.Atoi(parts[1])
+
+	records := s.records[shardID][next:]
+	out := &streams.GetRecordsOutput{Records: records}
+	if !s.closed[shardID] || len(records) > 0 {
+		out.NextShardIterator = aws.String(shardID + "/" + strconv.Itoa(len(s.records[shardID])))
+	}
+	return out, nil
+}
+
+// newRecord returns a record of `eventName` of the item with key `id`.
+func newRecord(seq, eventName, id string) *streams.Record {
+	key := map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}}
+	return &streams.Record{
+		EventID:   aws.String("event-" + seq),
+		EventName: aws.String(eventName),
+		Dynamodb: &streams.StreamRecord{
+			SequenceNumber:              aws.String(seq),
+			Keys:                        key,
+			NewImage:                    key,
+			ApproximateCreationDateTime: aws.Time(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+		},
+	}
+}
+
+// newRotatedStream returns a stream whose closed shard-0 is followed by
+// shard-1.
+func newRotatedStream() *mockStreamsAPI {
+	return &mockStreamsAPI{
+		shards: []*streams.Shard{
+			{ShardId: aws.String("shard-1"), ParentShardId: aws.String("shard-0")},
+			{ShardId: aws.String("shard-0")},
+		},
+		records: map[string][]*streams.Record{
+			"shard-0": {newRecord("1", "INSERT", "a"), newRecord("2", "MODIFY", "a")},
+			"shard-1": {newRecord("3", "REMOVE", "a")},
+		},
+		closed: map[string]bool{"shard-0": true},
+	}
+}
+
+// recordingReceiver records the event names of the messages it receives,
+// failing the first time it receives a message of `failOnce`.
+type recordingReceiver struct {
+	mux      sync.Mutex
+	events   []string
+	failOnce string
+	received chan Change
+}
+
+func (r *recordingReceiver) Receive(ctx context.Context, m *msg.Message) error {
+	b, _ := ioutil.ReadAll(m.Body)
+	var c Change
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.failOnce == c.EventName {
+		r.failOnce = ""
+		return errors.New("failed")
+	}
+	r.events = append(r.events, m.Attributes.Get(EventNameAttribute))
+	r.received <- c
+	return nil
+}
+
+// serve serves the stream of `svc` with a Server created with `opts` until
+// `n` messages were received, returning their changes.
+func serve(t *testing.T, svc dynamodbstreamsiface.DynamoDBStreamsAPI, r *recordingReceiver, n int, opts ...Option) []Change {
+	opts = append([]Option{
+		WithClient(svc),
+		WithStartingPosition(streams.ShardIteratorTypeTrimHorizon),
+		WithPollInterval(10 * time.Millisecond),
+		WithRetryDelay(10 * time.Millisecond),
+		WithLogger(logger.Nop),
+	}, opts...)
+	s, err := NewServer("arn:aws:dynamodb:us-west-2:000000000000:table/orders/stream/2021", opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(context.Background(), r) }()
+
+	var changes []Change
+	for len(changes) < n {
+		select {
+		case c := <-r.received:
+			changes = append(changes, c)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after receiving %d messages", len(changes))
+		}
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if err := <-served; err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+
+	return changes
+}
+
+// Tests that the records of a shard are received in order, once its parent
+// was consumed entirely, that failed records are retried, and that shards
+// are checkpointed.
+func TestServer(t *testing.T) {
+	r := &recordingReceiver{failOnce: "MODIFY", received: make(chan Change, 10)}
+	checkpointer := &kinesis.MemoryCheckpointer{}
+
+	changes := serve(t, newRotatedStream(), r, 3, WithCheckpointer(checkpointer))
+
+	if strings.Join(r.events, ",") != "INSERT,MODIFY,REMOVE" {
+		t.Errorf("Expected the records to be received in order, got %v", r.events)
+	}
+	if changes[0].Keys["id"] != "a" || changes[0].NewImage["id"] != "a" || changes[0].OldImage != nil {
+		t.Errorf("Unexpected change %+v", changes[0])
+	}
+
+	for shardID, seq := range map[string]string{"shard-0": "2", "shard-1": "3"} {
+		if got, _ := checkpointer.Checkpoint(context.Background(), shardID); got != seq {
+			t.Errorf("Expected %s to be checkpointed at %s, got %q", shardID, seq, got)
+		}
+	}
+}
+
+// Tests that a Server resumes consuming shards after their checkpoint.
+func TestServer_ResumesFromCheckpoint(t *testing.T) {
+	checkpointer := &kinesis.MemoryCheckpointer{}
+	checkpointer.SetCheckpoint(context.Background(), "shard-0", "1")
+
+	r := &recordingReceiver{received: make(chan Change, 10)}
+	serve(t, newRotatedStream(), r, 2, WithCheckpointer(checkpointer))
+
+	if strings.Join(r.events, ",") != "MODIFY,REMOVE" {
+		t.Errorf("Expected the records after the checkpoint to be received, got %v", r.events)
+	}
+}
+
+// Tests that records are converted to the attributes and JSON body of
+// messages.
+func TestServer_receiveRecord(t *testing.T) {
+	record := newRecord("7", "MODIFY", "a")
+	record.Dynamodb.OldImage = map[string]*dynamodb.AttributeValue{
+		"id":      {S: aws.String("a")},
+		"total":   {N: aws.String("12345678901234567890")},
+		"paid":    {BOOL: aws.Bool(false)},
+		"note":    {NULL: aws.Bool(true)},
+		"tags":    {SS: []*string{aws.String("x"), aws.String("y")}},
+		"lines":   {L: []*dynamodb.AttributeValue{{M: map[string]*dynamodb.AttributeValue{"qty": {N: aws.String("2")}}}}},
+		"payload": {B: []byte("hi")},
+	}
+
+	var m *msg.Message
+	s := &Server{logger: logger.Nop}
+	s.receiveRecord(msg.ReceiverFunc(func(ctx context.Context, received *msg.Message) error {
+		m = received
+		return nil
+	}), "shard-0", record)
+
+	expected := map[string]string{
+		EventNameAttribute:      "MODIFY",
+		EventIDAttribute:        "event-7",
+		SequenceNumberAttribute: "7",
+		ShardIDAttribute:        "shard-0",
+		CreationTimeAttribute:   "2021-01-01T00:00:00Z",
+	}
+	for k, v := range expected {
+		if m.Attributes.Get(k) != v {
+			t.Errorf("Expected attribute %s to be %q, got %q", k, v, m.Attributes.Get(k))
+		}
+	}
+
+	b, _ := ioutil.ReadAll(m.Body)
+	body := `{"eventName":"MODIFY","keys":{"id":"a"},` +
+		`"oldImage":{"id":"a","lines":[{"qty":2}],"note":null,"paid":false,"payload":"aGk=","tags":["x","y"],"total":12345678901234567890},` +
+		`"newImage":{"id":"a"}}`
+	if string(b) != body {
+		t.Errorf("Expected body %s, got %s", body, b)
+	}
+}
@@ -0,0 +1,92 @@
+package dynamodbstreams
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	streams "github.com/aws/aws-sdk-go/service/dynamodbstreams"
+)
+
+// Change is the JSON body of the messages received by a Server: the change
+// of an item described by a stream record. Its images are nil unless the
+// StreamViewType of the stream includes them.
+//
+// Attribute values are converted to plain JSON: numbers are JSON numbers,
+// binary values base64-encoded strings, and sets arrays.
+type Change struct {
+	// EventName is the type of change, "INSERT", "MODIFY" or "REMOVE".
+	EventName string `json:"eventName"`
+	// Keys holds the key attributes of the item.
+	Keys map[string]interface{} `json:"keys"`
+	// OldImage is the item before it was modified.
+	OldImage map[string]interface{} `json:"oldImage,omitempty"`
+	// NewImage is the item after it was modified.
+	NewImage map[string]interface{} `json:"newImage,omitempty"`
+}
+
+// marshalChange returns the JSON representation of the Change of `r`.
+func marshalChange(r *streams.Record) ([]byte, error) {
+	c := Change{EventName: *r.EventName}
+	if r.Dynamodb != nil {
+		c.Keys = convertItem(r.Dynamodb.Keys)
+		c.OldImage = convertItem(r.Dynamodb.OldImage)
+		c.NewImage = convertItem(r.Dynamodb.NewImage)
+	}
+
+	return json.Marshal(c)
+}
+
+// convertItem converts the attributes of an item to plain values.
+func convertItem(item map[string]*dynamodb.AttributeValue) map[string]interface{} {
+	if item == nil {
+		return nil
+	}
+
+	m := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		m[k] = convertValue(v)
+	}
+
+	return m
+}
+
+// convertValue converts an attribute value to a plain value marshaled to
+// JSON as described by Change.
+func convertValue(v *dynamodb.AttributeValue) interface{} {
+	switch {
+	case v == nil || v.NULL != nil:
+		return nil
+	case v.S != nil:
+		return *v.S
+	case v.N != nil:
+		return json.Number(*v.N)
+	case v.BOOL != nil:
+		return *v.BOOL
+	case v.B != nil:
+		return v.B
+	case v.M != nil:
+		return convertItem(v.M)
+	case v.L != nil:
+		l := make([]interface{}, len(v.L))
+		for i, e := range v.L {
+			l[i] = convertValue(e)
+		}
+		return l
+	case v.SS != nil:
+		l := make([]string, len(v.SS))
+		for i, e := range v.SS {
+			l[i] = *e
+		}
+		return l
+	case v.NS != nil:
+		l := make([]json.Number, len(v.NS))
+		for i, e := range v.NS {
+			l[i] = json.Number(*e)
+		}
+		return l
+	case v.BS != nil:
+		return v.BS
+	}
+
+	return nil
+}
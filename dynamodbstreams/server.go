@@ -0,0 +1,502 @@
+// Package dynamodbstreams implements a msg.Server tailing a DynamoDB Stream,
+// for change-data-capture consumers to reuse the receivers and middleware
+// written for SQS.
+//
+// Each record of the stream is received as a message whose body is the JSON
+// representation of a Change, with attributes describing the record, e.g.
+// EventNameAttribute:
+//
+//	srv, err := dynamodbstreams.NewServer(streamARN, dynamodbstreams.WithCheckpointer(checkpointer))
+//	srv.Serve(ctx, msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+//		var c dynamodbstreams.Change
+//		if err := json.NewDecoder(m.Body).Decode(&c); err != nil {
+//			return err
+//		}
+//		// ...
+//	}))
+package dynamodbstreams
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	streams "github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/hdtradeservices/go-aws-msg/kinesis"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// The attributes of the messages received by a Server.
+const (
+	// EventNameAttribute is the type of change, "INSERT", "MODIFY" or "REMOVE".
+	EventNameAttribute = "Event-Name"
+	// EventIDAttribute is the unique ID of the record.
+	EventIDAttribute = "Event-Id"
+	// SequenceNumberAttribute is the sequence number of the record in its shard.
+	SequenceNumberAttribute = "Sequence-Number"
+	// ShardIDAttribute is the ID of the shard of the record.
+	ShardIDAttribute = "Shard-Id"
+	// CreationTimeAttribute is the approximate time the change was made,
+	// formatted as RFC 3339.
+	CreationTimeAttribute = "Approximate-Creation-Time"
+)
+
+const (
+	// defaultPollInterval is how long a Server waits before polling a shard
+	// again after an empty GetRecords call.
+	defaultPollInterval = time.Second
+
+	// defaultRetryDelay is how long a Server waits before passing a record
+	// to the receiver again after it failed.
+	defaultRetryDelay = 5 * time.Second
+
+	// shardListInterval is how often a Server lists the shards of the
+	// stream, to consume the new shards DynamoDB opens every few hours.
+	shardListInterval = time.Minute
+)
+
+// Server tails a DynamoDB Stream, passing its records to a receiver.
+//
+// The records of a shard are received one at a time, in order: a record the
+// receiver fails to process is retried, after a delay, until it succeeds,
+// blocking the following records of the shard. The children of a shard are
+// consumed once it was consumed entirely.
+type Server struct {
+	// ARN of the stream
+	StreamARN string
+	// Concrete instance of DynamoDBStreamsAPI
+	Svc dynamodbstreamsiface.DynamoDBStreamsAPI
+
+	startingPosition string               // ShardIteratorType of shards without checkpoint
+	pollInterval     time.Duration        // delay between polls of a shard without new records
+	retryDelay       time.Duration        // delay before a failed record is received again
+	checkpointer     kinesis.Checkpointer // stores the last record processed of each shard; may be nil
+	logger           logger.Logger        // where the Server logs; logger.Default when nil
+
+	mux       sync.Mutex
+	started   map[string]bool // shards being or done consumed
+	finished  map[string]bool // shards consumed entirely
+	shardDone chan struct{}   // receives a value once a shard was consumed entirely
+
+	routines           sync.WaitGroup     // shard consumers, waited for by Shutdown
+	receiverCtx        context.Context    // context used to control the life of receivers
+	receiverCancelFunc context.CancelFunc // CancelFunc for all receivers
+	serverCtx          context.Context    // context used to control the life of the Server
+	serverCancelFunc   context.CancelFunc // CancelFunc to signal the server should stop consuming shards
+}
+
+// Option is the signature that modifies a `Server` to set some configuration
+type Option func(*Server) error
+
+// NewServer returns a Server tailing the stream `streamARN`, with a
+// DynamoDB Streams client configured from the environment. Shards without
+// checkpoint are consumed from their latest record, see WithStartingPosition.
+func NewServer(streamARN string, opts ...Option) (*Server, error) {
+	conf := aws.Config{}
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		conf.Region = aws.String(r)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            conf,
+		SharedConfigState: session.SharedConfigStateFromEnv,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String("us-west-2")
+	}
+
+	serverCtx, serverCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	s := &Server{
+		StreamARN:          streamARN,
+		Svc:                streams.New(sess),
+		startingPosition:   streams.ShardIteratorTypeLatest,
+		pollInterval:       defaultPollInterval,
+		retryDelay:         defaultRetryDelay,
+		started:            make(map[string]bool),
+		finished:           make(map[string]bool),
+		shardDone:          make(chan struct{}, 1),
+		serverCtx:          serverCtx,
+		serverCancelFunc:   serverCancelFunc,
+		receiverCtx:        receiverCtx,
+		receiverCancelFunc: receiverCancelFunc,
+	}
+
+	for _, opt := range opts {
+		if err = opt(s); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	return s, nil
+}
+
+// WithClient makes the `Server` use `svc` instead of the DynamoDB Streams
+// client built by NewServer from the environment.
+func WithClient(svc dynamodbstreamsiface.DynamoDBStreamsAPI) Option {
+	return func(s *Server) error {
+		if svc == nil {
+			return errors.New("client must not be nil")
+		}
+
+		s.Svc = svc
+
+		return nil
+	}
+}
+
+// WithStartingPosition sets where the `Server` starts consuming shards
+// without checkpoint: streams.ShardIteratorTypeLatest, the default, or
+// streams.ShardIteratorTypeTrimHorizon to consume the records of the last
+// 24 hours.
+func WithStartingPosition(iteratorType string) Option {
+	return func(s *Server) error {
+		switch iteratorType {
+		case streams.ShardIteratorTypeLatest, streams.ShardIteratorTypeTrimHorizon:
+		default:
+			return fmt.Errorf("unsupported starting position %q", iteratorType)
+		}
+
+		s.startingPosition = iteratorType
+
+		return nil
+	}
+}
+
+// WithPollInterval sets how long the `Server` waits before polling a shard
+// again after it returned no record, one second by default.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Server) error {
+		if d <= 0 {
+			return errors.New("poll interval must be positive")
+		}
+
+		s.pollInterval = d
+
+		return nil
+	}
+}
+
+// WithRetryDelay sets how long the `Server` waits before passing a record
+// the receiver failed to process to it again, 5 seconds by default.
+func WithRetryDelay(d time.Duration) Option {
+	return func(s *Server) error {
+		if d <= 0 {
+			return errors.New("retry delay must be positive")
+		}
+
+		s.retryDelay = d
+
+		return nil
+	}
+}
+
+// WithCheckpointer makes the `Server` store the sequence number of the last
+// record of each shard processed in `c`, and resume consuming shards after
+// it.
+func WithCheckpointer(c kinesis.Checkpointer) Option {
+	return func(s *Server) error {
+		if c == nil {
+			return errors.New("checkpointer must not be nil")
+		}
+
+		s.checkpointer = c
+
+		return nil
+	}
+}
+
+// WithLogger sets the Logger the `Server` logs to, instead of logger.Default.
+func WithLogger(l logger.Logger) Option {
+	return func(s *Server) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+
+		s.logger = l
+
+		return nil
+	}
+}
+
+// Serve consumes the shards of the stream, passing their records to `r`,
+// until Shutdown is called, and returns msg.ErrServerClosed. It returns
+// the error of DescribeStream if the shards of the stream cannot be listed.
+func (s *Server) Serve(ctx context.Context, r msg.Receiver) error {
+	if s.serverCtx.Err() != nil {
+		return msg.ErrServerClosed
+	}
+
+	ticker := time.NewTicker(shardListInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.startShards(r); err != nil {
+			return err
+		}
+
+		select {
+		case <-s.serverCtx.Done():
+			return msg.ErrServerClosed
+		case <-s.shardDone:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown stops consuming shards, and waits for the records being received
+// to be processed. If ctx is done first, the contexts of the receivers are
+// canceled and the error of ctx is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.serverCancelFunc()
+
+	done := make(chan struct{})
+	go func() {
+		s.routines.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.receiverCancelFunc()
+		return ctx.Err()
+	}
+}
+
+// startShards lists the shards of the stream, and starts consuming those
+// which were not started and whose parent, if any, was consumed entirely.
+func (s *Server) startShards(r msg.Receiver) error {
+	shards, err := s.listShards()
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[aws.StringValue(shard.ShardId)] = true
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, shard := range shards {
+		id := aws.StringValue(shard.ShardId)
+		parent := aws.StringValue(shard.ParentShardId)
+
+		// parents which are no longer listed expired with their records
+		if s.started[id] || (parent != "" && listed[parent] && !s.finished[parent]) {
+			continue
+		}
+
+		s.started[id] = true
+		s.routines.Add(1)
+		go func() {
+			defer s.routines.Done()
+			s.consumeShard(r, id)
+		}()
+	}
+
+	return nil
+}
+
+// listShards returns every shard of the stream.
+func (s *Server) listShards() ([]*streams.Shard, error) {
+	var shards []*streams.Shard
+
+	input := &streams.DescribeStreamInput{StreamArn: aws.String(s.StreamARN)}
+	for {
+		out, err := s.Svc.DescribeStreamWithContext(s.serverCtx, input)
+		if err != nil {
+			return nil, fmt.Errorf("cannot describe stream %s: %w", s.StreamARN, err)
+		}
+		shards = append(shards, out.StreamDescription.Shards...)
+
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// consumeShard consumes the shard `shardID` until it is consumed entirely,
+// or the Server is shut down.
+func (s *Server) consumeShard(r msg.Receiver, shardID string) {
+	finished, err := s.pollShard(r, shardID)
+	if err != nil {
+		s.logf(logger.Error, "stopped consuming shard %s of stream %s: %s", shardID, s.StreamARN, err)
+
+		// let the next listing of the shards start the shard again
+		s.mux.Lock()
+		delete(s.started, shardID)
+		s.mux.Unlock()
+		s.wait(s.retryDelay)
+	}
+
+	if finished {
+		s.mux.Lock()
+		s.finished[shardID] = true
+		s.mux.Unlock()
+	}
+
+	if finished || err != nil {
+		select {
+		case s.shardDone <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// pollShard consumes the shard `shardID` with GetRecords calls. It returns
+// true once the shard was consumed entirely, false if the Server was shut
+// down.
+func (s *Server) pollShard(r msg.Receiver, shardID string) (bool, error) {
+	var seq string
+	if s.checkpointer != nil {
+		var err error
+		if seq, err = s.checkpointer.Checkpoint(s.serverCtx, shardID); err != nil {
+			return false, fmt.Errorf("cannot load checkpoint: %w", err)
+		}
+	}
+
+	iterator, err := s.shardIterator(shardID, seq)
+	if err != nil {
+		return false, err
+	}
+
+	for iterator != nil {
+		if s.serverCtx.Err() != nil {
+			return false, nil
+		}
+
+		out, err := s.Svc.GetRecordsWithContext(s.serverCtx, &streams.GetRecordsInput{ShardIterator: iterator})
+		if err != nil {
+			if s.serverCtx.Err() != nil {
+				return false, nil
+			}
+
+			var aerr awserr.Error
+			if errors.As(err, &aerr) && aerr.Code() == streams.ErrCodeExpiredIteratorException {
+				if iterator, err = s.shardIterator(shardID, seq); err != nil {
+					return false, err
+				}
+				continue
+			}
+
+			return false, fmt.Errorf("GetRecords: %w", err)
+		}
+
+		for _, record := range out.Records {
+			if !s.receiveRecord(r, shardID, record) {
+				return false, nil
+			}
+			seq = aws.StringValue(record.Dynamodb.SequenceNumber)
+
+			if s.checkpointer != nil {
+				if err := s.checkpointer.SetCheckpoint(s.receiverCtx, shardID, seq); err != nil {
+					// the record is received again if the Server restarts
+					s.logf(logger.Error, "cannot checkpoint shard %s at %s: %s", shardID, seq, err)
+				}
+			}
+		}
+
+		iterator = out.NextShardIterator
+		if len(out.Records) == 0 && iterator != nil {
+			s.wait(s.pollInterval)
+		}
+	}
+
+	return true, nil
+}
+
+// shardIterator returns an iterator of the shard `shardID`, after the
+// sequence number `seq` if set, or at the starting position of the Server.
+func (s *Server) shardIterator(shardID, seq string) (*string, error) {
+	input := &streams.GetShardIteratorInput{
+		StreamArn:         aws.String(s.StreamARN),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(s.startingPosition),
+	}
+	if seq != "" {
+		input.ShardIteratorType = aws.String(streams.ShardIteratorTypeAfterSequenceNumber)
+		input.SequenceNumber = aws.String(seq)
+	}
+
+	out, err := s.Svc.GetShardIteratorWithContext(s.serverCtx, input)
+	if err != nil {
+		return nil, fmt.Errorf("GetShardIterator: %w", err)
+	}
+
+	return out.ShardIterator, nil
+}
+
+// receiveRecord passes `record` to `r` until it succeeds. It returns false
+// if the Server was shut down before.
+func (s *Server) receiveRecord(r msg.Receiver, shardID string, record *streams.Record) bool {
+	body, err := marshalChange(record)
+	if err != nil {
+		// cannot happen, every value converted is marshalable
+		s.logf(logger.Error, "cannot marshal record %s: %s", aws.StringValue(record.EventID), err)
+		return true
+	}
+
+	for {
+		m := &msg.Message{
+			Attributes: msg.Attributes{},
+			Body:       bytes.NewReader(body),
+		}
+		m.Attributes.Set(EventNameAttribute, aws.StringValue(record.EventName))
+		m.Attributes.Set(EventIDAttribute, aws.StringValue(record.EventID))
+		m.Attributes.Set(SequenceNumberAttribute, aws.StringValue(record.Dynamodb.SequenceNumber))
+		m.Attributes.Set(ShardIDAttribute, shardID)
+		if t := record.Dynamodb.ApproximateCreationDateTime; t != nil {
+			m.Attributes.Set(CreationTimeAttribute, t.UTC().Format(time.RFC3339))
+		}
+
+		err := r.Receive(s.receiverCtx, m)
+		if err == nil {
+			return true
+		}
+
+		s.logf(logger.Error, "cannot receive record %s of shard %s: %s", aws.StringValue(record.EventID), shardID, err)
+		if !s.wait(s.retryDelay) {
+			return false
+		}
+	}
+}
+
+// wait waits for `d`, returning false if the Server is shut down before.
+func (s *Server) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-s.serverCtx.Done():
+		return false
+	}
+}
+
+// logf logs a message at level to the Logger of the Server.
+func (s *Server) logf(level logger.Level, format string, args ...interface{}) {
+	l := s.logger
+	if l == nil {
+		l = logger.Default
+	}
+
+	l.Logf(level, format, args...)
+}
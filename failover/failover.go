@@ -0,0 +1,203 @@
+// Package failover publishes messages to a secondary Topic, e.g. a queue in
+// another region, when publishing them to the primary Topic fails, so that
+// critical events survive a regional outage.
+//
+//	primary, _ := sqs.NewTopic(queueURL, sqs.WithTopicRegion("us-east-1"))
+//	secondary, _ := sqs.NewTopic(replicaURL, sqs.WithTopicRegion("us-west-2"))
+//	topic := failover.Topic(primary, secondary, failover.WithMetrics(rec, "events"))
+//
+// Consumers must read from both queues, e.g. with a Server for each.
+package failover
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/metrics"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Option configures a Topic.
+type Option func(*config)
+
+type config struct {
+	shouldFailover func(error) bool
+	metrics        metrics.FailoverRecorder
+	destination    string
+	logger         logger.Logger
+}
+
+// WithShouldFailover sets the function reporting whether a message which
+// failed to be published to the primary Topic with err is published to the
+// secondary Topic, instead of on every error but context cancellations,
+// e.g. sqs.IsRetryablePublishError to not fail over messages SQS rejected.
+func WithShouldFailover(f func(err error) bool) Option {
+	return func(c *config) {
+		c.shouldFailover = f
+	}
+}
+
+// WithMetrics makes the Topic report each failover to `r`, labeled with
+// `destination`, e.g. the name of the primary queue.
+func WithMetrics(r metrics.FailoverRecorder, destination string) Option {
+	return func(c *config) {
+		c.metrics = r
+		c.destination = destination
+	}
+}
+
+// WithLogger sets the Logger the Topic logs failovers to, instead of
+// logger.Default.
+func WithLogger(l logger.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{shouldFailover: shouldFailover, logger: logger.Default}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// shouldFailover is the default function reporting whether a message which
+// failed to be published with err is failed over.
+func shouldFailover(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// Topic returns a Topic publishing messages to `primary`, and publishing
+// those which failed to be to `secondary` instead. The body, attributes, delay
+// and FIFO message group and deduplication IDs of the message are set on the
+// MessageWriters of both Topics, when they support them.
+//
+// Close returns nil once the message was published to either Topic, or an
+// error wrapping the error of the secondary Topic.
+func Topic(primary, secondary msg.Topic, opts ...Option) msg.Topic {
+	c := newConfig(opts)
+
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &failoverWriter{
+			primary:    primary,
+			secondary:  secondary,
+			ctx:        ctx,
+			config:     c,
+			attributes: msg.Attributes{},
+		}
+	})
+}
+
+// failoverWriter is the msg.MessageWriter of a failover Topic. It buffers
+// the message until Close, so that it can be written to both Topics.
+type failoverWriter struct {
+	primary   msg.Topic
+	secondary msg.Topic
+	ctx       context.Context
+	config    *config
+
+	attributes      msg.Attributes
+	buf             bytes.Buffer
+	delay           *time.Duration
+	groupID         string
+	deduplicationID string
+
+	closed bool
+	mux    sync.Mutex
+}
+
+// Attributes returns the attributes of the message.
+func (w *failoverWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// Write writes data to the buffer of the message.
+func (w *failoverWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+
+	return w.buf.Write(p)
+}
+
+// SetDelay sets a delay on the message, if the MessageWriters of the Topics
+// support it, e.g. sqs.MessageWriters.
+func (w *failoverWriter) SetDelay(delay time.Duration) {
+	w.delay = &delay
+}
+
+// SetMessageGroupID sets the MessageGroupId of a message sent to a FIFO
+// queue, if the MessageWriters of the Topics support it.
+func (w *failoverWriter) SetMessageGroupID(id string) {
+	w.groupID = id
+}
+
+// SetDeduplicationID sets the MessageDeduplicationId of a message sent to a
+// FIFO queue, if the MessageWriters of the Topics support it.
+func (w *failoverWriter) SetDeduplicationID(id string) {
+	w.deduplicationID = id
+}
+
+// Close publishes the message to the primary Topic, and to the secondary
+// Topic if it failed.
+func (w *failoverWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	err := w.publish(w.primary)
+	if err == nil || !w.config.shouldFailover(err) {
+		return err
+	}
+
+	w.config.logger.Logf(logger.Warn, "publishing to secondary topic, primary failed: %s", err)
+	secondaryErr := w.publish(w.secondary)
+	if w.config.metrics != nil {
+		w.config.metrics.ObserveFailover(w.config.destination, secondaryErr)
+	}
+	if secondaryErr != nil {
+		return fmt.Errorf("cannot publish to secondary topic after primary failed with %q: %w", err, secondaryErr)
+	}
+
+	return nil
+}
+
+// publish writes the message to a new MessageWriter of `topic`, and closes
+// it.
+func (w *failoverWriter) publish(topic msg.Topic) error {
+	mw := topic.NewWriter(w.ctx)
+
+	attrs := mw.Attributes()
+	for k, v := range w.attributes {
+		(*attrs)[k] = append([]string(nil), v...)
+	}
+	if d, ok := mw.(interface{ SetDelay(time.Duration) }); ok && w.delay != nil {
+		d.SetDelay(*w.delay)
+	}
+	if g, ok := mw.(interface{ SetMessageGroupID(string) }); ok && w.groupID != "" {
+		g.SetMessageGroupID(w.groupID)
+	}
+	if d, ok := mw.(interface{ SetDeduplicationID(string) }); ok && w.deduplicationID != "" {
+		d.SetDeduplicationID(w.deduplicationID)
+	}
+
+	if _, err := mw.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+
+	return mw.Close()
+}
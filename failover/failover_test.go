@@ -0,0 +1,151 @@
+package failover
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// recordingWriter records the message it is closed with to its topic.
+type recordingWriter struct {
+	bytes.Buffer
+
+	topic      *recordingTopic
+	attributes msg.Attributes
+	delay      time.Duration
+}
+
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+func (w *recordingWriter) SetDelay(delay time.Duration) {
+	w.delay = delay
+}
+
+func (w *recordingWriter) Close() error {
+	if w.topic.err != nil {
+		return w.topic.err
+	}
+	w.topic.sent = append(w.topic.sent, w)
+	return nil
+}
+
+// recordingTopic is a Topic whose writers fail with err, or record the
+// messages they send.
+type recordingTopic struct {
+	err  error
+	sent []*recordingWriter
+}
+
+func (t *recordingTopic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &recordingWriter{topic: t, attributes: msg.Attributes{}}
+}
+
+// failoverRecorder records the errors of failovers by destination.
+type failoverRecorder map[string][]error
+
+func (r failoverRecorder) ObserveFailover(destination string, err error) {
+	r[destination] = append(r[destination], err)
+}
+
+func send(topic msg.Topic) error {
+	w := topic.NewWriter(context.Background())
+	w.Attributes().Set("Event", "created")
+	w.(interface{ SetDelay(time.Duration) }).SetDelay(time.Minute)
+	w.Write([]byte("hello"))
+	return w.Close()
+}
+
+func TestTopic_Primary(t *testing.T) {
+	primary, secondary := &recordingTopic{}, &recordingTopic{}
+	rec := failoverRecorder{}
+	topic := Topic(primary, secondary, WithMetrics(rec, "events"), WithLogger(logger.Nop))
+
+	if err := send(topic); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(primary.sent) != 1 || len(secondary.sent) != 0 {
+		t.Fatalf("Expected 1 message sent to the primary topic, got %d and %d", len(primary.sent), len(secondary.sent))
+	}
+	if len(rec) != 0 {
+		t.Errorf("Expected no failover, got %v", rec)
+	}
+}
+
+func TestTopic_Failover(t *testing.T) {
+	primary := &recordingTopic{err: errors.New("service unavailable")}
+	secondary := &recordingTopic{}
+	rec := failoverRecorder{}
+	topic := Topic(primary, secondary, WithMetrics(rec, "events"), WithLogger(logger.Nop))
+
+	if err := send(topic); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(secondary.sent) != 1 {
+		t.Fatalf("Expected 1 message sent to the secondary topic, got %d", len(secondary.sent))
+	}
+
+	w := secondary.sent[0]
+	if body := w.String(); body != "hello" {
+		t.Errorf("Expected body %q, got %q", "hello", body)
+	}
+	if v := w.attributes.Get("Event"); v != "created" {
+		t.Errorf("Expected attribute Event %q, got %q", "created", v)
+	}
+	if w.delay != time.Minute {
+		t.Errorf("Expected delay %s, got %s", time.Minute, w.delay)
+	}
+	if errs := rec["events"]; len(errs) != 1 || errs[0] != nil {
+		t.Errorf("Expected 1 successful failover, got %v", errs)
+	}
+}
+
+func TestTopic_SecondaryFails(t *testing.T) {
+	outage := errors.New("service unavailable")
+	primary, secondary := &recordingTopic{err: outage}, &recordingTopic{err: outage}
+	rec := failoverRecorder{}
+	topic := Topic(primary, secondary, WithMetrics(rec, "events"), WithLogger(logger.Nop))
+
+	if err := send(topic); !errors.Is(err, outage) {
+		t.Fatalf("Expected error wrapping %v, got %v", outage, err)
+	}
+	if errs := rec["events"]; len(errs) != 1 || errs[0] != outage {
+		t.Errorf("Expected 1 failed failover, got %v", errs)
+	}
+}
+
+func TestTopic_ShouldFailover(t *testing.T) {
+	rejected := errors.New("invalid message")
+	primary, secondary := &recordingTopic{err: rejected}, &recordingTopic{}
+	topic := Topic(primary, secondary, WithLogger(logger.Nop), WithShouldFailover(func(err error) bool {
+		return err != rejected
+	}))
+
+	if err := send(topic); err != rejected {
+		t.Fatalf("Expected error %v, got %v", rejected, err)
+	}
+	if len(secondary.sent) != 0 {
+		t.Errorf("Expected no message sent to the secondary topic, got %d", len(secondary.sent))
+	}
+}
+
+func TestTopic_WriteAfterClose(t *testing.T) {
+	topic := Topic(&recordingTopic{}, &recordingTopic{})
+
+	w := topic.NewWriter(context.Background())
+	if err := w.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := w.Write([]byte("hello")); err != msg.ErrClosedMessageWriter {
+		t.Errorf("Expected %v, got %v", msg.ErrClosedMessageWriter, err)
+	}
+	if err := w.Close(); err != msg.ErrClosedMessageWriter {
+		t.Errorf("Expected %v, got %v", msg.ErrClosedMessageWriter, err)
+	}
+}
@@ -3,8 +3,13 @@ module github.com/hdtradeservices/go-aws-msg
 go 1.12
 
 require (
-	github.com/aws/aws-sdk-go v1.20.20
+	github.com/aws/aws-lambda-go v1.28.0
+	github.com/aws/aws-sdk-go v1.44.332
+	github.com/aws/aws-xray-sdk-go v1.7.0
 	github.com/hdtradeservices/go-msg v0.0.0-20230330182712-1df65f858829
-	github.com/stretchr/testify v1.3.0 // indirect
-	golang.org/x/net v0.0.0-20190628185345-da137c7871d7 // indirect
+	github.com/prometheus/client_golang v1.11.1
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+	google.golang.org/protobuf v1.26.0
 )
@@ -0,0 +1,210 @@
+// Package gzip compresses message bodies, so that large payloads, e.g. JSON
+// documents, fit within the 256 KB limit of SQS and SNS messages.
+//
+// Compressor wraps a Topic so that bodies larger than a threshold are
+// compressed, with the Content-Encoding attribute set to "gzip".
+// Decompressor wraps a Receiver so that such messages are decompressed
+// before being received, while other messages are received as is:
+//
+//	topic = gzip.Compressor(topic, 64*1024)
+//
+//	srv.Serve(ctx, gzip.Decompressor(receiver))
+//
+// Other algorithms, e.g. zstd or snappy, can be used by implementing a Codec,
+// passing it to CompressorWithCodec, and registering it with Register so
+// that Decompressor recognizes its name in the Content-Encoding attribute.
+//
+// Compressed bodies are base64-encoded, so they can be sent to SQS and SNS.
+// When used with a Topic which encodes bodies itself, e.g. created with
+// sns.NewTopic, the Receiver must decode them before decompressing them.
+package gzip
+
+import (
+	"bytes"
+	gz "compress/gzip"
+	"context"
+	"encoding/base64"
+	"io"
+	"sync"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+const (
+	// EncodingAttribute is the message attribute set to Encoding
+	// when the body of a message is compressed.
+	EncodingAttribute = "Content-Encoding"
+
+	// Encoding is the value of EncodingAttribute for bodies
+	// compressed with gzip.
+	Encoding = "gzip"
+)
+
+// Codec is a compression algorithm.
+//
+// Its methods may be called concurrently from several goroutines.
+type Codec interface {
+	// Name returns the name of the algorithm, set as the Content-Encoding
+	// attribute of the messages it compressed, e.g. "zstd".
+	Name() string
+
+	// NewWriter returns a WriteCloser compressing the data written to it
+	// into w, flushing it on Close.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader returns a Reader decompressing the data read from r.
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// Gzip is the Codec compressing with gzip, used by Compressor.
+var Gzip Codec = gzipCodec{}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+	return Encoding
+}
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gz.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.Reader, error) {
+	return gz.NewReader(r)
+}
+
+var (
+	codecsMux sync.RWMutex
+	codecs    = map[string]Codec{Encoding: Gzip}
+)
+
+// Register makes Decompressor decompress the messages whose Content-Encoding
+// attribute is the name of `c`, replacing any Codec registered with the same
+// name. It is typically called from an init function.
+func Register(c Codec) {
+	codecsMux.Lock()
+	defer codecsMux.Unlock()
+
+	codecs[c.Name()] = c
+}
+
+// lookupCodec returns the Codec registered as `name`, or nil.
+func lookupCodec(name string) Codec {
+	codecsMux.RLock()
+	defer codecsMux.RUnlock()
+
+	return codecs[name]
+}
+
+// Compressor wraps a topic with another which compresses the body of each
+// Message larger than `threshold` bytes with gzip. Smaller bodies are not
+// worth the cost of compressing and decompressing them, and are sent as is.
+func Compressor(next msg.Topic, threshold int) msg.Topic {
+	return CompressorWithCodec(next, threshold, Gzip)
+}
+
+// CompressorWithCodec is like Compressor, compressing bodies with `c`.
+// Receivers must Register `c` to decompress them.
+func CompressorWithCodec(next msg.Topic, threshold int, c Codec) msg.Topic {
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &compressWriter{
+			Next:      next.NewWriter(ctx),
+			threshold: threshold,
+			codec:     c,
+		}
+	})
+}
+
+type compressWriter struct {
+	Next      msg.MessageWriter
+	threshold int
+	codec     Codec
+
+	buf    bytes.Buffer
+	closed bool
+	mux    sync.Mutex
+}
+
+// Attributes returns the attributes associated with the MessageWriter.
+func (w *compressWriter) Attributes() *msg.Attributes {
+	return w.Next.Attributes()
+}
+
+// Close compresses the contents of the buffer if it is larger than the
+// threshold, before writing them to the next MessageWriter.
+func (w *compressWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	body := w.buf.Bytes()
+	if len(body) > w.threshold {
+		var compressed bytes.Buffer
+
+		enc := base64.NewEncoder(base64.StdEncoding, &compressed)
+		zw, err := w.codec.NewWriter(enc)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+
+		attrs := *w.Attributes()
+		attrs[EncodingAttribute] = []string{w.codec.Name()}
+		body = compressed.Bytes()
+	}
+
+	if _, err := w.Next.Write(body); err != nil {
+		return err
+	}
+	return w.Next.Close()
+}
+
+// Write writes bytes to an internal buffer.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(b)
+}
+
+// Decompressor wraps a msg.Receiver with decompression of the messages
+// whose Content-Encoding attribute is the name of a registered Codec, e.g.
+// "gzip". Other messages are received as is.
+//
+// Messages whose body cannot be decompressed are not received and the error
+// is returned. Errors further in the body are returned by the Read calls of
+// the receiver.
+func Decompressor(next msg.Receiver) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		c := lookupCodec(m.Attributes.Get(EncodingAttribute))
+		if c == nil {
+			return next.Receive(ctx, m)
+		}
+
+		r, err := c.NewReader(base64.NewDecoder(base64.StdEncoding, m.Body))
+		if err != nil {
+			return err
+		}
+		if closer, ok := r.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		m.Body = r
+		return next.Receive(ctx, m)
+	})
+}
@@ -0,0 +1,145 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// recordingWriter is a msg.MessageWriter recording the message
+// it was closed with.
+type recordingWriter struct {
+	bytes.Buffer
+
+	attributes msg.Attributes
+	closed     chan *msg.Message
+}
+
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed <- &msg.Message{Attributes: w.attributes, Body: &w.Buffer}
+	return nil
+}
+
+// Tests that bodies larger than the threshold are compressed by Compressor,
+// and that Decompressor receives every message with its original body.
+func TestCompressorAndDecompressor(t *testing.T) {
+	cases := map[string]struct {
+		body       string
+		compressed bool
+	}{
+		"small": {"hello", false},
+		"large": {strings.Repeat(`{"hello":"world"}`, 1000), true},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			closed := make(chan *msg.Message, 1)
+			topic := Compressor(msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+				return &recordingWriter{attributes: msg.Attributes{}, closed: closed}
+			}), 1024)
+
+			w := topic.NewWriter(context.Background())
+			w.Write([]byte(c.body))
+			if err := w.Close(); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			m := <-closed
+
+			size := m.Body.(*bytes.Buffer).Len()
+			if compressed := m.Attributes.Get(EncodingAttribute) == Encoding; compressed != c.compressed {
+				t.Errorf("Expected compressed to be %v, got attributes %v", c.compressed, m.Attributes)
+			}
+			if c.compressed && size >= len(c.body)/10 {
+				t.Errorf("Expected the body to be compressed, got %d bytes out of %d", size, len(c.body))
+			}
+
+			var received string
+			r := Decompressor(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+				body, err := ioutil.ReadAll(m.Body)
+				received = string(body)
+				return err
+			}))
+			if err := r.Receive(context.Background(), m); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if received != c.body {
+				t.Errorf("Expected the original body, got %d bytes", len(received))
+			}
+		})
+	}
+}
+
+// Tests that Decompressor returns an error for bodies which are not gzip data.
+func TestDecompressor_InvalidBody(t *testing.T) {
+	m := &msg.Message{Attributes: msg.Attributes{}, Body: bytes.NewBufferString("aGVsbG8=")}
+	m.Attributes.Set(EncodingAttribute, Encoding)
+
+	r := Decompressor(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		t.Errorf("Expected the message not to be received")
+		return nil
+	}))
+	if err := r.Receive(context.Background(), m); err == nil {
+		t.Errorf("Expected an error, got nil")
+	}
+}
+
+// deflateCodec is a Codec compressing with DEFLATE.
+type deflateCodec struct{}
+
+func (deflateCodec) Name() string { return "deflate" }
+
+func (deflateCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.BestCompression)
+}
+
+func (deflateCodec) NewReader(r io.Reader) (io.Reader, error) {
+	return flate.NewReader(r), nil
+}
+
+// Tests that bodies compressed with a registered Codec are decompressed,
+// while those with an unknown Content-Encoding are received as is.
+func TestCompressorWithCodec(t *testing.T) {
+	Register(deflateCodec{})
+
+	closed := make(chan *msg.Message, 1)
+	topic := CompressorWithCodec(msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &recordingWriter{attributes: msg.Attributes{}, closed: closed}
+	}), 0, deflateCodec{})
+
+	body := strings.Repeat("hello ", 100)
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	m := <-closed
+	if m.Attributes.Get(EncodingAttribute) != "deflate" {
+		t.Errorf("Expected the codec name to be set, got %v", m.Attributes)
+	}
+
+	var received string
+	r := Decompressor(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b, err := ioutil.ReadAll(m.Body)
+		received = string(b)
+		return err
+	}))
+	if err := r.Receive(context.Background(), m); err != nil || received != body {
+		t.Errorf("Expected the original body, got %d bytes, %v", len(received), err)
+	}
+
+	m = &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader("lz4 data")}
+	m.Attributes.Set(EncodingAttribute, "lz4")
+	if err := r.Receive(context.Background(), m); err != nil || received != "lz4 data" {
+		t.Errorf("Expected the body to be received as is, got %q, %v", received, err)
+	}
+}
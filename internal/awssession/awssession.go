@@ -0,0 +1,38 @@
+// Package awssession creates the AWS sessions the sqs, sns and kinesis
+// packages build their clients from, so that they all refresh assumed
+// credentials the same way.
+package awssession
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// webIdentityExpiryWindow is how long before they expire the credentials
+// assumed with a web identity token are refreshed, so that no request is
+// signed with credentials expiring while it is in flight.
+const webIdentityExpiryWindow = 5 * time.Minute
+
+// New returns a session created from conf. The shared config file is loaded
+// if AWS_SDK_LOAD_CONFIG is set, or a named `profile` is passed; otherwise,
+// the profile in AWS_PROFILE is used.
+func New(conf aws.Config, profile string) (*session.Session, error) {
+	sharedConfigState := session.SharedConfigStateFromEnv
+	if profile != "" {
+		sharedConfigState = session.SharedConfigEnable
+	}
+
+	return session.NewSessionWithOptions(session.Options{
+		Config:            conf,
+		Profile:           profile,
+		SharedConfigState: sharedConfigState,
+		CredentialsProviderOptions: &session.CredentialsProviderOptions{
+			WebIdentityRoleProviderOptions: func(p *stscreds.WebIdentityRoleProvider) {
+				p.ExpiryWindow = webIdentityExpiryWindow
+			},
+		},
+	})
+}
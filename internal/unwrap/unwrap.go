@@ -0,0 +1,23 @@
+// Package unwrap walks chains of msg.MessageWriters wrapping one another,
+// so that the sqs and sns packages can reach their own MessageWriters
+// behind the writers of middlewares.
+package unwrap
+
+import msg "github.com/hdtradeservices/go-msg"
+
+// Find returns the first MessageWriter for which match returns true,
+// starting from `w` and following the Unwrap methods of the writers
+// wrapping another one, or nil if there is none.
+func Find(w msg.MessageWriter, match func(msg.MessageWriter) bool) msg.MessageWriter {
+	for {
+		if match(w) {
+			return w
+		}
+
+		u, ok := w.(interface{ Unwrap() msg.MessageWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+}
@@ -0,0 +1,49 @@
+package kinesis
+
+import (
+	"context"
+	"sync"
+)
+
+// Checkpointer stores the sequence number of the last record of each shard
+// processed by a Server, so that a Server resumes consuming a shard after
+// the last record it processed once restarted.
+//
+// It must be safe for concurrent use, as shards are consumed concurrently.
+type Checkpointer interface {
+	// Checkpoint returns the sequence number of the last record of the shard
+	// `shardID` processed, or "" if none was.
+	Checkpoint(ctx context.Context, shardID string) (string, error)
+	// SetCheckpoint stores the sequence number of the last record of the
+	// shard `shardID` processed.
+	SetCheckpoint(ctx context.Context, shardID, sequenceNumber string) error
+}
+
+// MemoryCheckpointer is a Checkpointer keeping sequence numbers in memory.
+// It does not survive restarts, but lets a Server started again in the same
+// process resume where it stopped.
+type MemoryCheckpointer struct {
+	mux       sync.Mutex
+	sequences map[string]string
+}
+
+// Checkpoint returns the sequence number stored for `shardID`.
+func (c *MemoryCheckpointer) Checkpoint(ctx context.Context, shardID string) (string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.sequences[shardID], nil
+}
+
+// SetCheckpoint stores `sequenceNumber` for `shardID`.
+func (c *MemoryCheckpointer) SetCheckpoint(ctx context.Context, shardID, sequenceNumber string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.sequences == nil {
+		c.sequences = make(map[string]string)
+	}
+	c.sequences[shardID] = sequenceNumber
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package kinesis
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// WithEnhancedFanOut makes the `Server` consume shards with enhanced
+// fan-out, as the consumer `consumerARN` registered with
+// RegisterStreamConsumer, instead of polling them with GetRecords: records
+// are pushed to the Server as soon as they are written, with a dedicated
+// throughput per consumer.
+func WithEnhancedFanOut(consumerARN string) Option {
+	return func(s *Server) error {
+		if consumerARN == "" {
+			return errors.New("consumer ARN must not be empty")
+		}
+
+		s.consumerARN = consumerARN
+
+		return nil
+	}
+}
+
+// subscribeToShard consumes the shard `shardID` with SubscribeToShard calls,
+// each of which lasts up to 5 minutes. It returns true once the shard was
+// consumed entirely, false if the Server was shut down.
+func (s *Server) subscribeToShard(r msg.Receiver, shardID string) (bool, error) {
+	seq, err := s.startingSequence(shardID)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		if s.serverCtx.Err() != nil {
+			return false, nil
+		}
+
+		position := &kinesis.StartingPosition{Type: aws.String(s.startingPosition)}
+		if seq != "" {
+			position = &kinesis.StartingPosition{
+				Type:           aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber),
+				SequenceNumber: aws.String(seq),
+			}
+		}
+
+		out, err := s.Svc.SubscribeToShardWithContext(s.serverCtx, &kinesis.SubscribeToShardInput{
+			ConsumerARN:      aws.String(s.consumerARN),
+			ShardId:          aws.String(shardID),
+			StartingPosition: position,
+		})
+		if err != nil {
+			if s.serverCtx.Err() != nil {
+				return false, nil
+			}
+			return false, fmt.Errorf("SubscribeToShard: %w", err)
+		}
+
+		finished, ok := s.receiveEvents(r, shardID, out.EventStream, &seq)
+		out.EventStream.Close()
+		if !ok {
+			return false, nil
+		}
+		if finished {
+			return true, nil
+		}
+		if err := out.EventStream.Err(); err != nil {
+			s.logf(logger.Warn, "subscription to shard %s of stream %s failed, subscribing again: %s", shardID, s.StreamName, err)
+		}
+	}
+}
+
+// receiveEvents passes the records of the events of `stream` to `r`, until
+// the stream ends, and keeps the sequence number of the last record
+// processed in `seq`. It returns true if the shard was consumed entirely,
+// and false if the Server was shut down.
+func (s *Server) receiveEvents(r msg.Receiver, shardID string, stream *kinesis.SubscribeToShardEventStream, seq *string) (finished, ok bool) {
+	for {
+		select {
+		case <-s.serverCtx.Done():
+			return false, false
+
+		case event, open := <-stream.Events():
+			if !open {
+				return false, true
+			}
+
+			e, isRecords := event.(*kinesis.SubscribeToShardEvent)
+			if !isRecords {
+				continue
+			}
+
+			last, ok := s.receiveRecords(r, shardID, e.Records)
+			if last != "" {
+				*seq = last
+			}
+			if !ok {
+				return false, false
+			}
+
+			// the continuation is nil once the end of a closed shard is reached
+			if e.ContinuationSequenceNumber == nil {
+				return true, true
+			}
+			*seq = aws.StringValue(e.ContinuationSequenceNumber)
+		}
+	}
+}
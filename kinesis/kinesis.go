@@ -0,0 +1,63 @@
+// Package kinesis implements msg.Topic and msg.Server for Amazon Kinesis
+// Data Streams, for ordered, high-throughput streams to be produced and
+// consumed with the same programming model as SQS queues.
+//
+// A Topic writes each message as a record of a stream, partitioned by one of
+// its attributes. A Server consumes every shard of a stream, in order,
+// either by polling it with GetRecords, or with enhanced fan-out, passing
+// each record to a receiver as a message holding its data:
+//
+//	topic, err := kinesis.NewTopic("orders", kinesis.WithPartitionKeyAttribute("Customer-Id"))
+//
+//	srv, err := kinesis.NewServer("orders", kinesis.WithCheckpointer(checkpointer))
+//	srv.Serve(ctx, receiver)
+//
+// Kinesis records have no attributes: the attributes of the messages written
+// to a Topic are not sent, and the messages received by a Server have the
+// attributes describing their record, e.g. PartitionKeyAttribute.
+package kinesis
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hdtradeservices/go-aws-msg/internal/awssession"
+)
+
+// The attributes of the messages received by a Server.
+const (
+	// PartitionKeyAttribute is the partition key of the record.
+	PartitionKeyAttribute = "Partition-Key"
+	// SequenceNumberAttribute is the sequence number of the record in its shard.
+	SequenceNumberAttribute = "Sequence-Number"
+	// ShardIDAttribute is the ID of the shard of the record.
+	ShardIDAttribute = "Shard-Id"
+	// ArrivalTimeAttribute is the approximate time the record was written
+	// to the stream, formatted as RFC 3339.
+	ArrivalTimeAttribute = "Approximate-Arrival-Timestamp"
+)
+
+// newSession returns the session NewServer and NewTopic create their Kinesis
+// client from, configured from the environment. The region defaults to
+// us-west-2.
+func newSession() (*session.Session, error) {
+	conf := aws.Config{}
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		conf.Region = aws.String(r)
+	}
+	if url := os.Getenv("KINESIS_ENDPOINT"); url != "" {
+		conf.Endpoint = aws.String(url)
+	}
+
+	sess, err := awssession.New(conf, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String("us-west-2")
+	}
+
+	return sess, nil
+}
@@ -0,0 +1,277 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// mockKinesisAPI serves the records of shards from memory. The iterator of
+// a shard is its ID and the index of its next record. Shards in `closed`
+// have no iterator once their records were read.
+type mockKinesisAPI struct {
+	kinesisiface.KinesisAPI
+
+	shards  []*kinesis.Shard
+	records map[string][]*kinesis.Record
+	closed  map[string]bool
+
+	mux  sync.Mutex
+	puts []*kinesis.PutRecordInput
+}
+
+func (s *mockKinesisAPI) ListShardsWithContext(ctx aws.Context, input *kinesis.ListShardsInput, opts ...request.Option) (*kinesis.ListShardsOutput, error) {
+	return &kinesis.ListShardsOutput{Shards: s.shards}, nil
+}
+
+func (s *mockKinesisAPI) GetShardIteratorWithContext(ctx aws.Context, input *kinesis.GetShardIteratorInput, opts ...request.Option) (*kinesis.GetShardIteratorOutput, error) {
+	next := 0
+	if aws.StringValue(input.ShardIteratorType) == kinesis.ShardIteratorTypeAfterSequenceNumber {
+		for i, r := range s.records[*input.ShardId] {
+			if *r.SequenceNumber == *input.StartingSequenceNumber {
+				next = i + 1
+			}
+		}
+	}
+	return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String(*input.ShardId + "/" + string(rune('0'+next)))}, nil
+}
+
+func (s *mockKinesisAPI) GetRecordsWithContext(ctx aws.Context, input *kinesis.GetRecordsInput, opts ...request.Option) (*kinesis.GetRecordsOutput, error) {
+	parts := strings.Split(*input.ShardIterator, "/")
+	shardID, next := parts[0], int(parts[1][0]-'0')
+
+	records := s.records[shardID][next:]
+	out := &kinesis.GetRecordsOutput{Records: records}
+	if !s.closed[shardID] || len(records) > 0 {
+		out.NextShardIterator = aws.String(shardID + "/" + string(rune('0'+len(s.records[shardID]))))
+	}
+	return out, nil
+}
+
+func (s *mockKinesisAPI) PutRecordWithContext(ctx aws.Context, input *kinesis.PutRecordInput, opts ...request.Option) (*kinesis.PutRecordOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.puts = append(s.puts, input)
+	return &kinesis.PutRecordOutput{}, nil
+}
+
+func newRecord(seq, data string) *kinesis.Record {
+	return &kinesis.Record{
+		SequenceNumber:              aws.String(seq),
+		PartitionKey:                aws.String("customer-1"),
+		Data:                        []byte(data),
+		ApproximateArrivalTimestamp: aws.Time(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+}
+
+// newResharedStream returns a stream whose closed shard-0 was split into
+// shard-1 and shard-2.
+func newResharedStream() *mockKinesisAPI {
+	return &mockKinesisAPI{
+		shards: []*kinesis.Shard{
+			{ShardId: aws.String("shard-1"), ParentShardId: aws.String("shard-0")},
+			{ShardId: aws.String("shard-0")},
+			{ShardId: aws.String("shard-2"), ParentShardId: aws.String("shard-0")},
+		},
+		records: map[string][]*kinesis.Record{
+			"shard-0": {newRecord("1", "first"), newRecord("2", "second")},
+			"shard-1": {newRecord("3", "third")},
+			"shard-2": {},
+		},
+		closed: map[string]bool{"shard-0": true},
+	}
+}
+
+// recordingReceiver records the messages it receives, failing the first
+// time it receives each message whose body is in `failOnce`.
+type recordingReceiver struct {
+	mux      sync.Mutex
+	bodies   []string
+	failOnce map[string]bool
+	received chan *msg.Message
+}
+
+func (r *recordingReceiver) Receive(ctx context.Context, m *msg.Message) error {
+	b, _ := ioutil.ReadAll(m.Body)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.failOnce[string(b)] {
+		delete(r.failOnce, string(b))
+		return errors.New("failed")
+	}
+	r.bodies = append(r.bodies, string(b))
+	r.received <- m
+	return nil
+}
+
+// serve serves the stream of `svc` with a Server created with `opts` until
+// `n` messages were received, returning them.
+func serve(t *testing.T, svc kinesisiface.KinesisAPI, r *recordingReceiver, n int, opts ...Option) []*msg.Message {
+	opts = append([]Option{
+		WithClient(svc),
+		WithStartingPosition(kinesis.ShardIteratorTypeTrimHorizon),
+		WithPollInterval(10 * time.Millisecond),
+		WithRetryDelay(10 * time.Millisecond),
+		WithLogger(logger.Nop),
+	}, opts...)
+	s, err := NewServer("orders", opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(context.Background(), r) }()
+
+	var messages []*msg.Message
+	for len(messages) < n {
+		select {
+		case m := <-r.received:
+			messages = append(messages, m)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after receiving %d messages", len(messages))
+		}
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if err := <-served; err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+
+	return messages
+}
+
+// Tests that the records of a shard are received in order, once its parent
+// was consumed entirely, that failed records are retried, and that shards
+// are checkpointed.
+func TestServer(t *testing.T) {
+	r := &recordingReceiver{failOnce: map[string]bool{"second": true}, received: make(chan *msg.Message, 10)}
+	checkpointer := &MemoryCheckpointer{}
+
+	messages := serve(t, newResharedStream(), r, 3, WithCheckpointer(checkpointer))
+
+	if strings.Join(r.bodies, ",") != "first,second,third" {
+		t.Errorf("Expected the records to be received in order, got %v", r.bodies)
+	}
+
+	m := messages[2]
+	expected := map[string]string{
+		PartitionKeyAttribute:   "customer-1",
+		SequenceNumberAttribute: "3",
+		ShardIDAttribute:        "shard-1",
+		ArrivalTimeAttribute:    "2021-01-01T00:00:00Z",
+	}
+	for k, v := range expected {
+		if m.Attributes.Get(k) != v {
+			t.Errorf("Expected attribute %s to be %q, got %q", k, v, m.Attributes.Get(k))
+		}
+	}
+
+	for shardID, seq := range map[string]string{"shard-0": "2", "shard-1": "3"} {
+		if got, _ := checkpointer.Checkpoint(context.Background(), shardID); got != seq {
+			t.Errorf("Expected %s to be checkpointed at %s, got %q", shardID, seq, got)
+		}
+	}
+}
+
+// Tests that a Server resumes consuming shards after their checkpoint.
+func TestServer_ResumesFromCheckpoint(t *testing.T) {
+	checkpointer := &MemoryCheckpointer{}
+	checkpointer.SetCheckpoint(context.Background(), "shard-0", "1")
+
+	r := &recordingReceiver{received: make(chan *msg.Message, 10)}
+	serve(t, newResharedStream(), r, 2, WithCheckpointer(checkpointer))
+
+	if strings.Join(r.bodies, ",") != "second,third" {
+		t.Errorf("Expected the records after the checkpoint to be received, got %v", r.bodies)
+	}
+}
+
+// eventStreamReader is a kinesis.SubscribeToShardEventStreamReader
+// reading events from a channel.
+type eventStreamReader struct {
+	events chan kinesis.SubscribeToShardEventStreamEvent
+}
+
+func (r *eventStreamReader) Events() <-chan kinesis.SubscribeToShardEventStreamEvent {
+	return r.events
+}
+
+func (r *eventStreamReader) Close() error { return nil }
+func (r *eventStreamReader) Err() error   { return nil }
+
+// fanOutKinesisAPI pushes the records of shards in a single event.
+type fanOutKinesisAPI struct {
+	*mockKinesisAPI
+}
+
+func (s *fanOutKinesisAPI) SubscribeToShardWithContext(ctx aws.Context, input *kinesis.SubscribeToShardInput, opts ...request.Option) (*kinesis.SubscribeToShardOutput, error) {
+	events := make(chan kinesis.SubscribeToShardEventStreamEvent, 1)
+	event := &kinesis.SubscribeToShardEvent{Records: s.records[*input.ShardId]}
+	if !s.closed[*input.ShardId] {
+		event.ContinuationSequenceNumber = aws.String("continuation")
+	}
+	events <- event
+	if s.closed[*input.ShardId] {
+		close(events)
+	}
+
+	stream := kinesis.NewSubscribeToShardEventStream(func(es *kinesis.SubscribeToShardEventStream) {
+		es.Reader = &eventStreamReader{events: events}
+		es.StreamCloser = ioutil.NopCloser(nil)
+	})
+	return &kinesis.SubscribeToShardOutput{EventStream: stream}, nil
+}
+
+func TestServer_WithEnhancedFanOut(t *testing.T) {
+	r := &recordingReceiver{received: make(chan *msg.Message, 10)}
+	serve(t, &fanOutKinesisAPI{newResharedStream()}, r, 3,
+		WithEnhancedFanOut("arn:aws:kinesis:us-west-2:123456789012:stream/orders/consumer/billing:1"))
+
+	if strings.Join(r.bodies, ",") != "first,second,third" {
+		t.Errorf("Expected the records to be received in order, got %v", r.bodies)
+	}
+}
+
+// Tests that records are partitioned by the partition key attribute.
+func TestTopic(t *testing.T) {
+	svc := &mockKinesisAPI{}
+	topic, err := NewTopic("orders", WithTopicClient(svc), WithPartitionKeyAttribute("Customer-Id"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for _, customer := range []string{"customer-1", ""} {
+		w := topic.NewWriter(context.Background())
+		if customer != "" {
+			w.Attributes().Set("Customer-Id", customer)
+		}
+		w.Write([]byte("hello"))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	if key := aws.StringValue(svc.puts[0].PartitionKey); key != "customer-1" {
+		t.Errorf("Expected partition key customer-1, got %q", key)
+	}
+	if key := aws.StringValue(svc.puts[1].PartitionKey); key == "" {
+		t.Errorf("Expected a random partition key")
+	}
+	if string(svc.puts[0].Data) != "hello" || aws.StringValue(svc.puts[0].StreamName) != "orders" {
+		t.Errorf("Unexpected record %v", svc.puts[0])
+	}
+}
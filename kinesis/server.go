@@ -0,0 +1,505 @@
+package kinesis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+const (
+	// defaultPollInterval is how long a Server waits before polling a shard
+	// again after an empty GetRecords call. Each shard supports 5 GetRecords
+	// calls per second.
+	defaultPollInterval = time.Second
+
+	// defaultRetryDelay is how long a Server waits before passing a record
+	// to the receiver again after it failed.
+	defaultRetryDelay = 5 * time.Second
+
+	// defaultMaxRecords is the maximum number of records returned by each
+	// GetRecords call.
+	defaultMaxRecords = 1000
+)
+
+// Server consumes every shard of a Kinesis stream, passing its records to a
+// receiver.
+//
+// The records of a shard are received one at a time, in order: a record the
+// receiver fails to process is retried, after a delay, until it succeeds,
+// blocking the following records of the shard. Shards are consumed
+// concurrently, the children of a shard once it was consumed entirely after
+// it was split or merged.
+type Server struct {
+	// Name of the stream
+	StreamName string
+	// Concrete instance of KinesisAPI
+	Svc kinesisiface.KinesisAPI
+
+	startingPosition string        // ShardIteratorType of shards without checkpoint
+	pollInterval     time.Duration // delay between polls of a shard without new records
+	retryDelay       time.Duration // delay before a failed record is received again
+	maxRecords       int64         // maximum number of records of each GetRecords call
+	consumerARN      string        // consumes shards with enhanced fan-out when set
+	checkpointer     Checkpointer  // stores the last record processed of each shard; may be nil
+	logger           logger.Logger // where the Server logs; logger.Default when nil
+
+	mux       sync.Mutex
+	started   map[string]bool // shards being or done consumed
+	finished  map[string]bool // shards consumed entirely
+	shardDone chan struct{}   // receives a value once a shard was consumed entirely
+
+	routines           sync.WaitGroup     // shard consumers, waited for by Shutdown
+	receiverCtx        context.Context    // context used to control the life of receivers
+	receiverCancelFunc context.CancelFunc // CancelFunc for all receivers
+	serverCtx          context.Context    // context used to control the life of the Server
+	serverCancelFunc   context.CancelFunc // CancelFunc to signal the server should stop consuming shards
+}
+
+// Option is the signature that modifies a `Server` to set some configuration
+type Option func(*Server) error
+
+// NewServer returns a Server consuming the stream `streamName`, with a
+// Kinesis client configured from the environment. Shards without checkpoint
+// are consumed from their latest record, see WithStartingPosition.
+func NewServer(streamName string, opts ...Option) (*Server, error) {
+	sess, err := newSession()
+	if err != nil {
+		return nil, err
+	}
+
+	serverCtx, serverCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	s := &Server{
+		StreamName:         streamName,
+		Svc:                kinesis.New(sess),
+		startingPosition:   kinesis.ShardIteratorTypeLatest,
+		pollInterval:       defaultPollInterval,
+		retryDelay:         defaultRetryDelay,
+		maxRecords:         defaultMaxRecords,
+		started:            make(map[string]bool),
+		finished:           make(map[string]bool),
+		shardDone:          make(chan struct{}, 1),
+		serverCtx:          serverCtx,
+		serverCancelFunc:   serverCancelFunc,
+		receiverCtx:        receiverCtx,
+		receiverCancelFunc: receiverCancelFunc,
+	}
+
+	for _, opt := range opts {
+		if err = opt(s); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	return s, nil
+}
+
+// WithClient makes the `Server` use `svc` instead of the Kinesis client
+// built by NewServer from the environment.
+func WithClient(svc kinesisiface.KinesisAPI) Option {
+	return func(s *Server) error {
+		if svc == nil {
+			return errors.New("client must not be nil")
+		}
+
+		s.Svc = svc
+
+		return nil
+	}
+}
+
+// WithStartingPosition sets where the `Server` starts consuming shards
+// without checkpoint: kinesis.ShardIteratorTypeLatest, the default, or
+// kinesis.ShardIteratorTypeTrimHorizon to consume every record retained.
+func WithStartingPosition(iteratorType string) Option {
+	return func(s *Server) error {
+		switch iteratorType {
+		case kinesis.ShardIteratorTypeLatest, kinesis.ShardIteratorTypeTrimHorizon:
+		default:
+			return fmt.Errorf("unsupported starting position %q", iteratorType)
+		}
+
+		s.startingPosition = iteratorType
+
+		return nil
+	}
+}
+
+// WithPollInterval sets how long the `Server` waits before polling a shard
+// again after it returned no record, one second by default.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Server) error {
+		if d <= 0 {
+			return errors.New("poll interval must be positive")
+		}
+
+		s.pollInterval = d
+
+		return nil
+	}
+}
+
+// WithRetryDelay sets how long the `Server` waits before passing a record
+// the receiver failed to process to it again, 5 seconds by default.
+func WithRetryDelay(d time.Duration) Option {
+	return func(s *Server) error {
+		if d <= 0 {
+			return errors.New("retry delay must be positive")
+		}
+
+		s.retryDelay = d
+
+		return nil
+	}
+}
+
+// WithCheckpointer makes the `Server` store the sequence number of the last
+// record of each shard processed in `c`, and resume consuming shards after
+// it.
+func WithCheckpointer(c Checkpointer) Option {
+	return func(s *Server) error {
+		if c == nil {
+			return errors.New("checkpointer must not be nil")
+		}
+
+		s.checkpointer = c
+
+		return nil
+	}
+}
+
+// WithLogger sets the Logger the `Server` logs to, instead of logger.Default.
+func WithLogger(l logger.Logger) Option {
+	return func(s *Server) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+
+		s.logger = l
+
+		return nil
+	}
+}
+
+// Serve consumes the shards of the stream, passing their records to `r`,
+// until Shutdown is called, and returns msg.ErrServerClosed. It returns
+// the error of ListShards if the shards of the stream cannot be listed.
+func (s *Server) Serve(ctx context.Context, r msg.Receiver) error {
+	if s.serverCtx.Err() != nil {
+		return msg.ErrServerClosed
+	}
+
+	for {
+		if err := s.startShards(r); err != nil {
+			return err
+		}
+
+		select {
+		case <-s.serverCtx.Done():
+			return msg.ErrServerClosed
+		case <-s.shardDone:
+			// list the shards again, to consume the children of the shard
+		}
+	}
+}
+
+// Shutdown stops consuming shards, and waits for the records being received
+// to be processed. If ctx is done first, the contexts of the receivers are
+// canceled and the error of ctx is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.serverCancelFunc()
+
+	done := make(chan struct{})
+	go func() {
+		s.routines.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.receiverCancelFunc()
+		return ctx.Err()
+	}
+}
+
+// startShards lists the shards of the stream, and starts consuming those
+// which were not started and whose parents, if any, were consumed entirely.
+func (s *Server) startShards(r msg.Receiver) error {
+	shards, err := s.listShards()
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[aws.StringValue(shard.ShardId)] = true
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, shard := range shards {
+		id := aws.StringValue(shard.ShardId)
+		if s.started[id] {
+			continue
+		}
+
+		// parents which are no longer listed expired with their records
+		ready := true
+		for _, parent := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+			if p := aws.StringValue(parent); p != "" && listed[p] && !s.finished[p] {
+				ready = false
+			}
+		}
+		if !ready {
+			continue
+		}
+
+		s.started[id] = true
+		s.routines.Add(1)
+		go func() {
+			defer s.routines.Done()
+			s.consumeShard(r, id)
+		}()
+	}
+
+	return nil
+}
+
+// listShards returns every shard of the stream.
+func (s *Server) listShards() ([]*kinesis.Shard, error) {
+	var shards []*kinesis.Shard
+
+	input := &kinesis.ListShardsInput{StreamName: aws.String(s.StreamName)}
+	for {
+		out, err := s.Svc.ListShardsWithContext(s.serverCtx, input)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list shards of stream %s: %w", s.StreamName, err)
+		}
+		shards = append(shards, out.Shards...)
+
+		if out.NextToken == nil {
+			return shards, nil
+		}
+		input = &kinesis.ListShardsInput{NextToken: out.NextToken}
+	}
+}
+
+// consumeShard consumes the shard `shardID` until it is consumed entirely,
+// or the Server is shut down.
+func (s *Server) consumeShard(r msg.Receiver, shardID string) {
+	var err error
+	var finished bool
+	if s.consumerARN != "" {
+		finished, err = s.subscribeToShard(r, shardID)
+	} else {
+		finished, err = s.pollShard(r, shardID)
+	}
+
+	if err != nil {
+		s.logf(logger.Error, "stopped consuming shard %s of stream %s: %s", shardID, s.StreamName, err)
+
+		// let the next listing of the shards start the shard again
+		s.mux.Lock()
+		delete(s.started, shardID)
+		s.mux.Unlock()
+		s.wait(s.retryDelay)
+	}
+
+	if finished {
+		s.mux.Lock()
+		s.finished[shardID] = true
+		s.mux.Unlock()
+	}
+
+	if finished || err != nil {
+		select {
+		case s.shardDone <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// startingSequence returns the sequence number of the last record of the
+// shard `shardID` processed, or "" if there is none.
+func (s *Server) startingSequence(shardID string) (string, error) {
+	if s.checkpointer == nil {
+		return "", nil
+	}
+
+	seq, err := s.checkpointer.Checkpoint(s.serverCtx, shardID)
+	if err != nil {
+		return "", fmt.Errorf("cannot load checkpoint: %w", err)
+	}
+
+	return seq, nil
+}
+
+// pollShard consumes the shard `shardID` with GetRecords calls. It returns
+// true once the shard was consumed entirely, false if the Server was shut
+// down.
+func (s *Server) pollShard(r msg.Receiver, shardID string) (bool, error) {
+	seq, err := s.startingSequence(shardID)
+	if err != nil {
+		return false, err
+	}
+
+	iterator, err := s.shardIterator(shardID, seq)
+	if err != nil {
+		return false, err
+	}
+
+	for iterator != nil {
+		if s.serverCtx.Err() != nil {
+			return false, nil
+		}
+
+		out, err := s.Svc.GetRecordsWithContext(s.serverCtx, &kinesis.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         aws.Int64(s.maxRecords),
+		})
+		if err != nil {
+			if s.serverCtx.Err() != nil {
+				return false, nil
+			}
+
+			var aerr awserr.Error
+			if errors.As(err, &aerr) {
+				switch aerr.Code() {
+				case kinesis.ErrCodeExpiredIteratorException:
+					if iterator, err = s.shardIterator(shardID, seq); err != nil {
+						return false, err
+					}
+					continue
+				case kinesis.ErrCodeProvisionedThroughputExceededException:
+					s.wait(s.pollInterval)
+					continue
+				}
+			}
+
+			return false, fmt.Errorf("GetRecords: %w", err)
+		}
+
+		last, ok := s.receiveRecords(r, shardID, out.Records)
+		if !ok {
+			return false, nil
+		}
+		if last != "" {
+			seq = last
+		}
+
+		iterator = out.NextShardIterator
+		if len(out.Records) == 0 && iterator != nil {
+			s.wait(s.pollInterval)
+		}
+	}
+
+	return true, nil
+}
+
+// shardIterator returns an iterator of the shard `shardID`, after the
+// sequence number `seq` if set, or at the starting position of the Server.
+func (s *Server) shardIterator(shardID, seq string) (*string, error) {
+	input := &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(s.StreamName),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(s.startingPosition),
+	}
+	if seq != "" {
+		input.ShardIteratorType = aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber)
+		input.StartingSequenceNumber = aws.String(seq)
+	}
+
+	out, err := s.Svc.GetShardIteratorWithContext(s.serverCtx, input)
+	if err != nil {
+		return nil, fmt.Errorf("GetShardIterator: %w", err)
+	}
+
+	return out.ShardIterator, nil
+}
+
+// receiveRecords passes each of `records` to `r` in order, retrying each
+// until it succeeds, and checkpoints them. It returns the sequence number of
+// the last record processed, and false if the Server was shut down before
+// every record was processed.
+func (s *Server) receiveRecords(r msg.Receiver, shardID string, records []*kinesis.Record) (string, bool) {
+	var last string
+	for _, record := range records {
+		if !s.receiveRecord(r, shardID, record) {
+			return last, false
+		}
+		last = aws.StringValue(record.SequenceNumber)
+
+		if s.checkpointer != nil {
+			if err := s.checkpointer.SetCheckpoint(s.receiverCtx, shardID, last); err != nil {
+				// the record is received again if the Server restarts
+				s.logf(logger.Error, "cannot checkpoint shard %s at %s: %s", shardID, last, err)
+			}
+		}
+	}
+
+	return last, true
+}
+
+// receiveRecord passes `record` to `r` until it succeeds. It returns false
+// if the Server was shut down before.
+func (s *Server) receiveRecord(r msg.Receiver, shardID string, record *kinesis.Record) bool {
+	for {
+		m := &msg.Message{
+			Attributes: msg.Attributes{},
+			Body:       bytes.NewReader(record.Data),
+		}
+		m.Attributes.Set(PartitionKeyAttribute, aws.StringValue(record.PartitionKey))
+		m.Attributes.Set(SequenceNumberAttribute, aws.StringValue(record.SequenceNumber))
+		m.Attributes.Set(ShardIDAttribute, shardID)
+		if record.ApproximateArrivalTimestamp != nil {
+			m.Attributes.Set(ArrivalTimeAttribute, record.ApproximateArrivalTimestamp.UTC().Format(time.RFC3339))
+		}
+
+		err := r.Receive(s.receiverCtx, m)
+		if err == nil {
+			return true
+		}
+
+		s.logf(logger.Error, "cannot receive record %s of shard %s: %s", aws.StringValue(record.SequenceNumber), shardID, err)
+		if !s.wait(s.retryDelay) {
+			return false
+		}
+	}
+}
+
+// wait waits for `d`, returning false if the Server is shut down before.
+func (s *Server) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-s.serverCtx.Done():
+		return false
+	}
+}
+
+// logf logs a message at level to the Logger of the Server.
+func (s *Server) logf(level logger.Level, format string, args ...interface{}) {
+	l := s.logger
+	if l == nil {
+		l = logger.Default
+	}
+
+	l.Logf(level, format, args...)
+}
@@ -0,0 +1,165 @@
+package kinesis
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Topic writes messages as records of a Kinesis stream.
+type Topic struct {
+	// Name of the stream
+	StreamName string
+	// Concrete instance of KinesisAPI
+	Svc kinesisiface.KinesisAPI
+
+	partitionKeyAttribute string // attribute holding the partition key of records
+}
+
+// TopicOption is the signature that modifies a `Topic` to set some configuration
+type TopicOption func(*Topic) error
+
+// NewTopic returns a Topic writing records to the stream `streamName`, with
+// a Kinesis client configured from the environment. The partition key of
+// each record is the PartitionKeyAttribute of its message, see
+// WithPartitionKeyAttribute.
+func NewTopic(streamName string, opts ...TopicOption) (msg.Topic, error) {
+	sess, err := newSession()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Topic{
+		StreamName:            streamName,
+		Svc:                   kinesis.New(sess),
+		partitionKeyAttribute: PartitionKeyAttribute,
+	}
+
+	for _, opt := range opts {
+		if err = opt(t); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	return t, nil
+}
+
+// WithTopicClient makes the `Topic` use `svc` instead of the Kinesis client
+// built by NewTopic from the environment.
+func WithTopicClient(svc kinesisiface.KinesisAPI) TopicOption {
+	return func(t *Topic) error {
+		if svc == nil {
+			return errors.New("client must not be nil")
+		}
+
+		t.Svc = svc
+
+		return nil
+	}
+}
+
+// WithPartitionKeyAttribute makes the `Topic` use the attribute `name` of
+// messages, e.g. "Customer-Id", as the partition key of their record, so
+// that the records of a customer are consumed in order. Messages without the
+// attribute have a random partition key.
+func WithPartitionKeyAttribute(name string) TopicOption {
+	return func(t *Topic) error {
+		if name == "" {
+			return errors.New("partition key attribute must not be empty")
+		}
+
+		t.partitionKeyAttribute = name
+
+		return nil
+	}
+}
+
+// NewWriter returns a MessageWriter writing a record to the stream of the
+// Topic.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		attributes:            make(map[string][]string),
+		ctx:                   ctx,
+		svc:                   t.Svc,
+		streamName:            t.StreamName,
+		partitionKeyAttribute: t.partitionKeyAttribute,
+	}
+}
+
+// MessageWriter writes a record to a Kinesis stream.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	attributes msg.Attributes
+	buf        bytes.Buffer
+	closed     bool
+	mux        sync.Mutex
+
+	ctx                   context.Context
+	svc                   kinesisiface.KinesisAPI
+	streamName            string
+	partitionKeyAttribute string
+}
+
+// Attributes returns the attributes associated with the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// Close writes the contents of the buffer as a record, partitioned by the
+// partition key attribute of the message.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	partitionKey := w.attributes.Get(w.partitionKeyAttribute)
+	if partitionKey == "" {
+		var err error
+		if partitionKey, err = randomPartitionKey(); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.svc.PutRecordWithContext(w.ctx, &kinesis.PutRecordInput{
+		StreamName:   aws.String(w.streamName),
+		PartitionKey: aws.String(partitionKey),
+		Data:         w.buf.Bytes(),
+	})
+	return err
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
+
+// randomPartitionKey returns a random partition key, spreading records
+// evenly across shards.
+func randomPartitionKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,53 @@
+// Package kms encrypts message bodies client-side with envelope encryption,
+// for payloads which must not be readable by anyone with access to the
+// queue, e.g. containing PII, where SSE-SQS is not sufficient.
+//
+// Encrypter wraps a Topic so that the body of each message is encrypted
+// with AES-256-GCM, using a data key generated by AWS KMS under a given KMS
+// key. The data key, encrypted by KMS, travels with the message in its
+// attributes. Decrypter wraps a Receiver so that encrypted messages are
+// decrypted, having KMS decrypt their data key, before being received:
+//
+//	topic, _ := sqs.NewTopic(queueURL)
+//	topic = kms.Encrypter(topic, kmsClient, "alias/messages")
+//
+//	srv.Serve(ctx, kms.Decrypter(receiver, kmsClient))
+//
+// Encrypted bodies are base64-encoded, so they can be sent to SQS and SNS.
+// When used with a Topic which encodes bodies itself, e.g. created with
+// sns.NewTopic, the Receiver must decode them before decrypting them.
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+)
+
+const (
+	// AlgorithmAttribute is the message attribute holding the algorithm
+	// the body of a message was encrypted with.
+	AlgorithmAttribute = "Encryption-Algorithm"
+
+	// KeyAttribute is the message attribute holding the data key the body
+	// of a message was encrypted with, encrypted by KMS and base64-encoded.
+	KeyAttribute = "Encryption-Key"
+
+	// AlgorithmAES256GCM is the algorithm messages are encrypted with: the
+	// body is sealed with AES-256-GCM, prefixed by its random nonce.
+	AlgorithmAES256GCM = "AES-256-GCM"
+)
+
+// ErrUnsupportedAlgorithm is returned by a Decrypter receiving a message
+// encrypted with an algorithm other than AlgorithmAES256GCM.
+var ErrUnsupportedAlgorithm = errors.New("unsupported encryption algorithm")
+
+// newGCM returns the AES-256-GCM AEAD using key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
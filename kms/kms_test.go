@@ -0,0 +1,146 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// mockKMSAPI generates data keys whose "encrypted" form is the key
+// prefixed by the KMS key ID, and decrypts them if they have the prefix.
+type mockKMSAPI struct {
+	kmsiface.KMSAPI
+
+	keyID string
+}
+
+func (k *mockKMSAPI) GenerateDataKeyWithContext(ctx aws.Context, input *kms.GenerateDataKeyInput, opts ...request.Option) (*kms.GenerateDataKeyOutput, error) {
+	key := bytes.Repeat([]byte{7}, 32)
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          input.KeyId,
+		Plaintext:      key,
+		CiphertextBlob: append([]byte(aws.StringValue(input.KeyId)), key...),
+	}, nil
+}
+
+func (k *mockKMSAPI) DecryptWithContext(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+	if !bytes.HasPrefix(input.CiphertextBlob, []byte(k.keyID)) {
+		return nil, errors.New("AccessDeniedException")
+	}
+	return &kms.DecryptOutput{Plaintext: input.CiphertextBlob[len(k.keyID):]}, nil
+}
+
+// recordingWriter is a msg.MessageWriter recording the message
+// it was closed with.
+type recordingWriter struct {
+	bytes.Buffer
+
+	attributes msg.Attributes
+	closed     chan *msg.Message
+}
+
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed <- &msg.Message{Attributes: w.attributes, Body: &w.Buffer}
+	return nil
+}
+
+// encrypt returns the message published by an Encrypter for body.
+func encrypt(t *testing.T, svc kmsiface.KMSAPI, body string) *msg.Message {
+	closed := make(chan *msg.Message, 1)
+	topic := Encrypter(msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &recordingWriter{attributes: msg.Attributes{}, closed: closed}
+	}), svc, "alias/messages")
+
+	w := topic.NewWriter(context.Background())
+	w.Attributes().Set("Tenant", "acme")
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	return <-closed
+}
+
+// Tests that a message encrypted by Encrypter is decrypted by Decrypter.
+func TestEncrypterAndDecrypter(t *testing.T) {
+	svc := &mockKMSAPI{keyID: "alias/messages"}
+	m := encrypt(t, svc, "ssn=123-45-6789")
+
+	if m.Attributes.Get(AlgorithmAttribute) != AlgorithmAES256GCM || m.Attributes.Get(KeyAttribute) == "" {
+		t.Errorf("Expected encryption attributes to be set, got %v", m.Attributes)
+	}
+	if bytes.Contains(m.Body.(*bytes.Buffer).Bytes(), []byte("123-45-6789")) {
+		t.Errorf("Expected the body to be encrypted")
+	}
+
+	var received string
+	r := Decrypter(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, err := ioutil.ReadAll(m.Body)
+		received = string(body)
+		if m.Attributes.Get("Tenant") != "acme" {
+			t.Errorf("Expected the attributes to be kept, got %v", m.Attributes)
+		}
+		return err
+	}), svc)
+
+	if err := r.Receive(context.Background(), m); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if received != "ssn=123-45-6789" {
+		t.Errorf("Expected the decrypted body, got %q", received)
+	}
+}
+
+// Tests that Decrypter returns an error for messages it cannot decrypt,
+// and passes unencrypted messages through.
+func TestDecrypter(t *testing.T) {
+	received := 0
+	next := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received++
+		return nil
+	})
+
+	t.Run("unencrypted", func(t *testing.T) {
+		m := &msg.Message{Attributes: msg.Attributes{}, Body: bytes.NewBufferString("hello")}
+		if err := Decrypter(next, &mockKMSAPI{}).Receive(context.Background(), m); err != nil || received != 1 {
+			t.Errorf("Expected the message to be received, got %v", err)
+		}
+	})
+
+	t.Run("access denied", func(t *testing.T) {
+		m := encrypt(t, &mockKMSAPI{}, "hello")
+		if err := Decrypter(next, &mockKMSAPI{keyID: "alias/other"}).Receive(context.Background(), m); err == nil || received != 1 {
+			t.Errorf("Expected an error, got %v", err)
+		}
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		m := &msg.Message{Attributes: msg.Attributes{}, Body: bytes.NewBufferString("hello")}
+		m.Attributes.Set(AlgorithmAttribute, "ROT13")
+		if err := Decrypter(next, &mockKMSAPI{}).Receive(context.Background(), m); !errors.Is(err, ErrUnsupportedAlgorithm) {
+			t.Errorf("Expected ErrUnsupportedAlgorithm, got %v", err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		svc := &mockKMSAPI{keyID: "alias/messages"}
+		m := encrypt(t, svc, "hello")
+		body := m.Body.(*bytes.Buffer).Bytes()
+		body[len(body)-5] ^= 1
+		if err := Decrypter(next, svc).Receive(context.Background(), m); err == nil {
+			t.Errorf("Expected an error for a tampered body")
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Decrypter wraps a msg.Receiver with decryption of messages encrypted by
+// an Encrypter. Messages without the AlgorithmAttribute are received as is.
+//
+// Messages which cannot be decrypted, e.g. because KMS refuses to decrypt
+// their data key, are not received and the error is returned, so that they
+// are retried.
+func Decrypter(next msg.Receiver, svc kmsiface.KMSAPI) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		algorithm := m.Attributes.Get(AlgorithmAttribute)
+		if algorithm == "" {
+			return next.Receive(ctx, m)
+		}
+		if algorithm != AlgorithmAES256GCM {
+			return fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, algorithm)
+		}
+
+		body, err := decrypt(ctx, svc, m)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt message: %w", err)
+		}
+		m.Body = bytes.NewReader(body)
+
+		return next.Receive(ctx, m)
+	})
+}
+
+// decrypt returns the decrypted body of m.
+func decrypt(ctx context.Context, svc kmsiface.KMSAPI, m *msg.Message) ([]byte, error) {
+	wrappedKey, err := base64.StdEncoding.DecodeString(m.Attributes.Get(KeyAttribute))
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := svc.DecryptWithContext(ctx, &kms.DecryptInput{CiphertextBlob: wrappedKey})
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, m.Body))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted body too short: %d bytes", len(sealed))
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
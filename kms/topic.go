@@ -0,0 +1,99 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Encrypter wraps a topic with another which encrypts the body of each
+// Message with a new data key generated by KMS under the KMS key `keyID`,
+// e.g. a key ARN or "alias/messages".
+func Encrypter(next msg.Topic, svc kmsiface.KMSAPI, keyID string) msg.Topic {
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &encryptWriter{
+			Next:  next.NewWriter(ctx),
+			ctx:   ctx,
+			svc:   svc,
+			keyID: keyID,
+		}
+	})
+}
+
+type encryptWriter struct {
+	Next msg.MessageWriter
+
+	ctx   context.Context
+	svc   kmsiface.KMSAPI
+	keyID string
+
+	buf    bytes.Buffer
+	closed bool
+	mux    sync.Mutex
+}
+
+// Attributes returns the attributes associated with the MessageWriter.
+func (w *encryptWriter) Attributes() *msg.Attributes {
+	return w.Next.Attributes()
+}
+
+// Close encrypts the contents of the buffer before writing them,
+// base64-encoded, to the next MessageWriter.
+func (w *encryptWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	dataKey, err := w.svc.GenerateDataKeyWithContext(w.ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(w.keyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(dataKey.Plaintext)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := gcm.Seal(nonce, nonce, w.buf.Bytes(), nil)
+
+	attrs := *w.Attributes()
+	attrs[AlgorithmAttribute] = []string{AlgorithmAES256GCM}
+	attrs[KeyAttribute] = []string{base64.StdEncoding.EncodeToString(dataKey.CiphertextBlob)}
+
+	buf := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(buf, sealed)
+
+	if _, err := w.Next.Write(buf); err != nil {
+		return err
+	}
+	return w.Next.Close()
+}
+
+// Write writes bytes to an internal buffer.
+func (w *encryptWriter) Write(b []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(b)
+}
@@ -0,0 +1,239 @@
+// Package lambda adapts the SQS events of Lambda functions triggered by a
+// queue into calls to a msg.Receiver, so that the same receiver and
+// middleware can be served by an sqs.Server, e.g. on ECS, and by Lambda:
+//
+//	h, err := lambda.NewHandler(receiver, lambda.WithMiddleware(middleware...))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	awslambda.Start(h.Handle)
+//
+// Messages are converted as an sqs.Server converts them: their message
+// attributes are set as attributes, and their system attributes too, with
+// their name prefixed by sqs.SystemAttributePrefix, with WithSystemAttributes.
+// With the ReportBatchItemFailures response type configured on the event
+// source mapping, HandleBatch reports the messages the receiver failed to
+// process, so that only these messages are received again:
+//
+//	awslambda.Start(h.HandleBatch)
+//
+// The context passed to the receiver carries the MessageId of the message,
+// see sqs.MessageIDFromContext, and its X-Ray trace header, see
+// sqs.TraceHeaderFromContext.
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// traceHeaderAttribute is the system attribute holding the X-Ray trace
+// header of a message.
+const traceHeaderAttribute = "AWSTraceHeader"
+
+// Handler passes the messages of the SQS events of a Lambda function to a
+// msg.Receiver.
+type Handler struct {
+	receiver msg.Receiver // receiver wrapped with the middleware
+
+	middleware            []func(msg.Receiver) msg.Receiver // decorators wrapping the receiver
+	unwrapSNS             bool                              // whether SNS notification envelopes are unwrapped before the middleware
+	verifySNS             sqs.EnvelopeVerifier              // verifies SNS notification envelopes before they are unwrapped; may be nil
+	systemAttributePrefix string                            // prefix of system attributes; they are not converted when empty
+	logger                logger.Logger                     // where the Handler logs; logger.Default when nil
+}
+
+// Option is the signature that modifies a `Handler` to set some configuration
+type Option func(*Handler) error
+
+// NewHandler returns a Handler passing messages to `r`.
+func NewHandler(r msg.Receiver, opts ...Option) (*Handler, error) {
+	if r == nil {
+		return nil, errors.New("receiver must not be nil")
+	}
+
+	h := &Handler{}
+	for _, opt := range opts {
+		if err := opt(h); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		r = h.middleware[i](r)
+	}
+	if h.verifySNS != nil {
+		r = sqs.VerifiedSNSEnvelopeDecoder(r, h.verifySNS)
+	} else if h.unwrapSNS {
+		r = sqs.SNSEnvelopeDecoder(r)
+	}
+	h.receiver = r
+
+	return h, nil
+}
+
+// WithMiddleware wraps the receiver with `middleware`, the first being the
+// outermost, as sqs.WithMiddleware.
+func WithMiddleware(middleware ...func(msg.Receiver) msg.Receiver) Option {
+	return func(h *Handler) error {
+		for i, mw := range middleware {
+			if mw == nil {
+				return fmt.Errorf("middleware %d must not be nil", i)
+			}
+		}
+
+		h.middleware = append(h.middleware, middleware...)
+
+		return nil
+	}
+}
+
+// WithSNSEnvelopeUnwrapping makes the `Handler` unwrap messages delivered by
+// SNS without raw message delivery, as sqs.WithSNSEnvelopeUnwrapping.
+func WithSNSEnvelopeUnwrapping() Option {
+	return func(h *Handler) error {
+		h.unwrapSNS = true
+
+		return nil
+	}
+}
+
+// WithSNSEnvelopeVerification makes the `Handler` unwrap SNS notification
+// envelopes once `v` verified their signature, as
+// sqs.WithSNSEnvelopeVerification.
+func WithSNSEnvelopeVerification(v sqs.EnvelopeVerifier) Option {
+	return func(h *Handler) error {
+		if v == nil {
+			return errors.New("verifier must not be nil")
+		}
+
+		h.unwrapSNS = true
+		h.verifySNS = v
+
+		return nil
+	}
+}
+
+// WithSystemAttributes makes the `Handler` set the system attributes of
+// messages, e.g. ApproximateReceiveCount, as attributes with their name
+// prefixed by sqs.SystemAttributePrefix, as sqs.WithSystemAttributes.
+func WithSystemAttributes() Option {
+	return func(h *Handler) error {
+		h.systemAttributePrefix = sqs.SystemAttributePrefix
+
+		return nil
+	}
+}
+
+// WithLogger sets the Logger the `Handler` logs to, instead of logger.Default.
+func WithLogger(l logger.Logger) Option {
+	return func(h *Handler) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+
+		h.logger = l
+
+		return nil
+	}
+}
+
+// Handle passes the messages of `event` to the receiver, in order. It stops
+// at the first message the receiver fails to process, and returns the
+// error, so that the whole batch is received again after the visibility
+// timeout of the queue.
+func (h *Handler) Handle(ctx context.Context, event events.SQSEvent) error {
+	for _, record := range event.Records {
+		if err := h.receive(ctx, record); err != nil {
+			h.logf(logger.Error, "Receiver error for message %s: %s", record.MessageId, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HandleBatch passes the messages of `event` to the receiver, in order, and
+// returns the messages it failed to process as batch item failures, for the
+// Lambda function to only receive them again. The event source mapping of
+// the function must report batch item failures, or the failed messages are
+// deleted as if they were processed.
+//
+// Messages of FIFO queues following a failed message are reported as
+// failed without being received, to preserve their order.
+func (h *Handler) HandleBatch(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var resp events.SQSEventResponse
+
+	failed := false
+	for _, record := range event.Records {
+		if failed && strings.HasSuffix(record.EventSourceARN, ".fifo") {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			continue
+		}
+
+		if err := h.receive(ctx, record); err != nil {
+			h.logf(logger.Error, "Receiver error for message %s: %s; will retry after visibility timeout", record.MessageId, err)
+
+			failed = true
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+
+	return resp, nil
+}
+
+// receive passes the message converted from `record` to the receiver.
+func (h *Handler) receive(ctx context.Context, record events.SQSMessage) error {
+	// set the system attributes first
+	// and the message attributes after
+	// as they may override the system attributes
+	attrs := msg.Attributes{}
+	if h.systemAttributePrefix != "" {
+		for k, v := range record.Attributes {
+			attrs.Set(h.systemAttributePrefix+k, v)
+		}
+	}
+	for k, v := range record.MessageAttributes {
+		attrs.Set(k, attributeValue(v))
+	}
+
+	m := &msg.Message{
+		Attributes: attrs,
+		Body:       strings.NewReader(record.Body),
+	}
+
+	ctx = sqs.ContextWithMessageID(ctx, record.MessageId)
+	if header := record.Attributes[traceHeaderAttribute]; header != "" {
+		ctx = sqs.ContextWithTraceHeader(ctx, header)
+	}
+
+	return h.receiver.Receive(ctx, m)
+}
+
+// attributeValue returns the value of a message attribute, base64-encoded
+// for binary attributes.
+func attributeValue(v events.SQSMessageAttribute) string {
+	if v.StringValue != nil {
+		return *v.StringValue
+	}
+
+	return base64.StdEncoding.EncodeToString(v.BinaryValue)
+}
+
+// logf logs a message at level to the Logger of the Handler.
+func (h *Handler) logf(level logger.Level, format string, args ...interface{}) {
+	l := h.logger
+	if l == nil {
+		l = logger.Default
+	}
+
+	l.Logf(level, format, args...)
+}
@@ -0,0 +1,173 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// received is a message received by a test receiver, with the values its
+// context carried.
+type received struct {
+	body        string
+	attrs       msg.Attributes
+	messageID   string
+	traceHeader string
+}
+
+func newEvent(bodies ...string) events.SQSEvent {
+	var event events.SQSEvent
+	for i, body := range bodies {
+		event.Records = append(event.Records, events.SQSMessage{
+			MessageId: string(rune('a' + i)),
+			Body:      body,
+			Attributes: map[string]string{
+				"ApproximateReceiveCount": "1",
+				"AWSTraceHeader":          "Root=1-5759e988-bd862e3fe1be46a994272793",
+			},
+			MessageAttributes: map[string]events.SQSMessageAttribute{
+				"tenant":  {StringValue: aws.String("acme"), DataType: "String"},
+				"payload": {BinaryValue: []byte("hi"), DataType: "Binary"},
+			},
+		})
+	}
+	return event
+}
+
+// Tests that the messages of an event are converted as an sqs.Server
+// converts them, and received in order, through the middleware.
+func TestHandler_Handle(t *testing.T) {
+	var messages []received
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b, _ := ioutil.ReadAll(m.Body)
+		messages = append(messages, received{
+			body:        string(b),
+			attrs:       m.Attributes,
+			messageID:   sqs.MessageIDFromContext(ctx),
+			traceHeader: sqs.TraceHeaderFromContext(ctx),
+		})
+		return nil
+	})
+	middleware := func(next msg.Receiver) msg.Receiver {
+		return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			m.Attributes.Set("Middleware", "yes")
+			return next.Receive(ctx, m)
+		})
+	}
+
+	h, err := NewHandler(r, WithMiddleware(middleware), WithSystemAttributes(), WithLogger(logger.Nop))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := h.Handle(context.Background(), newEvent("first", "second")); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if len(messages) != 2 || messages[0].body != "first" || messages[1].body != "second" {
+		t.Fatalf("Expected the messages to be received in order, got %v", messages)
+	}
+
+	m := messages[1]
+	expected := map[string]string{
+		"Tenant":                      "acme",
+		"Payload":                     "aGk=",
+		"Middleware":                  "yes",
+		"SQS-ApproximateReceiveCount": "1",
+	}
+	for k, v := range expected {
+		if got := m.attrs.Get(k); got != v {
+			t.Errorf("Expected attribute %s to be %q, got %q", k, v, got)
+		}
+	}
+	if m.messageID != "b" {
+		t.Errorf("Expected message ID b, got %q", m.messageID)
+	}
+	if m.traceHeader != "Root=1-5759e988-bd862e3fe1be46a994272793" {
+		t.Errorf("Unexpected trace header %q", m.traceHeader)
+	}
+}
+
+// Tests that Handle stops at the first failure and returns it, and that
+// system attributes are not converted by default.
+func TestHandler_HandleError(t *testing.T) {
+	fail := errors.New("failed")
+	var bodies []string
+	h, err := NewHandler(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b, _ := ioutil.ReadAll(m.Body)
+		bodies = append(bodies, string(b))
+		if m.Attributes.Get("SQS-ApproximateReceiveCount") != "" {
+			t.Errorf("Expected no system attribute, got %v", m.Attributes)
+		}
+		if string(b) == "second" {
+			return fail
+		}
+		return nil
+	}), WithLogger(logger.Nop))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if err := h.Handle(context.Background(), newEvent("first", "second", "third")); err != fail {
+		t.Errorf("Expected the error of the receiver, got %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Errorf("Expected the messages after the failure not to be received, got %v", bodies)
+	}
+}
+
+// Tests that HandleBatch reports the failed messages, and the messages of
+// FIFO queues following them.
+func TestHandler_HandleBatch(t *testing.T) {
+	var bodies []string
+	h, err := NewHandler(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b, _ := ioutil.ReadAll(m.Body)
+		bodies = append(bodies, string(b))
+		if string(b) == "second" {
+			return errors.New("failed")
+		}
+		return nil
+	}), WithLogger(logger.Nop))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for arn, expected := range map[string]string{
+		"arn:aws:sqs:us-west-2:000000000000:jobs":      "b",
+		"arn:aws:sqs:us-west-2:000000000000:jobs.fifo": "b,c",
+	} {
+		bodies = nil
+		event := newEvent("first", "second", "third")
+		for i := range event.Records {
+			event.Records[i].EventSourceARN = arn
+		}
+
+		resp, err := h.HandleBatch(context.Background(), event)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+
+		var failed []string
+		for _, f := range resp.BatchItemFailures {
+			failed = append(failed, f.ItemIdentifier)
+		}
+		if strings.Join(failed, ",") != expected {
+			t.Errorf("Expected %s to be reported failed for %s, got %v", expected, arn, failed)
+		}
+
+		received := 3
+		if strings.HasSuffix(arn, ".fifo") {
+			received = 2
+		}
+		if len(bodies) != received {
+			t.Errorf("Expected %d messages to be received for %s, got %v", received, arn, bodies)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package largepayload offloads message bodies too large for SQS and SNS to
+// S3, in the format of the Amazon SQS Extended Client Library, so that
+// messages can be exchanged with its Java and Python implementations.
+//
+// Topic wraps a Topic so that bodies larger than a threshold are stored as
+// S3 objects, the messages only carrying a pointer to them. Receiver wraps a
+// Receiver so that the body of such messages is fetched from S3 before they
+// are received:
+//
+//	topic = largepayload.Topic(topic, s3Client, "my-payloads", 256*1024)
+//
+//	srv.Serve(ctx, largepayload.Receiver(receiver, s3Client, largepayload.WithDeleteObjects()))
+package largepayload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+const (
+	// SizeAttribute is the message attribute set to the size of the body
+	// of messages whose body was offloaded to S3.
+	SizeAttribute = "ExtendedPayloadSize"
+
+	// legacySizeAttribute is the SizeAttribute of older versions of the
+	// Extended Client Library.
+	legacySizeAttribute = "SQSLargePayloadSize"
+
+	// pointerClass is the class name the Extended Client Library tags
+	// pointers with.
+	pointerClass = "software.amazon.payloadoffloading.PayloadS3Pointer"
+)
+
+// Pointer locates the body of a message stored in S3.
+type Pointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// Option configures a Topic or Receiver.
+type Option func(*config)
+
+type config struct {
+	keyPrefix     string
+	deleteObjects bool
+	logger        logger.Logger
+}
+
+// WithKeyPrefix makes the Topic prefix the keys of the S3 objects it
+// creates with `prefix`, e.g. "payloads/".
+func WithKeyPrefix(prefix string) Option {
+	return func(c *config) {
+		c.keyPrefix = prefix
+	}
+}
+
+// WithDeleteObjects makes the Receiver delete the S3 object holding the body
+// of a message once it was processed successfully. It must not be used when
+// several queues, e.g. subscribed to the same SNS topic, receive pointers to
+// the same objects.
+func WithDeleteObjects() Option {
+	return func(c *config) {
+		c.deleteObjects = true
+	}
+}
+
+// WithLogger sets the Logger a Receiver logs to, instead of logger.Default.
+func WithLogger(l logger.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{logger: logger.Default}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// marshalPointer returns the message body pointing to p.
+func marshalPointer(p Pointer) ([]byte, error) {
+	return json.Marshal([]interface{}{pointerClass, p})
+}
+
+// unmarshalPointer parses a message body pointing to an S3 object.
+func unmarshalPointer(body []byte) (Pointer, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Pointer{}, fmt.Errorf("invalid S3 pointer: %w", err)
+	}
+	if len(raw) != 2 {
+		return Pointer{}, errors.New("invalid S3 pointer: expected a class and a pointer")
+	}
+
+	var p Pointer
+	if err := json.Unmarshal(raw[1], &p); err != nil {
+		return Pointer{}, fmt.Errorf("invalid S3 pointer: %w", err)
+	}
+	if p.Bucket == "" || p.Key == "" {
+		return Pointer{}, errors.New("invalid S3 pointer: missing bucket or key")
+	}
+
+	return p, nil
+}
@@ -0,0 +1,147 @@
+package largepayload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// mockS3API stores objects in memory.
+type mockS3API struct {
+	s3iface.S3API
+
+	objects map[string][]byte // by bucket/key
+}
+
+func (s *mockS3API) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	b, err := ioutil.ReadAll(input.Body)
+	s.objects[*input.Bucket+"/"+*input.Key] = b
+	return &s3.PutObjectOutput{}, err
+}
+
+func (s *mockS3API) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	b, ok := s.objects[*input.Bucket+"/"+*input.Key]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (s *mockS3API) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	delete(s.objects, *input.Bucket+"/"+*input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// recordingWriter is a msg.MessageWriter recording the message
+// it was closed with.
+type recordingWriter struct {
+	bytes.Buffer
+
+	attributes msg.Attributes
+	closed     chan *msg.Message
+}
+
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed <- &msg.Message{Attributes: w.attributes, Body: &w.Buffer}
+	return nil
+}
+
+// Tests that bodies larger than the threshold are offloaded to S3 by Topic,
+// and that Receiver receives every message with its original body.
+func TestTopicAndReceiver(t *testing.T) {
+	cases := map[string]struct {
+		body      string
+		offloaded bool
+	}{
+		"small": {"hello", false},
+		"large": {strings.Repeat("x", 2048), true},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockS3API{objects: map[string][]byte{}}
+			closed := make(chan *msg.Message, 1)
+			topic := Topic(msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+				return &recordingWriter{attributes: msg.Attributes{}, closed: closed}
+			}), svc, "payloads", 1024, WithKeyPrefix("jobs/"))
+
+			w := topic.NewWriter(context.Background())
+			w.Write([]byte(c.body))
+			if err := w.Close(); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			m := <-closed
+
+			if offloaded := len(svc.objects) == 1; offloaded != c.offloaded {
+				t.Fatalf("Expected offloaded to be %v, got %d objects", c.offloaded, len(svc.objects))
+			}
+			if c.offloaded {
+				if v := m.Attributes[SizeAttribute]; len(v) != 1 || v[0] != "2048" {
+					t.Errorf("Expected the size attribute to be set, got %v", m.Attributes)
+				}
+				p, err := unmarshalPointer(m.Body.(*bytes.Buffer).Bytes())
+				if err != nil || p.Bucket != "payloads" || !strings.HasPrefix(p.Key, "jobs/") {
+					t.Errorf("Unexpected pointer %v, %v", p, err)
+				}
+			}
+
+			var received string
+			r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+				body, err := ioutil.ReadAll(m.Body)
+				received = string(body)
+				return err
+			}), svc, WithDeleteObjects())
+			if err := r.Receive(context.Background(), m); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if received != c.body {
+				t.Errorf("Expected the original body, got %d bytes", len(received))
+			}
+			if len(svc.objects) != 0 {
+				t.Errorf("Expected the object to be deleted, got %d objects", len(svc.objects))
+			}
+		})
+	}
+}
+
+// Tests that Receiver reads pointers written by the Extended Client Library,
+// and keeps the object when processing fails.
+func TestReceiver_ExtendedClientPointer(t *testing.T) {
+	svc := &mockS3API{objects: map[string][]byte{"bucket/key": []byte("payload")}}
+
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       strings.NewReader(`["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"key"}]`),
+	}
+	m.Attributes.Set(legacySizeAttribute, "7")
+
+	var received string
+	r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, _ := ioutil.ReadAll(m.Body)
+		received = string(body)
+		return errors.New("failed")
+	}), svc, WithDeleteObjects())
+
+	if err := r.Receive(context.Background(), m); err == nil {
+		t.Errorf("Expected the error of the receiver, got nil")
+	}
+	if received != "payload" {
+		t.Errorf("Expected the payload to be received, got %q", received)
+	}
+	if len(svc.objects) != 1 {
+		t.Errorf("Expected the object to be kept")
+	}
+}
@@ -0,0 +1,80 @@
+package largepayload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Receiver wraps a msg.Receiver with the retrieval from S3 of the body of
+// messages offloaded by a Topic, or by the Extended Client Library. Other
+// messages are received as is.
+//
+// Messages whose body cannot be retrieved are not received and the error
+// is returned, so that they are retried.
+func Receiver(next msg.Receiver, svc s3iface.S3API, opts ...Option) msg.Receiver {
+	c := newConfig(opts)
+
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		if !hasAttribute(m.Attributes, SizeAttribute) && !hasAttribute(m.Attributes, legacySizeAttribute) {
+			return next.Receive(ctx, m)
+		}
+
+		pointerBody, err := ioutil.ReadAll(m.Body)
+		if err != nil {
+			return err
+		}
+		p, err := unmarshalPointer(pointerBody)
+		if err != nil {
+			return err
+		}
+
+		obj, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(p.Bucket),
+			Key:    aws.String(p.Key),
+		})
+		if err != nil {
+			return fmt.Errorf("cannot retrieve message body from S3: %w", err)
+		}
+		body, err := ioutil.ReadAll(obj.Body)
+		obj.Body.Close()
+		if err != nil {
+			return fmt.Errorf("cannot retrieve message body from S3: %w", err)
+		}
+		m.Body = bytes.NewReader(body)
+
+		if err := next.Receive(ctx, m); err != nil {
+			return err
+		}
+
+		if c.deleteObjects {
+			if _, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(p.Bucket),
+				Key:    aws.String(p.Key),
+			}); err != nil {
+				// the message was processed, only the object is left behind
+				c.logger.Logf(logger.Error, "cannot delete message body s3://%s/%s: %s", p.Bucket, p.Key, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// hasAttribute reports whether attrs has the attribute `name`, whether its
+// key was canonicalized, as by a Server, or not, as set by Topic.
+func hasAttribute(attrs msg.Attributes, name string) bool {
+	if attrs.Get(name) != "" {
+		return true
+	}
+
+	_, ok := attrs[name]
+	return ok
+}
@@ -0,0 +1,121 @@
+package largepayload
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Topic wraps a topic with another which stores the body of each Message
+// larger than `threshold` bytes as an object of `bucket`, replacing it with
+// a pointer to the object. Smaller bodies are sent as is.
+func Topic(next msg.Topic, svc s3iface.S3API, bucket string, threshold int, opts ...Option) msg.Topic {
+	c := newConfig(opts)
+
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &offloadWriter{
+			Next:      next.NewWriter(ctx),
+			ctx:       ctx,
+			svc:       svc,
+			bucket:    bucket,
+			threshold: threshold,
+			keyPrefix: c.keyPrefix,
+		}
+	})
+}
+
+type offloadWriter struct {
+	Next msg.MessageWriter
+
+	ctx       context.Context
+	svc       s3iface.S3API
+	bucket    string
+	threshold int
+	keyPrefix string
+
+	buf    bytes.Buffer
+	closed bool
+	mux    sync.Mutex
+}
+
+// Attributes returns the attributes associated with the MessageWriter.
+func (w *offloadWriter) Attributes() *msg.Attributes {
+	return w.Next.Attributes()
+}
+
+// Close stores the contents of the buffer in S3 if it is larger than the
+// threshold, writing a pointer to the object to the next MessageWriter
+// instead.
+func (w *offloadWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	body := w.buf.Bytes()
+	if len(body) > w.threshold {
+		key, err := newKey()
+		if err != nil {
+			return err
+		}
+		p := Pointer{Bucket: w.bucket, Key: w.keyPrefix + key}
+
+		if _, err := w.svc.PutObjectWithContext(w.ctx, &s3.PutObjectInput{
+			Bucket: aws.String(p.Bucket),
+			Key:    aws.String(p.Key),
+			Body:   bytes.NewReader(body),
+		}); err != nil {
+			return fmt.Errorf("cannot store message body in S3: %w", err)
+		}
+
+		// the attribute is not canonicalized, as other
+		// implementations look it up with this exact name
+		attrs := *w.Attributes()
+		attrs[SizeAttribute] = []string{strconv.Itoa(len(body))}
+
+		if body, err = marshalPointer(p); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Next.Write(body); err != nil {
+		return err
+	}
+	return w.Next.Close()
+}
+
+// Write writes bytes to an internal buffer.
+func (w *offloadWriter) Write(b []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(b)
+}
+
+// newKey returns a random UUID, as the Extended Client Library names
+// the objects it stores.
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
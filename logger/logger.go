@@ -0,0 +1,76 @@
+// Package logger defines the leveled Logger used by the SQS and SNS
+// primitives, so that their logs can be routed to any logging stack.
+package logger
+
+import (
+	"fmt"
+	"log"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+// Levels, from the most verbose to the most severe.
+const (
+	Trace Level = iota
+	Debug
+	Info
+	Warn
+	Error
+)
+
+// String returns the name of the level, as prefixed to messages by Std.
+func (l Level) String() string {
+	switch l {
+	case Trace:
+		return "TRACE"
+	case Debug:
+		return "DEBUG"
+	case Info:
+		return "INFO"
+	case Warn:
+		return "WARN"
+	case Error:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// Logger logs messages at a given level.
+//
+// Logf may be called concurrently from several goroutines.
+type Logger interface {
+	Logf(level Level, format string, args ...interface{})
+}
+
+// Func is an adapter to use an ordinary function as a Logger.
+type Func func(level Level, format string, args ...interface{})
+
+// Logf calls f(level, format, args...).
+func (f Func) Logf(level Level, format string, args ...interface{}) {
+	f(level, format, args...)
+}
+
+// Std logs messages with the standard library's log package, prefixed
+// with their level, e.g. "[ERROR] ...".
+var Std Logger = Func(func(level Level, format string, args ...interface{}) {
+	log.Printf("["+level.String()+"] "+format, args...)
+})
+
+// Default is the Logger used when none is set: Std, silencing TRACE and
+// DEBUG messages. Use Std to see them.
+var Default Logger = MinLevel(Std, Info)
+
+// Nop discards every message.
+var Nop Logger = Func(func(Level, string, ...interface{}) {})
+
+// MinLevel returns a Logger passing to l only the messages at or above min,
+// e.g. MinLevel(Std, Info) silences TRACE and DEBUG messages.
+func MinLevel(l Logger, min Level) Logger {
+	return Func(func(level Level, format string, args ...interface{}) {
+		if level >= min {
+			l.Logf(level, format, args...)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Std.Logf(Warn, "receive failed %d times", 3)
+
+	if !strings.Contains(buf.String(), "[WARN] receive failed 3 times") {
+		t.Errorf("Unexpected log output %q", buf.String())
+	}
+}
+
+func TestMinLevel(t *testing.T) {
+	var logged []Level
+	l := MinLevel(Func(func(level Level, format string, args ...interface{}) {
+		logged = append(logged, level)
+	}), Info)
+
+	for _, level := range []Level{Trace, Debug, Info, Warn, Error} {
+		l.Logf(level, "message")
+	}
+
+	if len(logged) != 3 || logged[0] != Info || logged[2] != Error {
+		t.Errorf("Expected Info, Warn and Error to be logged, got %v", logged)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Default.Logf(Trace, "writing to sqs")
+	Default.Logf(Info, "autoscaling to %d pollers", 2)
+
+	if strings.Contains(buf.String(), "[TRACE]") {
+		t.Errorf("Expected TRACE messages to be silenced, got %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "[INFO] autoscaling to 2 pollers") {
+		t.Errorf("Unexpected log output %q", buf.String())
+	}
+}
@@ -0,0 +1,96 @@
+// Package metrics defines the Recorder the SQS and SNS primitives report
+// metrics to, so that they can be exported to any monitoring system.
+//
+// See packages metrics/prometheus and metrics/statsd for Prometheus and
+// DogStatsD implementations.
+package metrics
+
+import "time"
+
+// Recorder records metrics about the messages handled by a Server and the
+// messages published by a Topic.
+//
+// Its methods are called from the goroutines receiving, processing and
+// publishing messages, so they must be safe for concurrent use and should
+// not block.
+type Recorder interface {
+	// ObserveReceive is called after each ReceiveMessage call which
+	// returned n messages from queue.
+	ObserveReceive(queue string, n int)
+
+	// ObserveProcessed is called once Receive returned err
+	// for a message from queue, after running for d.
+	ObserveProcessed(queue string, d time.Duration, err error)
+
+	// ObserveSkipped is called instead of ObserveProcessed once Receive
+	// skipped a message from queue, e.g. by returning sqs.ErrSkipMessage,
+	// after running for d.
+	ObserveSkipped(queue string, d time.Duration)
+
+	// ObserveDelete is called once a processed message was deleted
+	// from queue, or failed to be with err.
+	ObserveDelete(queue string, err error)
+
+	// AddInFlight adds delta to the number of messages
+	// from queue being processed.
+	AddInFlight(queue string, delta int)
+
+	// ObservePublish is called once a message was published to
+	// destination, a queue or topic, or failed to be with err.
+	ObservePublish(destination string, err error)
+
+	// ObserveAPICall is called after each AWS API call, e.g.
+	// "ReceiveMessage", which took d and returned err.
+	ObserveAPICall(operation string, d time.Duration, err error)
+}
+
+// FailoverRecorder is implemented by Recorders which also record the
+// failovers of a failover.Topic, see its WithMetrics option.
+type FailoverRecorder interface {
+	// ObserveFailover is called once a message failed to be published to
+	// the primary topic of destination, and was published to its
+	// secondary topic instead, or failed to be with err.
+	ObserveFailover(destination string, err error)
+}
+
+// ExpiryRecorder is implemented by Recorders which also record the
+// messages a Server deleted because they expired, see
+// sqs.WithMessageExpiry.
+type ExpiryRecorder interface {
+	// ObserveExpired is called once an expired message from queue was
+	// deleted without being processed.
+	ObserveExpired(queue string)
+}
+
+// Nop is a Recorder which discards every metric.
+//
+// It can be embedded in Recorder implementations
+// only interested in some of the metrics.
+type Nop struct{}
+
+// ObserveReceive does nothing.
+func (Nop) ObserveReceive(queue string, n int) {}
+
+// ObserveProcessed does nothing.
+func (Nop) ObserveProcessed(queue string, d time.Duration, err error) {}
+
+// ObserveSkipped does nothing.
+func (Nop) ObserveSkipped(queue string, d time.Duration) {}
+
+// ObserveDelete does nothing.
+func (Nop) ObserveDelete(queue string, err error) {}
+
+// AddInFlight does nothing.
+func (Nop) AddInFlight(queue string, delta int) {}
+
+// ObservePublish does nothing.
+func (Nop) ObservePublish(destination string, err error) {}
+
+// ObserveAPICall does nothing.
+func (Nop) ObserveAPICall(operation string, d time.Duration, err error) {}
+
+// ObserveFailover does nothing.
+func (Nop) ObserveFailover(destination string, err error) {}
+
+// ObserveExpired does nothing.
+func (Nop) ObserveExpired(queue string) {}
@@ -0,0 +1,198 @@
+// Package prometheus implements a metrics.Recorder exporting Prometheus
+// counters, gauges and histograms.
+//
+// A Recorder is registered once and may be shared by several Servers and
+// Topics, their metrics being labeled with the name of their queue or
+// topic:
+//
+//	rec, err := prometheus.New(prom.DefaultRegisterer)
+//	if err != nil {
+//		// ...
+//	}
+//
+//	srv, err := sqs.NewServer(queueURL, 10, 30, sqs.WithMetrics(rec))
+package prometheus
+
+import (
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace prefixes the names of the metrics of a Recorder.
+const Namespace = "aws_msg"
+
+// Recorder is a metrics.Recorder exporting Prometheus metrics.
+type Recorder struct {
+	received   *prom.CounterVec
+	failed     *prom.CounterVec
+	skipped    *prom.CounterVec
+	deleted    *prom.CounterVec
+	published  *prom.CounterVec
+	processing *prom.HistogramVec
+	batchSize  *prom.HistogramVec
+	inFlight   *prom.GaugeVec
+	apiLatency *prom.HistogramVec
+	apiErrors  *prom.CounterVec
+	failovers  *prom.CounterVec
+	expired    *prom.CounterVec
+}
+
+var (
+	_ metrics.Recorder         = (*Recorder)(nil)
+	_ metrics.FailoverRecorder = (*Recorder)(nil)
+	_ metrics.ExpiryRecorder   = (*Recorder)(nil)
+)
+
+// New returns a Recorder whose metrics are registered with reg.
+func New(reg prom.Registerer) (*Recorder, error) {
+	r := &Recorder{
+		received: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_received_total",
+			Help:      "Number of messages received from a queue.",
+		}, []string{"queue"}),
+		failed: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_failed_total",
+			Help:      "Number of messages for which the receiver returned an error.",
+		}, []string{"queue"}),
+		skipped: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_skipped_total",
+			Help:      "Number of messages skipped by the receiver.",
+		}, []string{"queue"}),
+		deleted: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_deleted_total",
+			Help:      "Number of processed messages deleted from a queue.",
+		}, []string{"queue"}),
+		published: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_published_total",
+			Help:      "Number of messages published to a queue or topic, by result.",
+		}, []string{"destination", "result"}),
+		processing: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "processing_duration_seconds",
+			Help:      "Time spent by the receiver processing a message.",
+			Buckets:   prom.DefBuckets,
+		}, []string{"queue"}),
+		batchSize: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "receive_batch_size",
+			Help:      "Number of messages returned by a ReceiveMessage call.",
+			Buckets:   prom.LinearBuckets(0, 1, 11),
+		}, []string{"queue"}),
+		inFlight: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "messages_in_flight",
+			Help:      "Number of messages being processed.",
+		}, []string{"queue"}),
+		apiLatency: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "api_call_duration_seconds",
+			Help:      "Latency of AWS API calls.",
+			Buckets:   prom.DefBuckets,
+		}, []string{"operation"}),
+		apiErrors: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Name:      "api_call_errors_total",
+			Help:      "Number of failed AWS API calls.",
+		}, []string{"operation"}),
+		failovers: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_failed_over_total",
+			Help:      "Number of messages published to a secondary topic after the primary failed, by result.",
+		}, []string{"destination", "result"}),
+		expired: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_expired_total",
+			Help:      "Number of expired messages deleted from a queue without being processed.",
+		}, []string{"queue"}),
+	}
+
+	collectors := []prom.Collector{
+		r.received, r.failed, r.skipped, r.deleted, r.published,
+		r.processing, r.batchSize, r.inFlight, r.apiLatency, r.apiErrors,
+		r.failovers, r.expired,
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// ObserveReceive counts n received messages and observes the batch size.
+func (r *Recorder) ObserveReceive(queue string, n int) {
+	r.received.WithLabelValues(queue).Add(float64(n))
+	r.batchSize.WithLabelValues(queue).Observe(float64(n))
+}
+
+// ObserveProcessed observes the processing duration, and counts the
+// message as failed if err is not nil.
+func (r *Recorder) ObserveProcessed(queue string, d time.Duration, err error) {
+	r.processing.WithLabelValues(queue).Observe(d.Seconds())
+	if err != nil {
+		r.failed.WithLabelValues(queue).Inc()
+	}
+}
+
+// ObserveSkipped observes the processing duration,
+// and counts the message as skipped.
+func (r *Recorder) ObserveSkipped(queue string, d time.Duration) {
+	r.processing.WithLabelValues(queue).Observe(d.Seconds())
+	r.skipped.WithLabelValues(queue).Inc()
+}
+
+// ObserveDelete counts the message as deleted if err is nil.
+func (r *Recorder) ObserveDelete(queue string, err error) {
+	if err == nil {
+		r.deleted.WithLabelValues(queue).Inc()
+	}
+}
+
+// AddInFlight adds delta to the in-flight gauge.
+func (r *Recorder) AddInFlight(queue string, delta int) {
+	r.inFlight.WithLabelValues(queue).Add(float64(delta))
+}
+
+// ObservePublish counts a published message with result "success",
+// or "error" if err is not nil.
+func (r *Recorder) ObservePublish(destination string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	r.published.WithLabelValues(destination, result).Inc()
+}
+
+// ObserveAPICall observes the latency of an AWS API call,
+// and counts it as failed if err is not nil.
+func (r *Recorder) ObserveAPICall(operation string, d time.Duration, err error) {
+	r.apiLatency.WithLabelValues(operation).Observe(d.Seconds())
+	if err != nil {
+		r.apiErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveFailover counts a message failed over with result "success",
+// or "error" if err is not nil.
+func (r *Recorder) ObserveFailover(destination string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	r.failovers.WithLabelValues(destination, result).Inc()
+}
+
+// ObserveExpired counts the message as expired.
+func (r *Recorder) ObserveExpired(queue string) {
+	r.expired.WithLabelValues(queue).Inc()
+}
@@ -0,0 +1,56 @@
+package prometheus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecorder(t *testing.T) {
+	reg := prom.NewRegistry()
+	r, err := New(reg)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	r.ObserveReceive("jobs", 3)
+	r.AddInFlight("jobs", 3)
+	r.ObserveProcessed("jobs", time.Second, nil)
+	r.ObserveProcessed("jobs", time.Second, errors.New("failed"))
+	r.ObserveSkipped("jobs", time.Second)
+	r.ObserveDelete("jobs", nil)
+	r.AddInFlight("jobs", -2)
+	r.ObservePublish("events", nil)
+	r.ObserveAPICall("ReceiveMessage", time.Millisecond, errors.New("throttled"))
+	r.ObserveFailover("events", nil)
+	r.ObserveExpired("jobs")
+
+	cases := []struct {
+		name      string
+		collector prom.Collector
+		expected  float64
+	}{
+		{"received", r.received.WithLabelValues("jobs"), 3},
+		{"failed", r.failed.WithLabelValues("jobs"), 1},
+		{"skipped", r.skipped.WithLabelValues("jobs"), 1},
+		{"deleted", r.deleted.WithLabelValues("jobs"), 1},
+		{"in flight", r.inFlight.WithLabelValues("jobs"), 1},
+		{"published", r.published.WithLabelValues("events", "success"), 1},
+		{"api errors", r.apiErrors.WithLabelValues("ReceiveMessage"), 1},
+		{"failovers", r.failovers.WithLabelValues("events", "success"), 1},
+		{"expired", r.expired.WithLabelValues("jobs"), 1},
+	}
+
+	for _, c := range cases {
+		if v := testutil.ToFloat64(c.collector); v != c.expected {
+			t.Errorf("Expected %s to be %v, got %v", c.name, c.expected, v)
+		}
+	}
+
+	if _, err := New(reg); err == nil {
+		t.Errorf("Expected registering the metrics twice to fail")
+	}
+}
@@ -0,0 +1,183 @@
+// Package statsd implements a metrics.Recorder emitting DogStatsD metrics
+// over UDP, for teams not using Prometheus.
+//
+//	rec, err := statsd.New("127.0.0.1:8125", statsd.WithTags("env:prod"))
+//	if err != nil {
+//		// ...
+//	}
+//	defer rec.Close()
+//
+//	srv, err := sqs.NewServer(queueURL, 10, 30, sqs.WithMetrics(rec))
+//
+// Metrics are sent without client-side aggregation, one datagram per
+// observation, and are dropped if the agent cannot be reached.
+package statsd
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/metrics"
+)
+
+// DefaultPrefix prefixes the names of the metrics of a Recorder.
+const DefaultPrefix = "aws_msg."
+
+// Recorder is a metrics.Recorder emitting DogStatsD metrics.
+type Recorder struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+var (
+	_ metrics.Recorder         = (*Recorder)(nil)
+	_ metrics.FailoverRecorder = (*Recorder)(nil)
+	_ metrics.ExpiryRecorder   = (*Recorder)(nil)
+)
+
+// Option is the signature that modifies a `Recorder` to set some configuration
+type Option func(*Recorder)
+
+// WithPrefix sets the prefix of the metric names, instead of DefaultPrefix.
+func WithPrefix(prefix string) Option {
+	return func(r *Recorder) {
+		r.prefix = prefix
+	}
+}
+
+// WithTags adds tags, e.g. "env:prod", to every metric.
+func WithTags(tags ...string) Option {
+	return func(r *Recorder) {
+		r.tags = append(r.tags, tags...)
+	}
+}
+
+// New returns a Recorder sending metrics to the DogStatsD agent
+// listening on addr, e.g. "127.0.0.1:8125".
+func New(addr string, opts ...Option) (*Recorder, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		conn:   conn,
+		prefix: DefaultPrefix,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r, nil
+}
+
+// Close closes the connection to the agent.
+func (r *Recorder) Close() error {
+	return r.conn.Close()
+}
+
+// ObserveReceive counts n received messages and observes the batch size.
+func (r *Recorder) ObserveReceive(queue string, n int) {
+	r.send("messages_received", strconv.Itoa(n), "c", "queue:"+queue)
+	r.send("receive_batch_size", strconv.Itoa(n), "h", "queue:"+queue)
+}
+
+// ObserveProcessed times the processing of a message, and counts it as
+// failed if err is not nil.
+func (r *Recorder) ObserveProcessed(queue string, d time.Duration, err error) {
+	r.send("processing_duration", milliseconds(d), "ms", "queue:"+queue)
+	if err != nil {
+		r.send("messages_failed", "1", "c", "queue:"+queue)
+	}
+}
+
+// ObserveSkipped times the processing of a message, and counts it as
+// skipped.
+func (r *Recorder) ObserveSkipped(queue string, d time.Duration) {
+	r.send("processing_duration", milliseconds(d), "ms", "queue:"+queue)
+	r.send("messages_skipped", "1", "c", "queue:"+queue)
+}
+
+// ObserveDelete counts the message as deleted if err is nil.
+func (r *Recorder) ObserveDelete(queue string, err error) {
+	if err == nil {
+		r.send("messages_deleted", "1", "c", "queue:"+queue)
+	}
+}
+
+// AddInFlight adds delta to the in-flight gauge.
+func (r *Recorder) AddInFlight(queue string, delta int) {
+	value := strconv.Itoa(delta)
+	if delta >= 0 {
+		value = "+" + value
+	}
+
+	r.send("messages_in_flight", value, "g", "queue:"+queue)
+}
+
+// ObservePublish counts a published message with result "success",
+// or "error" if err is not nil.
+func (r *Recorder) ObservePublish(destination string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	r.send("messages_published", "1", "c", "destination:"+destination, "result:"+result)
+}
+
+// ObserveFailover counts a message failed over with result "success",
+// or "error" if err is not nil.
+func (r *Recorder) ObserveFailover(destination string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	r.send("messages_failed_over", "1", "c", "destination:"+destination, "result:"+result)
+}
+
+// ObserveExpired counts the message as expired.
+func (r *Recorder) ObserveExpired(queue string) {
+	r.send("messages_expired", "1", "c", "queue:"+queue)
+}
+
+// ObserveAPICall times an AWS API call, and counts it as failed
+// if err is not nil.
+func (r *Recorder) ObserveAPICall(operation string, d time.Duration, err error) {
+	r.send("api_call_duration", milliseconds(d), "ms", "operation:"+operation)
+	if err != nil {
+		r.send("api_call_errors", "1", "c", "operation:"+operation)
+	}
+}
+
+// send writes a metric in the DogStatsD format,
+// e.g. "aws_msg.messages_received:3|c|#queue:jobs".
+func (r *Recorder) send(name, value, kind string, tags ...string) {
+	var b strings.Builder
+	b.WriteString(r.prefix)
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+
+	tags = append(tags, r.tags...)
+	if len(tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(tags, ","))
+	}
+
+	// metrics are best effort: errors, e.g. when no agent
+	// is listening, are ignored
+	r.conn.Write([]byte(b.String()))
+}
+
+// milliseconds formats d as a number of milliseconds.
+func milliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
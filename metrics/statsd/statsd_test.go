@@ -0,0 +1,52 @@
+package statsd
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer conn.Close()
+
+	r, err := New(conn.LocalAddr().String(), WithTags("env:test"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer r.Close()
+
+	r.ObserveReceive("jobs", 3)
+	r.AddInFlight("jobs", -1)
+	r.ObserveProcessed("jobs", 1500*time.Microsecond, errors.New("failed"))
+	r.ObservePublish("events", nil)
+	r.ObserveFailover("events", errors.New("failed"))
+	r.ObserveExpired("jobs")
+
+	expected := []string{
+		"aws_msg.messages_received:3|c|#queue:jobs,env:test",
+		"aws_msg.receive_batch_size:3|h|#queue:jobs,env:test",
+		"aws_msg.messages_in_flight:-1|g|#queue:jobs,env:test",
+		"aws_msg.processing_duration:1.5|ms|#queue:jobs,env:test",
+		"aws_msg.messages_failed:1|c|#queue:jobs,env:test",
+		"aws_msg.messages_published:1|c|#destination:events,result:success,env:test",
+		"aws_msg.messages_failed_over:1|c|#destination:events,result:error,env:test",
+		"aws_msg.messages_expired:1|c|#queue:jobs,env:test",
+	}
+
+	buf := make([]byte, 1024)
+	for _, e := range expected {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Expected metric %s, got error %s", e, err)
+		}
+		if string(buf[:n]) != e {
+			t.Errorf("Expected metric %s, got %s", e, buf[:n])
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package dynamodb provides an outbox.Store backed by a DynamoDB table,
+// recording messages within the TransactWriteItems calls of the caller.
+//
+// The table must have a string partition key called PartitionAttribute and
+// a string sort key called IDAttribute. Every message of a Store is kept in
+// the same partition, so that they can be read in order.
+package dynamodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/hdtradeservices/go-aws-msg/outbox"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+const (
+	// PartitionAttribute is the partition key of the table, holding the
+	// name of the outbox.
+	PartitionAttribute = "Outbox"
+
+	// IDAttribute is the sort key of the table, holding message IDs.
+	IDAttribute = "MessageId"
+
+	// BodyAttribute holds the body of messages.
+	BodyAttribute = "Body"
+
+	// AttributesAttribute holds the attributes of messages, as a JSON object.
+	AttributesAttribute = "Attributes"
+
+	// CreatedAtAttribute holds when messages were recorded, in nanoseconds
+	// since the epoch.
+	CreatedAtAttribute = "CreatedAt"
+)
+
+// maxBatchDeletes is the maximum number of requests of a BatchWriteItem
+// call.
+const maxBatchDeletes = 25
+
+// Store is an outbox.Store keeping messages in a DynamoDB table.
+type Store struct {
+	svc   dynamodbiface.DynamoDBAPI
+	table string
+	name  string
+}
+
+var _ outbox.Store = (*Store)(nil)
+
+// New returns a Store keeping messages in the partition `name` of `table`,
+// so that several outboxes can share a table.
+func New(svc dynamodbiface.DynamoDBAPI, table, name string) *Store {
+	return &Store{
+		svc:   svc,
+		table: table,
+		name:  name,
+	}
+}
+
+// Topic returns a msg.Topic whose MessageWriters add a Put of their message
+// to the TransactItems of `input` when closed, so that it is only relayed
+// if the caller's TransactWriteItems call with `input` succeeds.
+func (s *Store) Topic(input *dynamodb.TransactWriteItemsInput) msg.Topic {
+	return outbox.Topic(func(ctx context.Context, m *outbox.Message) error {
+		item, err := s.TransactItem(m)
+		if err != nil {
+			return err
+		}
+
+		input.TransactItems = append(input.TransactItems, item)
+
+		return nil
+	})
+}
+
+// TransactItem returns the Put of `m` to add to a TransactWriteItems call.
+func (s *Store) TransactItem(m *outbox.Message) (*dynamodb.TransactWriteItem, error) {
+	attributes, err := json.Marshal(m.Attributes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode attributes: %w", err)
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: aws.String(s.table),
+			Item: map[string]*dynamodb.AttributeValue{
+				PartitionAttribute:  {S: aws.String(s.name)},
+				IDAttribute:         {S: aws.String(m.ID)},
+				BodyAttribute:       {B: m.Body},
+				AttributesAttribute: {S: aws.String(string(attributes))},
+				CreatedAtAttribute:  {N: aws.String(strconv.FormatInt(m.CreatedAt.UnixNano(), 10))},
+			},
+		},
+	}, nil
+}
+
+// Pending returns up to `limit` messages, oldest first. Messages are read
+// consistently, so that messages just deleted are not returned again.
+func (s *Store) Pending(ctx context.Context, limit int) ([]*outbox.Message, error) {
+	resp, err := s.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(s.table),
+		KeyConditionExpression:    aws.String("#outbox = :outbox"),
+		ExpressionAttributeNames:  map[string]*string{"#outbox": aws.String(PartitionAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":outbox": {S: aws.String(s.name)}},
+		ConsistentRead:            aws.Bool(true),
+		Limit:                     aws.Int64(int64(limit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*outbox.Message, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		m := &outbox.Message{
+			ID:   aws.StringValue(item[IDAttribute].S),
+			Body: item[BodyAttribute].B,
+		}
+		if v := item[AttributesAttribute]; v != nil {
+			if err := json.Unmarshal([]byte(aws.StringValue(v.S)), &m.Attributes); err != nil {
+				return nil, fmt.Errorf("cannot decode attributes of message %s: %w", m.ID, err)
+			}
+		}
+		if v := item[CreatedAtAttribute]; v != nil {
+			createdAt, _ := strconv.ParseInt(aws.StringValue(v.N), 10, 64)
+			m.CreatedAt = time.Unix(0, createdAt)
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+// Delete deletes the messages with the given IDs, with BatchWriteItem
+// calls. It returns an error if some of them could not be deleted, in
+// which case they are relayed again.
+func (s *Store) Delete(ctx context.Context, ids []string) error {
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxBatchDeletes {
+			n = maxBatchDeletes
+		}
+
+		requests := make([]*dynamodb.WriteRequest, n)
+		for i, id := range ids[:n] {
+			requests[i] = &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{
+					Key: map[string]*dynamodb.AttributeValue{
+						PartitionAttribute: {S: aws.String(s.name)},
+						IDAttribute:        {S: aws.String(id)},
+					},
+				},
+			}
+		}
+
+		resp, err := s.svc.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{s.table: requests},
+		})
+		if err != nil {
+			return err
+		}
+		if unprocessed := len(resp.UnprocessedItems[s.table]); unprocessed > 0 {
+			return fmt.Errorf("%d messages were not deleted", unprocessed)
+		}
+
+		ids = ids[n:]
+	}
+
+	return nil
+}
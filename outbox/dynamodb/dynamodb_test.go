@@ -0,0 +1,111 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// mockDynamoDBAPI stores items in memory, by message ID.
+type mockDynamoDBAPI struct {
+	dynamodbiface.DynamoDBAPI
+
+	items   map[string]map[string]*dynamodb.AttributeValue
+	batches []int // number of requests of each BatchWriteItem call
+}
+
+// transact applies the Puts of input.
+func (m *mockDynamoDBAPI) transact(input *dynamodb.TransactWriteItemsInput) {
+	for _, item := range input.TransactItems {
+		m.items[aws.StringValue(item.Put.Item[IDAttribute].S)] = item.Put.Item
+	}
+}
+
+func (m *mockDynamoDBAPI) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	var ids []string
+	for id := range m.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if limit := int(aws.Int64Value(input.Limit)); len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	resp := &dynamodb.QueryOutput{}
+	for _, id := range ids {
+		resp.Items = append(resp.Items, m.items[id])
+	}
+
+	return resp, nil
+}
+
+func (m *mockDynamoDBAPI) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	for _, requests := range input.RequestItems {
+		m.batches = append(m.batches, len(requests))
+		for _, r := range requests {
+			delete(m.items, aws.StringValue(r.DeleteRequest.Key[IDAttribute].S))
+		}
+	}
+
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	svc := &mockDynamoDBAPI{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	s := New(svc, "outbox", "orders")
+
+	input := &dynamodb.TransactWriteItemsInput{}
+	topic := s.Topic(input)
+	for i := 0; i < 30; i++ {
+		w := topic.NewWriter(ctx)
+		w.Attributes().Set("Event", "created")
+		fmt.Fprintf(w, "order %02d", i)
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+	if len(svc.items) != 0 {
+		t.Fatalf("Expected no message to be recorded before the transaction")
+	}
+
+	svc.transact(input)
+	if partition := aws.StringValue(input.TransactItems[0].Put.Item[PartitionAttribute].S); partition != "orders" {
+		t.Errorf("Expected partition %q, got %q", "orders", partition)
+	}
+
+	messages, err := s.Pending(ctx, 30)
+	if err != nil || len(messages) != 30 {
+		t.Fatalf("Expected 30 pending messages, got %d (%v)", len(messages), err)
+	}
+	if body := string(messages[0].Body); body != "order 00" {
+		t.Errorf("Expected body %q, got %q", "order 00", body)
+	}
+	if v := messages[0].Attributes.Get("Event"); v != "created" {
+		t.Errorf("Expected attribute Event %q, got %q", "created", v)
+	}
+	if since := time.Since(messages[0].CreatedAt); since < 0 || since > time.Minute {
+		t.Errorf("Unexpected creation time %s", messages[0].CreatedAt)
+	}
+
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	if err := s.Delete(ctx, ids); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(svc.items) != 0 {
+		t.Errorf("Expected every message to be deleted, got %d left", len(svc.items))
+	}
+	if len(svc.batches) != 2 || svc.batches[0] != 25 || svc.batches[1] != 5 {
+		t.Errorf("Expected deletes in batches of 25 and 5, got %v", svc.batches)
+	}
+}
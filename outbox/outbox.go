@@ -0,0 +1,287 @@
+// Package outbox implements the transactional outbox pattern: instead of
+// being published directly, messages are recorded in a Store within the
+// transaction of the caller, so that they are recorded if and only if the
+// transaction commits. A Relay then publishes them to a msg.Topic, e.g. an
+// SQS queue or SNS topic, and deletes them from the Store.
+//
+//	store := sql.New(db, "outbox")
+//
+//	tx, _ := db.BeginTx(ctx, nil)
+//	// ... update the database with tx
+//	codec.WriteJSON(store.Topic(tx).NewWriter(ctx), event)
+//	tx.Commit()
+//
+//	go outbox.NewRelay(store, topic).Run(ctx)
+//
+// Messages are published at least once: a message published by a Relay
+// which fails to delete it is published again. Each message is published
+// with its ID as the MessageIDAttribute attribute, so that receivers can
+// detect duplicates, e.g. with dedup.Attribute(outbox.MessageIDAttribute).
+package outbox
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/clock"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// MessageIDAttribute is the attribute holding the ID of the messages
+// published by a Relay.
+const MessageIDAttribute = "Outbox-Message-Id"
+
+// Message is a message recorded in an outbox, waiting to be published.
+type Message struct {
+	// ID identifies the message. IDs sort in the order messages were
+	// recorded in.
+	ID string
+	// Body is the body of the message.
+	Body []byte
+	// Attributes are the attributes of the message.
+	Attributes msg.Attributes
+	// CreatedAt is when the message was recorded.
+	CreatedAt time.Time
+}
+
+// Store holds the messages of an outbox. Implementations record messages
+// within the transactions of their callers, see Topic, so that is not part
+// of the interface.
+type Store interface {
+	// Pending returns up to `limit` messages, oldest first.
+	Pending(ctx context.Context, limit int) ([]*Message, error)
+
+	// Delete deletes the messages with the given IDs, once published.
+	Delete(ctx context.Context, ids []string) error
+}
+
+// RecordFunc records a message in an outbox.
+type RecordFunc func(ctx context.Context, m *Message) error
+
+// Topic returns a msg.Topic whose MessageWriters record their message with
+// `record` when closed, instead of publishing it. Store implementations
+// use it to record messages within the transaction of the caller.
+func Topic(record RecordFunc) msg.Topic {
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &writer{
+			ctx:        ctx,
+			record:     record,
+			attributes: msg.Attributes{},
+		}
+	})
+}
+
+// writer is the msg.MessageWriter of a Topic.
+type writer struct {
+	ctx        context.Context
+	record     RecordFunc
+	attributes msg.Attributes
+	buf        bytes.Buffer
+
+	closed bool
+	mux    sync.Mutex
+}
+
+// Attributes returns the attributes of the message.
+func (w *writer) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// Write writes data to the body of the message.
+func (w *writer) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+
+	return w.buf.Write(p)
+}
+
+// Close records the message in the outbox.
+func (w *writer) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	now := time.Now()
+	id, err := newID(now)
+	if err != nil {
+		return err
+	}
+
+	return w.record(w.ctx, &Message{
+		ID:         id,
+		Body:       w.buf.Bytes(),
+		Attributes: w.attributes,
+		CreatedAt:  now,
+	})
+}
+
+// newID returns a random message ID sorting after the IDs created before
+// `now`.
+func newID(now time.Time) (string, error) {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("cannot generate message ID: %w", err)
+	}
+
+	return fmt.Sprintf("%020d-%s", now.UnixNano(), hex.EncodeToString(b[:])), nil
+}
+
+// Option configures a Relay.
+type Option func(*Relay)
+
+// WithBatchSize makes the Relay read up to `n` messages at a time from the
+// Store, instead of 100.
+func WithBatchSize(n int) Option {
+	return func(r *Relay) {
+		r.batchSize = n
+	}
+}
+
+// WithInterval makes Run relay pending messages every `d`, instead of
+// every second.
+func WithInterval(d time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = d
+	}
+}
+
+// WithClock sets the Clock Run waits with, instead of clock.Real, e.g. a
+// clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(r *Relay) {
+		r.clock = c
+	}
+}
+
+// WithLogger sets the Logger Run logs errors to, instead of logger.Default.
+func WithLogger(l logger.Logger) Option {
+	return func(r *Relay) {
+		r.logger = l
+	}
+}
+
+// Relay publishes the messages of a Store to a msg.Topic.
+type Relay struct {
+	store     Store
+	topic     msg.Topic
+	batchSize int
+	interval  time.Duration
+	clock     clock.Clock
+	logger    logger.Logger
+}
+
+// NewRelay returns a Relay publishing the messages of `store` to `topic`.
+//
+// Several Relays may drain the same Store, e.g. one per process, at the
+// cost of more duplicates, as they may publish the same messages.
+func NewRelay(store Store, topic msg.Topic, opts ...Option) *Relay {
+	r := &Relay{
+		store:     store,
+		topic:     topic,
+		batchSize: 100,
+		interval:  time.Second,
+		clock:     clock.Real,
+		logger:    logger.Default,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run relays pending messages every interval, see WithInterval, until ctx
+// is done, in which case it returns the error of ctx. Errors are logged,
+// and the messages which could not be relayed are retried at the next
+// interval.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Logf(logger.Error, "cannot relay outbox messages: %s", err)
+		}
+
+		timer := r.clock.NewTimer(r.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// RelayPending publishes the pending messages of the Store, oldest first,
+// and deletes them from the Store, until none is left. It returns the
+// number of messages published and deleted.
+//
+// It stops at the first message which cannot be published, so that
+// messages are not published out of order, after deleting the messages
+// published before it.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	relayed := 0
+
+	for {
+		messages, err := r.store.Pending(ctx, r.batchSize)
+		if err != nil {
+			return relayed, fmt.Errorf("cannot read pending messages: %w", err)
+		}
+		if len(messages) == 0 {
+			return relayed, nil
+		}
+
+		ids := make([]string, 0, len(messages))
+		var publishErr error
+		for _, m := range messages {
+			if publishErr = r.publish(ctx, m); publishErr != nil {
+				publishErr = fmt.Errorf("cannot publish message %s: %w", m.ID, publishErr)
+				break
+			}
+			ids = append(ids, m.ID)
+		}
+
+		if len(ids) > 0 {
+			if err := r.store.Delete(ctx, ids); err != nil {
+				return relayed, fmt.Errorf("cannot delete published messages: %w", err)
+			}
+			relayed += len(ids)
+		}
+
+		if publishErr != nil {
+			return relayed, publishErr
+		}
+		if len(messages) < r.batchSize {
+			return relayed, nil
+		}
+	}
+}
+
+// publish publishes `m` to the Topic of the Relay.
+func (r *Relay) publish(ctx context.Context, m *Message) error {
+	w := r.topic.NewWriter(ctx)
+
+	attrs := w.Attributes()
+	for k, v := range m.Attributes {
+		(*attrs)[k] = append([]string(nil), v...)
+	}
+	attrs.Set(MessageIDAttribute, m.ID)
+
+	if _, err := w.Write(m.Body); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// memoryStore is a Store keeping messages in memory, by ID.
+type memoryStore struct {
+	messages  map[string]*Message
+	deleteErr error
+}
+
+func (s *memoryStore) record(ctx context.Context, m *Message) error {
+	s.messages[m.ID] = m
+	return nil
+}
+
+func (s *memoryStore) Pending(ctx context.Context, limit int) ([]*Message, error) {
+	var messages []*Message
+	for _, m := range s.messages {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, ids []string) error {
+	if s.deleteErr != nil {
+		return s.deleteErr
+	}
+	for _, id := range ids {
+		delete(s.messages, id)
+	}
+	return nil
+}
+
+// recordingWriter records the message it is closed with to its topic.
+type recordingWriter struct {
+	bytes.Buffer
+
+	topic      *recordingTopic
+	attributes msg.Attributes
+}
+
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+func (w *recordingWriter) Close() error {
+	if len(w.topic.errs) > 0 {
+		err := w.topic.errs[0]
+		w.topic.errs = w.topic.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	w.topic.sent = append(w.topic.sent, w)
+	return nil
+}
+
+// recordingTopic is a Topic whose writers fail with the errors in errs,
+// in order, then record the messages they send.
+type recordingTopic struct {
+	errs []error
+	sent []*recordingWriter
+}
+
+func (t *recordingTopic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &recordingWriter{topic: t, attributes: msg.Attributes{}}
+}
+
+func record(t *testing.T, store *memoryStore, bodies ...string) {
+	topic := Topic(store.record)
+	for _, body := range bodies {
+		w := topic.NewWriter(context.Background())
+		w.Attributes().Set("Event", "created")
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+}
+
+func TestRelay_RelayPending(t *testing.T) {
+	store := &memoryStore{messages: map[string]*Message{}}
+	record(t, store, "first", "second", "third")
+
+	topic := &recordingTopic{}
+	n, err := NewRelay(store, topic, WithBatchSize(2)).RelayPending(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 messages relayed, got %d (%v)", n, err)
+	}
+	if len(store.messages) != 0 {
+		t.Errorf("Expected the outbox to be empty, got %d messages", len(store.messages))
+	}
+
+	for i, want := range []string{"first", "second", "third"} {
+		w := topic.sent[i]
+		if body := w.String(); body != want {
+			t.Errorf("Expected body %q, got %q", want, body)
+		}
+		if v := w.attributes.Get("Event"); v != "created" {
+			t.Errorf("Expected attribute Event %q, got %q", "created", v)
+		}
+		if w.attributes.Get(MessageIDAttribute) == "" {
+			t.Errorf("Expected the %s attribute to be set", MessageIDAttribute)
+		}
+	}
+}
+
+// Tests that RelayPending stops at the first message which cannot be
+// published, deleting the messages published before it.
+func TestRelay_RelayPending_PublishError(t *testing.T) {
+	store := &memoryStore{messages: map[string]*Message{}}
+	record(t, store, "first", "second", "third")
+
+	outage := errors.New("service unavailable")
+	topic := &recordingTopic{errs: []error{nil, outage}}
+	n, err := NewRelay(store, topic).RelayPending(context.Background())
+	if !errors.Is(err, outage) || n != 1 {
+		t.Fatalf("Expected 1 message relayed and error %v, got %d (%v)", outage, n, err)
+	}
+	if len(store.messages) != 2 {
+		t.Errorf("Expected 2 messages left in the outbox, got %d", len(store.messages))
+	}
+
+	// the remaining messages are relayed in order
+	if n, err := NewRelay(store, topic).RelayPending(context.Background()); err != nil || n != 2 {
+		t.Fatalf("Expected 2 messages relayed, got %d (%v)", n, err)
+	}
+	if body := topic.sent[1].String(); body != "second" {
+		t.Errorf("Expected body %q, got %q", "second", body)
+	}
+}
+
+// Tests that messages which could not be deleted are relayed again.
+func TestRelay_RelayPending_DeleteError(t *testing.T) {
+	store := &memoryStore{messages: map[string]*Message{}, deleteErr: errors.New("timeout")}
+	record(t, store, "first")
+
+	topic := &recordingTopic{}
+	relay := NewRelay(store, topic, WithLogger(logger.Nop))
+	if _, err := relay.RelayPending(context.Background()); err == nil {
+		t.Fatalf("Expected error, received nil")
+	}
+
+	store.deleteErr = nil
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(topic.sent) != 2 {
+		t.Errorf("Expected the message to be published twice, got %d", len(topic.sent))
+	}
+}
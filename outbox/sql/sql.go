@@ -0,0 +1,144 @@
+// Package sql provides an outbox.Store backed by a SQL table, recording
+// messages within the database transactions of the caller.
+//
+// The table must have the following columns, e.g. for PostgreSQL:
+//
+//	CREATE TABLE outbox (
+//		id         VARCHAR(64) PRIMARY KEY,
+//		body       BYTEA NOT NULL,
+//		attributes TEXT NOT NULL,
+//		created_at BIGINT NOT NULL
+//	);
+//
+// Attributes are stored as a JSON object, and created_at in nanoseconds
+// since the epoch.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/outbox"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Execer executes SQL statements, e.g. a *sql.Tx, *sql.DB or *sql.Conn.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithDollarPlaceholders makes the Store use $1, $2, etc. as query
+// placeholders, as PostgreSQL does, instead of ?.
+func WithDollarPlaceholders() Option {
+	return func(s *Store) {
+		s.placeholder = func(i int) string {
+			return "$" + strconv.Itoa(i)
+		}
+	}
+}
+
+// Store is an outbox.Store keeping messages in a SQL table.
+type Store struct {
+	db          *sql.DB
+	table       string
+	placeholder func(i int) string // returns the placeholder of the i-th argument, from 1
+}
+
+var _ outbox.Store = (*Store)(nil)
+
+// New returns a Store keeping messages in `table`, read and deleted by
+// Relays through `db`.
+func New(db *sql.DB, table string, opts ...Option) *Store {
+	s := &Store{
+		db:    db,
+		table: table,
+		placeholder: func(int) string {
+			return "?"
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Topic returns a msg.Topic whose MessageWriters record their message in
+// the table with `tx` when closed, so that it is only relayed if `tx`
+// commits.
+func (s *Store) Topic(tx Execer) msg.Topic {
+	return outbox.Topic(func(ctx context.Context, m *outbox.Message) error {
+		return s.Record(ctx, tx, m)
+	})
+}
+
+// Record inserts `m` in the table with `tx`.
+func (s *Store) Record(ctx context.Context, tx Execer, m *outbox.Message) error {
+	attributes, err := json.Marshal(m.Attributes)
+	if err != nil {
+		return fmt.Errorf("cannot encode attributes: %w", err)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (id, body, attributes, created_at) VALUES (%s, %s, %s, %s)",
+		s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4))
+	_, err = tx.ExecContext(ctx, query, m.ID, m.Body, string(attributes), m.CreatedAt.UnixNano())
+
+	return err
+}
+
+// Pending returns up to `limit` messages, oldest first.
+func (s *Store) Pending(ctx context.Context, limit int) ([]*outbox.Message, error) {
+	query := fmt.Sprintf("SELECT id, body, attributes, created_at FROM %s ORDER BY id LIMIT %d", s.table, limit)
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*outbox.Message
+	for rows.Next() {
+		var (
+			m          outbox.Message
+			attributes string
+			createdAt  int64
+		)
+		if err := rows.Scan(&m.ID, &m.Body, &attributes, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(attributes), &m.Attributes); err != nil {
+			return nil, fmt.Errorf("cannot decode attributes of message %s: %w", m.ID, err)
+		}
+		m.CreatedAt = time.Unix(0, createdAt)
+
+		messages = append(messages, &m)
+	}
+
+	return messages, rows.Err()
+}
+
+// Delete deletes the messages with the given IDs.
+func (s *Store) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = s.placeholder(i + 1)
+		args[i] = id
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", s.table, strings.Join(placeholders, ", "))
+	_, err := s.db.ExecContext(ctx, query, args...)
+
+	return err
+}
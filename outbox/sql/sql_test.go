@@ -0,0 +1,157 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeDriver is a database/sql driver understanding the statements of a
+// Store, keeping the rows of its table in memory, by ID.
+type fakeDriver struct {
+	rows    map[string][]driver.Value
+	queries []string
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+// Connect makes fakeDriver a driver.Connector, so that it can be opened
+// without being registered.
+func (d *fakeDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *fakeDriver) Driver() driver.Driver { return d }
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c.driver, query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *fakeConn) Commit() error { return nil }
+
+func (c *fakeConn) Rollback() error { return nil }
+
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.queries = append(s.driver.queries, s.query)
+
+	switch {
+	case strings.HasPrefix(s.query, "INSERT"):
+		s.driver.rows[args[0].(string)] = args
+	case strings.HasPrefix(s.query, "DELETE"):
+		for _, id := range args {
+			delete(s.driver.rows, id.(string))
+		}
+	default:
+		return nil, errors.New("unexpected statement")
+	}
+
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.driver.queries = append(s.driver.queries, s.query)
+
+	var ids []string
+	for id := range s.driver.rows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rows := &fakeRows{}
+	for _, id := range ids {
+		rows.values = append(rows.values, s.driver.rows[id])
+	}
+
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id", "body", "attributes", "created_at"}
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	d := &fakeDriver{rows: map[string][]driver.Value{}}
+	db := sql.OpenDB(d)
+	s := New(db, "outbox", WithDollarPlaceholders())
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	for _, body := range []string{"first", "second"} {
+		w := s.Topic(tx).NewWriter(ctx)
+		w.Attributes().Set("Event", "created")
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if q := d.queries[0]; q != "INSERT INTO outbox (id, body, attributes, created_at) VALUES ($1, $2, $3, $4)" {
+		t.Errorf("Unexpected query %q", q)
+	}
+
+	messages, err := s.Pending(ctx, 10)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Expected 2 pending messages, got %d (%v)", len(messages), err)
+	}
+	if body := string(messages[0].Body); body != "first" {
+		t.Errorf("Expected body %q, got %q", "first", body)
+	}
+	if v := messages[0].Attributes.Get("Event"); v != "created" {
+		t.Errorf("Expected attribute Event %q, got %q", "created", v)
+	}
+
+	if err := s.Delete(ctx, []string{messages[0].ID, messages[1].ID}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if q := d.queries[len(d.queries)-1]; q != "DELETE FROM outbox WHERE id IN ($1, $2)" {
+		t.Errorf("Unexpected query %q", q)
+	}
+	if len(d.rows) != 0 {
+		t.Errorf("Expected every message to be deleted, got %d left", len(d.rows))
+	}
+}
@@ -0,0 +1,109 @@
+package s3event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Receiver wraps a msg.Receiver so that it receives one message per record
+// of the S3 event notifications, in order. The body of these messages is
+// the JSON record, and their attributes are those of the notification, and
+// those describing the record, e.g. BucketAttribute and KeyAttribute.
+//
+// If `next` fails to receive a record, the following records are not
+// received and the error is returned, so that the notification is retried
+// with every record: receivers should be idempotent. Test notifications are
+// acknowledged without being received, and messages which are not valid
+// notifications are not received and the error is returned.
+func Receiver(next msg.Receiver) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		n, err := decode(m)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range n.Records {
+			body, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+
+			key, err := r.Key()
+			if err != nil {
+				return fmt.Errorf("s3event: invalid key %q: %w", r.S3.Object.Key, err)
+			}
+
+			attrs := msg.Attributes{}
+			for k, v := range m.Attributes {
+				attrs[k] = v
+			}
+			attrs.Set(EventNameAttribute, r.EventName)
+			attrs.Set(EventTimeAttribute, r.EventTime.UTC().Format(time.RFC3339Nano))
+			attrs.Set(RegionAttribute, r.AWSRegion)
+			attrs.Set(BucketAttribute, r.S3.Bucket.Name)
+			attrs.Set(KeyAttribute, key)
+			if strings.HasPrefix(r.EventName, "ObjectCreated:") {
+				attrs.Set(SizeAttribute, strconv.FormatInt(r.S3.Object.Size, 10))
+			}
+			if r.S3.Object.VersionID != "" {
+				attrs.Set(VersionIDAttribute, r.S3.Object.VersionID)
+			}
+
+			if err := next.Receive(ctx, &msg.Message{Attributes: attrs, Body: bytes.NewReader(body)}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RecordReceiver returns a msg.Receiver passing each record of the S3 event
+// notifications to `fn`, in order, with the same semantics as Receiver.
+func RecordReceiver(fn func(context.Context, *Record) error) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		n, err := decode(m)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range n.Records {
+			if err := fn(ctx, r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// decode decodes the notification in the body of `m`. The notification of a
+// test event has no record.
+func decode(m *msg.Message) (*Notification, error) {
+	body, err := ioutil.ReadAll(m.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var n Notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("s3event: invalid notification: %w", err)
+	}
+
+	if n.Event == TestEvent {
+		n.Records = nil
+	} else if len(n.Records) == 0 {
+		return nil, errors.New("s3event: invalid notification: no records")
+	}
+
+	return &n, nil
+}
@@ -0,0 +1,91 @@
+// Package s3event receives the event notifications S3 delivers to SQS
+// queues, or to SNS topics whose subscribed queues are served with
+// sqs.WithSNSEnvelopeUnwrapping.
+//
+// A notification holds one or more records. Receiver wraps a Receiver so
+// that it receives one message per record, whose attributes describe the
+// object, e.g. BucketAttribute and KeyAttribute, and whose body is the JSON
+// record. RecordReceiver passes the decoded Record to a function instead:
+//
+//	srv.Serve(ctx, s3event.RecordReceiver(func(ctx context.Context, r *s3event.Record) error {
+//		key, err := r.Key()
+//		// ...
+//	}))
+//
+// The s3:TestEvent notification S3 sends when notifications are configured
+// is acknowledged without being received.
+package s3event
+
+import (
+	"net/url"
+	"time"
+)
+
+// TestEvent is the event of the notification S3 sends to check the
+// destination of notifications when they are configured.
+const TestEvent = "s3:TestEvent"
+
+// The attributes of the messages received by the Receiver.
+const (
+	// EventNameAttribute is the type of event, e.g. "ObjectCreated:Put".
+	EventNameAttribute = "Event-Name"
+	// EventTimeAttribute is the time of the event, formatted as RFC 3339.
+	EventTimeAttribute = "Event-Time"
+	// RegionAttribute is the region of the bucket.
+	RegionAttribute = "Region"
+	// BucketAttribute is the name of the bucket.
+	BucketAttribute = "Bucket"
+	// KeyAttribute is the key of the object, URL-decoded.
+	KeyAttribute = "Key"
+	// SizeAttribute is the size of the object in bytes, for object creations.
+	SizeAttribute = "Size"
+	// VersionIDAttribute is the version of the object, in versioned buckets.
+	VersionIDAttribute = "Version-Id"
+)
+
+// Notification is an event notification delivered by S3.
+type Notification struct {
+	Records []*Record `json:"Records"`
+
+	// Event is set to TestEvent, and Records empty, by test notifications.
+	Event  string `json:"Event,omitempty"`
+	Bucket string `json:"Bucket,omitempty"`
+}
+
+// Record is an S3 event, as documented in
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html.
+type Record struct {
+	EventVersion string    `json:"eventVersion"`
+	EventSource  string    `json:"eventSource"`
+	AWSRegion    string    `json:"awsRegion"`
+	EventTime    time.Time `json:"eventTime"`
+	EventName    string    `json:"eventName"`
+	S3           Entity    `json:"s3"`
+}
+
+// Entity describes the bucket and object of a Record.
+type Entity struct {
+	ConfigurationID string `json:"configurationId"`
+	Bucket          Bucket `json:"bucket"`
+	Object          Object `json:"object"`
+}
+
+// Bucket is the bucket of a Record.
+type Bucket struct {
+	Name string `json:"name"`
+	ARN  string `json:"arn"`
+}
+
+// Object is the object of a Record. Its Key is URL-encoded, see Record.Key.
+type Object struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size,omitempty"`
+	ETag      string `json:"eTag,omitempty"`
+	VersionID string `json:"versionId,omitempty"`
+	Sequencer string `json:"sequencer,omitempty"`
+}
+
+// Key returns the URL-decoded key of the object of the record.
+func (r *Record) Key() (string, error) {
+	return url.QueryUnescape(r.S3.Object.Key)
+}
@@ -0,0 +1,107 @@
+package s3event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+const notification = `{"Records":[
+	{"eventVersion":"2.1","eventSource":"aws:s3","awsRegion":"us-west-2","eventTime":"2021-01-01T00:00:00.123Z",
+	 "eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"uploads","arn":"arn:aws:s3:::uploads"},
+	 "object":{"key":"invoices/march+2021%281%29.pdf","size":1024,"eTag":"abc","versionId":"v1","sequencer":"01"}}},
+	{"eventVersion":"2.1","eventSource":"aws:s3","awsRegion":"us-west-2","eventTime":"2021-01-01T00:00:01Z",
+	 "eventName":"ObjectRemoved:Delete","s3":{"bucket":{"name":"uploads"},"object":{"key":"old.txt","sequencer":"02"}}}
+]}`
+
+func newMessage(body string) *msg.Message {
+	attrs := msg.Attributes{}
+	attrs.Set("Tenant", "acme")
+	return &msg.Message{Attributes: attrs, Body: strings.NewReader(body)}
+}
+
+// Tests that the Receiver receives one message per record, with attributes
+// describing the record, and the JSON record as body.
+func TestReceiver(t *testing.T) {
+	var received []*msg.Message
+	r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received = append(received, m)
+		return nil
+	}))
+
+	if err := r.Receive(context.Background(), newMessage(notification)); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(received))
+	}
+
+	expected := map[string]string{
+		"Tenant":           "acme",
+		EventNameAttribute: "ObjectCreated:Put",
+		EventTimeAttribute: "2021-01-01T00:00:00.123Z",
+		RegionAttribute:    "us-west-2",
+		BucketAttribute:    "uploads",
+		KeyAttribute:       "invoices/march 2021(1).pdf",
+		SizeAttribute:      "1024",
+		VersionIDAttribute: "v1",
+	}
+	for k, v := range expected {
+		if got := received[0].Attributes.Get(k); got != v {
+			t.Errorf("Expected attribute %s to be %q, got %q", k, v, got)
+		}
+	}
+
+	var record Record
+	b, _ := ioutil.ReadAll(received[1].Body)
+	if err := json.Unmarshal(b, &record); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if record.EventName != "ObjectRemoved:Delete" || record.S3.Object.Key != "old.txt" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if received[1].Attributes.Get(VersionIDAttribute) != "" || received[1].Attributes.Get(SizeAttribute) != "" {
+		t.Errorf("Expected no version nor size, got %v", received[1].Attributes)
+	}
+}
+
+// Tests that test notifications are acknowledged without being received,
+// and that invalid notifications and failures are returned.
+func TestRecordReceiver(t *testing.T) {
+	var keys []string
+	fail := errors.New("failed")
+	r := RecordReceiver(func(ctx context.Context, r *Record) error {
+		key, _ := r.Key()
+		keys = append(keys, key)
+		if r.EventName == "ObjectRemoved:Delete" {
+			return fail
+		}
+		return nil
+	})
+
+	test := `{"Service":"Amazon S3","Event":"s3:TestEvent","Time":"2021-01-01T00:00:00Z","Bucket":"uploads"}`
+	if err := r.Receive(context.Background(), newMessage(test)); err != nil {
+		t.Errorf("Expected test events to be acknowledged, got %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected test events not to be received, got %v", keys)
+	}
+
+	for _, body := range []string{"not json", `{"Records":[]}`} {
+		if err := r.Receive(context.Background(), newMessage(body)); err == nil {
+			t.Errorf("Expected an error for %s", body)
+		}
+	}
+
+	if err := r.Receive(context.Background(), newMessage(notification)); err != fail {
+		t.Errorf("Expected the error of the receiver, got %v", err)
+	}
+	if strings.Join(keys, ",") != "invoices/march 2021(1).pdf,old.txt" {
+		t.Errorf("Expected the records to be received in order, got %v", keys)
+	}
+}
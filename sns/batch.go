@@ -0,0 +1,166 @@
+package sns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+const (
+	// maxBatchSize is the maximum number of messages of a PublishBatch call.
+	maxBatchSize = 10
+
+	// maxBatchBytes is the maximum total size of the messages of a
+	// PublishBatch call.
+	maxBatchBytes = 256 * 1024
+)
+
+// WithBatchPublish makes MessageWriters of the `Topic` publish their messages
+// with PublishBatch calls of up to 10 messages, instead of a Publish call
+// each, reducing the number of API calls of producers publishing many
+// messages concurrently.
+//
+// Close blocks until the message is published: messages are published once
+// 10 of them are pending, or their total size reaches the limit of SNS, or
+// `flushInterval` after the first pending message was closed.
+func WithBatchPublish(flushInterval time.Duration) Option {
+	return func(t *Topic) error {
+		if flushInterval <= 0 {
+			return errors.New("flush interval must be positive")
+		}
+		t.batcher = &publishBatcher{topic: t, interval: flushInterval}
+		return nil
+	}
+}
+
+// publishEntry is a message published through a publishBatcher.
+type publishEntry struct {
+	input *sns.PublishBatchRequestEntry
+	size  int
+	done  chan error // receives the result of the publication of the entry
+}
+
+// publishBatcher accumulates messages and publishes them with PublishBatch
+// calls, from the goroutine closing the message completing a batch, or from
+// a timer once the flush interval elapsed.
+type publishBatcher struct {
+	topic    *Topic
+	interval time.Duration
+
+	mux     sync.Mutex
+	entries []*publishEntry
+	size    int         // total size of entries
+	timer   *time.Timer // flushes entries once the interval elapsed; nil when there are none
+}
+
+// publish queues the message `input` to be published with the next
+// PublishBatch call, and waits for the result of the call or ctx to be done.
+func (b *publishBatcher) publish(ctx context.Context, input *sns.PublishBatchRequestEntry) error {
+	e := &publishEntry{input: input, size: entrySize(input), done: make(chan error, 1)}
+
+	b.mux.Lock()
+	var full []*publishEntry // entries to publish from this goroutine
+	if b.size+e.size > maxBatchBytes {
+		full = b.take()
+	}
+	b.entries = append(b.entries, e)
+	b.size += e.size
+	if len(b.entries) == maxBatchSize {
+		full = b.take()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flushPending)
+	}
+	b.mux.Unlock()
+
+	if full != nil {
+		b.flush(full)
+	}
+
+	select {
+	case err := <-e.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// take returns the pending entries, and resets the batcher. It must be
+// called with b.mux held.
+func (b *publishBatcher) take() []*publishEntry {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	entries := b.entries
+	b.entries, b.size = nil, 0
+
+	return entries
+}
+
+// flushPending flushes the pending entries, once the flush interval elapsed.
+func (b *publishBatcher) flushPending() {
+	b.mux.Lock()
+	entries := b.take()
+	b.mux.Unlock()
+
+	if len(entries) > 0 {
+		b.flush(entries)
+	}
+}
+
+// flush publishes `entries` with a single PublishBatch call, and sends the
+// result of each entry to its done channel.
+func (b *publishBatcher) flush(entries []*publishEntry) {
+	t := b.topic
+	input := &sns.PublishBatchInput{TopicArn: aws.String(t.TopicARN)}
+	byID := make(map[string]*publishEntry, len(entries))
+	for i, e := range entries {
+		id := strconv.Itoa(i)
+		e.input.Id = aws.String(id)
+		input.PublishBatchRequestEntries = append(input.PublishBatchRequestEntries, e.input)
+		byID[id] = e
+	}
+
+	t.logf(logger.Trace, "publishing batch of %d messages to sns", len(entries))
+	start := time.Now()
+	out, err := t.Svc.PublishBatchWithContext(context.Background(), input)
+	if t.metrics != nil {
+		t.metrics.ObserveAPICall("PublishBatch", time.Since(start), err)
+	}
+	if err != nil {
+		for _, e := range entries {
+			e.done <- err
+		}
+		return
+	}
+
+	for _, f := range out.Failed {
+		if e, ok := byID[aws.StringValue(f.Id)]; ok {
+			e.done <- fmt.Errorf("%s: %s", aws.StringValue(f.Code), aws.StringValue(f.Message))
+			delete(byID, aws.StringValue(f.Id))
+		}
+	}
+	for _, e := range byID {
+		e.done <- nil
+	}
+}
+
+// entrySize returns the size of a message counted towards the limit of a
+// PublishBatch call: its body, and the names, types and values of its
+// attributes.
+func entrySize(e *sns.PublishBatchRequestEntry) int {
+	size := len(aws.StringValue(e.Message))
+	for name, v := range e.MessageAttributes {
+		size += len(name) + len(aws.StringValue(v.DataType)) + len(aws.StringValue(v.StringValue)) + len(v.BinaryValue)
+	}
+
+	return size
+}
@@ -0,0 +1,128 @@
+package sns
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+)
+
+// batchSNSAPI records PublishBatch calls, failing the entries whose
+// message is "fail".
+type batchSNSAPI struct {
+	snsiface.SNSAPI
+
+	mux     sync.Mutex
+	batches []*sns.PublishBatchInput
+}
+
+func (s *batchSNSAPI) PublishBatchWithContext(ctx aws.Context, input *sns.PublishBatchInput, opts ...request.Option) (*sns.PublishBatchOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.batches = append(s.batches, input)
+
+	out := &sns.PublishBatchOutput{}
+	for _, e := range input.PublishBatchRequestEntries {
+		if aws.StringValue(e.Message) == "fail" {
+			out.Failed = append(out.Failed, &sns.BatchResultErrorEntry{
+				Id:      e.Id,
+				Code:    aws.String("InvalidParameter"),
+				Message: aws.String("invalid message"),
+			})
+		}
+	}
+	return out, nil
+}
+
+// publishConcurrently publishes `bodies` concurrently to `topic`,
+// returning the error of each Close.
+func publishConcurrently(topic *Topic, bodies []string) []error {
+	errs := make([]error, len(bodies))
+	var wg sync.WaitGroup
+	for i, body := range bodies {
+		wg.Add(1)
+		go func(i int, body string) {
+			defer wg.Done()
+			w := topic.NewWriter(context.Background())
+			w.Attributes().Set("Tenant", "acme")
+			w.Write([]byte(body))
+			errs[i] = w.Close()
+		}(i, body)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// Tests that messages are published in batches of up to 10, and that the
+// failure of an entry is only returned by the Close of its MessageWriter.
+func TestWithBatchPublish(t *testing.T) {
+	svc := &batchSNSAPI{}
+	topic := &Topic{Svc: svc, TopicARN: "arn:aws:sns:us-west-2:123456789012:orders"}
+	if err := WithBatchPublish(50 * time.Millisecond)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	bodies := make([]string, 25)
+	for i := range bodies {
+		bodies[i] = "hello"
+	}
+	bodies[7] = "fail"
+
+	errs := publishConcurrently(topic, bodies)
+	for i, err := range errs {
+		if (err != nil) != (i == 7) {
+			t.Errorf("Unexpected error %v for message %d", err, i)
+		}
+	}
+
+	if len(svc.batches) != 3 {
+		t.Fatalf("Expected 3 PublishBatch calls, got %d", len(svc.batches))
+	}
+	for _, b := range svc.batches {
+		if len(b.PublishBatchRequestEntries) > maxBatchSize {
+			t.Errorf("Expected at most %d messages per batch, got %d", maxBatchSize, len(b.PublishBatchRequestEntries))
+		}
+		if aws.StringValue(b.PublishBatchRequestEntries[0].MessageAttributes["Tenant"].StringValue) != "acme" {
+			t.Errorf("Expected the attributes to be published")
+		}
+	}
+}
+
+// Tests that batches do not exceed the maximum size of a PublishBatch call.
+func TestWithBatchPublish_MaxBatchBytes(t *testing.T) {
+	svc := &batchSNSAPI{}
+	topic := &Topic{Svc: svc, TopicARN: "arn:aws:sns:us-west-2:123456789012:orders"}
+	if err := WithBatchPublish(50 * time.Millisecond)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for _, err := range publishConcurrently(topic, []string{
+		strings.Repeat("a", 100*1024),
+		strings.Repeat("b", 100*1024),
+		strings.Repeat("c", 100*1024),
+	}) {
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	for _, b := range svc.batches {
+		size := 0
+		for _, e := range b.PublishBatchRequestEntries {
+			size += entrySize(e)
+		}
+		if size > maxBatchBytes {
+			t.Errorf("Expected batches of at most %d bytes, got %d", maxBatchBytes, size)
+		}
+	}
+	if len(svc.batches) != 2 {
+		t.Errorf("Expected 2 PublishBatch calls, got %d", len(svc.batches))
+	}
+}
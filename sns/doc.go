@@ -0,0 +1,11 @@
+// Package sns implements msg.Topic for Amazon SNS.
+//
+// A Topic created with NewTopic publishes each message written to its
+// MessageWriters to an SNS topic, with its attributes as SNS message
+// attributes, so that producers can fan messages out to every queue
+// subscribed to the topic without knowing about them. Messages are
+// base64-encoded, see NewUnencodedTopic otherwise.
+//
+// Queues subscribed without raw message delivery receive messages wrapped in
+// an SNS notification, see sqs.WithSNSEnvelopeUnwrapping.
+package sns
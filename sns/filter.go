@@ -0,0 +1,85 @@
+package sns
+
+import (
+	"encoding/json"
+	"net/textproto"
+	"strings"
+)
+
+// FilterPolicy is an SNS subscription filter policy, built with its methods
+// and passed to WithFilterPolicy with String:
+//
+//	policy := sns.FilterPolicy{}.
+//		Equals("tenant", "acme", "globex").
+//		AnythingBut("event-type", "deleted")
+//
+//	sns.SubscribeQueue(ctx, snsSvc, sqsSvc, topicARN, queueURL, sns.WithFilterPolicy(policy.String()))
+//
+// A message matches the policy when each of its attributes matches one of the
+// conditions set on the attribute. Attribute names are canonicalized, as by
+// msg.Attributes.Set, so that they match the names of the attributes
+// published by a Topic.
+//
+// A Topic publishes attributes with several values as a single
+// comma-separated String value, which Equals does not match, and publishes
+// no Number attributes, which numeric conditions only match.
+type FilterPolicy map[string][]interface{}
+
+// add adds the `condition` to the conditions of the attribute `name`.
+func (p FilterPolicy) add(name string, condition ...interface{}) FilterPolicy {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	p[name] = append(p[name], condition...)
+	return p
+}
+
+// Equals matches messages whose attribute `name` is one of `values`.
+func (p FilterPolicy) Equals(name string, values ...string) FilterPolicy {
+	for _, v := range values {
+		p.add(name, v)
+	}
+	return p
+}
+
+// AnythingBut matches messages whose attribute `name` is none of `values`.
+// Messages without the attribute do not match.
+func (p FilterPolicy) AnythingBut(name string, values ...string) FilterPolicy {
+	return p.add(name, map[string]interface{}{"anything-but": values})
+}
+
+// Prefix matches messages whose attribute `name` starts with `prefix`.
+func (p FilterPolicy) Prefix(name, prefix string) FilterPolicy {
+	return p.add(name, map[string]interface{}{"prefix": prefix})
+}
+
+// Exists matches messages which have the attribute `name` if `exists` is
+// true, or which do not have it otherwise.
+func (p FilterPolicy) Exists(name string, exists bool) FilterPolicy {
+	return p.add(name, map[string]interface{}{"exists": exists})
+}
+
+// Between matches messages whose Number attribute `name` is between `min`
+// and `max`, inclusive.
+func (p FilterPolicy) Between(name string, min, max float64) FilterPolicy {
+	return p.add(name, map[string]interface{}{"numeric": []interface{}{">=", min, "<=", max}})
+}
+
+// GreaterThan matches messages whose Number attribute `name` is greater
+// than `value`.
+func (p FilterPolicy) GreaterThan(name string, value float64) FilterPolicy {
+	return p.add(name, map[string]interface{}{"numeric": []interface{}{">", value}})
+}
+
+// LessThan matches messages whose Number attribute `name` is less than
+// `value`.
+func (p FilterPolicy) LessThan(name string, value float64) FilterPolicy {
+	return p.add(name, map[string]interface{}{"numeric": []interface{}{"<", value}})
+}
+
+// String returns the JSON representation of the policy.
+func (p FilterPolicy) String() string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false) // keep the numeric operators readable
+	enc.Encode(map[string][]interface{}(p))
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,25 @@
+package sns
+
+import "testing"
+
+func TestFilterPolicy(t *testing.T) {
+	policy := FilterPolicy{}.
+		Equals("tenant", "acme", "globex").
+		AnythingBut("event-type", "deleted").
+		Prefix("region", "us-").
+		Exists("trace-id", true).
+		Between("priority", 1, 5).
+		GreaterThan("Size", 10).
+		LessThan("Size", 2)
+
+	expected := `{"Event-Type":[{"anything-but":["deleted"]}],` +
+		`"Priority":[{"numeric":[">=",1,"<=",5]}],` +
+		`"Region":[{"prefix":"us-"}],` +
+		`"Size":[{"numeric":[">",10]},{"numeric":["<",2]}],` +
+		`"Tenant":["acme","globex"],` +
+		`"Trace-Id":[{"exists":true}]}`
+
+	if s := policy.String(); s != expected {
+		t.Errorf("Expected policy %s, got %s", expected, s)
+	}
+}
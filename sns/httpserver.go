@@ -0,0 +1,304 @@
+package sns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// The types of the messages SNS sends to HTTP/S endpoints.
+const (
+	notificationType             = "Notification"
+	subscriptionConfirmationType = "SubscriptionConfirmation"
+	unsubscribeConfirmationType  = "UnsubscribeConfirmation"
+)
+
+// maxNotificationSize bounds the size of the requests read by an HTTPServer.
+// SNS messages are at most 256 KiB, escaped in a JSON notification.
+const maxNotificationSize = 1 << 20
+
+// notification is the JSON document SNS sends to HTTP/S endpoints.
+type notification struct {
+	Type              string
+	MessageID         string `json:"MessageId"`
+	Token             string
+	TopicArn          string
+	Subject           string
+	Message           string
+	Timestamp         string
+	SignatureVersion  string
+	Signature         string
+	SigningCertURL    string
+	SubscribeURL      string
+	MessageAttributes map[string]struct {
+		Type  string
+		Value string
+	}
+}
+
+// HTTPServer is a msg.Server receiving the notifications of SNS topics
+// subscribed to an HTTP/S endpoint, for services which cannot poll SQS.
+//
+// The signature of the notifications is verified, see Verifier, and
+// subscriptions of the endpoint are confirmed automatically. Each
+// notification is passed to the receiver as a message holding the published
+// message and its attributes: SNS retries, according to the delivery policy
+// of the subscription, the notifications the receiver returns an error for.
+type HTTPServer struct {
+	// Addr is the TCP address the server listens on, e.g. ":8080".
+	Addr string
+
+	certFile, keyFile string          // serve HTTPS with this certificate when set
+	allowedTopics     map[string]bool // ARNs of the topics accepted; any when empty
+	client            *http.Client    // confirms subscriptions
+	verifier          *Verifier       // verifies the signature of notifications; nil disables it
+	logger            logger.Logger   // where the HTTPServer logs; logger.Default when nil
+
+	server *http.Server
+}
+
+// HTTPServerOption is the signature that modifies an `HTTPServer` to set
+// some configuration.
+type HTTPServerOption func(*HTTPServer) error
+
+// WithTLS makes the `HTTPServer` serve HTTPS with the certificate and key of
+// the given files, as SNS requires for endpoints receiving messages of
+// topics encrypted with KMS.
+func WithTLS(certFile, keyFile string) HTTPServerOption {
+	return func(s *HTTPServer) error {
+		if certFile == "" || keyFile == "" {
+			return errors.New("certificate and key files must not be empty")
+		}
+		s.certFile, s.keyFile = certFile, keyFile
+		return nil
+	}
+}
+
+// WithAllowedTopics makes the `HTTPServer` only confirm subscriptions to,
+// and accept notifications of, the topics `topicARNs`.
+func WithAllowedTopics(topicARNs ...string) HTTPServerOption {
+	return func(s *HTTPServer) error {
+		if s.allowedTopics == nil {
+			s.allowedTopics = make(map[string]bool)
+		}
+		for _, arn := range topicARNs {
+			s.allowedTopics[arn] = true
+		}
+		return nil
+	}
+}
+
+// WithVerifier makes the `HTTPServer` verify the signature of notifications
+// with `v`, e.g. created with custom signing domains, instead of a Verifier
+// created with the default options.
+func WithVerifier(v *Verifier) HTTPServerOption {
+	return func(s *HTTPServer) error {
+		if v == nil {
+			return errors.New("verifier must not be nil")
+		}
+		s.verifier = v
+		return nil
+	}
+}
+
+// WithoutVerification makes the `HTTPServer` accept notifications without
+// verifying they were signed by SNS. It must only be used for local
+// development, e.g. with an SNS emulator which does not sign notifications.
+func WithoutVerification() HTTPServerOption {
+	return func(s *HTTPServer) error {
+		s.verifier = nil
+		return nil
+	}
+}
+
+// WithConfirmationClient makes the `HTTPServer` confirm subscriptions with
+// `client`, instead of an http.Client with a 10 second timeout.
+func WithConfirmationClient(client *http.Client) HTTPServerOption {
+	return func(s *HTTPServer) error {
+		if client == nil {
+			return errors.New("http client must not be nil")
+		}
+		s.client = client
+		return nil
+	}
+}
+
+// WithServerLogger sets the Logger the `HTTPServer` logs to,
+// instead of logger.Default.
+func WithServerLogger(l logger.Logger) HTTPServerOption {
+	return func(s *HTTPServer) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+		s.logger = l
+		return nil
+	}
+}
+
+// NewHTTPServer returns an HTTPServer listening on `addr` once Serve is
+// called, verifying notifications with a Verifier created with the default
+// options.
+func NewHTTPServer(addr string, opts ...HTTPServerOption) (*HTTPServer, error) {
+	verifier, err := NewVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &HTTPServer{
+		Addr:     addr,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		verifier: verifier,
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	s.server = &http.Server{Addr: addr}
+
+	return s, nil
+}
+
+// Serve listens on the address of the HTTPServer, passing the notifications
+// it receives to `r` with a context derived from `ctx`, until Shutdown is
+// called. It returns msg.ErrServerClosed after Shutdown.
+func (s *HTTPServer) Serve(ctx context.Context, r msg.Receiver) error {
+	s.server.Handler = s.Handler(r)
+	s.server.BaseContext = func(net.Listener) context.Context { return ctx }
+
+	var err error
+	if s.certFile != "" {
+		err = s.server.ListenAndServeTLS(s.certFile, s.keyFile)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return msg.ErrServerClosed
+	}
+
+	return err
+}
+
+// Shutdown stops the HTTPServer, waiting for the notifications being
+// received to be processed, or ctx to be done.
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Handler returns an http.Handler passing the notifications it receives to
+// `r`, for the HTTPServer to be mounted on an existing HTTP server instead
+// of calling Serve.
+func (s *HTTPServer) Handler(r msg.Receiver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var n notification
+		if err := json.NewDecoder(io.LimitReader(req.Body, maxNotificationSize)).Decode(&n); err != nil {
+			s.logf(logger.Error, "cannot decode sns notification: %s", err)
+			http.Error(w, "invalid notification", http.StatusBadRequest)
+			return
+		}
+
+		if len(s.allowedTopics) > 0 && !s.allowedTopics[n.TopicArn] {
+			s.logf(logger.Error, "rejected %s of topic %s", n.Type, n.TopicArn)
+			http.Error(w, "topic not allowed", http.StatusForbidden)
+			return
+		}
+
+		if s.verifier != nil {
+			if err := s.verifier.verify(&n); err != nil {
+				s.logf(logger.Error, "cannot verify %s of topic %s: %s", n.Type, n.TopicArn, err)
+				if errors.Is(err, ErrInvalidSignature) {
+					http.Error(w, "invalid signature", http.StatusForbidden)
+				} else {
+					http.Error(w, "cannot verify signature", http.StatusInternalServerError)
+				}
+				return
+			}
+		}
+
+		switch n.Type {
+		case notificationType:
+			if err := r.Receive(req.Context(), n.toMessage()); err != nil {
+				s.logf(logger.Error, "cannot receive sns notification %s: %s", n.MessageID, err)
+				http.Error(w, "receiver failed", http.StatusInternalServerError)
+				return
+			}
+
+		case subscriptionConfirmationType:
+			if err := s.confirmSubscription(req.Context(), &n); err != nil {
+				s.logf(logger.Error, "cannot confirm subscription to %s: %s", n.TopicArn, err)
+				http.Error(w, "cannot confirm subscription", http.StatusInternalServerError)
+				return
+			}
+			s.logf(logger.Info, "confirmed subscription to %s", n.TopicArn)
+
+		case unsubscribeConfirmationType:
+			s.logf(logger.Info, "unsubscribed from %s", n.TopicArn)
+
+		default:
+			http.Error(w, "unknown notification type", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// confirmSubscription confirms a subscription by visiting its SubscribeURL.
+func (s *HTTPServer) confirmSubscription(ctx context.Context, n *notification) error {
+	req, err := http.NewRequest(http.MethodGet, n.SubscribeURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// toMessage returns the message published in the notification.
+func (n *notification) toMessage() *msg.Message {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       strings.NewReader(n.Message),
+	}
+	for k, v := range n.MessageAttributes {
+		m.Attributes.Set(k, v.Value)
+	}
+
+	return m
+}
+
+// logf logs a message at level to the Logger of the HTTPServer.
+func (s *HTTPServer) logf(level logger.Level, format string, args ...interface{}) {
+	l := s.logger
+	if l == nil {
+		l = logger.Default
+	}
+	l.Logf(level, format, args...)
+}
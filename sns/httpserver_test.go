@@ -0,0 +1,76 @@
+package sns
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that an HTTPServer confirms subscriptions, passes notifications to
+// its receiver, and rejects the notifications of other topics.
+func TestHTTPServer(t *testing.T) {
+	const topicARN = "arn:aws:sns:us-west-2:123456789012:orders"
+
+	confirmed := 0
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("Token") == "token" {
+			confirmed++
+		}
+	}))
+	defer aws.Close()
+
+	s, err := NewHTTPServer(":0", WithAllowedTopics(topicARN), WithServerLogger(logger.Nop), WithoutVerification())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var received []string
+	endpoint := httptest.NewServer(s.Handler(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b, _ := ioutil.ReadAll(m.Body)
+		if string(b) == "fail" {
+			return errors.New("failed")
+		}
+		received = append(received, string(b)+" for "+m.Attributes.Get("Tenant"))
+		return nil
+	})))
+	defer endpoint.Close()
+
+	post := func(body string) int {
+		resp, err := http.Post(endpoint.URL, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	cases := []struct {
+		body   string
+		status int
+	}{
+		{`{"Type":"SubscriptionConfirmation","TopicArn":"` + topicARN + `","SubscribeURL":"` + aws.URL + `/?Action=ConfirmSubscription&Token=token"}`, http.StatusOK},
+		{`{"Type":"Notification","TopicArn":"` + topicARN + `","Message":"hello","MessageAttributes":{"Tenant":{"Type":"String","Value":"acme"}}}`, http.StatusOK},
+		{`{"Type":"Notification","TopicArn":"` + topicARN + `","Message":"fail"}`, http.StatusInternalServerError},
+		{`{"Type":"Notification","TopicArn":"arn:aws:sns:us-west-2:123456789012:other","Message":"hello"}`, http.StatusForbidden},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if status := post(c.body); status != c.status {
+			t.Errorf("Expected status %d for %s, got %d", c.status, c.body, status)
+		}
+	}
+
+	if confirmed != 1 {
+		t.Errorf("Expected the subscription to be confirmed, got %d confirmations", confirmed)
+	}
+	if len(received) != 1 || received[0] != "hello for acme" {
+		t.Errorf("Expected 1 notification to be received, got %v", received)
+	}
+}
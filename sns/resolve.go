@@ -0,0 +1,92 @@
+package sns
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+)
+
+// resolveTopic returns the ARN of the topic used by a Topic.
+//
+// If ensureAttributes is not nil, the topic (called name, or named after
+// topicARN) is created with those attributes if it does not already exist.
+// Otherwise, if name is set, its ARN is resolved using ListTopics.
+// In any other case topicARN is returned as is.
+func resolveTopic(svc snsiface.SNSAPI, topicARN, name string, ensureAttributes map[string]string) (string, error) {
+	if ensureAttributes != nil {
+		if name == "" {
+			name = topicName(topicARN)
+		}
+
+		arn, err := createTopic(svc, name, ensureAttributes)
+		if err != nil {
+			return "", fmt.Errorf("cannot create topic %s: %w", name, err)
+		}
+
+		return arn, nil
+	}
+
+	if name != "" {
+		arn, err := findTopic(svc, name)
+		if err != nil {
+			return "", fmt.Errorf("cannot resolve topic %s: %w", name, err)
+		}
+
+		return arn, nil
+	}
+
+	return topicARN, nil
+}
+
+// findTopic returns the ARN of the topic called name, listing the topics of
+// the account with ListTopics.
+func findTopic(svc snsiface.SNSAPI, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("topic name must not be empty")
+	}
+
+	var arn string
+	err := svc.ListTopicsPages(&sns.ListTopicsInput{}, func(page *sns.ListTopicsOutput, lastPage bool) bool {
+		for _, t := range page.Topics {
+			if topicName(aws.StringValue(t.TopicArn)) == name {
+				arn = aws.StringValue(t.TopicArn)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if arn == "" {
+		return "", errors.New("topic not found")
+	}
+
+	return arn, nil
+}
+
+// createTopic creates the topic called name with the given attributes and
+// returns its ARN. CreateTopic is idempotent: if the topic already exists
+// with the same attributes, its ARN is returned.
+func createTopic(svc snsiface.SNSAPI, name string, attributes map[string]string) (string, error) {
+	if name == "" {
+		return "", errors.New("topic name must not be empty")
+	}
+
+	params := &sns.CreateTopicInput{
+		Name: aws.String(name),
+	}
+	if len(attributes) > 0 {
+		params.Attributes = aws.StringMap(attributes)
+	}
+
+	resp, err := svc.CreateTopic(params)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(resp.TopicArn), nil
+}
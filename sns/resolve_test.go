@@ -0,0 +1,72 @@
+package sns
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+)
+
+// mockTopicsAPI lists topics over pages of 2, and creates topics.
+type mockTopicsAPI struct {
+	snsiface.SNSAPI
+
+	topics  []string
+	created []*sns.CreateTopicInput
+}
+
+func (s *mockTopicsAPI) ListTopicsPages(input *sns.ListTopicsInput, fn func(*sns.ListTopicsOutput, bool) bool) error {
+	for i := 0; i < len(s.topics); i += 2 {
+		page := &sns.ListTopicsOutput{}
+		for _, arn := range s.topics[i:minInt(i+2, len(s.topics))] {
+			page.Topics = append(page.Topics, &sns.Topic{TopicArn: aws.String(arn)})
+		}
+		if !fn(page, i+2 >= len(s.topics)) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *mockTopicsAPI) CreateTopic(input *sns.CreateTopicInput) (*sns.CreateTopicOutput, error) {
+	s.created = append(s.created, input)
+	return &sns.CreateTopicOutput{TopicArn: aws.String("arn:aws:sns:us-west-2:123456789012:" + *input.Name)}, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestResolveTopic(t *testing.T) {
+	svc := &mockTopicsAPI{topics: []string{
+		"arn:aws:sns:us-west-2:123456789012:orders",
+		"arn:aws:sns:us-west-2:123456789012:billing",
+		"arn:aws:sns:us-west-2:123456789012:events",
+	}}
+
+	arn, err := resolveTopic(svc, "", "events", nil)
+	if err != nil || arn != "arn:aws:sns:us-west-2:123456789012:events" {
+		t.Errorf("Expected the ARN of events to be resolved, got %q, %v", arn, err)
+	}
+
+	if _, err := resolveTopic(svc, "", "missing", nil); err == nil {
+		t.Errorf("Expected an error resolving a missing topic")
+	}
+
+	arn, err = resolveTopic(svc, "arn:aws:sns:us-west-2:123456789012:jobs", "", map[string]string{"DisplayName": "Jobs"})
+	if err != nil || arn != "arn:aws:sns:us-west-2:123456789012:jobs" {
+		t.Errorf("Expected the jobs topic to be created, got %q, %v", arn, err)
+	}
+	if len(svc.created) != 1 || aws.StringValue(svc.created[0].Attributes["DisplayName"]) != "Jobs" {
+		t.Errorf("Expected CreateTopic to be called with the attributes, got %v", svc.created)
+	}
+
+	arn, err = resolveTopic(svc, "arn:aws:sns:us-west-2:123456789012:orders", "", nil)
+	if err != nil || arn != "arn:aws:sns:us-west-2:123456789012:orders" {
+		t.Errorf("Expected the ARN to be used as is, got %q, %v", arn, err)
+	}
+}
@@ -0,0 +1,262 @@
+package sns
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidSignature is matched by the errors returned by Verifier.Verify
+// when a notification is not signed by SNS.
+var ErrInvalidSignature = errors.New("invalid sns signature")
+
+// maxCertSize bounds the size of the signing certificates downloaded by a
+// Verifier.
+const maxCertSize = 64 * 1024
+
+// CertCache caches the signing certificates of SNS by URL, so that they are
+// only downloaded once. It must be safe for concurrent use.
+type CertCache interface {
+	Get(certURL string) (*x509.Certificate, bool)
+	Put(certURL string, cert *x509.Certificate)
+}
+
+// memoryCertCache is a CertCache keeping certificates in memory.
+type memoryCertCache struct {
+	mux   sync.RWMutex
+	certs map[string]*x509.Certificate
+}
+
+func (c *memoryCertCache) Get(certURL string) (*x509.Certificate, bool) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	cert, ok := c.certs[certURL]
+	return cert, ok
+}
+
+func (c *memoryCertCache) Put(certURL string, cert *x509.Certificate) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.certs[certURL] = cert
+}
+
+// Verifier verifies that notifications were signed by SNS, as sent to HTTP/S
+// endpoints or to SQS queues subscribed without raw message delivery.
+type Verifier struct {
+	domains []string     // domains of the hosts serving signing certificates
+	cache   CertCache    // signing certificates by URL
+	client  *http.Client // downloads signing certificates
+}
+
+// VerifierOption is the signature that modifies a `Verifier` to set some
+// configuration.
+type VerifierOption func(*Verifier) error
+
+// WithSigningDomains makes the `Verifier` only download signing certificates
+// from the SNS endpoints of `domains`, e.g. "sns.us-west-2.amazonaws.com" for
+// "amazonaws.com", instead of the domains of the AWS commercial and China
+// partitions.
+func WithSigningDomains(domains ...string) VerifierOption {
+	return func(v *Verifier) error {
+		if len(domains) == 0 {
+			return errors.New("signing domains must not be empty")
+		}
+		v.domains = domains
+		return nil
+	}
+}
+
+// WithCertCache makes the `Verifier` cache signing certificates in `cache`,
+// instead of in memory.
+func WithCertCache(cache CertCache) VerifierOption {
+	return func(v *Verifier) error {
+		if cache == nil {
+			return errors.New("cert cache must not be nil")
+		}
+		v.cache = cache
+		return nil
+	}
+}
+
+// WithCertHTTPClient makes the `Verifier` download signing certificates with
+// `client`, instead of an http.Client with a 10 second timeout.
+func WithCertHTTPClient(client *http.Client) VerifierOption {
+	return func(v *Verifier) error {
+		if client == nil {
+			return errors.New("http client must not be nil")
+		}
+		v.client = client
+		return nil
+	}
+}
+
+// NewVerifier returns a Verifier of the notifications of SNS.
+func NewVerifier(opts ...VerifierOption) (*Verifier, error) {
+	v := &Verifier{
+		domains: []string{"amazonaws.com", "amazonaws.com.cn"},
+		cache:   &memoryCertCache{certs: make(map[string]*x509.Certificate)},
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	return v, nil
+}
+
+// Verify verifies the signature of the JSON notification `body`, returning
+// an error matching ErrInvalidSignature if it was not signed by SNS.
+func (v *Verifier) Verify(body []byte) error {
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+
+	return v.verify(&n)
+}
+
+// verify verifies the signature of the notification `n`.
+func (v *Verifier) verify(n *notification) error {
+	var h hash.Hash
+	var algorithm crypto.Hash
+	switch n.SignatureVersion {
+	case "1":
+		h, algorithm = sha1.New(), crypto.SHA1
+	case "2":
+		h, algorithm = sha256.New(), crypto.SHA256
+	default:
+		return fmt.Errorf("%w: unsupported signature version %q", ErrInvalidSignature, n.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(n.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+
+	cert, err := v.signingCert(n.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: signing certificate has no RSA key", ErrInvalidSignature)
+	}
+
+	io.WriteString(h, n.stringToSign())
+	if err := rsa.VerifyPKCS1v15(key, algorithm, h.Sum(nil), signature); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+
+	return nil
+}
+
+// signingCert returns the certificate at `certURL`, from the cache or
+// downloaded if the URL is an SNS endpoint of the allowed domains.
+func (v *Verifier) signingCert(certURL string) (*x509.Certificate, error) {
+	if cert, ok := v.cache.Get(certURL); ok {
+		return cert, nil
+	}
+
+	u, err := url.Parse(certURL)
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Path, ".pem") || !v.isSigningHost(u.Hostname()) {
+		return nil, fmt.Errorf("%w: untrusted signing certificate URL %q", ErrInvalidSignature, certURL)
+	}
+
+	resp, err := v.client.Get(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot download signing certificate: unexpected status %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCertSize))
+	if err != nil {
+		return nil, fmt.Errorf("cannot download signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%w: signing certificate is not PEM encoded", ErrInvalidSignature)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+
+	v.cache.Put(certURL, cert)
+
+	return cert, nil
+}
+
+// isSigningHost reports whether host is the SNS endpoint of a region in one
+// of the allowed domains, e.g. "sns.us-west-2.amazonaws.com".
+func (v *Verifier) isSigningHost(host string) bool {
+	if !strings.HasPrefix(host, "sns.") {
+		return false
+	}
+
+	for _, d := range v.domains {
+		region := strings.TrimSuffix(host[len("sns."):], "."+d)
+		if region != host[len("sns."):] && region != "" && !strings.Contains(region, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signedNotificationFields and signedConfirmationFields are the fields of notifications, and of subscription and
+// unsubscribe confirmations, signed by SNS, in the order they are signed.
+var (
+	signedNotificationFields = []string{"Message", "MessageId", "Subject", "Timestamp", "TopicArn", "Type"}
+	signedConfirmationFields = []string{"Message", "MessageId", "SubscribeURL", "Timestamp", "Token", "TopicArn", "Type"}
+)
+
+// stringToSign returns the fields of the notification signed by SNS.
+func (n *notification) stringToSign() string {
+	values := map[string]string{
+		"Message":      n.Message,
+		"MessageId":    n.MessageID,
+		"Subject":      n.Subject,
+		"SubscribeURL": n.SubscribeURL,
+		"Timestamp":    n.Timestamp,
+		"Token":        n.Token,
+		"TopicArn":     n.TopicArn,
+		"Type":         n.Type,
+	}
+
+	fields := signedConfirmationFields
+	if n.Type == notificationType {
+		fields = signedNotificationFields
+	}
+
+	var b strings.Builder
+	for _, name := range fields {
+		// the subject is only signed when the message has one
+		if name == "Subject" && n.Subject == "" {
+			continue
+		}
+		b.WriteString(name + "\n" + values[name] + "\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,184 @@
+package sns
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+const testCertURL = "https://sns.us-west-2.amazonaws.com/SimpleNotificationService-test.pem"
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// newSigningCert returns a key and a self-signed certificate, PEM encoded,
+// to sign notifications with.
+func newSigningCert(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// sign signs `n` with `key`, returning its JSON representation.
+func sign(t *testing.T, n *notification, key *rsa.PrivateKey) []byte {
+	n.SignatureVersion = "2"
+	n.SigningCertURL = testCertURL
+
+	digest := sha256.Sum256([]byte(n.stringToSign()))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	n.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return b
+}
+
+// newTestVerifier returns a Verifier downloading the certificate `certPEM`
+// from any URL, and counting the downloads.
+func newTestVerifier(t *testing.T, certPEM []byte, downloads *int) *Verifier {
+	v, err := NewVerifier(WithCertHTTPClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		*downloads++
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(certPEM))}, nil
+	})}))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return v
+}
+
+func TestVerifier(t *testing.T) {
+	key, certPEM := newSigningCert(t)
+	downloads := 0
+	v := newTestVerifier(t, certPEM, &downloads)
+
+	n := &notification{
+		Type:      notificationType,
+		MessageID: "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		TopicArn:  "arn:aws:sns:us-west-2:123456789012:orders",
+		Message:   "hello",
+		Timestamp: "2012-05-02T00:54:06.655Z",
+	}
+	body := sign(t, n, key)
+
+	for i := 0; i < 2; i++ {
+		if err := v.Verify(body); err != nil {
+			t.Errorf("Expected the notification to be verified, got %s", err)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("Expected the certificate to be downloaded once, got %d", downloads)
+	}
+
+	tampered := bytes.Replace(body, []byte(`"hello"`), []byte(`"hacked"`), 1)
+	if err := v.Verify(tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a tampered notification, got %v", err)
+	}
+
+	confirmation := &notification{
+		Type:         subscriptionConfirmationType,
+		MessageID:    "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		Token:        "token",
+		TopicArn:     "arn:aws:sns:us-west-2:123456789012:orders",
+		SubscribeURL: "https://sns.us-west-2.amazonaws.com/?Action=ConfirmSubscription",
+		Timestamp:    "2012-04-26T20:45:04.751Z",
+	}
+	if err := v.Verify(sign(t, confirmation, key)); err != nil {
+		t.Errorf("Expected the confirmation to be verified, got %s", err)
+	}
+}
+
+func TestVerifier_UntrustedCertURL(t *testing.T) {
+	key, certPEM := newSigningCert(t)
+	downloads := 0
+	v := newTestVerifier(t, certPEM, &downloads)
+
+	for _, certURL := range []string{
+		"http://sns.us-west-2.amazonaws.com/cert.pem",
+		"https://sns.us-west-2.amazonaws.com.evil.com/cert.pem",
+		"https://attacker.s3.amazonaws.com/cert.pem",
+		"https://sns.us-west-2.amazonaws.com/cert.txt",
+	} {
+		n := &notification{Type: notificationType, Message: "hello"}
+		sign(t, n, key)
+		n.SigningCertURL = certURL
+		body, _ := json.Marshal(n)
+
+		if err := v.Verify(body); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Expected ErrInvalidSignature for %s, got %v", certURL, err)
+		}
+	}
+	if downloads != 0 {
+		t.Errorf("Expected no certificate to be downloaded, got %d", downloads)
+	}
+}
+
+// Tests that an HTTPServer rejects notifications not signed by SNS.
+func TestHTTPServer_Verification(t *testing.T) {
+	key, certPEM := newSigningCert(t)
+	downloads := 0
+	s, err := NewHTTPServer(":0", WithVerifier(newTestVerifier(t, certPEM, &downloads)), WithServerLogger(logger.Nop))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	endpoint := httptest.NewServer(s.Handler(nil))
+	defer endpoint.Close()
+
+	n := &notification{Type: "Unknown", TopicArn: "arn:aws:sns:us-west-2:123456789012:orders"}
+	signed := sign(t, n, key)
+	n.Signature = base64.StdEncoding.EncodeToString([]byte("forged"))
+	forged, _ := json.Marshal(n)
+
+	for body, status := range map[string]int{
+		string(signed): http.StatusBadRequest, // verified, but of an unknown type
+		string(forged): http.StatusForbidden,
+	} {
+		resp, err := http.Post(endpoint.URL, "application/json", bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Expected status %d, got %d", status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// The protocols of SNS subscriptions, whose message can be set with
+// SetProtocolMessage.
+const (
+	ProtocolSQS         = "sqs"
+	ProtocolLambda      = "lambda"
+	ProtocolHTTP        = "http"
+	ProtocolHTTPS       = "https"
+	ProtocolEmail       = "email"
+	ProtocolEmailJSON   = "email-json"
+	ProtocolSMS         = "sms"
+	ProtocolApplication = "application"
+	ProtocolFirehose    = "firehose"
+)
+
+// messageStructureJSON is the MessageStructure of messages holding a
+// message per protocol.
+const messageStructureJSON = "json"
+
+// SetProtocolMessage sets the message delivered to the subscriptions using
+// `protocol`, e.g. ProtocolEmail, instead of the body written to the
+// MessageWriter, which is delivered to the subscriptions using any other
+// protocol. The message is then published with the "json" MessageStructure.
+//
+// Decorators of the MessageWriter, such as the base64 encoding of NewTopic,
+// only apply to the body. See the SetProtocolMessage function for the
+// MessageWriters of a Topic created with NewTopic.
+func (w *MessageWriter) SetProtocolMessage(protocol, message string) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.protocolMessages == nil {
+		w.protocolMessages = make(map[string]string)
+	}
+	w.protocolMessages[protocol] = message
+}
+
+// SetProtocolMessage sets the message delivered to the subscriptions using
+// `protocol` on `w`, a MessageWriter of a Topic created with NewTopic or
+// NewUnencodedTopic, see MessageWriter.SetProtocolMessage. It returns an
+// error if `w` is neither.
+func SetProtocolMessage(w msg.MessageWriter, protocol, message string) error {
+	mw, ok := unwrapWriter(w)
+	if !ok {
+		return fmt.Errorf("cannot set protocol message: unsupported MessageWriter %T", w)
+	}
+
+	mw.SetProtocolMessage(protocol, message)
+
+	return nil
+}
+
+// structuredMessage returns the JSON object holding the message of each
+// protocol, and the body as the default message.
+func (w *MessageWriter) structuredMessage() (string, error) {
+	messages := make(map[string]string, len(w.protocolMessages)+1)
+	for protocol, message := range w.protocolMessages {
+		messages[protocol] = message
+	}
+	messages["default"] = w.buf.String()
+
+	b, err := json.Marshal(messages)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,120 @@
+package sns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that messages set per protocol are published with the json
+// MessageStructure, the body being the default message.
+func TestMessageWriter_SetProtocolMessage(t *testing.T) {
+	sent := make(chan *sns.PublishInput, 1)
+	topic := &Topic{Svc: &mockSNSAPI{sentParamChan: sent, t: t}, TopicARN: "test-arn"}
+
+	w := topic.NewWriter(context.Background()).(*MessageWriter)
+	w.SetProtocolMessage(ProtocolEmail, "Your order shipped")
+	w.SetProtocolMessage(ProtocolSQS, `{"order":42}`)
+	w.Write([]byte("order 42 shipped"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	params := <-sent
+	if aws.StringValue(params.MessageStructure) != "json" {
+		t.Errorf("Expected MessageStructure json, got %v", params.MessageStructure)
+	}
+
+	var messages map[string]string
+	if err := json.Unmarshal([]byte(aws.StringValue(params.Message)), &messages); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	expected := map[string]string{
+		"default": "order 42 shipped",
+		"email":   "Your order shipped",
+		"sqs":     `{"order":42}`,
+	}
+	if len(messages) != len(expected) {
+		t.Errorf("Expected messages %v, got %v", expected, messages)
+	}
+	for protocol, message := range expected {
+		if messages[protocol] != message {
+			t.Errorf("Expected %s message %q, got %q", protocol, message, messages[protocol])
+		}
+	}
+}
+
+// Tests that messages can be set per protocol on the MessageWriters of a
+// Topic created with NewTopic, which base64-encodes the body only.
+func TestSetProtocolMessage_NewTopic(t *testing.T) {
+	published := make(chan url.Values, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		published <- r.PostForm
+		fmt.Fprintln(w, `
+<PublishResponse xmlns="http://sns.amazonaws.com/doc/2010-03-31/">
+  <PublishResult>
+    <MessageId>94f20ce6-13c5-43a0-9a9e-ca52d816e90b</MessageId>
+  </PublishResult>
+  <ResponseMetadata>
+    <RequestId>f187a3c1-376f-11df-8963-01868b7c937a</RequestId>
+  </ResponseMetadata>
+</PublishResponse>`)
+	}))
+	defer ts.Close()
+
+	os.Setenv("SNS_ENDPOINT", ts.URL)
+	os.Setenv("AWS_ACCESS_KEY_ID", "fake")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "fake")
+	defer func() {
+		os.Unsetenv("SNS_ENDPOINT")
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	}()
+
+	topic, err := NewTopic("arn:aws:sns:us-west-2:777777777777:orders")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	w := topic.NewWriter(context.Background())
+	if err := SetProtocolMessage(w, ProtocolEmail, "Your order shipped"); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	w.Write([]byte("order 42 shipped"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	form := <-published
+	if s := form.Get("MessageStructure"); s != "json" {
+		t.Errorf("Expected MessageStructure json, got %q", s)
+	}
+	var messages map[string]string
+	if err := json.Unmarshal([]byte(form.Get("Message")), &messages); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	expected := map[string]string{
+		"default": base64.StdEncoding.EncodeToString([]byte("order 42 shipped")),
+		"email":   "Your order shipped",
+	}
+	for protocol, message := range expected {
+		if messages[protocol] != message {
+			t.Errorf("Expected %s message %q, got %q", protocol, message, messages[protocol])
+		}
+	}
+
+	if err := SetProtocolMessage(&struct{ msg.MessageWriter }{}, ProtocolEmail, "Your order shipped"); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+}
@@ -0,0 +1,145 @@
+package sns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// SubscriptionOption configures the subscription created by SubscribeQueue.
+type SubscriptionOption func(*subscription)
+
+type subscription struct {
+	attributes map[string]*string
+}
+
+// WithRawMessageDelivery makes SNS deliver messages to the queue as is,
+// instead of wrapped in a JSON notification.
+func WithRawMessageDelivery() SubscriptionOption {
+	return func(s *subscription) {
+		s.attributes["RawMessageDelivery"] = aws.String("true")
+	}
+}
+
+// WithFilterPolicy makes SNS only deliver to the queue the messages whose
+// attributes match the JSON filter `policy`, e.g. `{"Tenant": ["acme"]}`.
+func WithFilterPolicy(policy string) SubscriptionOption {
+	return func(s *subscription) {
+		s.attributes["FilterPolicy"] = aws.String(policy)
+	}
+}
+
+// SubscribeQueue subscribes the SQS queue at `queueURL` to the topic
+// `topicARN`, returning the ARN of the subscription. The access policy of the
+// queue is updated, unless it already does, to allow the topic to send
+// messages to the queue.
+//
+// SubscribeQueue is idempotent, so that services can call it on every start:
+// subscribing a queue again with the same options returns the existing
+// subscription.
+func SubscribeQueue(ctx context.Context, snsSvc snsiface.SNSAPI, sqsSvc sqsiface.SQSAPI, topicARN, queueURL string, opts ...SubscriptionOption) (string, error) {
+	s := &subscription{attributes: map[string]*string{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	attrs, err := sqsSvc.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn, sqs.QueueAttributeNamePolicy}),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot get attributes of queue %s: %w", queueURL, err)
+	}
+	queueARN := aws.StringValue(attrs.Attributes[sqs.QueueAttributeNameQueueArn])
+
+	policy, changed, err := allowTopic(aws.StringValue(attrs.Attributes[sqs.QueueAttributeNamePolicy]), queueARN, topicARN)
+	if err != nil {
+		return "", fmt.Errorf("cannot update policy of queue %s: %w", queueURL, err)
+	}
+	if changed {
+		if _, err := sqsSvc.SetQueueAttributesWithContext(ctx, &sqs.SetQueueAttributesInput{
+			QueueUrl:   aws.String(queueURL),
+			Attributes: map[string]*string{sqs.QueueAttributeNamePolicy: aws.String(policy)},
+		}); err != nil {
+			return "", fmt.Errorf("cannot update policy of queue %s: %w", queueURL, err)
+		}
+	}
+
+	input := &sns.SubscribeInput{
+		TopicArn:              aws.String(topicARN),
+		Protocol:              aws.String("sqs"),
+		Endpoint:              aws.String(queueARN),
+		ReturnSubscriptionArn: aws.Bool(true),
+	}
+	if len(s.attributes) > 0 {
+		input.Attributes = s.attributes
+	}
+
+	out, err := snsSvc.SubscribeWithContext(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("cannot subscribe queue %s to topic %s: %w", queueURL, topicARN, err)
+	}
+
+	return aws.StringValue(out.SubscriptionArn), nil
+}
+
+// nonAlphanumeric matches the characters not allowed in the Sid of a
+// policy statement.
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// allowTopic adds to the access policy of the queue `queueARN` a statement
+// allowing the topic `topicARN` to send messages to the queue, unless a
+// statement with the same Sid exists. It returns the policy, and whether
+// it was changed.
+func allowTopic(policy, queueARN, topicARN string) (string, bool, error) {
+	doc := map[string]interface{}{}
+	if policy != "" {
+		if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+			return "", false, err
+		}
+	}
+	if _, ok := doc["Version"]; !ok {
+		doc["Version"] = "2012-10-17"
+	}
+
+	// Statement is either a list of statements or a single statement
+	var statements []interface{}
+	switch s := doc["Statement"].(type) {
+	case []interface{}:
+		statements = s
+	case map[string]interface{}:
+		statements = []interface{}{s}
+	}
+
+	sid := "AllowSNS" + nonAlphanumeric.ReplaceAllString(topicName(topicARN), "")
+	for _, s := range statements {
+		if s, ok := s.(map[string]interface{}); ok && s["Sid"] == sid {
+			return policy, false, nil
+		}
+	}
+
+	doc["Statement"] = append(statements, map[string]interface{}{
+		"Sid":       sid,
+		"Effect":    "Allow",
+		"Principal": map[string]interface{}{"Service": "sns.amazonaws.com"},
+		"Action":    "sqs:SendMessage",
+		"Resource":  queueARN,
+		"Condition": map[string]interface{}{
+			"ArnEquals": map[string]interface{}{"aws:SourceArn": topicARN},
+		},
+	})
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(b), true, nil
+}
@@ -0,0 +1,91 @@
+package sns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// mockQueueAPI stores the attributes of a queue.
+type mockQueueAPI struct {
+	sqsiface.SQSAPI
+
+	attributes   map[string]*string
+	policyWrites int
+}
+
+func (s *mockQueueAPI) GetQueueAttributesWithContext(ctx aws.Context, input *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	return &sqs.GetQueueAttributesOutput{Attributes: s.attributes}, nil
+}
+
+func (s *mockQueueAPI) SetQueueAttributesWithContext(ctx aws.Context, input *sqs.SetQueueAttributesInput, opts ...request.Option) (*sqs.SetQueueAttributesOutput, error) {
+	for k, v := range input.Attributes {
+		s.attributes[k] = v
+	}
+	s.policyWrites++
+	return &sqs.SetQueueAttributesOutput{}, nil
+}
+
+// mockSubscribeAPI records Subscribe calls.
+type mockSubscribeAPI struct {
+	snsiface.SNSAPI
+
+	subscribed []*sns.SubscribeInput
+}
+
+func (s *mockSubscribeAPI) SubscribeWithContext(ctx aws.Context, input *sns.SubscribeInput, opts ...request.Option) (*sns.SubscribeOutput, error) {
+	s.subscribed = append(s.subscribed, input)
+	return &sns.SubscribeOutput{SubscriptionArn: aws.String(*input.TopicArn + ":1234")}, nil
+}
+
+// Tests that SubscribeQueue subscribes the queue with the given attributes,
+// and only adds the topic to the queue policy once.
+func TestSubscribeQueue(t *testing.T) {
+	const (
+		topicARN = "arn:aws:sns:us-west-2:123456789012:order-events"
+		queueARN = "arn:aws:sqs:us-west-2:123456789012:billing"
+		queueURL = "https://sqs.us-west-2.amazonaws.com/123456789012/billing"
+	)
+
+	sqsSvc := &mockQueueAPI{attributes: map[string]*string{
+		sqs.QueueAttributeNameQueueArn: aws.String(queueARN),
+		sqs.QueueAttributeNamePolicy:   aws.String(`{"Version":"2012-10-17","Statement":{"Sid":"Existing","Effect":"Deny"}}`),
+	}}
+	snsSvc := &mockSubscribeAPI{}
+
+	for i := 0; i < 2; i++ {
+		arn, err := SubscribeQueue(context.Background(), snsSvc, sqsSvc, topicARN, queueURL,
+			WithRawMessageDelivery(), WithFilterPolicy(`{"Tenant":["acme"]}`))
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if arn != topicARN+":1234" {
+			t.Errorf("Unexpected subscription ARN %s", arn)
+		}
+	}
+
+	if sqsSvc.policyWrites != 1 {
+		t.Errorf("Expected the policy to be written once, got %d", sqsSvc.policyWrites)
+	}
+	policy := aws.StringValue(sqsSvc.attributes[sqs.QueueAttributeNamePolicy])
+	for _, s := range []string{`"Sid":"Existing"`, `"Sid":"AllowSNSorderevents"`, `"aws:SourceArn":"` + topicARN + `"`, `"Resource":"` + queueARN + `"`} {
+		if !strings.Contains(policy, s) {
+			t.Errorf("Expected the policy to contain %s, got %s", s, policy)
+		}
+	}
+
+	sub := snsSvc.subscribed[0]
+	if aws.StringValue(sub.Protocol) != "sqs" || aws.StringValue(sub.Endpoint) != queueARN {
+		t.Errorf("Unexpected subscription %v", sub)
+	}
+	if aws.StringValue(sub.Attributes["RawMessageDelivery"]) != "true" || aws.StringValue(sub.Attributes["FilterPolicy"]) != `{"Tenant":["acme"]}` {
+		t.Errorf("Unexpected subscription attributes %v", sub.Attributes)
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"net/textproto"
 	"os"
 	"strings"
 	"sync"
@@ -14,10 +15,16 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/hdtradeservices/go-aws-msg/internal/awssession"
+	"github.com/hdtradeservices/go-aws-msg/internal/unwrap"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/metrics"
 	msg "github.com/hdtradeservices/go-msg"
 	b64 "github.com/hdtradeservices/go-msg/decorators/base64"
 	"github.com/zerofox-oss/go-aws-msg/retryer"
@@ -27,7 +34,14 @@ import (
 type Topic struct {
 	Svc      snsiface.SNSAPI
 	TopicARN string
+	logger   logger.Logger    // where MessageWriters log; logger.Default when nil
+	metrics  metrics.Recorder // where MessageWriters report metrics; none when nil
+	batcher  *publishBatcher  // publishes messages with PublishBatch calls when set
+	defaults msg.Attributes   // attributes every message is created with
 	session  *session.Session
+
+	name   string            // name of the topic whose ARN is resolved by NewTopic
+	ensure map[string]string // attributes of the topic created by NewTopic if it does not exist
 }
 
 func getConf(t *Topic) (*aws.Config, error) {
@@ -41,6 +55,169 @@ func getConf(t *Topic) (*aws.Config, error) {
 // Option is the signature that modifies a `Topic` to set some configuration
 type Option func(*Topic) error
 
+// WithSession makes the `Topic` use an SNS client created from `sess`,
+// e.g. shared with the rest of the application, instead of the session and
+// configuration NewTopic creates from the environment. `cfgs` override the
+// configuration of `sess` for the SNS client only, e.g. its Region.
+//
+// Unlike the client created by NewTopic, it does not retry on credential
+// errors unless WithRetries is passed after it.
+func WithSession(sess *session.Session, cfgs ...*aws.Config) Option {
+	return func(t *Topic) error {
+		if sess == nil {
+			return errors.New("session must not be nil")
+		}
+		t.session = sess
+		t.Svc = sns.New(sess, cfgs...)
+		return nil
+	}
+}
+
+// WithEnvCredentials makes the `Topic` only read AWS credentials from the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables, instead
+// of using the default credential chain.
+func WithEnvCredentials() Option {
+	return func(t *Topic) error {
+		c, err := getConf(t)
+		if err != nil {
+			return err
+		}
+		c.Credentials = credentials.NewCredentials(&credentials.EnvProvider{})
+		t.Svc = sns.New(t.session, c)
+		return nil
+	}
+}
+
+// WithProfile makes the `Topic` use the credentials and region of the named
+// profile of the shared config and credentials files, e.g. ~/.aws/config,
+// instead of the profile in AWS_PROFILE, so that exporting AWS keys is not
+// needed to develop against real topics.
+func WithProfile(name string) Option {
+	return func(t *Topic) error {
+		if name == "" {
+			return errors.New("profile must not be empty")
+		}
+		c, err := getConf(t)
+		if err != nil {
+			return err
+		}
+		sess, err := awssession.New(aws.Config{}, name)
+		if err != nil {
+			return err
+		}
+		c.Credentials = sess.Config.Credentials
+		if region := aws.StringValue(sess.Config.Region); region != "" {
+			c.Region = aws.String(region)
+		}
+		t.session = sess
+		t.Svc = sns.New(sess, c)
+		return nil
+	}
+}
+
+// WithRegion makes the `Topic` call SNS in the AWS `region`, instead of the
+// one set by the AWS_REGION environment variable, or us-west-2.
+func WithRegion(region string) Option {
+	return func(t *Topic) error {
+		if region == "" {
+			return errors.New("region must not be empty")
+		}
+		c, err := getConf(t)
+		if err != nil {
+			return err
+		}
+		c.Region = aws.String(region)
+		t.Svc = sns.New(t.session, c)
+		return nil
+	}
+}
+
+// WithEndpoint makes the `Topic` call SNS at `url`, instead of the one set
+// by the SNS_ENDPOINT environment variable or the endpoint of its region,
+// e.g. to use a local SNS implementation.
+func WithEndpoint(url string) Option {
+	return func(t *Topic) error {
+		if url == "" {
+			return errors.New("endpoint must not be empty")
+		}
+		c, err := getConf(t)
+		if err != nil {
+			return err
+		}
+		c.Endpoint = aws.String(url)
+		t.Svc = sns.New(t.session, c)
+		return nil
+	}
+}
+
+// WithFIPSEndpoint makes the `Topic` call the FIPS 140-2 compliant SNS
+// endpoint of its region, e.g. as required in GovCloud.
+func WithFIPSEndpoint() Option {
+	return func(t *Topic) error {
+		c, err := getConf(t)
+		if err != nil {
+			return err
+		}
+		c.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+		t.Svc = sns.New(t.session, c)
+		return nil
+	}
+}
+
+// WithDualStackEndpoint makes the `Topic` call the dual-stack SNS endpoint
+// of its region, which is reachable over both IPv4 and IPv6, e.g. from an
+// IPv6-only VPC.
+func WithDualStackEndpoint() Option {
+	return func(t *Topic) error {
+		c, err := getConf(t)
+		if err != nil {
+			return err
+		}
+		c.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+		t.Svc = sns.New(t.session, c)
+		return nil
+	}
+}
+
+// WithHTTPClient makes the SNS client of the `Topic` send its requests with
+// `client`, e.g. to configure connection pooling, dial timeouts or proxies.
+func WithHTTPClient(client *http.Client) Option {
+	return func(t *Topic) error {
+		if client == nil {
+			return errors.New("http client must not be nil")
+		}
+		c, err := getConf(t)
+		if err != nil {
+			return err
+		}
+		c.HTTPClient = client
+		t.Svc = sns.New(t.session, c)
+		return nil
+	}
+}
+
+// WithAssumeRole makes the `Topic` assume the IAM role `roleARN` with STS,
+// e.g. to publish to a topic owned by another AWS account. The credentials
+// of the client are used to assume the role, and the temporary credentials
+// are refreshed before they expire. `externalID` may be left empty if the
+// role does not require one.
+func WithAssumeRole(roleARN, externalID string) Option {
+	return func(t *Topic) error {
+		c, err := getConf(t)
+		if err != nil {
+			return err
+		}
+		sess := t.session.Copy(&aws.Config{Credentials: c.Credentials})
+		c.Credentials = stscreds.NewCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+			if externalID != "" {
+				p.ExternalID = aws.String(externalID)
+			}
+		})
+		t.Svc = sns.New(t.session, c)
+		return nil
+	}
+}
+
 // WithCustomRetryer sets a custom `Retryer` to use on the SQS client.
 func WithCustomRetryer(r request.Retryer) Option {
 	return func(t *Topic) error {
@@ -73,6 +250,75 @@ func WithRetries(delay time.Duration, max int) Option {
 	}
 }
 
+// WithLogger sets the Logger MessageWriters of the `Topic` log to,
+// instead of logger.Default, which silences TRACE and DEBUG messages.
+func WithLogger(l logger.Logger) Option {
+	return func(t *Topic) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+		t.logger = l
+		return nil
+	}
+}
+
+// WithMetrics makes MessageWriters of the `Topic` report metrics about
+// the messages they publish and their Publish calls to r.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(t *Topic) error {
+		if r == nil {
+			return errors.New("metrics recorder must not be nil")
+		}
+		t.metrics = r
+		return nil
+	}
+}
+
+// WithDefaultAttributes makes MessageWriters of the `Topic` create every
+// message with a copy of `attrs`, e.g. the name of the service, its
+// environment and the version of the schema of the messages. They can be
+// overridden for a message through MessageWriter.Attributes.
+func WithDefaultAttributes(attrs map[string][]string) Option {
+	return func(t *Topic) error {
+		if len(attrs) == 0 {
+			return errors.New("default attributes must not be empty")
+		}
+		t.defaults = make(msg.Attributes, len(attrs))
+		for k, v := range attrs {
+			t.defaults[textproto.CanonicalMIMEHeaderKey(k)] = append([]string(nil), v...)
+		}
+		return nil
+	}
+}
+
+// WithTopicName makes NewTopic resolve the ARN of the topic called `name`
+// using ListTopics, instead of using the topicARN it was passed, which may
+// be empty.
+func WithTopicName(name string) Option {
+	return func(t *Topic) error {
+		if name == "" {
+			return errors.New("topic name must not be empty")
+		}
+		t.name = name
+		return nil
+	}
+}
+
+// WithEnsureTopic makes NewTopic create the topic, with the given attributes
+// (e.g. FifoTopic), if it does not already exist. The topic is named after
+// the topicARN passed to NewTopic, or the name set with WithTopicName.
+//
+// This is mostly useful for local development and ephemeral environments.
+func WithEnsureTopic(attributes map[string]string) Option {
+	return func(t *Topic) error {
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+		t.ensure = attributes
+		return nil
+	}
+}
+
 // NewTopic returns a sns.Topic with fully configured SNSAPI.
 //
 // Note: SQS has limited support for unicode characters.
@@ -85,18 +331,59 @@ func NewTopic(topicARN string, opts ...Option) (msg.Topic, error) {
 	if err != nil {
 		return nil, err
 	}
-	return b64.Encoder(topic), nil
+
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		w := topic.NewWriter(ctx)
+		single := msg.TopicFunc(func(context.Context) msg.MessageWriter { return w })
+
+		return &encodedWriter{
+			MessageWriter: b64.Encoder(single).NewWriter(ctx),
+			unencoded:     w,
+		}
+	}), nil
+}
+
+// encodedWriter is a MessageWriter of a Topic created with NewTopic,
+// base64-encoding the body written to it, which gives access to the
+// MessageWriter publishing the encoded message, see SetProtocolMessage.
+type encodedWriter struct {
+	msg.MessageWriter
+
+	unencoded msg.MessageWriter
+}
+
+// Unwrap returns the MessageWriter publishing the encoded message.
+func (w *encodedWriter) Unwrap() msg.MessageWriter {
+	return w.unencoded
+}
+
+// unwrapWriter returns the *MessageWriter `w` is, or wraps.
+func unwrapWriter(w msg.MessageWriter) (*MessageWriter, bool) {
+	mw, ok := unwrap.Find(w, func(w msg.MessageWriter) bool {
+		_, ok := w.(*MessageWriter)
+		return ok
+	}).(*MessageWriter)
+
+	return mw, ok
 }
 
 // NewUnencodedTopic creates an concrete SNS msg.Topic
 //
 // Messages published by the `Topic` returned will not
 // have the body base64-encoded.
+//
+// AWS credentials are resolved with the default credential chain of the SDK:
+// environment variables, shared credentials file, web identity token, then
+// ECS task role or EC2 instance profile. See WithEnvCredentials to only use
+// environment variables. Credentials assumed with a web identity token, e.g.
+// on EKS with IAM Roles for Service Accounts, are refreshed a few minutes
+// before they expire.
+//
+// The profile in AWS_PROFILE is used, and its region too when the shared
+// config file is loaded with AWS_SDK_LOAD_CONFIG, see WithProfile. Otherwise,
+// the region defaults to us-west-2.
 func NewUnencodedTopic(topicARN string, opts ...Option) (msg.Topic, error) {
-	conf := &aws.Config{
-		Credentials: credentials.NewCredentials(&credentials.EnvProvider{}),
-		Region:      aws.String("us-west-2"),
-	}
+	conf := &aws.Config{}
 
 	// You may override AWS_REGION, SNS_ENDPOINT
 	// http://docs.aws.amazon.com/sdk-for-go/api/aws/client/#Config
@@ -107,11 +394,16 @@ func NewUnencodedTopic(topicARN string, opts ...Option) (msg.Topic, error) {
 		conf.Endpoint = aws.String(url)
 	}
 
-	sess, err := session.NewSession(conf)
+	sess, err := awssession.New(*conf, "")
 	if err != nil {
 		return nil, err
 	}
 
+	// the region of the shared config file is used if it is loaded
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String("us-west-2")
+	}
+
 	t := &Topic{
 		Svc:      sns.New(sess),
 		TopicARN: topicARN,
@@ -129,17 +421,29 @@ func NewUnencodedTopic(topicARN string, opts ...Option) (msg.Topic, error) {
 		}
 	}
 
+	if t.TopicARN, err = resolveTopic(t.Svc, t.TopicARN, t.name, t.ensure); err != nil {
+		return nil, err
+	}
+
 	return t, nil
 }
 
 // NewWriter returns a sns.MessageWriter instance for writing to
 // the configured SNS topic.
 func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	attributes := make(msg.Attributes, len(t.defaults))
+	for k, v := range t.defaults {
+		attributes[k] = append([]string(nil), v...)
+	}
+
 	return &MessageWriter{
-		attributes: make(map[string][]string),
+		attributes: attributes,
 		snsClient:  t.Svc,
 		topicARN:   t.TopicARN,
 		ctx:        ctx,
+		logger:     t.logger,
+		metrics:    t.metrics,
+		batcher:    t.batcher,
 	}
 }
 
@@ -156,7 +460,12 @@ type MessageWriter struct {
 	snsClient snsiface.SNSAPI
 	topicARN  string
 
-	ctx context.Context
+	ctx     context.Context
+	logger  logger.Logger
+	metrics metrics.Recorder
+	batcher *publishBatcher
+
+	protocolMessages map[string]string // messages delivered instead of the body, by protocol
 }
 
 // Attributes returns the msg.Attributes associated with the MessageWriter.
@@ -187,11 +496,57 @@ func (w *MessageWriter) Close() error {
 		params.MessageAttributes = buildSNSAttributes(w.Attributes())
 	}
 
-	log.Printf("[TRACE] writing to sns: %v", params)
+	if len(w.protocolMessages) > 0 {
+		message, err := w.structuredMessage()
+		if err != nil {
+			return err
+		}
+		params.Message = aws.String(message)
+		params.MessageStructure = aws.String(messageStructureJSON)
+	}
+
+	if w.batcher != nil {
+		err := w.batcher.publish(w.ctx, &sns.PublishBatchRequestEntry{
+			Message:           params.Message,
+			MessageAttributes: params.MessageAttributes,
+			MessageStructure:  params.MessageStructure,
+		})
+		if w.metrics != nil {
+			w.metrics.ObservePublish(topicName(w.topicARN), err)
+		}
+		return err
+	}
+
+	w.logf(logger.Trace, "writing %d bytes to sns topic %s", len(aws.StringValue(params.Message)), w.topicARN)
+	start := time.Now()
 	_, err := w.snsClient.PublishWithContext(w.ctx, params)
+	if w.metrics != nil {
+		w.metrics.ObserveAPICall("Publish", time.Since(start), err)
+		w.metrics.ObservePublish(topicName(w.topicARN), err)
+	}
 	return err
 }
 
+// logf logs a message at level to the Logger of the Topic,
+// or logger.Default if it has none.
+func (t *Topic) logf(level logger.Level, format string, args ...interface{}) {
+	l := t.logger
+	if l == nil {
+		l = logger.Default
+	}
+	l.Logf(level, format, args...)
+}
+
+// logf logs a message at level to the Logger of the MessageWriter,
+// or logger.Default if it has none.
+func (w *MessageWriter) logf(level logger.Level, format string, args ...interface{}) {
+	l := w.logger
+	if l == nil {
+		l = logger.Default
+	}
+	l.Logf(level, format, args...)
+}
+
 // Write writes data to the MessageWriter's internal buffer for aggregation
 // before a .Close()
 //
@@ -207,6 +562,12 @@ func (w *MessageWriter) Write(p []byte) (int, error) {
 	return w.buf.Write(p)
 }
 
+// topicName returns the name of a topic from its ARN,
+// e.g. "events" for arn:aws:sns:us-west-2:123456789012:events.
+func topicName(topicARN string) string {
+	return topicARN[strings.LastIndex(topicARN, ":")+1:]
+}
+
 // buildSNSAttributes converts msg.Attributes into SNS message attributes.
 // uses csv encoding to use AWS's String datatype
 func buildSNSAttributes(a *msg.Attributes) map[string]*sns.MessageAttributeValue {
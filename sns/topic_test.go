@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	msg "github.com/hdtradeservices/go-msg"
 )
@@ -216,3 +218,206 @@ func TestMessageWriter_Close_retryer(t *testing.T) {
 		})
 	}
 }
+
+// Tests that the client created with WithSession uses the configuration of
+// the session, overridden by the configs passed.
+func TestWithSession(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+
+	topic, err := NewUnencodedTopic("arn:aws:sns:eu-west-1:123456789012:events", WithSession(sess))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if region := aws.StringValue(topic.(*Topic).Svc.(*sns.SNS).Client.Config.Region); region != "eu-west-1" {
+		t.Errorf("Expected the region of the session, got %s", region)
+	}
+
+	topic, err = NewUnencodedTopic("arn:aws:sns:us-east-1:123456789012:events", WithSession(sess, &aws.Config{Region: aws.String("us-east-1")}))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if region := aws.StringValue(topic.(*Topic).Svc.(*sns.SNS).Client.Config.Region); region != "us-east-1" {
+		t.Errorf("Expected the region of the config, got %s", region)
+	}
+}
+
+// Tests that the Topic reads credentials with the default credential chain,
+// unless WithEnvCredentials is set.
+func TestNewUnencodedTopic_Credentials(t *testing.T) {
+	f, err := ioutil.TempFile("", "credentials")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprint(f, "[default]\naws_access_key_id = fromfile\naws_secret_access_key = secret\n")
+	f.Close()
+
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", f.Name())
+	defer os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+
+	topic, err := NewUnencodedTopic("arn:aws:sns:us-west-2:123456789012:events")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	creds, err := topic.(*Topic).Svc.(*sns.SNS).Client.Config.Credentials.Get()
+	if err != nil || creds.AccessKeyID != "fromfile" {
+		t.Errorf("Expected credentials from the shared credentials file, got %v, %v", creds.AccessKeyID, err)
+	}
+
+	topic, err = NewUnencodedTopic("arn:aws:sns:us-west-2:123456789012:events", WithEnvCredentials())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if _, err := topic.(*Topic).Svc.(*sns.SNS).Client.Config.Credentials.Get(); err == nil {
+		t.Errorf("Expected no credentials to be found in the environment")
+	}
+}
+
+// Tests that WithAssumeRole assumes the role with the external ID.
+func TestWithAssumeRole(t *testing.T) {
+	var roleARN, externalID string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roleARN, externalID = r.FormValue("RoleArn"), r.FormValue("ExternalId")
+		fmt.Fprint(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>assumed</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>
+<SessionToken>token</SessionToken><Expiration>2100-01-01T00:00:00Z</Expiration>
+</Credentials></AssumeRoleResult></AssumeRoleResponse>`)
+	}))
+	defer sts.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(sts.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+
+	topic, err := NewUnencodedTopic("arn:aws:sns:us-west-2:210987654321:events", WithSession(sess), WithAssumeRole("arn:aws:iam::210987654321:role/publisher", "external"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	creds, err := topic.(*Topic).Svc.(*sns.SNS).Client.Config.Credentials.Get()
+	if err != nil || creds.AccessKeyID != "assumed" {
+		t.Errorf("Expected assumed credentials, got %v, %v", creds.AccessKeyID, err)
+	}
+	if roleARN != "arn:aws:iam::210987654321:role/publisher" || externalID != "external" {
+		t.Errorf("Expected the role to be assumed with the external ID, got %s and %s", roleARN, externalID)
+	}
+}
+
+// Tests that WithRegion and WithEndpoint override the environment.
+func TestWithRegionAndEndpoint(t *testing.T) {
+	os.Setenv("SNS_ENDPOINT", "http://localhost:4566")
+	defer os.Unsetenv("SNS_ENDPOINT")
+
+	topic, err := NewUnencodedTopic("arn:aws:sns:eu-west-1:123456789012:events", WithRegion("eu-west-1"), WithEndpoint("http://localhost:9911"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	c := topic.(*Topic).Svc.(*sns.SNS).Client
+	if region := aws.StringValue(c.Config.Region); region != "eu-west-1" {
+		t.Errorf("Expected region eu-west-1, got %s", region)
+	}
+	if c.Endpoint != "http://localhost:9911" {
+		t.Errorf("Expected endpoint http://localhost:9911, got %s", c.Endpoint)
+	}
+
+	if _, err := NewUnencodedTopic("arn:aws:sns:eu-west-1:123456789012:events", WithRegion("")); err == nil {
+		t.Errorf("Expected error for an empty region")
+	}
+}
+
+// Tests that WithHTTPClient sets the HTTP client of the SNS client.
+func TestWithHTTPClient(t *testing.T) {
+	client := &http.Client{Timeout: time.Minute}
+
+	topic, err := NewUnencodedTopic("arn:aws:sns:us-west-2:123456789012:events", WithHTTPClient(client))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if c := topic.(*Topic).Svc.(*sns.SNS).Client.Config.HTTPClient; c != client {
+		t.Errorf("Expected the HTTP client to be used, got %v", c)
+	}
+}
+
+// Tests that the FIPS and dual-stack options resolve the matching endpoints.
+func TestFIPSAndDualStackEndpoints(t *testing.T) {
+	cases := map[string]struct {
+		opt      Option
+		expected string
+	}{
+		"fips":       {WithFIPSEndpoint(), "https://sns-fips.us-east-1.amazonaws.com"},
+		"dual-stack": {WithDualStackEndpoint(), "https://sns.us-east-1.api.aws"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			topic, err := NewUnencodedTopic("arn:aws:sns:us-east-1:123456789012:events", WithRegion("us-east-1"), c.opt)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if endpoint := topic.(*Topic).Svc.(*sns.SNS).Client.Endpoint; endpoint != c.expected {
+				t.Errorf("Expected endpoint %s, got %s", c.expected, endpoint)
+			}
+		})
+	}
+}
+
+// Tests that the Topic uses the credentials and region of the profile passed
+// to WithProfile.
+func TestWithProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/config", []byte("[profile dev]\nregion = eu-central-1\n"), 0600)
+	ioutil.WriteFile(dir+"/credentials", []byte("[dev]\naws_access_key_id = dev\naws_secret_access_key = secret\n"), 0600)
+
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	os.Setenv("AWS_CONFIG_FILE", dir+"/config")
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", dir+"/credentials")
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+	defer os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+
+	topic, err := NewUnencodedTopic("arn:aws:sns:eu-central-1:123456789012:events", WithProfile("dev"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	c := topic.(*Topic).Svc.(*sns.SNS).Client.Config
+	if region := aws.StringValue(c.Region); region != "eu-central-1" {
+		t.Errorf("Expected the region of the profile, got %s", region)
+	}
+	creds, err := c.Credentials.Get()
+	if err != nil || creds.AccessKeyID != "dev" {
+		t.Errorf("Expected the credentials of the profile, got %v, %v", creds.AccessKeyID, err)
+	}
+}
+
+// Tests that WithDefaultAttributes sets a copy of the default attributes on
+// every MessageWriter.
+func TestWithDefaultAttributes(t *testing.T) {
+	tpc := &Topic{TopicARN: "test-arn"}
+	if err := WithDefaultAttributes(map[string][]string{"service": {"billing"}})(tpc); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	w := tpc.NewWriter(context.Background())
+	if v := w.Attributes().Get("Service"); v != "billing" {
+		t.Errorf("Expected attribute Service to be %q, got %q", "billing", v)
+	}
+
+	w.Attributes().Set("Service", "shipping")
+	if v := tpc.NewWriter(context.Background()).Attributes().Get("Service"); v != "billing" {
+		t.Errorf("Expected the default attributes to be left unchanged, got %q", v)
+	}
+
+	if err := WithDefaultAttributes(nil)(tpc); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+}
@@ -0,0 +1,185 @@
+// Package sns implements msg.Topic for Amazon SNS on top of the AWS SDK for
+// Go v2. It is a separate module from github.com/hdtradeservices/go-aws-msg/sns,
+// which is built on the AWS SDK for Go v1, and offers the same msg.Topic
+// surface.
+package sns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	msg "github.com/hdtradeservices/go-msg"
+	b64 "github.com/hdtradeservices/go-msg/decorators/base64"
+)
+
+// PublishAPI is the subset of the SNS client used by a Topic.
+type PublishAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// Topic configures and manages the SNS client for sns.MessageWriter.
+type Topic struct {
+	Svc      PublishAPI
+	TopicARN string
+}
+
+// Option is the signature that modifies a `Topic` to set some configuration
+type Option func(*Topic) error
+
+// WithClient makes the `Topic` use `svc` instead of the SNS client created
+// from the shared AWS configuration, e.g. to share a client configured by
+// the application, or to use a fake in tests.
+func WithClient(svc PublishAPI) Option {
+	return func(t *Topic) error {
+		if svc == nil {
+			return errors.New("client must not be nil")
+		}
+		t.Svc = svc
+		return nil
+	}
+}
+
+// WithConfig makes the `Topic` create its SNS client from `cfg`.
+// `optFns` customize the SNS client only.
+func WithConfig(cfg aws.Config, optFns ...func(*sns.Options)) Option {
+	return func(t *Topic) error {
+		t.Svc = sns.NewFromConfig(cfg, optFns...)
+		return nil
+	}
+}
+
+// NewTopic returns a sns.Topic with fully configured SNS client.
+//
+// Messages published by the `Topic` returned will
+// have the body base64-encoded.
+// You may use NewUnencodedTopic if you wish to ignore the encoding step.
+func NewTopic(topicARN string, opts ...Option) (msg.Topic, error) {
+	topic, err := NewUnencodedTopic(topicARN, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return b64.Encoder(topic), nil
+}
+
+// NewUnencodedTopic creates an concrete SNS msg.Topic
+//
+// Messages published by the `Topic` returned will not
+// have the body base64-encoded.
+//
+// The SNS client is created from the shared AWS configuration, loaded with
+// config.LoadDefaultConfig, unless WithClient or WithConfig is passed.
+func NewUnencodedTopic(topicARN string, opts ...Option) (msg.Topic, error) {
+	t := &Topic{TopicARN: topicARN}
+
+	for _, opt := range opts {
+		if err := opt(t); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	if t.Svc == nil {
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		t.Svc = sns.NewFromConfig(cfg)
+	}
+
+	return t, nil
+}
+
+// NewWriter returns a sns.MessageWriter instance for writing to
+// the configured SNS topic.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		attributes: make(map[string][]string),
+		snsClient:  t.Svc,
+		topicARN:   t.TopicARN,
+		ctx:        ctx,
+	}
+}
+
+// MessageWriter writes data to an output SNS topic as configured via its
+// topicARN.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	attributes msg.Attributes
+	buf        bytes.Buffer
+	closed     bool
+	mux        sync.Mutex
+
+	snsClient PublishAPI
+	topicARN  string
+
+	ctx context.Context
+}
+
+// Attributes returns the msg.Attributes associated with the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// Close converts the MessageWriter's Body and Attributes to sns.PublishInput
+// in order to publish itself to the MessageWriter's snsClient.
+//
+// On the first call to Close, the MessageWriter is set to "isClosed" therefore
+// blocking subsequent Close and Write calls.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	params := &sns.PublishInput{
+		Message:  aws.String(w.buf.String()),
+		TopicArn: aws.String(w.topicARN),
+	}
+
+	if len(*w.Attributes()) > 0 {
+		params.MessageAttributes = buildSNSAttributes(w.Attributes())
+	}
+
+	_, err := w.snsClient.Publish(w.ctx, params)
+	return err
+}
+
+// Write writes data to the MessageWriter's internal buffer for aggregation
+// before a .Close()
+//
+// After a MessageWriter's .Close() method has been called, it is no longer
+// available for .Write() calls.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
+
+// buildSNSAttributes converts msg.Attributes into SNS message attributes.
+// uses csv encoding to use AWS's String datatype
+func buildSNSAttributes(a *msg.Attributes) map[string]types.MessageAttributeValue {
+	attrs := make(map[string]types.MessageAttributeValue)
+
+	for k, v := range *a {
+		attrs[k] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(strings.Join(v, ",")),
+		}
+	}
+	return attrs
+}
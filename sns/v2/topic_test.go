@@ -0,0 +1,67 @@
+package sns
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// mockSNSAPI records the messages published.
+type mockSNSAPI struct {
+	published []*sns.PublishInput
+}
+
+func (m *mockSNSAPI) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.published = append(m.published, params)
+	return &sns.PublishOutput{MessageId: aws.String("published")}, nil
+}
+
+// Tests that MessageWriter.Close publishes the body and attributes of the
+// message, base64-encoded by a Topic created with NewTopic.
+func TestMessageWriter_Close(t *testing.T) {
+	cases := map[string]struct {
+		newTopic func(string, ...Option) (msg.Topic, error)
+		expected string
+	}{
+		"encoded":   {NewTopic, base64.StdEncoding.EncodeToString([]byte("hello"))},
+		"unencoded": {NewUnencodedTopic, "hello"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			mockSNS := &mockSNSAPI{}
+			topic, err := c.newTopic("arn:aws:sns:us-west-2:123456789012:events", WithClient(mockSNS))
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			w := topic.NewWriter(context.Background())
+			w.Attributes().Set("Tenant", "acme")
+			if _, err := w.Write([]byte("hello")); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			if len(mockSNS.published) != 1 {
+				t.Fatalf("Expected 1 message to be published, got %d", len(mockSNS.published))
+			}
+			in := mockSNS.published[0]
+			if aws.ToString(in.Message) != c.expected || aws.ToString(in.TopicArn) != "arn:aws:sns:us-west-2:123456789012:events" {
+				t.Errorf("Unexpected message or topic: %s, %s", aws.ToString(in.Message), aws.ToString(in.TopicArn))
+			}
+			if aws.ToString(in.MessageAttributes["Tenant"].StringValue) != "acme" {
+				t.Errorf("Expected attribute Tenant to be acme, got %v", in.MessageAttributes)
+			}
+
+			if err := w.Close(); err != msg.ErrClosedMessageWriter {
+				t.Errorf("Expected msg.ErrClosedMessageWriter, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package sqs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ackOutcome is the outcome of a message decided through its Acker.
+type ackOutcome int
+
+const (
+	ackDefault ackOutcome = iota // decided by the error returned by the receiver
+	ackAck
+	ackNack
+	ackDiscard
+)
+
+// Acker lets a receiver decide the outcome of the message it is processing,
+// instead of the Server deciding it from the error the receiver returned.
+// It is retrieved from the receiver's context with AckerFromContext.
+//
+// Only the first call to Ack, Nack or Discard is taken into account, and
+// only once the receiver returned. Calls on a nil Acker are ignored, so that
+// receivers may be used with other servers than this package's.
+type Acker struct {
+	mux     sync.Mutex
+	outcome ackOutcome
+	delay   time.Duration
+}
+
+type ackerKey struct{}
+
+// AckerFromContext returns the Acker of the message being processed with ctx,
+// or nil if ctx is not the context of a receiver called by a Server.
+func AckerFromContext(ctx context.Context) *Acker {
+	a, _ := ctx.Value(ackerKey{}).(*Acker)
+	return a
+}
+
+// contextWithAcker returns a copy of ctx carrying a.
+func contextWithAcker(ctx context.Context, a *Acker) context.Context {
+	return context.WithValue(ctx, ackerKey{}, a)
+}
+
+// Ack deletes the message once the receiver returns,
+// even if it returns an error.
+func (a *Acker) Ack() {
+	a.decide(ackAck, 0)
+}
+
+// Nack makes the message visible again after delay once the receiver
+// returns, even if it returns nil. The delay is rounded down to the second,
+// and capped at the 12 hour maximum allowed by SQS. Unlike a failed message,
+// a nacked message is never forwarded to the dead-letter Topic.
+func (a *Acker) Nack(delay time.Duration) {
+	a.decide(ackNack, delay)
+}
+
+// Discard deletes the message once the receiver returns, without retrying
+// it nor forwarding it to the dead-letter Topic, and counts it as skipped
+// rather than processed, as returning ErrSkipMessage does. It is meant for
+// messages which can never be processed, e.g. because they are malformed.
+func (a *Acker) Discard() {
+	a.decide(ackDiscard, 0)
+}
+
+func (a *Acker) decide(outcome ackOutcome, delay time.Duration) {
+	if a == nil {
+		return
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if a.outcome == ackDefault {
+		a.outcome = outcome
+		a.delay = delay
+	}
+}
+
+// result returns the outcome decided through a, and the delay of a Nack.
+func (a *Acker) result() (ackOutcome, time.Duration) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	return a.outcome, a.delay
+}
@@ -0,0 +1,93 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that the outcome decided through the Acker overrides
+// the error returned by the receiver.
+func TestServer_Acker(t *testing.T) {
+	cases := []struct {
+		name     string
+		decide   func(a *Acker)
+		err      error
+		deletion bool
+	}{
+		{"ack with error", func(a *Acker) { a.Ack() }, errors.New("oops"), true},
+		{"discard", func(a *Acker) { a.Discard() }, errors.New("malformed"), true},
+		{"nack without error", func(a *Acker) { a.Nack(time.Minute) }, nil, false},
+		{"first decision wins", func(a *Acker) { a.Discard(); a.Nack(0) }, nil, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			msgs := newSQSMessages(1)
+			mockSQS := newMockSQSAPI(msgs, t)
+			srv := newMockServer(1, mockSQS)
+
+			r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+				c.decide(AckerFromContext(ctx))
+				return c.err
+			})
+
+			go srv.Serve(context.Background(), r)
+			defer srv.Shutdown(context.Background())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			var err error
+			if c.deletion {
+				err = mockSQS.WaitForAllDeletes(ctx)
+			} else {
+				err = mockSQS.WaitForVisibilityTimeouts(ctx)
+			}
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+		})
+	}
+}
+
+// Tests that messages for which the receiver returns ErrSkipMessage are
+// deleted and counted as skipped.
+func TestServer_ErrSkipMessage(t *testing.T) {
+	msgs := newSQSMessages(2)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		return fmt.Errorf("invalid payload: %w", ErrSkipMessage)
+	})
+
+	go srv.Serve(context.Background(), r)
+	defer srv.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if stats := srv.Stats(); stats.Skipped != 2 || stats.Failed != 0 || stats.Succeeded != 0 {
+		t.Errorf("Expected 2 skipped messages, got %+v", stats)
+	}
+}
+
+func TestAckerFromContext(t *testing.T) {
+	a := AckerFromContext(context.Background())
+	if a != nil {
+		t.Fatalf("Expected no Acker, got %v", a)
+	}
+
+	// calls on a nil Acker are ignored
+	a.Ack()
+	a.Nack(time.Second)
+	a.Discard()
+}
@@ -0,0 +1,169 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// AsyncSendError is passed to the error handler of a Topic sending messages
+// in the background, see WithTopicAsyncSend, when a message cannot be sent.
+type AsyncSendError struct {
+	// Body is the body of the message.
+	Body string
+	// Attributes are the message attributes of the message.
+	Attributes map[string]*sqs.MessageAttributeValue
+	// Err is the error of the sending of the message.
+	Err error
+}
+
+func (e *AsyncSendError) Error() string {
+	return fmt.Sprintf("cannot send message: %s", e.Err)
+}
+
+// Unwrap returns the error of the sending of the message.
+func (e *AsyncSendError) Unwrap() error {
+	return e.Err
+}
+
+// WithTopicAsyncSend makes MessageWriters of the `Topic` send their messages
+// in the background, from a pool of `workers` goroutines, so that Close
+// returns as soon as the message is queued, instead of blocking on an SQS
+// round-trip. Close only blocks when `bufferSize` messages are already
+// queued, until one is sent or the context of the MessageWriter is done.
+//
+// Messages which cannot be sent are passed to `onError` as an
+// *AsyncSendError, or logged if it is nil. Messages are sent with a
+// background context, as the context of their MessageWriter may be canceled
+// once Close returned, e.g. at the end of an HTTP request. Flush waits for
+// the queued messages to be sent, e.g. before the process exits.
+func WithTopicAsyncSend(workers, bufferSize int, onError func(error)) TopicOption {
+	return func(t *Topic) error {
+		if workers < 1 {
+			return errors.New("workers must be positive")
+		}
+		if bufferSize < 0 {
+			return errors.New("buffer size must not be negative")
+		}
+
+		t.async = &asyncSender{
+			topic:   t,
+			workers: workers,
+			queue:   make(chan *asyncEntry, bufferSize),
+			onError: onError,
+		}
+
+		return nil
+	}
+}
+
+// Flush blocks until the messages queued by MessageWriters of a Topic
+// created with WithTopicAsyncSend were sent or failed, or ctx is done, in
+// which case the error of ctx is returned. It returns immediately for other
+// Topics.
+func (t *Topic) Flush(ctx context.Context) error {
+	if t.async == nil {
+		return nil
+	}
+
+	a := t.async
+	a.mux.Lock()
+	if a.pending == 0 {
+		a.mux.Unlock()
+		return nil
+	}
+	if a.idle == nil {
+		a.idle = make(chan struct{})
+	}
+	idle := a.idle
+	a.mux.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// asyncEntry is a message queued by an asyncSender.
+type asyncEntry struct {
+	writer *MessageWriter
+	params *sqs.SendMessageInput
+}
+
+// asyncSender sends the messages of MessageWriters from a pool of
+// goroutines, started with the first message.
+type asyncSender struct {
+	topic   *Topic
+	workers int
+	queue   chan *asyncEntry
+	onError func(error) // called with the errors of messages; they are logged when nil
+
+	start sync.Once
+
+	mux     sync.Mutex
+	pending int           // messages queued and not sent yet
+	idle    chan struct{} // closed once pending drops to 0; nil when nobody waits
+}
+
+// enqueue queues the message `params` of `w` to be sent in the background.
+// It blocks while the queue is full, until the context of `w` is done.
+func (a *asyncSender) enqueue(w *MessageWriter, params *sqs.SendMessageInput) error {
+	a.start.Do(func() {
+		for i := 0; i < a.workers; i++ {
+			go a.run()
+		}
+	})
+
+	a.add(1)
+	select {
+	case a.queue <- &asyncEntry{writer: w, params: params}:
+		return nil
+	case <-w.ctx.Done():
+		a.add(-1)
+		return w.ctx.Err()
+	}
+}
+
+// add adds `n` to the number of pending messages, waking up Flush once
+// there are none.
+func (a *asyncSender) add(n int) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	a.pending += n
+	if a.pending == 0 && a.idle != nil {
+		close(a.idle)
+		a.idle = nil
+	}
+}
+
+// run sends the queued messages.
+func (a *asyncSender) run() {
+	for e := range a.queue {
+		if err := e.writer.send(context.Background(), e.params); err != nil {
+			a.fail(&AsyncSendError{
+				Body:       aws.StringValue(e.params.MessageBody),
+				Attributes: e.params.MessageAttributes,
+				Err:        err,
+			})
+		}
+		a.add(-1)
+	}
+}
+
+// fail reports the failure of the sending of a message.
+func (a *asyncSender) fail(err *AsyncSendError) {
+	if a.onError != nil {
+		a.onError(err)
+		return
+	}
+
+	a.topic.logf(logger.Error, "%s", err)
+}
@@ -0,0 +1,112 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// blockingSQSAPI blocks SendMessage calls until `release` is closed, and
+// fails those whose body is "fail".
+type blockingSQSAPI struct {
+	sqsiface.SQSAPI
+
+	release chan struct{}
+	mux     sync.Mutex
+	sent    []string
+}
+
+func (s *blockingSQSAPI) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	<-s.release
+
+	if aws.StringValue(input.MessageBody) == "fail" {
+		return nil, errors.New("send failed")
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.sent = append(s.sent, aws.StringValue(input.MessageBody))
+	return &sqs.SendMessageOutput{}, nil
+}
+
+// Tests that Close returns before the message is sent, that Flush waits for
+// the queued messages, and that failures are passed to the error handler.
+func TestWithTopicAsyncSend(t *testing.T) {
+	svc := &blockingSQSAPI{release: make(chan struct{})}
+	topic := &Topic{Svc: svc, QueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"}
+
+	var mux sync.Mutex
+	var failures []*AsyncSendError
+	onError := func(err error) {
+		mux.Lock()
+		defer mux.Unlock()
+		var sendErr *AsyncSendError
+		if errors.As(err, &sendErr) {
+			failures = append(failures, sendErr)
+		}
+	}
+	if err := WithTopicAsyncSend(2, 10, onError)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, body := range []string{"first", "fail", "second"} {
+		w := topic.NewWriter(ctx)
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+	// messages are sent even though the context of their writer is canceled
+	cancel()
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelFlush()
+	if err := topic.Flush(flushCtx); err != context.DeadlineExceeded {
+		t.Errorf("Expected Flush to wait for the blocked messages, got %v", err)
+	}
+
+	close(svc.release)
+	if err := topic.Flush(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if len(svc.sent) != 2 {
+		t.Errorf("Expected 2 messages to be sent, got %v", svc.sent)
+	}
+	if len(failures) != 1 || failures[0].Body != "fail" || failures[0].Err.Error() != "send failed" {
+		t.Errorf("Expected the failure to be passed to the error handler, got %v", failures)
+	}
+}
+
+// Tests that Close blocks while the queue is full, until the context of the
+// MessageWriter is done.
+func TestWithTopicAsyncSend_FullQueue(t *testing.T) {
+	svc := &blockingSQSAPI{release: make(chan struct{})}
+	defer close(svc.release)
+	topic := &Topic{Svc: svc, QueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"}
+	if err := WithTopicAsyncSend(1, 1, nil)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the worker blocks on the first message, the second fills the queue
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		w := topic.NewWriter(ctx)
+		w.Write([]byte("hello"))
+		err = w.Close()
+	}
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected Close to block until its context is done, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// autoscaler adjusts the number of active pollers, and the concurrency, of
+// a Server according to the depth of its queue.
+type autoscaler struct {
+	min, max int
+	interval time.Duration
+
+	active  int32 // number of active pollers, accessed atomically
+	mux     sync.Mutex
+	scaleCh chan struct{} // closed and replaced whenever active changes
+}
+
+// WithAutoscaling makes the `Server` scale its number of pollers between
+// `min` and `max` according to the depth of its queue. Every `interval`,
+// the ApproximateNumberOfMessages of the queue is read and enough pollers
+// are activated to receive all of them in a single round-trip.
+//
+// The concurrency is scaled along with the pollers, in proportion to the
+// concurrency set when Serve is called, which is only reached with `max`
+// pollers. Changes made with SetConcurrency while serving are overridden
+// the next time the pollers are scaled.
+//
+// This avoids over-provisioning pollers and receivers for bursty queues.
+// It overrides WithPollers.
+func WithAutoscaling(min, max int, interval time.Duration) Option {
+	return func(s *Server) error {
+		if min < 1 || max < min {
+			return fmt.Errorf("invalid pollers range: [%d, %d]. Must satisfy 1 <= min <= max", min, max)
+		}
+
+		if interval <= 0 {
+			return fmt.Errorf("invalid autoscaling interval: %s. Must be positive", interval)
+		}
+
+		s.pollers = max
+		s.autoscaler = &autoscaler{
+			min:      min,
+			max:      max,
+			interval: interval,
+			active:   int32(min),
+			scaleCh:  make(chan struct{}),
+		}
+
+		return nil
+	}
+}
+
+// run periodically scales the active pollers and the concurrency of s
+// until ctx is canceled.
+func (a *autoscaler) run(ctx context.Context, s *Server) {
+	concurrency := s.Concurrency()
+	s.SetConcurrency(a.concurrency(int(atomic.LoadInt32(&a.active)), concurrency))
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			depth, err := s.QueueDepth(ctx)
+			if err != nil {
+				s.logf(logger.Error, "autoscaling cannot read queue depth: %s", err)
+				continue
+			}
+
+			n := a.desiredPollers(depth.Visible, s.maxMessages)
+			if a.scale(n) {
+				c := a.concurrency(n, concurrency)
+				s.SetConcurrency(c)
+				s.logf(logger.Info, "autoscaling to %d pollers, concurrency %d", n, c)
+			}
+		}
+	}
+}
+
+// desiredPollers returns the number of pollers needed to receive
+// `depth` messages in a single round-trip, within the autoscaler bounds.
+func (a *autoscaler) desiredPollers(depth, maxMessages int64) int {
+	n := int((depth + maxMessages - 1) / maxMessages)
+
+	if n < a.min {
+		return a.min
+	}
+	if n > a.max {
+		return a.max
+	}
+
+	return n
+}
+
+// concurrency returns the share of the concurrency `limit` which goes with
+// `pollers` active pollers, rounded up.
+func (a *autoscaler) concurrency(pollers, limit int) int {
+	return (limit*pollers + a.max - 1) / a.max
+}
+
+// scale sets the number of active pollers to n, waking up pollers
+// waiting for activation. It reports whether the number changed.
+func (a *autoscaler) scale(n int) bool {
+	if atomic.SwapInt32(&a.active, int32(n)) == int32(n) {
+		return false
+	}
+
+	a.mux.Lock()
+	close(a.scaleCh)
+	a.scaleCh = make(chan struct{})
+	a.mux.Unlock()
+
+	return true
+}
+
+// waitForActivation blocks poller i while it is inactive, until the number
+// of active pollers changes or ctx is canceled. It reports whether it
+// blocked, in which case the caller should check whether ctx was canceled
+// and whether the poller is now active.
+func (a *autoscaler) waitForActivation(ctx context.Context, i int) bool {
+	a.mux.Lock()
+	scaleCh := a.scaleCh
+	a.mux.Unlock()
+
+	if i < int(atomic.LoadInt32(&a.active)) {
+		return false
+	}
+
+	select {
+	case <-scaleCh:
+	case <-ctx.Done():
+	}
+
+	return true
+}
@@ -0,0 +1,122 @@
+package sqs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAutoscaler_DesiredPollers(t *testing.T) {
+	a := &autoscaler{min: 2, max: 8}
+
+	cases := map[int64]int{
+		0:    2,
+		10:   2,
+		35:   4,
+		80:   8,
+		1000: 8,
+	}
+
+	for depth, pollers := range cases {
+		if n := a.desiredPollers(depth, 10); n != pollers {
+			t.Errorf("depth %d: expected %d pollers, got %d", depth, pollers, n)
+		}
+	}
+}
+
+func TestAutoscaler_Concurrency(t *testing.T) {
+	a := &autoscaler{min: 1, max: 4}
+
+	cases := map[int]int{
+		1: 3,
+		2: 5,
+		3: 8,
+		4: 10,
+	}
+
+	for pollers, concurrency := range cases {
+		if n := a.concurrency(pollers, 10); n != concurrency {
+			t.Errorf("%d pollers: expected a concurrency of %d, got %d", pollers, concurrency, n)
+		}
+	}
+}
+
+// Tests that inactive pollers are woken up when the autoscaler scales up.
+func TestAutoscaler_WaitForActivation(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithAutoscaling(1, 4, time.Second)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	a := srv.autoscaler
+
+	if a.waitForActivation(context.Background(), 0) {
+		t.Errorf("Expected poller 0 to be active")
+	}
+
+	woken := make(chan bool, 1)
+	go func() {
+		woken <- a.waitForActivation(context.Background(), 2)
+	}()
+
+	select {
+	case <-woken:
+		t.Fatalf("Expected poller 2 to be inactive")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	a.scale(3)
+	select {
+	case blocked := <-woken:
+		if !blocked {
+			t.Errorf("Expected poller 2 to wait for activation")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected poller 2 to be woken up")
+	}
+
+	if atomic.LoadInt32(&a.active) != 3 {
+		t.Errorf("Expected 3 active pollers, got %d", a.active)
+	}
+}
+
+// Tests that the autoscaler scales pollers and concurrency with the queue
+// depth.
+func TestAutoscaler_Run(t *testing.T) {
+	srv := newMockServer(20, newMockSQSAPI(newSQSMessages(45), t))
+	if err := WithAutoscaling(1, 10, 10*time.Millisecond)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.autoscaler.run(ctx, srv)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&srv.autoscaler.active) != 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 5 active pollers, got %d", atomic.LoadInt32(&srv.autoscaler.active))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for srv.Concurrency() != 10 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a concurrency of 10, got %d", srv.Concurrency())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithAutoscaling_ErrorOnInvalidBounds(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithAutoscaling(0, 4, time.Second)(srv); err == nil {
+		t.Errorf("Expected error for min < 1, received nil")
+	}
+	if err := WithAutoscaling(4, 2, time.Second)(srv); err == nil {
+		t.Errorf("Expected error for max < min, received nil")
+	}
+	if err := WithAutoscaling(1, 2, 0)(srv); err == nil {
+		t.Errorf("Expected error for zero interval, received nil")
+	}
+}
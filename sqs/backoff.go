@@ -0,0 +1,147 @@
+package sqs
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// BackoffFunc computes how long to wait before the next attempt,
+// given the number of attempts made so far (starting at 1).
+type BackoffFunc func(attempt int) time.Duration
+
+// ExponentialBackoff returns a BackoffFunc which doubles the delay on every
+// attempt, starting at `base` on the first attempt and never exceeding `max`.
+func ExponentialBackoff(base, max time.Duration) BackoffFunc {
+	return func(attempt int) time.Duration {
+		if attempt < 1 {
+			attempt = 1
+		}
+
+		d := float64(base) * math.Pow(2, float64(attempt-1))
+		if d > float64(max) {
+			return max
+		}
+
+		return time.Duration(d)
+	}
+}
+
+// FullJitter returns a BackoffFunc which picks a random delay between 0 and
+// the delay computed by f, to avoid many clients retrying in lockstep.
+func FullJitter(f BackoffFunc) BackoffFunc {
+	return func(attempt int) time.Duration {
+		d := f(attempt)
+		if d <= 0 {
+			return 0
+		}
+
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	}
+}
+
+// WithBackoffFunc makes the `Server` compute the visibility timeout of a
+// message whose receiver failed from the message's ApproximateReceiveCount,
+// instead of using the fixed retryTimeout. This lets poison messages back off
+// (e.g. with ExponentialBackoff) rather than being retried in a hot loop.
+//
+// The result is rounded down to the second and capped at the 12 hour maximum
+// allowed by SQS. WithRetryJitter has no effect when a BackoffFunc is set.
+func WithBackoffFunc(f BackoffFunc) Option {
+	return func(s *Server) error {
+		if f == nil {
+			return errors.New("backoff func must not be nil")
+		}
+
+		s.backoffFunc = f
+
+		return nil
+	}
+}
+
+// retryVisibilityTimeout returns the visibility timeout, in seconds,
+// to set on sqsMsg after its receiver failed with err.
+func (s *Server) retryVisibilityTimeout(sqsMsg *sqs.Message, err error) int64 {
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		return delayVisibilityTimeout(retryErr.Delay)
+	}
+
+	if s.backoffFunc == nil {
+		return getVisiblityTimeout(s.retryTimeout, s.retryJitter)
+	}
+
+	return delayVisibilityTimeout(s.backoffFunc(receiveCount(sqsMsg)))
+}
+
+// delayVisibilityTimeout returns the visibility timeout, in seconds, making
+// a message visible again after delay: rounded down to the second, and
+// capped at the 12 hour maximum allowed by SQS.
+func delayVisibilityTimeout(delay time.Duration) int64 {
+	timeout := int64(delay / time.Second)
+	if timeout < 0 {
+		return 0
+	}
+	if timeout > maxVisibilityTimeout {
+		return maxVisibilityTimeout
+	}
+
+	return timeout
+}
+
+// receiveCount returns the ApproximateReceiveCount of sqsMsg,
+// defaulting to 1 when it was not requested or cannot be parsed.
+func receiveCount(sqsMsg *sqs.Message) int {
+	v, ok := sqsMsg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]
+	if !ok || v == nil {
+		return 1
+	}
+
+	n, err := strconv.Atoi(*v)
+	if err != nil || n < 1 {
+		return 1
+	}
+
+	return n
+}
+
+// receiveAttributeNames returns the system attributes to request on
+// ReceiveMessage calls, adding ApproximateReceiveCount and the attributes
+// of FIFO messages when the Server needs them but they were not requested
+// through WithSystemAttributes.
+func (s *Server) receiveAttributeNames() []*string {
+	var required []string
+	if s.backoffFunc != nil || s.deadLetterTopic != nil {
+		required = append(required, sqs.MessageSystemAttributeNameApproximateReceiveCount)
+	}
+	if s.groups != nil {
+		required = append(required, fifoAttributeNames...)
+	}
+
+	names := s.attributeNames
+	for _, r := range required {
+		if !containsAttributeName(names, r) {
+			names = append(names[:len(names):len(names)], aws.String(r))
+		}
+	}
+
+	return names
+}
+
+// containsAttributeName reports whether requesting names returns the
+// attribute called name.
+func containsAttributeName(names []*string, name string) bool {
+	for _, n := range names {
+		switch aws.StringValue(n) {
+		case sqs.QueueAttributeNameAll, name:
+			return true
+		}
+	}
+
+	return false
+}
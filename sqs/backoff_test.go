@@ -0,0 +1,101 @@
+package sqs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	f := ExponentialBackoff(time.Second, 10*time.Second)
+	expected := map[int]time.Duration{
+		0:  time.Second,
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  8 * time.Second,
+		5:  10 * time.Second,
+		50: 10 * time.Second,
+	}
+
+	for attempt, d := range expected {
+		if got := f(attempt); got != d {
+			t.Errorf("attempt %d: expected %s, got %s", attempt, d, got)
+		}
+	}
+}
+
+func TestServer_RetryVisibilityTimeout_BackoffFunc(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithBackoffFunc(ExponentialBackoff(10*time.Second, time.Minute))(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	cases := map[string]int64{
+		"":    10, // attribute missing
+		"1":   10,
+		"3":   40,
+		"10":  60,
+		"bad": 10,
+	}
+
+	for count, timeout := range cases {
+		m := &sqs.Message{Attributes: map[string]*string{}}
+		if count != "" {
+			m.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount] = aws.String(count)
+		}
+
+		if got := srv.retryVisibilityTimeout(m, nil); got != timeout {
+			t.Errorf("receive count %q: expected visibility timeout %d, got %d", count, timeout, got)
+		}
+	}
+}
+
+// Tests that a RetryAfterError overrides the BackoffFunc, even when wrapped.
+func TestServer_RetryVisibilityTimeout_RetryAfter(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithBackoffFunc(ExponentialBackoff(10*time.Second, time.Minute))(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	m := &sqs.Message{Attributes: map[string]*string{}}
+	err := fmt.Errorf("downstream unavailable: %w", RetryAfter(5*time.Minute))
+	if got := srv.retryVisibilityTimeout(m, err); got != 300 {
+		t.Errorf("Expected visibility timeout 300, got %d", got)
+	}
+}
+
+func TestDelayVisibilityTimeout(t *testing.T) {
+	cases := map[time.Duration]int64{
+		-time.Second:            0,
+		1500 * time.Millisecond: 1,
+		24 * time.Hour:          maxVisibilityTimeout,
+	}
+
+	for delay, expected := range cases {
+		if timeout := delayVisibilityTimeout(delay); timeout != expected {
+			t.Errorf("Expected a timeout of %d for %s, got %d", expected, delay, timeout)
+		}
+	}
+}
+
+func TestServer_ReceiveAttributeNames(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithSystemAttributes(sqs.MessageSystemAttributeNameSentTimestamp)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if names := aws.StringValueSlice(srv.receiveAttributeNames()); len(names) != 1 {
+		t.Errorf("Expected only SentTimestamp to be requested, got %v", names)
+	}
+
+	if err := WithBackoffFunc(ExponentialBackoff(time.Second, time.Minute))(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	names := aws.StringValueSlice(srv.receiveAttributeNames())
+	if len(names) != 2 || names[1] != sqs.MessageSystemAttributeNameApproximateReceiveCount {
+		t.Errorf("Expected ApproximateReceiveCount to be requested, got %v", names)
+	}
+}
@@ -0,0 +1,363 @@
+package sqs
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// maxBatchSize is the maximum number of entries of an SQS batch request.
+const maxBatchSize = 10
+
+// maxBatchAttempts is the number of times an entry of a batch request is
+// sent before giving up on it.
+const maxBatchAttempts = 3
+
+// batchEntry is a message acknowledged through a batcher.
+type batchEntry struct {
+	receiptHandle     *string
+	visibilityTimeout int64       // only used when changing message visibility
+	attempts          int         // number of batch requests the entry was sent in
+	err               error       // error of the last batch request the entry was sent in
+	done              func(error) // called once the entry succeeded or was given up on; may be nil
+}
+
+// finish calls the done callback of e, if any, with its last error.
+func (e *batchEntry) finish() {
+	if e.done != nil {
+		e.done(e.err)
+	}
+}
+
+// batchFlushFunc sends a single batch request of up to maxBatchSize entries,
+// setting the err of each entry which failed. It returns the failed entries
+// which may be retried.
+type batchFlushFunc func(entries []*batchEntry) []*batchEntry
+
+// batcher accumulates entries and sends them with batch requests, either
+// once maxBatchSize entries are pending or every flush interval.
+type batcher struct {
+	name      string // used in logs
+	interval  time.Duration
+	flushFunc batchFlushFunc
+	logger    logger.Logger
+
+	mux     sync.Mutex
+	closed  bool
+	entries chan *batchEntry
+	done    chan struct{} // closed once every entry was flushed after close
+}
+
+// newBatcher returns a started batcher sending entries with flushFunc
+// and logging to l.
+func newBatcher(name string, interval time.Duration, flushFunc batchFlushFunc, l logger.Logger) *batcher {
+	b := &batcher{
+		name:      name,
+		interval:  interval,
+		flushFunc: flushFunc,
+		logger:    l,
+		entries:   make(chan *batchEntry, maxBatchSize),
+		done:      make(chan struct{}),
+	}
+
+	go b.run()
+
+	return b
+}
+
+// add queues e to be sent with the next batch request. It returns false
+// if the batcher was closed, in which case the caller must send e itself.
+func (b *batcher) add(e *batchEntry) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.closed {
+		return false
+	}
+
+	b.entries <- e
+
+	return true
+}
+
+// close flushes the pending entries and stops the batcher.
+// It blocks until every entry was sent or given up on.
+func (b *batcher) close() {
+	b.mux.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.entries)
+	}
+	b.mux.Unlock()
+
+	<-b.done
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]*batchEntry, 0, maxBatchSize)
+
+	for {
+		select {
+		case e, ok := <-b.entries:
+			if !ok {
+				for len(batch) > 0 {
+					batch = b.flush(batch)
+				}
+
+				return
+			}
+
+			batch = append(batch, e)
+			if len(batch) >= maxBatchSize {
+				batch = b.flush(batch)
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				batch = b.flush(batch)
+			}
+		}
+	}
+}
+
+// flush sends the first maxBatchSize entries of batch and returns the
+// entries left to send, including the failed entries which can be retried.
+func (b *batcher) flush(batch []*batchEntry) []*batchEntry {
+	n := len(batch)
+	if n > maxBatchSize {
+		n = maxBatchSize
+	}
+
+	sent := batch[:n]
+	for _, e := range sent {
+		e.attempts++
+		e.err = nil
+	}
+
+	remaining := make([]*batchEntry, 0, maxBatchSize)
+	remaining = append(remaining, batch[n:]...)
+
+	retry := map[*batchEntry]bool{}
+	for _, e := range b.flushFunc(sent) {
+		if e.attempts >= maxBatchAttempts {
+			b.logger.Logf(logger.Error, "%s: giving up after %d attempts", b.name, e.attempts)
+			continue
+		}
+
+		retry[e] = true
+		remaining = append(remaining, e)
+	}
+
+	for _, e := range sent {
+		if !retry[e] {
+			e.finish()
+		}
+	}
+
+	return remaining
+}
+
+// WithBatchDelete makes the `Server` delete successfully processed messages
+// with DeleteMessageBatch calls of up to 10 messages, sent whenever 10
+// messages are pending or every `flushInterval`, instead of calling
+// DeleteMessage for each message. This cuts API costs by up to 10x
+// for busy queues.
+//
+// Entries which fail for reasons other than a client error are retried in
+// later batches. Pending deletes are flushed by Shutdown.
+func WithBatchDelete(flushInterval time.Duration) Option {
+	return func(s *Server) error {
+		if flushInterval <= 0 {
+			return fmt.Errorf("invalid flush interval: %s. Must be positive", flushInterval)
+		}
+
+		s.deleteBatchInterval = flushInterval
+
+		return nil
+	}
+}
+
+// deleteMessage deletes the message identified by receiptHandle,
+// through the delete batcher if the Server has one. If done is not nil, it
+// is called with the result of the deletion once it completed.
+func (s *Server) deleteMessage(receiptHandle *string, done func(error)) {
+	if s.deleteBatcher != nil && s.deleteBatcher.add(&batchEntry{receiptHandle: receiptHandle, done: done}) {
+		return
+	}
+
+	start := time.Now()
+	_, err := s.Svc.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(s.QueueURL),
+		ReceiptHandle: receiptHandle,
+	})
+	s.observeAPICall("DeleteMessage", start, err)
+
+	if err != nil {
+		s.logf(logger.Error, "Delete message: %s", err.Error())
+	}
+
+	if done != nil {
+		done(err)
+	}
+}
+
+// deleteMessageBatch is the batchFlushFunc of the delete batcher.
+func (s *Server) deleteMessageBatch(entries []*batchEntry) []*batchEntry {
+	params := &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(s.QueueURL),
+		Entries:  make([]*sqs.DeleteMessageBatchRequestEntry, len(entries)),
+	}
+	for i, e := range entries {
+		params.Entries[i] = &sqs.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: e.receiptHandle,
+		}
+	}
+
+	start := time.Now()
+	resp, err := s.Svc.DeleteMessageBatch(params)
+	s.observeAPICall("DeleteMessageBatch", start, err)
+	if err != nil {
+		s.logf(logger.Error, "Delete message batch: %s", err.Error())
+
+		return failAllBatchEntries(entries, err)
+	}
+
+	return s.failedBatchEntries(entries, resp.Failed, "Delete message")
+}
+
+// WithBatchVisibilityChange makes the `Server` change the visibility of
+// messages whose receiver failed with ChangeMessageVisibilityBatch calls of
+// up to 10 messages, sent whenever 10 messages are pending or every
+// `flushInterval`, instead of calling ChangeMessageVisibility for each
+// message. Under heavy error rates this saves meaningful latency and cost.
+//
+// Entries which fail for reasons other than a client error are retried in
+// later batches. Pending changes are flushed by Shutdown.
+func WithBatchVisibilityChange(flushInterval time.Duration) Option {
+	return func(s *Server) error {
+		if flushInterval <= 0 {
+			return fmt.Errorf("invalid flush interval: %s. Must be positive", flushInterval)
+		}
+
+		s.visibilityBatchInterval = flushInterval
+
+		return nil
+	}
+}
+
+// changeMessageVisibility sets the visibility timeout of the message
+// identified by receiptHandle, through the visibility batcher if the
+// Server has one.
+func (s *Server) changeMessageVisibility(receiptHandle *string, visibilityTimeout int64) {
+	e := &batchEntry{receiptHandle: receiptHandle, visibilityTimeout: visibilityTimeout}
+	if s.visibilityBatcher != nil && s.visibilityBatcher.add(e) {
+		return
+	}
+
+	params := &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(s.QueueURL),
+		ReceiptHandle:     receiptHandle,
+		VisibilityTimeout: aws.Int64(visibilityTimeout),
+	}
+	start := time.Now()
+	_, err := s.Svc.ChangeMessageVisibility(params)
+	s.observeAPICall("ChangeMessageVisibility", start, err)
+	if err != nil {
+		s.logf(logger.Error, "cannot change message visibility %s", err)
+	}
+}
+
+// changeMessageVisibilityBatch is the batchFlushFunc of the visibility batcher.
+func (s *Server) changeMessageVisibilityBatch(entries []*batchEntry) []*batchEntry {
+	params := &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(s.QueueURL),
+		Entries:  make([]*sqs.ChangeMessageVisibilityBatchRequestEntry, len(entries)),
+	}
+	for i, e := range entries {
+		params.Entries[i] = &sqs.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			ReceiptHandle:     e.receiptHandle,
+			VisibilityTimeout: aws.Int64(e.visibilityTimeout),
+		}
+	}
+
+	start := time.Now()
+	resp, err := s.Svc.ChangeMessageVisibilityBatch(params)
+	s.observeAPICall("ChangeMessageVisibilityBatch", start, err)
+	if err != nil {
+		s.logf(logger.Error, "cannot change message visibility batch %s", err)
+
+		return failAllBatchEntries(entries, err)
+	}
+
+	return s.failedBatchEntries(entries, resp.Failed, "Change message visibility")
+}
+
+// startBatchers starts the batchers configured by WithBatchDelete and
+// WithBatchVisibilityChange. It is called by NewServer once the Server was
+// created, so that no batcher routine is left running when it fails.
+func (s *Server) startBatchers() {
+	if s.deleteBatchInterval > 0 {
+		s.deleteBatcher = newBatcher("delete message batch", s.deleteBatchInterval, s.deleteMessageBatch, logger.Func(s.logf))
+	}
+
+	if s.visibilityBatchInterval > 0 {
+		s.visibilityBatcher = newBatcher("change message visibility batch", s.visibilityBatchInterval, s.changeMessageVisibilityBatch, logger.Func(s.logf))
+	}
+}
+
+// closeBatchers flushes the pending batch requests of the Server.
+func (s *Server) closeBatchers() {
+	if s.deleteBatcher != nil {
+		s.deleteBatcher.close()
+	}
+
+	if s.visibilityBatcher != nil {
+		s.visibilityBatcher.close()
+	}
+}
+
+// failAllBatchEntries sets err on every entry of a batch request which
+// failed as a whole, and returns them all to be retried.
+func failAllBatchEntries(entries []*batchEntry, err error) []*batchEntry {
+	for _, e := range entries {
+		e.err = err
+	}
+
+	return entries
+}
+
+// failedBatchEntries logs the failures of a batch request, sets the err of
+// the failed entries and returns the ones which may be retried, i.e. which
+// did not fail due to the sender.
+func (s *Server) failedBatchEntries(entries []*batchEntry, failures []*sqs.BatchResultErrorEntry, op string) []*batchEntry {
+	var failed []*batchEntry
+
+	for _, f := range failures {
+		s.logf(logger.Error, "%s: %s: %s", op, aws.StringValue(f.Code), aws.StringValue(f.Message))
+
+		i, err := strconv.Atoi(aws.StringValue(f.Id))
+		if err != nil || i < 0 || i >= len(entries) {
+			continue
+		}
+
+		entries[i].err = awserr.New(aws.StringValue(f.Code), aws.StringValue(f.Message), nil)
+		if !aws.BoolValue(f.SenderFault) {
+			failed = append(failed, entries[i])
+		}
+	}
+
+	return failed
+}
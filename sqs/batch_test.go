@@ -0,0 +1,141 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that a Server configured with WithBatchDelete deletes messages
+// with batches of up to 10 messages.
+func TestServer_BatchDelete(t *testing.T) {
+	msgs := newSQSMessages(25)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(25, mockSQS)
+	if err := WithBatchDelete(10 * time.Millisecond)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	srv.startBatchers()
+
+	go func() {
+		r := &SimpleReceiver{t: t}
+		if err := srv.Serve(context.Background(), r); err != msg.ErrServerClosed {
+			t.Errorf("server died %s", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+	srv.Shutdown(ctx)
+
+	mockSQS.mux.Lock()
+	defer mockSQS.mux.Unlock()
+	for _, n := range mockSQS.batchSizes {
+		if n > maxBatchSize {
+			t.Errorf("Expected batches of at most %d entries, got %d", maxBatchSize, n)
+		}
+	}
+}
+
+// Tests that closing a batcher flushes pending entries, and that failed
+// entries are retried until maxBatchAttempts.
+func TestBatcher_CloseRetriesFailedEntries(t *testing.T) {
+	attempts := map[string]int{}
+	b := newBatcher("test", time.Hour, func(entries []*batchEntry) []*batchEntry {
+		var failed []*batchEntry
+		for _, e := range entries {
+			h := aws.StringValue(e.receiptHandle)
+			attempts[h]++
+			if h == "fail" {
+				failed = append(failed, e)
+			}
+		}
+		return failed
+	}, logger.Nop)
+
+	for i := 0; i < 3; i++ {
+		b.add(&batchEntry{receiptHandle: aws.String(fmt.Sprint(i))})
+	}
+	b.add(&batchEntry{receiptHandle: aws.String("fail")})
+	b.close()
+
+	if attempts["fail"] != maxBatchAttempts {
+		t.Errorf("Expected failed entry to be sent %d times, got %d", maxBatchAttempts, attempts["fail"])
+	}
+	for i := 0; i < 3; i++ {
+		if attempts[fmt.Sprint(i)] != 1 {
+			t.Errorf("Expected entry %d to be sent once, got %d", i, attempts[fmt.Sprint(i)])
+		}
+	}
+
+	if b.add(&batchEntry{receiptHandle: aws.String("late")}) {
+		t.Errorf("Expected add to fail on a closed batcher")
+	}
+}
+
+// Tests that a Server configured with WithBatchVisibilityChange changes the
+// visibility of failed messages with batches of up to 10 messages.
+func TestServer_BatchVisibilityChange(t *testing.T) {
+	msgs := newSQSMessages(25)
+	mockSQS := newMockSQSAPI(msgs, t)
+	mockSQS.rmChan = make(chan struct{}, len(*msgs))
+	srv := newMockServer(25, mockSQS)
+	if err := WithBatchVisibilityChange(10 * time.Millisecond)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	srv.startBatchers()
+
+	go func() {
+		r := &FailingReceiver{t: t}
+		if err := srv.Serve(context.Background(), r); err != msg.ErrServerClosed {
+			t.Errorf("server died %s", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForVisibilityTimeouts(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+	srv.Shutdown(ctx)
+
+	mockSQS.mux.Lock()
+	defer mockSQS.mux.Unlock()
+	if len(mockSQS.batchSizes) == 0 {
+		t.Errorf("Expected visibility to be changed with batch requests")
+	}
+	for _, n := range mockSQS.batchSizes {
+		if n > maxBatchSize {
+			t.Errorf("Expected batches of at most %d entries, got %d", maxBatchSize, n)
+		}
+	}
+}
+
+// Tests that the batch options only start their batcher once the Server was
+// created, so that none is leaked when NewServer fails.
+func TestBatchOptions_DoNotStartBatchers(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithBatchDelete(time.Second)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := WithBatchVisibilityChange(time.Second)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if srv.deleteBatcher != nil || srv.visibilityBatcher != nil {
+		t.Errorf("Expected no batcher to be started by the options")
+	}
+
+	srv.startBatchers()
+	defer srv.closeBatchers()
+	if srv.deleteBatcher == nil || srv.visibilityBatcher == nil {
+		t.Errorf("Expected both batchers to be started")
+	}
+}
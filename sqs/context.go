@@ -0,0 +1,22 @@
+package sqs
+
+import "context"
+
+// messageIDKey is the context key of SQS message IDs.
+type messageIDKey struct{}
+
+// MessageIDFromContext returns the SQS MessageId of the message whose
+// receiver was called with ctx, or "" if ctx was not passed to a receiver
+// by a Server.
+func MessageIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+
+	return id
+}
+
+// ContextWithMessageID returns a copy of ctx carrying the MessageId of a
+// message, for receivers called outside a Server, e.g. by the lambda
+// package, to find it with MessageIDFromContext.
+func ContextWithMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, messageIDKey{}, id)
+}
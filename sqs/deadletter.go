@@ -0,0 +1,105 @@
+package sqs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Attributes set on the messages forwarded to a dead-letter Topic,
+// along with the message attributes of the original message.
+const (
+	DeadLetterSourceQueueAttribute  = "Dead-Letter-Source-Queue"  // URL of the queue the message was received from
+	DeadLetterMessageIDAttribute    = "Dead-Letter-Message-Id"    // SQS MessageId of the original message
+	DeadLetterReceiveCountAttribute = "Dead-Letter-Receive-Count" // ApproximateReceiveCount of the original message
+	DeadLetterErrorAttribute        = "Dead-Letter-Error"         // last error returned by the receiver, if known
+)
+
+// WithDeadLetterTopic makes the `Server` forward poison messages to
+// `topic`, e.g. an sqs.Topic or sns.Topic, and delete them from the queue,
+// instead of relying solely on the redrive policy of the queue. This covers
+// queues whose redrive policy cannot be configured.
+//
+// A message is forwarded once its receiver failed and it was received
+// `maxReceiveCount` times, or when it is received more than
+// `maxReceiveCount` times, e.g. because its receivers kept timing out.
+// The forwarded message has the body and message attributes of the
+// original message, plus the Dead-Letter-* attributes describing it.
+// If it cannot be forwarded, the message is retried as any failed message.
+func WithDeadLetterTopic(maxReceiveCount int, topic msg.Topic) Option {
+	return func(s *Server) error {
+		if maxReceiveCount < 1 {
+			return fmt.Errorf("invalid max receive count: %d. Must be at least 1", maxReceiveCount)
+		}
+		if topic == nil {
+			return errors.New("dead-letter topic must not be nil")
+		}
+
+		s.deadLetterTopic = topic
+		s.deadLetterMaxReceives = maxReceiveCount
+
+		return nil
+	}
+}
+
+// shouldDeadLetter reports whether sqsMsg must be forwarded to the
+// dead-letter topic, after its receiver failed if failed is true,
+// or before calling its receiver otherwise.
+func (s *Server) shouldDeadLetter(sqsMsg *sqs.Message, failed bool) bool {
+	if s.deadLetterTopic == nil {
+		return false
+	}
+
+	if failed {
+		return receiveCount(sqsMsg) >= s.deadLetterMaxReceives
+	}
+
+	return receiveCount(sqsMsg) > s.deadLetterMaxReceives
+}
+
+// deadLetter forwards sqsMsg to the dead-letter topic with the last error
+// of its receiver, which may be nil, and deletes it from the queue.
+// It reports whether the message was forwarded.
+func (s *Server) deadLetter(sqsMsg *sqs.Message, receiverErr error) bool {
+	w := s.deadLetterTopic.NewWriter(s.receiverCtx)
+
+	attrs := w.Attributes()
+	s.convertToMsgAttrs(*attrs, sqsMsg.MessageAttributes)
+	attrs.Set(DeadLetterSourceQueueAttribute, s.QueueURL)
+	attrs.Set(DeadLetterMessageIDAttribute, aws.StringValue(sqsMsg.MessageId))
+	attrs.Set(DeadLetterReceiveCountAttribute, strconv.Itoa(receiveCount(sqsMsg)))
+	if receiverErr != nil {
+		attrs.Set(DeadLetterErrorAttribute, receiverErr.Error())
+	}
+
+	// messages forwarded to a FIFO queue keep their group; messages from a
+	// standard queue have none, so each is given its own
+	if fw, ok := w.(*MessageWriter); ok {
+		groupID := messageGroupID(sqsMsg)
+		if groupID == "" {
+			groupID = aws.StringValue(sqsMsg.MessageId)
+		}
+		fw.SetMessageGroupID(groupID)
+		fw.SetDeduplicationID(aws.StringValue(sqsMsg.MessageId))
+	}
+
+	_, err := w.Write([]byte(aws.StringValue(sqsMsg.Body)))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.logf(logger.Error, "cannot forward message %s to the dead-letter topic: %s", aws.StringValue(sqsMsg.MessageId), err)
+
+		return false
+	}
+
+	s.logf(logger.Warn, "forwarded message %s to the dead-letter topic after %d receives", aws.StringValue(sqsMsg.MessageId), receiveCount(sqsMsg))
+	s.deleteMessage(sqsMsg.ReceiptHandle, nil)
+
+	return true
+}
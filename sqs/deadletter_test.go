@@ -0,0 +1,135 @@
+package sqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that poison messages are forwarded to the dead-letter topic,
+// with metadata, and deleted.
+func TestServer_WithDeadLetterTopic(t *testing.T) {
+	cases := []struct {
+		name         string
+		receiveCount string
+		receiver     msg.Receiver
+		expectedErr  string
+	}{
+		{"receiver failed on last receive", "3", &FailingReceiver{t: t}, "failing recevier returned error"},
+		{"received too many times", "4", msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			t.Errorf("Expected the receiver not to be called")
+			return nil
+		}), ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			msgs := newSQSMessages(1)
+			(*msgs)[0].Attributes = map[string]*string{
+				sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(c.receiveCount),
+			}
+			(*msgs)[0].MessageAttributes["Tenant"] = &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String("acme"),
+			}
+			mockSQS := newMockSQSAPI(msgs, t)
+			srv := newMockServer(1, mockSQS)
+
+			dlq := &Topic{QueueURL: "https://myqueue.com/000000000000/dlq", Svc: mockSQS}
+			if err := WithDeadLetterTopic(3, dlq)(srv); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			go srv.Serve(context.Background(), c.receiver)
+			defer srv.Shutdown(context.Background())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+				t.Fatalf(err.Error())
+			}
+
+			mockSQS.mux.Lock()
+			defer mockSQS.mux.Unlock()
+			if len(mockSQS.sent) != 1 {
+				t.Fatalf("Expected 1 message to be forwarded, got %d", len(mockSQS.sent))
+			}
+
+			sent := mockSQS.sent[0]
+			if aws.StringValue(sent.MessageBody) != "this is a test 0" {
+				t.Errorf("Unexpected body %s", aws.StringValue(sent.MessageBody))
+			}
+
+			attrs := map[string]string{}
+			for k, v := range sent.MessageAttributes {
+				attrs[k] = aws.StringValue(v.StringValue)
+			}
+			expected := map[string]string{
+				"Tenant":                        "acme",
+				DeadLetterSourceQueueAttribute:  srv.QueueURL,
+				DeadLetterMessageIDAttribute:    "msg0",
+				DeadLetterReceiveCountAttribute: c.receiveCount,
+			}
+			if c.expectedErr != "" {
+				expected[DeadLetterErrorAttribute] = c.expectedErr
+			}
+			if len(attrs) != len(expected) {
+				t.Errorf("Expected attributes %v, got %v", expected, attrs)
+			}
+			for k, v := range expected {
+				if attrs[k] != v {
+					t.Errorf("Expected attribute %s to be %q, got %q", k, v, attrs[k])
+				}
+			}
+		})
+	}
+}
+
+// Tests that poison messages from a standard queue can be forwarded to a
+// FIFO dead-letter queue, which requires a MessageGroupId.
+func TestServer_WithDeadLetterTopic_FIFO(t *testing.T) {
+	msgs := newSQSMessages(1)
+	(*msgs)[0].Attributes = map[string]*string{
+		sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String("4"),
+	}
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	dlq := &Topic{QueueURL: "https://myqueue.com/000000000000/dlq.fifo", Svc: mockSQS}
+	if err := WithDeadLetterTopic(3, dlq)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	go srv.Serve(context.Background(), &SimpleReceiver{t: t})
+	defer srv.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	mockSQS.mux.Lock()
+	defer mockSQS.mux.Unlock()
+	if len(mockSQS.sent) != 1 {
+		t.Fatalf("Expected 1 message to be forwarded, got %d", len(mockSQS.sent))
+	}
+	if group := aws.StringValue(mockSQS.sent[0].MessageGroupId); group != "msg0" {
+		t.Errorf("Expected the message ID to be used as MessageGroupId, got %q", group)
+	}
+}
+
+func TestWithDeadLetterTopic_Invalid(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+
+	if err := WithDeadLetterTopic(0, &Topic{})(srv); err == nil {
+		t.Errorf("Expected error for a max receive count of 0")
+	}
+	if err := WithDeadLetterTopic(3, nil)(srv); err == nil {
+		t.Errorf("Expected error for a nil topic")
+	}
+}
@@ -0,0 +1,76 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// WithReceiverDeadline gives each Receive call a context whose deadline is
+// `margin` before the visibility timeout of the message expires, so
+// receivers can abort cleanly instead of doing work which will be
+// redelivered anyway. The visibility timeout is read from the queue's
+// attributes when Serve is called, which fails if it is not longer than
+// `margin`.
+//
+// Deadlines are not set when WithHeartbeat is used, as the visibility
+// timeout of in-flight messages is then extended.
+func WithReceiverDeadline(margin time.Duration) Option {
+	return func(s *Server) error {
+		if margin < 0 {
+			return fmt.Errorf("invalid deadline margin: %s. Must not be negative", margin)
+		}
+
+		s.deadlineMargin = margin
+		s.receiverDeadline = true
+
+		return nil
+	}
+}
+
+// loadVisibilityTimeout reads the VisibilityTimeout attribute of the queue,
+// which is needed to compute receiver deadlines. It fails if the deadline
+// margin leaves receivers no time at all.
+func (s *Server) loadVisibilityTimeout() error {
+	if !s.receiverDeadline || s.heartbeatInterval > 0 {
+		return nil
+	}
+
+	start := time.Now()
+	resp, err := s.Svc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(s.QueueURL),
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameVisibilityTimeout)},
+	})
+	s.observeAPICall("GetQueueAttributes", start, err)
+	if err != nil {
+		return &OpError{Op: "GetQueueAttributes", Queue: s.QueueURL, Err: err}
+	}
+
+	timeout, err := strconv.ParseInt(aws.StringValue(resp.Attributes[sqs.QueueAttributeNameVisibilityTimeout]), 10, 64)
+	if err != nil {
+		return &OpError{Op: "GetQueueAttributes", Queue: s.QueueURL, Err: fmt.Errorf("invalid visibility timeout: %w", err)}
+	}
+
+	visibilityTimeout := time.Duration(timeout) * time.Second
+	if s.deadlineMargin >= visibilityTimeout {
+		return &OpError{Op: "GetQueueAttributes", Queue: s.QueueURL, Err: fmt.Errorf("deadline margin %s must be shorter than the visibility timeout %s", s.deadlineMargin, visibilityTimeout)}
+	}
+
+	s.queueVisibilityTimeout = visibilityTimeout
+
+	return nil
+}
+
+// receiverContext returns the context passed to Receive for a message
+// received at receivedAt.
+func (s *Server) receiverContext(receivedAt time.Time) (context.Context, context.CancelFunc) {
+	if s.queueVisibilityTimeout == 0 {
+		return context.WithCancel(s.receiverCtx)
+	}
+
+	return context.WithDeadline(s.receiverCtx, receivedAt.Add(s.queueVisibilityTimeout-s.deadlineMargin))
+}
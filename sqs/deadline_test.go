@@ -0,0 +1,91 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that receivers are given a context with a deadline before the
+// visibility timeout of the queue expires.
+func TestServer_ReceiverDeadline(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(1), t)
+	mockSQS.queueAttributes = map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "60"}
+	srv := newMockServer(1, mockSQS)
+	if err := WithReceiverDeadline(10 * time.Second)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	start := time.Now()
+	deadlines := make(chan time.Time, 1)
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		return nil
+	})
+
+	go func() {
+		if err := srv.Serve(context.Background(), r); err != msg.ErrServerClosed {
+			t.Errorf("server died %s", err)
+		}
+	}()
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case deadline := <-deadlines:
+		if deadline.Before(start.Add(50*time.Second)) || deadline.After(time.Now().Add(50*time.Second)) {
+			t.Errorf("Expected deadline to be 50s after the message was received, got %s", deadline.Sub(start))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected message to be received")
+	}
+}
+
+// Tests that receivers have no deadline when a heartbeat is configured.
+func TestServer_ReceiverDeadlineWithHeartbeat(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithReceiverDeadline(time.Second)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := WithHeartbeat(time.Second, 30)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if err := srv.loadVisibilityTimeout(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	ctx, cancel := srv.receiverContext(time.Now())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("Expected receiver context not to have a deadline")
+	}
+}
+
+// Tests that Serve fails when the deadline margin is not shorter than the
+// visibility timeout of the queue, rather than giving every receiver an
+// expired context.
+func TestServer_ReceiverDeadlineMarginTooLong(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(1), t)
+	mockSQS.queueAttributes = map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "30"}
+	srv := newMockServer(1, mockSQS)
+	if err := WithReceiverDeadline(30 * time.Second)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	err := srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		t.Errorf("Expected no message to be received")
+		return nil
+	}))
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Expected an *OpError, got %v", err)
+	}
+	if srv.queueVisibilityTimeout != 0 {
+		t.Errorf("Expected no receiver deadline to be set, got %s", srv.queueVisibilityTimeout)
+	}
+}
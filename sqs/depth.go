@@ -0,0 +1,117 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// oldestMessageAgeWindow is how far back QueueDepth looks for
+// ApproximateAgeOfOldestMessage datapoints, which CloudWatch publishes
+// with a few minutes of delay.
+const oldestMessageAgeWindow = 10 * time.Minute
+
+// Depth is the backlog of a queue, as returned by QueueDepth.
+type Depth struct {
+	Visible    int64 // ApproximateNumberOfMessages: messages available for retrieval
+	NotVisible int64 // ApproximateNumberOfMessagesNotVisible: messages in flight
+	Delayed    int64 // ApproximateNumberOfMessagesDelayed: messages not yet available
+
+	// OldestMessageAge is the ApproximateAgeOfOldestMessage of the queue.
+	// SQS only publishes it as a CloudWatch metric, so it is zero unless
+	// the Server was configured WithCloudWatch.
+	OldestMessageAge time.Duration
+}
+
+// WithCloudWatch sets the CloudWatch client QueueDepth uses to read the
+// ApproximateAgeOfOldestMessage metric of the queue.
+func WithCloudWatch(cw cloudwatchiface.CloudWatchAPI) Option {
+	return func(s *Server) error {
+		if cw == nil {
+			return errors.New("cloudwatch client must not be nil")
+		}
+
+		s.cloudWatch = cw
+
+		return nil
+	}
+}
+
+// QueueDepth returns the backlog of the Server's queue, so that
+// applications and autoscalers can act on consumer lag.
+func (s *Server) QueueDepth(ctx context.Context) (Depth, error) {
+	names := []string{
+		sqs.QueueAttributeNameApproximateNumberOfMessages,
+		sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+	}
+
+	start := time.Now()
+	resp, err := s.Svc.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(s.QueueURL),
+		AttributeNames: aws.StringSlice(names),
+	})
+	s.observeAPICall("GetQueueAttributes", start, err)
+	if err != nil {
+		return Depth{}, &OpError{Op: "GetQueueAttributes", Queue: s.QueueURL, Err: err}
+	}
+
+	counts := make([]int64, len(names))
+	for i, name := range names {
+		counts[i], err = strconv.ParseInt(aws.StringValue(resp.Attributes[name]), 10, 64)
+		if err != nil {
+			return Depth{}, &OpError{Op: "GetQueueAttributes", Queue: s.QueueURL, Err: err}
+		}
+	}
+
+	d := Depth{Visible: counts[0], NotVisible: counts[1], Delayed: counts[2]}
+
+	if s.cloudWatch != nil {
+		d.OldestMessageAge, err = s.oldestMessageAge(ctx)
+		if err != nil {
+			return d, &OpError{Op: "GetMetricStatistics", Queue: s.QueueURL, Err: err}
+		}
+	}
+
+	return d, nil
+}
+
+// oldestMessageAge returns the latest ApproximateAgeOfOldestMessage
+// datapoint of the queue, or 0 if there is none.
+func (s *Server) oldestMessageAge(ctx context.Context) (time.Duration, error) {
+	now := time.Now()
+	resp, err := s.cloudWatch.GetMetricStatisticsWithContext(ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/SQS"),
+		MetricName: aws.String("ApproximateAgeOfOldestMessage"),
+		Dimensions: []*cloudwatch.Dimension{{
+			Name:  aws.String("QueueName"),
+			Value: aws.String(queueNameFromURL(s.QueueURL)),
+		}},
+		StartTime:  aws.Time(now.Add(-oldestMessageAgeWindow)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(60),
+		Statistics: aws.StringSlice([]string{cloudwatch.StatisticMaximum}),
+	})
+	s.observeAPICall("GetMetricStatistics", now, err)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest *cloudwatch.Datapoint
+	for _, p := range resp.Datapoints {
+		if latest == nil || aws.TimeValue(p.Timestamp).After(aws.TimeValue(latest.Timestamp)) {
+			latest = p
+		}
+	}
+	if latest == nil {
+		return 0, nil
+	}
+
+	return time.Duration(aws.Float64Value(latest.Maximum)) * time.Second, nil
+}
@@ -0,0 +1,59 @@
+package sqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+// mockCloudWatchAPI returns the given ApproximateAgeOfOldestMessage datapoints.
+type mockCloudWatchAPI struct {
+	cloudwatchiface.CloudWatchAPI
+
+	datapoints []*cloudwatch.Datapoint
+	input      *cloudwatch.GetMetricStatisticsInput
+}
+
+func (m *mockCloudWatchAPI) GetMetricStatisticsWithContext(ctx aws.Context, input *cloudwatch.GetMetricStatisticsInput, opts ...request.Option) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	m.input = input
+	return &cloudwatch.GetMetricStatisticsOutput{Datapoints: m.datapoints}, nil
+}
+
+func TestServer_QueueDepth(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(3), t)
+	srv := newMockServer(1, mockSQS)
+	srv.QueueURL = "https://myqueue.com/000000000000/jobs"
+
+	d, err := srv.QueueDepth(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if d != (Depth{Visible: 3}) {
+		t.Errorf("Expected 3 visible messages, got %+v", d)
+	}
+
+	now := time.Now()
+	cw := &mockCloudWatchAPI{datapoints: []*cloudwatch.Datapoint{
+		{Timestamp: aws.Time(now.Add(-2 * time.Minute)), Maximum: aws.Float64(30)},
+		{Timestamp: aws.Time(now.Add(-time.Minute)), Maximum: aws.Float64(90)},
+	}}
+	if err := WithCloudWatch(cw)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	d, err = srv.QueueDepth(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if d.OldestMessageAge != 90*time.Second {
+		t.Errorf("Expected the latest oldest message age of 90s, got %s", d.OldestMessageAge)
+	}
+	if aws.StringValue(cw.input.Dimensions[0].Value) != "jobs" {
+		t.Errorf("Expected the metric of queue jobs, got %v", cw.input.Dimensions)
+	}
+}
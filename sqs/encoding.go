@@ -0,0 +1,80 @@
+package sqs
+
+import (
+	"encoding/base64"
+	"unicode/utf8"
+
+	msg "github.com/hdtradeservices/go-msg"
+	b64 "github.com/hdtradeservices/go-msg/decorators/base64"
+)
+
+// TransferEncodingAttribute is the attribute set to "base64" on messages
+// whose body was base64-encoded, as understood by the base64 decorators
+// of go-msg.
+const TransferEncodingAttribute = "Content-Transfer-Encoding"
+
+// WithTopicBinaryEncoding makes MessageWriters of the `Topic` base64-encode
+// bodies which SQS cannot carry, e.g. binary data which is not valid UTF-8,
+// setting their Content-Transfer-Encoding attribute to "base64". Other
+// bodies are sent as is.
+//
+// Servers must decode these bodies, see WithBase64Decoding.
+func WithTopicBinaryEncoding() TopicOption {
+	return func(t *Topic) error {
+		t.binaryEncoding = true
+
+		return nil
+	}
+}
+
+// WithBase64Decoding makes the `Server` decode the body of messages whose
+// Content-Transfer-Encoding attribute is "base64", e.g. sent by a Topic
+// created with WithTopicBinaryEncoding, before passing them to its
+// middleware and receiver.
+func WithBase64Decoding() Option {
+	return func(s *Server) error {
+		s.middleware = append([]func(msg.Receiver) msg.Receiver{b64.Decoder}, s.middleware...)
+
+		return nil
+	}
+}
+
+// isValidBody reports whether body only contains the characters allowed in
+// SQS message bodies: #x9, #xA, #xD, #x20 to #xD7FF, #xE000 to #xFFFD and
+// #x10000 to #x10FFFF, UTF-8 encoded.
+func isValidBody(body []byte) bool {
+	for len(body) > 0 {
+		r, size := utf8.DecodeRune(body)
+		if r == utf8.RuneError && size <= 1 {
+			return false
+		}
+
+		switch {
+		case r == 0x9 || r == 0xA || r == 0xD:
+		case r >= 0x20 && r <= 0xD7FF:
+		case r >= 0xE000 && r <= 0xFFFD:
+		case r >= 0x10000 && r <= 0x10FFFF:
+		default:
+			return false
+		}
+
+		body = body[size:]
+	}
+
+	return true
+}
+
+// encodeBody base64-encodes the body of the message into a new buffer from
+// bufferPool, putting the previous one back.
+func (w *MessageWriter) encodeBody() {
+	encoded := getBuffer()
+	encoded.Grow(base64.StdEncoding.EncodedLen(w.buf.Len()))
+
+	enc := base64.NewEncoder(base64.StdEncoding, encoded)
+	enc.Write(w.buf.Bytes())
+	enc.Close()
+
+	putBuffer(w.buf)
+	w.buf = encoded
+	w.Attributes().Set(TransferEncodingAttribute, "base64")
+}
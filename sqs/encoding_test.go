@@ -0,0 +1,77 @@
+package sqs
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+func TestIsValidBody(t *testing.T) {
+	cases := map[string]bool{
+		"hello":                          true,
+		"tab\tnew line\r\n":              true,
+		"héllo wörld 日本 🎉":               true,
+		"\x00":                           false,
+		"bell\x07":                       false,
+		"\xff\xfe binary":                false,
+		string([]byte{0xef, 0xbf, 0xbf}): false, // U+FFFF
+	}
+
+	for body, valid := range cases {
+		if got := isValidBody([]byte(body)); got != valid {
+			t.Errorf("Expected isValidBody(%q) to be %v, got %v", body, valid, got)
+		}
+	}
+}
+
+// Tests that bodies SQS cannot carry are base64-encoded by a Topic created
+// with WithTopicBinaryEncoding, and decoded by a Server created with
+// WithBase64Decoding.
+func TestBinaryEncoding(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: mockSQS}
+	if err := WithTopicBinaryEncoding()(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	srv := newMockServer(1, mockSQS)
+	if err := WithBase64Decoding()(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for _, body := range []string{"hello", "\x00\x01\xff binary"} {
+		w := topic.NewWriter(context.Background())
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+
+		sent := mockSQS.sent[len(mockSQS.sent)-1]
+		encoded := sent.MessageAttributes[TransferEncodingAttribute] != nil
+		if encoded != (body != "hello") {
+			t.Errorf("Expected only the binary body to be encoded, got %q encoded: %v", body, encoded)
+		}
+
+		m := &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(aws.StringValue(sent.MessageBody))}
+		for k, v := range sent.MessageAttributes {
+			m.Attributes.Set(k, aws.StringValue(v.StringValue))
+		}
+
+		var received string
+		r := srv.wrapReceiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			b, err := ioutil.ReadAll(m.Body)
+			received = string(b)
+			return err
+		}))
+		if err := r.Receive(context.Background(), m); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if received != body {
+			t.Errorf("Expected body %q to be received, got %q", body, received)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package sqs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrReceiveFailed is matched by the errors returned by Serve when it
+	// gives up after ReceiveMessage calls failed.
+	ErrReceiveFailed = errors.New("receive failed")
+
+	// ErrShutdownTimeout is matched by the errors returned by Shutdown when
+	// its context is done before every receiver returned.
+	ErrShutdownTimeout = errors.New("shutdown timed out")
+
+	// ErrQueueNotResolved is matched by the errors returned by NewServer and
+	// NewTopic when the URL of the queue cannot be resolved, or the queue
+	// cannot be created.
+	ErrQueueNotResolved = errors.New("cannot resolve queue")
+
+	// ErrNotServing is returned by the health checks of a Server
+	// when Serve is not running.
+	ErrNotServing = errors.New("server is not serving")
+
+	// ErrSkipMessage is returned by a receiver, possibly wrapped, to make the
+	// Server delete a message which can never be processed, e.g. because it
+	// fails validation, without retrying it. The message is counted as
+	// skipped rather than processed or failed.
+	ErrSkipMessage = errors.New("skip message")
+
+	// ErrNotSNSEnvelope is matched by the errors returned by the receivers
+	// verifying SNS notification envelopes, see WithSNSEnvelopeVerification,
+	// when a message is not an SNS notification envelope.
+	ErrNotSNSEnvelope = errors.New("message is not an sns notification envelope")
+
+	// ErrMissingMessageGroupID is returned by MessageWriter.Close when a
+	// message is sent to a FIFO queue without a MessageGroupId.
+	ErrMissingMessageGroupID = errors.New("messages sent to a FIFO queue require a MessageGroupId")
+
+	// ErrDelayNotSupported is returned by MessageWriter.Close when a delay
+	// is set on a message sent to a FIFO queue, which only supports
+	// queue-level delays.
+	ErrDelayNotSupported = errors.New("FIFO queues do not support per-message delays")
+
+	// ErrDelayOutOfRange is matched by the errors returned by
+	// MessageWriter.SetDelayStrict when a delay is not between 0 and 900
+	// seconds.
+	ErrDelayOutOfRange = errors.New("delay must be between 0 and 900 seconds")
+
+	// ErrPurgeInProgress is matched by the errors returned by Server.Purge
+	// when its context is done before the queue could be purged, because
+	// it was already purged in the last 60 seconds.
+	ErrPurgeInProgress = errors.New("purge already in progress")
+
+	// ErrMessageTooLarge is matched by the *MessageTooLargeError returned
+	// by MessageWriter.Close when a message exceeds the SQS size limit.
+	ErrMessageTooLarge = errors.New("message too large")
+)
+
+// OpError is the error returned by the Server and Topic when an operation
+// on a queue fails. It wraps the underlying error, typically an awserr.Error,
+// so that it can be inspected with errors.As, and matches Kind with errors.Is:
+//
+//	if errors.Is(err, sqs.ErrReceiveFailed) {
+//		// ...
+//	}
+type OpError struct {
+	// Op is the failed operation, e.g. "ReceiveMessage" or "Shutdown".
+	Op string
+	// Queue is the URL of the queue, or its name when its URL is unknown.
+	Queue string
+	// Kind is one of the sentinel errors of this package, or nil.
+	Kind error
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns a description of the error, e.g.
+// "sqs: ReceiveMessage https://...: receive failed: <aws error>".
+func (e *OpError) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("sqs: %s %s: %s", e.Op, e.Queue, e.Err)
+	}
+
+	return fmt.Sprintf("sqs: %s %s: %s: %s", e.Op, e.Queue, e.Kind, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the Kind of e.
+func (e *OpError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// RetryAfterError is returned by a receiver to make the Server retry the
+// message after Delay, instead of after the retry timeout of the Server or
+// the delay computed by its BackoffFunc, e.g. when the receiver knows how long
+// a downstream outage will last. The Delay is rounded down to the second,
+// and capped at the 12 hour maximum allowed by SQS.
+type RetryAfterError struct {
+	Delay time.Duration
+	// Err is the reason of the failure, or nil.
+	Err error
+}
+
+// RetryAfter returns a *RetryAfterError retrying the message after d.
+func RetryAfter(d time.Duration) error {
+	return &RetryAfterError{Delay: d}
+}
+
+func (e *RetryAfterError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("retry after %s", e.Delay)
+	}
+
+	return fmt.Sprintf("%s; retry after %s", e.Err, e.Delay)
+}
+
+// Unwrap returns the underlying error.
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// MessageTooLargeError is returned by MessageWriter.Close when the size of
+// the body and attributes of a message exceeds MaxMessageSize, so that the
+// caller can offload the body to S3 or split the message instead.
+// It matches ErrMessageTooLarge with errors.Is.
+type MessageTooLargeError struct {
+	// Size is the size of the message, in bytes.
+	Size int
+	// MaxSize is the maximum size of a message, in bytes.
+	MaxSize int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %d bytes, maximum is %d", ErrMessageTooLarge, e.Size, e.MaxSize)
+}
+
+// Is reports whether target is ErrMessageTooLarge.
+func (e *MessageTooLargeError) Is(target error) bool {
+	return target == ErrMessageTooLarge
+}
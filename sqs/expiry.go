@@ -0,0 +1,57 @@
+package sqs
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/metrics"
+)
+
+// ExpiresAtAttribute is the message attribute holding when a message set
+// with MessageWriter.SetExpiresAt expires, in RFC 3339 format.
+const ExpiresAtAttribute = "Expires-At"
+
+// SetExpiresAt makes the message expire at `t`: a Server created with
+// WithMessageExpiry receiving it afterwards deletes it without passing it to
+// its receiver, e.g. for events which are worthless after a deadline.
+func (w *MessageWriter) SetExpiresAt(t time.Time) {
+	w.Attributes().Set(ExpiresAtAttribute, t.UTC().Format(time.RFC3339Nano))
+}
+
+// WithMessageExpiry makes the `Server` delete the messages whose
+// ExpiresAtAttribute is in the past, see MessageWriter.SetExpiresAt, instead
+// of passing them to the receiver. The attribute is requested on each
+// ReceiveMessage call, even if WithMessageAttributeNames does not list it.
+//
+// Messages whose ExpiresAtAttribute cannot be parsed never expire.
+func WithMessageExpiry() Option {
+	return func(s *Server) error {
+		s.messageExpiry = true
+
+		return nil
+	}
+}
+
+// expire deletes sqsMsg if message expiry is enabled and its
+// ExpiresAtAttribute is in the past, and reports whether it did, in which
+// case it must not be passed to the receiver.
+func (s *Server) expire(sqsMsg *sqs.Message, info MessageInfo) bool {
+	if !s.messageExpiry {
+		return false
+	}
+
+	expiresAt := s.timeAttribute(sqsMsg, ExpiresAtAttribute)
+	if expiresAt.IsZero() || s.getClock().Now().Before(expiresAt) {
+		return false
+	}
+
+	s.logf(logger.Debug, "deleting message %s, expired at %s", info.MessageID, expiresAt)
+	if r, ok := s.recorder().(metrics.ExpiryRecorder); ok {
+		r.ObserveExpired(s.queueLabel())
+	}
+	s.updateStats(func(stats *Stats) { stats.Expired++ })
+	s.deleteMessage(sqsMsg.ReceiptHandle, nil)
+
+	return true
+}
@@ -0,0 +1,116 @@
+package sqs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+func TestMessageWriter_SetExpiresAt(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: mockSQS}
+
+	expiresAt := time.Now().Add(time.Minute)
+	w, err := NewWriterWithOptions(context.Background(), topic, WithWriterExpiresAt(expiresAt))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	v := mockSQS.sent[0].MessageAttributes[ExpiresAtAttribute]
+	if v == nil {
+		t.Fatalf("Expected the %s attribute to be set", ExpiresAtAttribute)
+	}
+	if at, err := time.Parse(time.RFC3339Nano, aws.StringValue(v.StringValue)); err != nil || !at.Equal(expiresAt) {
+		t.Errorf("Expected %s to be %s, got %s", ExpiresAtAttribute, expiresAt, aws.StringValue(v.StringValue))
+	}
+}
+
+// Tests that expired messages are deleted and counted, without being
+// passed to the receiver.
+func TestServer_ExpiredMessages(t *testing.T) {
+	msgs := newSQSMessages(3)
+	for i, at := range []string{
+		time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano),
+		time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano),
+		"tomorrow",
+	} {
+		(*msgs)[i].MessageAttributes[ExpiresAtAttribute] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(at),
+		}
+	}
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	rec := &countingRecorder{apiCalls: map[string]int{}}
+	if err := WithMetrics(rec)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := WithMessageExpiry()(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var received int32
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		if id := MessageIDFromContext(ctx); id == "msg0" {
+			t.Errorf("Expected the expired message not to be delivered")
+		}
+		atomic.AddInt32(&received, 1)
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if n := atomic.LoadInt32(&received); n != 2 {
+		t.Errorf("Expected 2 messages to be delivered, got %d", n)
+	}
+	if expired := srv.Stats().Expired; expired != 1 {
+		t.Errorf("Expected 1 expired message, got %d", expired)
+	}
+	rec.mux.Lock()
+	defer rec.mux.Unlock()
+	if rec.expired != 1 {
+		t.Errorf("Expected 1 expired message to be recorded, got %d", rec.expired)
+	}
+}
+
+// Tests that messages are not expired, and ExpiresAtAttribute is not
+// requested, unless WithMessageExpiry is used.
+func TestServer_ExpiredMessagesWithoutMessageExpiry(t *testing.T) {
+	msgs := newSQSMessages(1)
+	(*msgs)[0].MessageAttributes[ExpiresAtAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano)),
+	}
+	srv := newMockServer(1, newMockSQSAPI(msgs, t))
+	if err := WithMessageAttributeNames("Content-Type")(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if srv.expire((*msgs)[0], MessageInfo{MessageID: "msg0"}) {
+		t.Errorf("Expected the message not to expire")
+	}
+	if names := aws.StringValueSlice(srv.receiveMessageAttributeNames()); len(names) != 1 || names[0] != "Content-Type" {
+		t.Errorf("Expected only Content-Type to be requested, got %v", names)
+	}
+
+	if err := WithMessageExpiry()(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if names := aws.StringValueSlice(srv.receiveMessageAttributeNames()); len(names) != 2 || names[1] != ExpiresAtAttribute {
+		t.Errorf("Expected %s to be requested, got %v", ExpiresAtAttribute, names)
+	}
+}
@@ -0,0 +1,267 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// FailoverServer is a msg.Server which consumes messages from a primary
+// SQS queue, and from a replica of it, typically in another region, when
+// the primary queue is unreachable. This is meant for disaster recovery
+// setups where messages are replicated to both queues.
+type FailoverServer struct {
+	primary *Server
+	replica *Server
+
+	threshold        int           // consecutive primary ReceiveMessage failures before failing over
+	failbackInterval time.Duration // how often the primary queue is checked after failing over
+	retryBackoff     BackoffFunc   // delay before retrying a failed ReceiveMessage call
+	concurrent       bool          // whether both queues are always drained concurrently
+
+	failedOver int32 // 1 while messages are received from the replica queue
+
+	serverCtx        context.Context    // context used to control the life of the FailoverServer
+	serverCancelFunc context.CancelFunc // CancelFunc to signal the server should stop requesting messages
+}
+
+// FailoverOption is the signature that modifies a FailoverServer.
+type FailoverOption func(*FailoverServer) error
+
+// WithFailoverThreshold makes the FailoverServer fail over to the replica
+// queue after `n` consecutive failed ReceiveMessage calls to the primary
+// queue, instead of 3.
+func WithFailoverThreshold(n int) FailoverOption {
+	return func(f *FailoverServer) error {
+		if n < 1 {
+			return fmt.Errorf("invalid failover threshold: %d. Must be at least 1", n)
+		}
+
+		f.threshold = n
+
+		return nil
+	}
+}
+
+// WithFailbackInterval makes the FailoverServer check whether the primary
+// queue is reachable again every `d` once it failed over, instead of every
+// minute. It goes back to receiving from the primary queue once it is.
+func WithFailbackInterval(d time.Duration) FailoverOption {
+	return func(f *FailoverServer) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid failback interval: %s. Must be positive", d)
+		}
+
+		f.failbackInterval = d
+
+		return nil
+	}
+}
+
+// WithFailoverRetryBackoff sets how long the FailoverServer waits before
+// retrying a failed ReceiveMessage call, given the number of consecutive
+// failures, instead of ExponentialBackoff(time.Second, 30*time.Second).
+func WithFailoverRetryBackoff(backoff BackoffFunc) FailoverOption {
+	return func(f *FailoverServer) error {
+		if backoff == nil {
+			return errors.New("backoff func must not be nil")
+		}
+
+		f.retryBackoff = backoff
+
+		return nil
+	}
+}
+
+// WithConcurrentDrain makes the FailoverServer receive messages from both
+// queues at all times, rather than from the replica queue only while the
+// primary queue is unreachable, e.g. when producers fail over to the
+// replica queue independently of the consumers.
+func WithConcurrentDrain() FailoverOption {
+	return func(f *FailoverServer) error {
+		f.concurrent = true
+
+		return nil
+	}
+}
+
+// NewFailoverServer returns a FailoverServer receiving messages from the
+// queue of `primary`, and from the queue of `replica` while the primary
+// queue is unreachable.
+//
+// The servers must have been created with NewServer, e.g. with WithRegion
+// for the replica; their concurrency, retry, receive and receiver deadline
+// options apply to the messages received from their queue. Their pollers,
+// idle backoff, autoscaling, pausing and receive error policy do not: the
+// queues are polled by the FailoverServer, which retries failed
+// ReceiveMessage calls itself, see WithFailoverRetryBackoff. Serve should
+// only be called on the FailoverServer, not on the individual servers.
+func NewFailoverServer(primary, replica msg.Server, opts ...FailoverOption) (msg.Server, error) {
+	p, ok := primary.(*Server)
+	if !ok {
+		return nil, fmt.Errorf("primary server must be an *sqs.Server, got %T", primary)
+	}
+
+	r, ok := replica.(*Server)
+	if !ok {
+		return nil, fmt.Errorf("replica server must be an *sqs.Server, got %T", replica)
+	}
+
+	serverCtx, serverCancelFunc := context.WithCancel(context.Background())
+
+	f := &FailoverServer{
+		primary:          p,
+		replica:          r,
+		threshold:        3,
+		failbackInterval: time.Minute,
+		retryBackoff:     ExponentialBackoff(time.Second, 30*time.Second),
+		serverCtx:        serverCtx,
+		serverCancelFunc: serverCancelFunc,
+	}
+
+	for _, opt := range opts {
+		if err := opt(f); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	return f, nil
+}
+
+// FailedOver reports whether the FailoverServer is receiving messages from
+// the replica queue because the primary queue is unreachable.
+func (f *FailoverServer) FailedOver() bool {
+	return atomic.LoadInt32(&f.failedOver) == 1
+}
+
+// Serve continuously receives messages from the FailoverServer's queues
+// and calls Receive on `r`. Serve is blocking and will not return until
+// Shutdown is called on the FailoverServer. Failed ReceiveMessage calls
+// are retried rather than making Serve return.
+func (f *FailoverServer) Serve(ctx context.Context, r msg.Receiver) error {
+	servers := []*Server{f.primary, f.replica}
+	receivers, done, err := serveGroup(servers, r)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if !f.concurrent {
+		return f.failover(receivers[0], receivers[1])
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(servers))
+	for i, srv := range servers {
+		go func(srv *Server, r msg.Receiver) {
+			defer wg.Done()
+
+			f.drain(srv, r)
+		}(srv, receivers[i])
+	}
+	wg.Wait()
+
+	return msg.ErrServerClosed
+}
+
+// drain receives messages from the queue of srv and dispatches them to `r`
+// until the FailoverServer is shut down.
+func (f *FailoverServer) drain(srv *Server, r msg.Receiver) {
+	failures := 0
+
+	for f.serverCtx.Err() == nil {
+		messages, err := srv.receive(f.serverCtx, srv.waitTimeSeconds, "")
+		if err == msg.ErrServerClosed {
+			return
+		}
+		if err != nil {
+			failures++
+			srv.sleep(f.serverCtx, f.retryBackoff(failures))
+
+			continue
+		}
+		failures = 0
+
+		receivedAt := time.Now()
+		for _, m := range messages {
+			srv.dispatch(r, m, receivedAt)
+		}
+	}
+}
+
+// failover receives messages from the primary queue and dispatches them to
+// `primary`, or from the replica queue to `replica` once the primary queue
+// failed, until the FailoverServer is shut down.
+func (f *FailoverServer) failover(primary, replica msg.Receiver) error {
+	clk := f.primary.getClock()
+	failures := 0         // consecutive failed ReceiveMessage calls to the active queue
+	var checkAt time.Time // when the primary queue is checked again while failed over
+
+	for f.serverCtx.Err() == nil {
+		srv, r := f.primary, primary
+		if f.FailedOver() {
+			if !clk.Now().Before(checkAt) {
+				if f.primaryReachable() {
+					f.primary.logf(logger.Info, "primary queue %s is reachable again, failing back", f.primary.QueueURL)
+					atomic.StoreInt32(&f.failedOver, 0)
+					failures = 0
+
+					continue
+				}
+				checkAt = clk.Now().Add(f.failbackInterval)
+			}
+
+			srv, r = f.replica, replica
+		}
+
+		messages, err := srv.receive(f.serverCtx, srv.waitTimeSeconds, "")
+		if err == msg.ErrServerClosed {
+			return err
+		}
+		if err != nil {
+			failures++
+			if srv == f.primary && failures >= f.threshold {
+				f.primary.logf(logger.Warn, "failing over to replica queue %s after %d consecutive receive failures", f.replica.QueueURL, failures)
+				atomic.StoreInt32(&f.failedOver, 1)
+				checkAt = clk.Now().Add(f.failbackInterval)
+				failures = 0
+
+				continue
+			}
+
+			srv.sleep(f.serverCtx, f.retryBackoff(failures))
+
+			continue
+		}
+		failures = 0
+
+		receivedAt := time.Now()
+		for _, m := range messages {
+			srv.dispatch(r, m, receivedAt)
+		}
+	}
+
+	return msg.ErrServerClosed
+}
+
+// primaryReachable reports whether the primary queue can be reached.
+func (f *FailoverServer) primaryReachable() bool {
+	ctx, cancel := context.WithTimeout(f.serverCtx, healthCheckTimeout)
+	defer cancel()
+
+	return f.primary.Healthy(ctx) == nil
+}
+
+// Shutdown stops the receipt of new messages and shuts down both
+// underlying Servers, waiting for their routines to complete or the passed
+// in ctx to be canceled. msg.ErrServerClosed will be returned upon a clean
+// shutdown. Otherwise, the first error returned by a Server is returned.
+func (f *FailoverServer) Shutdown(ctx context.Context) error {
+	return shutdownGroup(ctx, f.serverCancelFunc, []*Server{f.primary, f.replica})
+}
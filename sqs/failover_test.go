@@ -0,0 +1,141 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// noBackoff retries failed ReceiveMessage calls immediately.
+func noBackoff(int) time.Duration { return 0 }
+
+// serveFailover runs Serve on `srv` until every message of `queues` was
+// deleted, then shuts it down.
+func serveFailover(t *testing.T, srv msg.Server, queues ...*mockSQSAPI) {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(context.Background(), &SimpleReceiver{t: t})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, q := range queues {
+		if err := q.WaitForAllDeletes(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := srv.Shutdown(ctx); err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+	if err := <-errs; err != msg.ErrServerClosed {
+		t.Errorf("Expected Serve to return ErrServerClosed, got %v", err)
+	}
+}
+
+// Tests that a FailoverServer receives messages from the replica queue
+// once the primary queue failed.
+func TestFailoverServer_Failover(t *testing.T) {
+	outage := errors.New("service unavailable")
+	primary := newMockSQSAPI(newSQSMessages(0), t)
+	primary.receiveErrs = []error{outage, outage, outage, outage}
+	primary.attributesErr = outage
+	replica := newMockSQSAPI(newSQSMessages(3), t)
+
+	srv, err := NewFailoverServer(newMockServer(10, primary), newMockServer(10, replica),
+		WithFailoverThreshold(2), WithFailoverRetryBackoff(noBackoff))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	serveFailover(t, srv, replica)
+
+	if !srv.(*FailoverServer).FailedOver() {
+		t.Errorf("Expected the server to have failed over")
+	}
+	if calls := 4 - len(primary.receiveErrs); calls != 2 {
+		t.Errorf("Expected 2 ReceiveMessage calls to the primary queue, got %d", calls)
+	}
+}
+
+// Tests that a FailoverServer receives messages from the primary queue
+// again once it is reachable.
+func TestFailoverServer_Failback(t *testing.T) {
+	outage := errors.New("service unavailable")
+	primary := newMockSQSAPI(newSQSMessages(3), t)
+	primary.receiveErrs = []error{outage}
+	replica := newMockSQSAPI(newSQSMessages(0), t)
+
+	srv, err := NewFailoverServer(newMockServer(10, primary), newMockServer(10, replica),
+		WithFailoverThreshold(1), WithFailbackInterval(time.Nanosecond), WithFailoverRetryBackoff(noBackoff))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	serveFailover(t, srv, primary)
+
+	if srv.(*FailoverServer).FailedOver() {
+		t.Errorf("Expected the server to have failed back")
+	}
+}
+
+// Tests that a FailoverServer with WithConcurrentDrain receives messages
+// from both queues.
+func TestFailoverServer_ConcurrentDrain(t *testing.T) {
+	primary := newMockSQSAPI(newSQSMessages(3), t)
+	replica := newMockSQSAPI(newSQSMessages(3), t)
+
+	srv, err := NewFailoverServer(newMockServer(10, primary), newMockServer(10, replica), WithConcurrentDrain())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	serveFailover(t, srv, primary, replica)
+}
+
+// Tests that the receivers of a FailoverServer are given a deadline when
+// its Servers are configured WithReceiverDeadline.
+func TestFailoverServer_ReceiverDeadline(t *testing.T) {
+	primary := newMockSQSAPI(newSQSMessages(1), t)
+	primary.queueAttributes = map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "60"}
+	primarySrv := newMockServer(1, primary)
+	if err := WithReceiverDeadline(10 * time.Second)(primarySrv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	srv, err := NewFailoverServer(primarySrv, newMockServer(1, newMockSQSAPI(newSQSMessages(0), t)))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	deadlines := make(chan bool, 1)
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case ok := <-deadlines:
+		if !ok {
+			t.Errorf("Expected the receiver context to have a deadline")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected message to be received")
+	}
+}
+
+func TestNewFailoverServer_ErrorOnInvalidServer(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if _, err := NewFailoverServer(srv, &PriorityServer{}); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+	if _, err := NewFailoverServer(srv, srv, WithFailoverThreshold(0)); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+}
@@ -0,0 +1,137 @@
+package sqs
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// fifoAttributeNames are the system attributes always requested
+// from FIFO queues.
+var fifoAttributeNames = []string{
+	sqs.MessageSystemAttributeNameMessageGroupId,
+	sqs.MessageSystemAttributeNameSequenceNumber,
+	sqs.MessageSystemAttributeNameMessageDeduplicationId,
+}
+
+// isFIFOQueue reports whether the queue at queueURL is a FIFO queue,
+// whose name must end with ".fifo".
+func isFIFOQueue(queueURL string) bool {
+	return strings.HasSuffix(queueURL, ".fifo")
+}
+
+// WithReceiveRequestAttemptIDs makes the `Server` set a ReceiveRequestAttemptId
+// on the ReceiveMessage calls made to a FIFO queue, reusing it when retrying a
+// failed call. If a call failed after SQS handled it, e.g. because of a network
+// error, the retry returns the same messages instead of SQS keeping them, and
+// their whole groups, hidden until their visibility timeout expires.
+//
+// It has no effect on standard queues.
+func WithReceiveRequestAttemptIDs() Option {
+	return func(s *Server) error {
+		s.receiveAttemptIDs = true
+
+		return nil
+	}
+}
+
+// newReceiveAttemptID returns a random ReceiveRequestAttemptId.
+func newReceiveAttemptID() string {
+	var b [16]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic("cannot generate ReceiveRequestAttemptId: " + err.Error())
+	}
+
+	return hex.EncodeToString(b[:])
+}
+
+// groupSequencer makes the messages of a FIFO queue sharing the same
+// MessageGroupId be processed one at a time, in the order they were
+// received, while messages of different groups are processed concurrently.
+type groupSequencer struct {
+	mux   sync.Mutex
+	tails map[string]*groupTurn // turn of the last dispatched message of each group
+}
+
+// groupTurn is the turn of a message in its group.
+type groupTurn struct {
+	done   chan struct{} // closed once the message was handled
+	failed bool          // whether the message will be received again; set before done is closed
+}
+
+func newGroupSequencer() *groupSequencer {
+	return &groupSequencer{tails: map[string]*groupTurn{}}
+}
+
+// next returns the turn of the next message of group,
+// and the turn of the message before it, or nil if there is none.
+func (g *groupSequencer) next(group string) (prev, turn *groupTurn) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	turn = &groupTurn{done: make(chan struct{})}
+	prev = g.tails[group]
+	g.tails[group] = turn
+
+	return prev, turn
+}
+
+// finish ends turn, letting the next message of group be processed.
+func (g *groupSequencer) finish(group string, turn *groupTurn, failed bool) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	if g.tails[group] == turn {
+		delete(g.tails, group)
+	}
+
+	turn.failed = failed
+	close(turn.done)
+}
+
+// messageGroupID returns the MessageGroupId of sqsMsg,
+// or "" if it was not received from a FIFO queue.
+func messageGroupID(sqsMsg *sqs.Message) string {
+	return aws.StringValue(sqsMsg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId])
+}
+
+// FIFOAttributes are the system attributes of a message received from a
+// FIFO queue, which a Server always requests from FIFO queues.
+type FIFOAttributes struct {
+	// MessageGroupID is the group of the message, whose messages
+	// are processed in order.
+	MessageGroupID string
+	// SequenceNumber is the position of the message in its group,
+	// assigned by SQS. It is a large, non-consecutive number.
+	SequenceNumber string
+	// DeduplicationID is the token used by SQS
+	// to deduplicate messages sent within 5 minutes.
+	DeduplicationID string
+}
+
+// GetFIFOAttributes returns the FIFO system attributes of a message from
+// its attributes, whether or not the Server was configured with
+// WithSystemAttributes. Its fields are empty for messages received from
+// standard queues.
+func GetFIFOAttributes(attrs msg.Attributes) FIFOAttributes {
+	return FIFOAttributes{
+		MessageGroupID:  systemAttribute(attrs, sqs.MessageSystemAttributeNameMessageGroupId),
+		SequenceNumber:  systemAttribute(attrs, sqs.MessageSystemAttributeNameSequenceNumber),
+		DeduplicationID: systemAttribute(attrs, sqs.MessageSystemAttributeNameMessageDeduplicationId),
+	}
+}
+
+// systemAttribute returns the system attribute called name from attrs,
+// merged with or without SystemAttributePrefix.
+func systemAttribute(attrs msg.Attributes, name string) string {
+	if v := attrs.Get(SystemAttributePrefix + name); v != "" {
+		return v
+	}
+
+	return attrs.Get(name)
+}
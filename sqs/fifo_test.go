@@ -0,0 +1,231 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// newFIFOMessages returns n messages alternating between groups "a" and "b".
+func newFIFOMessages(n int) *[]*sqs.Message {
+	msgs := newSQSMessages(n)
+	for i, m := range *msgs {
+		m.Attributes = map[string]*string{
+			sqs.MessageSystemAttributeNameMessageGroupId: aws.String([]string{"a", "b"}[i%2]),
+		}
+	}
+
+	return msgs
+}
+
+// Tests that the messages of a group are processed one at a time, in order,
+// while different groups are processed concurrently.
+func TestServer_FIFOGroupOrdering(t *testing.T) {
+	msgs := newFIFOMessages(10)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(10, mockSQS)
+	srv.groups = newGroupSequencer()
+
+	var (
+		mux     sync.Mutex
+		order   = map[string][]string{}
+		running = map[string]int{}
+	)
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		group := m.Attributes.Get(sqs.MessageSystemAttributeNameMessageGroupId)
+
+		mux.Lock()
+		running[group]++
+		if running[group] > 1 {
+			t.Errorf("Expected messages of group %s to be processed one at a time", group)
+		}
+		body, _ := ioutil.ReadAll(m.Body)
+		order[group] = append(order[group], string(body))
+		mux.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mux.Lock()
+		running[group]--
+		mux.Unlock()
+
+		return nil
+	})
+
+	go srv.Serve(context.Background(), r)
+	defer srv.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	for i, group := range []string{"a", "b"} {
+		for j, id := range order[group] {
+			if expected := fmt.Sprintf("this is a test %d", 2*j+i); id != expected {
+				t.Errorf("Expected message %d of group %s to be %s, got %s", j, group, expected, id)
+			}
+		}
+	}
+}
+
+// Tests that once a message of a group failed, the following messages of
+// the group are made visible again rather than processed.
+func TestServer_FIFOGroupFailure(t *testing.T) {
+	msgs := newFIFOMessages(4)
+	mockSQS := newMockSQSAPI(msgs, t)
+	mockSQS.rmChan = make(chan struct{}, 4)
+	srv := newMockServer(4, mockSQS)
+	srv.groups = newGroupSequencer()
+
+	var (
+		mux      sync.Mutex
+		received []string
+	)
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		mux.Lock()
+		defer mux.Unlock()
+
+		body, _ := ioutil.ReadAll(m.Body)
+		received = append(received, string(body))
+		if m.Attributes.Get(sqs.MessageSystemAttributeNameMessageGroupId) == "a" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	go srv.Serve(context.Background(), r)
+	defer srv.Shutdown(context.Background())
+
+	// msg0 failed and msg2 was made visible again
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-mockSQS.rmChan:
+		case <-ctx.Done():
+			t.Fatalf("Expected 2 messages to be made visible again, got %d", i)
+		}
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	for _, id := range received {
+		if id == "this is a test 2" {
+			t.Errorf("Expected msg2 not to be processed after msg0 failed")
+		}
+	}
+}
+
+func TestIsFIFOQueue(t *testing.T) {
+	if !isFIFOQueue("https://sqs.us-west-2.amazonaws.com/123456789012/jobs.fifo") {
+		t.Errorf("Expected jobs.fifo to be a FIFO queue")
+	}
+	if isFIFOQueue("https://sqs.us-west-2.amazonaws.com/123456789012/jobs") {
+		t.Errorf("Expected jobs not to be a FIFO queue")
+	}
+}
+
+// Tests that FIFO attributes are requested even when not requested through
+// WithSystemAttributes, and returned by GetFIFOAttributes.
+func TestServer_FIFOAttributes(t *testing.T) {
+	msgs := newFIFOMessages(1)
+	m := (*msgs)[0]
+	m.Attributes[sqs.MessageSystemAttributeNameSequenceNumber] = aws.String("18849496460467696128")
+	m.Attributes[sqs.MessageSystemAttributeNameMessageDeduplicationId] = aws.String("dedup0")
+
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+	srv.groups = newGroupSequencer()
+	if err := WithSystemAttributes(sqs.MessageSystemAttributeNameSentTimestamp)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	names := aws.StringValueSlice(srv.receiveAttributeNames())
+	if len(names) != 4 {
+		t.Errorf("Expected SentTimestamp and 3 FIFO attributes to be requested, got %v", names)
+	}
+
+	attrs := make(chan FIFOAttributes, 1)
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		attrs <- GetFIFOAttributes(m.Attributes)
+		return nil
+	})
+
+	go srv.Serve(context.Background(), r)
+	defer srv.Shutdown(context.Background())
+
+	expected := FIFOAttributes{
+		MessageGroupID:  "a",
+		SequenceNumber:  "18849496460467696128",
+		DeduplicationID: "dedup0",
+	}
+	select {
+	case got := <-attrs:
+		if got != expected {
+			t.Errorf("Expected %+v, got %+v", expected, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the message to be received")
+	}
+
+	if got := GetFIFOAttributes(msg.Attributes{}); got != (FIFOAttributes{}) {
+		t.Errorf("Expected no FIFO attributes, got %+v", got)
+	}
+}
+
+// Tests that a ReceiveRequestAttemptId is reused after a failed
+// ReceiveMessage call, and renewed after a successful one.
+func TestServer_WithReceiveRequestAttemptIDs(t *testing.T) {
+	msgs := newFIFOMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	mockSQS.receiveErrs = []error{errors.New("network blip")}
+	srv := newMockServer(1, mockSQS)
+	srv.groups = newGroupSequencer()
+	opts := []Option{
+		WithReceiveRequestAttemptIDs(),
+		WithReceiveErrorPolicy(3, ExponentialBackoff(time.Millisecond, 10*time.Millisecond)),
+	}
+	for _, opt := range opts {
+		if err := opt(srv); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	go srv.Serve(context.Background(), &SimpleReceiver{t: t})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+	srv.Shutdown(ctx)
+
+	mockSQS.mux.Lock()
+	defer mockSQS.mux.Unlock()
+	if len(mockSQS.receiveInputs) < 3 {
+		t.Fatalf("Expected at least 3 ReceiveMessage calls, got %d", len(mockSQS.receiveInputs))
+	}
+
+	ids := make([]string, 3)
+	for i := range ids {
+		ids[i] = aws.StringValue(mockSQS.receiveInputs[i].ReceiveRequestAttemptId)
+	}
+	if ids[0] == "" || ids[1] != ids[0] {
+		t.Errorf("Expected the failed call to be retried with the same attempt ID, got %q and %q", ids[0], ids[1])
+	}
+	if ids[2] == "" || ids[2] == ids[1] {
+		t.Errorf("Expected a new attempt ID after a successful call, got %q", ids[2])
+	}
+}
@@ -0,0 +1,65 @@
+package sqs
+
+import (
+	"context"
+	"sync/atomic"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// serveGroup prepares `servers` to have their queues polled by a single
+// msg.Server, e.g. a PriorityServer, as Server.Serve does, and returns the
+// receivers messages from each queue are dispatched to, wrapping `r`.
+// done must be called once the queues are not polled anymore.
+func serveGroup(servers []*Server, r msg.Receiver) (receivers []msg.Receiver, done func(), err error) {
+	for _, srv := range servers {
+		if err := srv.loadVisibilityTimeout(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	receivers = make([]msg.Receiver, len(servers))
+	for i, srv := range servers {
+		receivers[i] = srv.wrapReceiver(r)
+
+		atomic.AddInt32(&srv.serving, 1)
+
+		// messages are dispatched to srv by the caller
+		srv.routines.Add(1)
+	}
+
+	done = func() {
+		for _, srv := range servers {
+			srv.routines.Done()
+			atomic.AddInt32(&srv.serving, -1)
+		}
+	}
+
+	return receivers, done, nil
+}
+
+// shutdownGroup stops the receipt of new messages by calling cancel, then
+// shuts down every server of a group, waiting for their routines to
+// complete or ctx to be canceled. msg.ErrServerClosed is returned upon a
+// clean shutdown. Otherwise, the first error returned by a Server is
+// returned.
+func shutdownGroup(ctx context.Context, cancel context.CancelFunc, servers []*Server) error {
+	if ctx == nil {
+		panic("context not set")
+	}
+
+	cancel()
+
+	var shutdownErr error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != msg.ErrServerClosed && shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+
+	if shutdownErr != nil {
+		return shutdownErr
+	}
+
+	return msg.ErrServerClosed
+}
@@ -0,0 +1,87 @@
+package sqs
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// healthCheckTimeout bounds the health checks run by the handlers
+// returned by LivenessHandler and ReadinessHandler.
+const healthCheckTimeout = 5 * time.Second
+
+// Alive returns ErrNotServing unless Serve is running, i.e. the Server
+// has not been shut down and its poll loop has not given up.
+func (s *Server) Alive() error {
+	if atomic.LoadInt32(&s.serving) == 0 {
+		return ErrNotServing
+	}
+
+	return nil
+}
+
+// Healthy returns nil if Serve is running and the queue is reachable.
+// Otherwise, it returns ErrNotServing or an *OpError wrapping the error
+// of the GetQueueAttributes call used to reach the queue.
+func (s *Server) Healthy(ctx context.Context) error {
+	if err := s.Alive(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	_, err := s.Svc.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(s.QueueURL),
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameQueueArn)},
+	})
+	s.observeAPICall("GetQueueAttributes", start, err)
+	if err != nil {
+		return &OpError{Op: "GetQueueAttributes", Queue: s.QueueURL, Err: err}
+	}
+
+	return nil
+}
+
+// LivenessHandler returns an http.Handler for liveness probes, which
+// responds 200 OK if Alive returns nil, and 503 Service Unavailable
+// otherwise. It does not call SQS, so that an SQS outage does not get
+// healthy consumers restarted.
+func (s *Server) LivenessHandler() http.Handler {
+	return s.healthHandler("liveness", func(context.Context) error {
+		return s.Alive()
+	})
+}
+
+// ReadinessHandler returns an http.Handler for readiness probes, which
+// responds 200 OK if Healthy returns nil, and 503 Service Unavailable
+// otherwise.
+func (s *Server) ReadinessHandler() http.Handler {
+	return s.healthHandler("readiness", s.Healthy)
+}
+
+// healthHandler returns an http.Handler reporting the result of check, for
+// the probe called `name`. Errors are logged rather than written to the
+// response, as they may reveal the queue URL or account ID to anyone who
+// can reach the probe.
+func (s *Server) healthHandler(name string, check func(context.Context) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		if err := check(ctx); err != nil {
+			s.logf(logger.Warn, "%s probe failed: %s", name, err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("unhealthy\n"))
+
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+}
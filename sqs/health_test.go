@@ -0,0 +1,66 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Tests that Healthy reports whether Serve is running and the queue is reachable.
+func TestServer_Healthy(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	srv := newMockServer(1, mockSQS)
+
+	if err := srv.Healthy(context.Background()); !errors.Is(err, ErrNotServing) {
+		t.Errorf("Expected ErrNotServing before Serve, got %v", err)
+	}
+
+	WithWaitTimeSeconds(0)(srv)
+	go srv.Serve(context.Background(), &SimpleReceiver{t: t})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.Alive() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the server to be alive")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := srv.Healthy(context.Background()); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	mockSQS.attributesErr = errors.New("unreachable")
+	var opErr *OpError
+	if err := srv.Healthy(context.Background()); !errors.As(err, &opErr) {
+		t.Errorf("Expected an OpError, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness to fail with %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if body := rec.Body.String(); body != "unhealthy\n" {
+		t.Errorf("Expected the error not to be exposed, got %q", body)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected liveness to succeed, got %d", rec.Code)
+	}
+
+	srv.Shutdown(context.Background())
+
+	deadline = time.Now().Add(2 * time.Second)
+	for srv.Alive() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the server not to be alive after Shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,94 @@
+package sqs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// maxVisibilityTimeout is the maximum visibility timeout, in seconds,
+// allowed by SQS (12 hours).
+const maxVisibilityTimeout = 43200
+
+// WithHeartbeat makes the `Server` periodically extend the visibility
+// timeout of messages which are still being processed. Every `interval`,
+// the visibility timeout of each in-flight message is reset to
+// `visibilityTimeout` seconds, so receivers which take longer than the
+// queue's visibility timeout are not redelivered mid-processing.
+//
+// Extensions stop as soon as Receive returns or the receivers' context
+// is canceled.
+func WithHeartbeat(interval time.Duration, visibilityTimeout int64) Option {
+	return func(s *Server) error {
+		if interval <= 0 {
+			return errors.New("heartbeat interval must be positive")
+		}
+
+		if visibilityTimeout < 1 || visibilityTimeout > maxVisibilityTimeout {
+			return fmt.Errorf(
+				"invalid heartbeat visibility timeout: %d. Must be between 1 and %d",
+				visibilityTimeout,
+				maxVisibilityTimeout,
+			)
+		}
+
+		if interval >= time.Duration(visibilityTimeout)*time.Second {
+			return fmt.Errorf(
+				"heartbeat interval (%s) must be shorter than the visibility timeout (%ds)",
+				interval,
+				visibilityTimeout,
+			)
+		}
+
+		s.heartbeatInterval = interval
+		s.heartbeatVisibilityTimeout = visibilityTimeout
+
+		return nil
+	}
+}
+
+// startHeartbeat periodically extends the visibility timeout of the message
+// identified by receiptHandle until the returned func is called or the
+// receivers' context is canceled. The returned func blocks until the
+// heartbeat has stopped, so no extension can race a later visibility change.
+func (s *Server) startHeartbeat(receiptHandle *string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(s.heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-s.receiverCtx.Done():
+				return
+			case <-ticker.C:
+				params := &sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(s.QueueURL),
+					ReceiptHandle:     receiptHandle,
+					VisibilityTimeout: aws.Int64(s.heartbeatVisibilityTimeout),
+				}
+				start := time.Now()
+				_, err := s.Svc.ChangeMessageVisibility(params)
+				s.observeAPICall("ChangeMessageVisibility", start, err)
+				if err != nil {
+					s.logf(logger.Error, "heartbeat cannot extend message visibility %s", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,67 @@
+package sqs
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// MessageInfo describes a message handled by a Server, as passed to Hooks.
+type MessageInfo struct {
+	// MessageID is the SQS MessageId of the message.
+	MessageID string
+	// QueueURL is the URL of the queue the message was received from.
+	QueueURL string
+	// ReceiveCount is the ApproximateReceiveCount of the message,
+	// or 1 if it was not requested (see WithSystemAttributes).
+	ReceiveCount int
+	// ReceivedAt is when the message was received from SQS.
+	ReceivedAt time.Time
+	// Duration is the time spent in Receive. It is zero in OnReceive.
+	Duration time.Duration
+	// Err is the error returned by Receive in OnError,
+	// or the error of the deletion in OnDelete.
+	Err error
+}
+
+// Hooks are callbacks fired by a Server for each message it handles, to
+// feed metrics or alerting systems. Any of them may be nil. They are called
+// from the goroutine processing the message, so they should not block.
+type Hooks struct {
+	// OnReceive is called before Receive.
+	OnReceive func(MessageInfo)
+	// OnProcessed is called after Receive returned nil.
+	OnProcessed func(MessageInfo)
+	// OnError is called after Receive returned an error.
+	OnError func(MessageInfo)
+	// OnDelete is called once a processed message was deleted from the
+	// queue, or failed to be.
+	OnDelete func(MessageInfo)
+}
+
+// fire calls hook with info if it is set.
+func (h Hooks) fire(hook func(MessageInfo), info MessageInfo) {
+	if hook != nil {
+		hook(info)
+	}
+}
+
+// WithHooks sets callbacks fired by the `Server` for each message.
+func WithHooks(h Hooks) Option {
+	return func(s *Server) error {
+		s.hooks = h
+
+		return nil
+	}
+}
+
+// messageInfo returns the MessageInfo of sqsMsg, received at receivedAt.
+func (s *Server) messageInfo(sqsMsg *sqs.Message, receivedAt time.Time) MessageInfo {
+	return MessageInfo{
+		MessageID:    aws.StringValue(sqsMsg.MessageId),
+		QueueURL:     s.QueueURL,
+		ReceiveCount: receiveCount(sqsMsg),
+		ReceivedAt:   receivedAt,
+	}
+}
@@ -0,0 +1,78 @@
+package sqs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that hooks are fired for processed and failed messages.
+func TestServer_Hooks(t *testing.T) {
+	cases := []struct {
+		name     string
+		receiver msg.Receiver
+		expected []string
+	}{
+		{"success", &SimpleReceiver{t: t}, []string{"receive", "processed", "delete"}},
+		{"failure", &FailingReceiver{t: t}, []string{"receive", "error"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			msgs := newSQSMessages(1)
+			mockSQS := newMockSQSAPI(msgs, t)
+			srv := newMockServer(1, mockSQS)
+
+			var mux sync.Mutex
+			var fired []string
+			done := make(chan MessageInfo, 1)
+			record := func(name string) func(MessageInfo) {
+				return func(info MessageInfo) {
+					mux.Lock()
+					fired = append(fired, name)
+					mux.Unlock()
+
+					if name == c.expected[len(c.expected)-1] {
+						done <- info
+					}
+				}
+			}
+
+			err := WithHooks(Hooks{
+				OnReceive:   record("receive"),
+				OnProcessed: record("processed"),
+				OnError:     record("error"),
+				OnDelete:    record("delete"),
+			})(srv)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			go srv.Serve(context.Background(), c.receiver)
+			defer srv.Shutdown(context.Background())
+
+			select {
+			case info := <-done:
+				if info.MessageID != "msg0" || info.ReceiveCount != 1 || info.QueueURL != srv.QueueURL {
+					t.Errorf("Unexpected message info %+v", info)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("Expected hooks to be fired")
+			}
+
+			mux.Lock()
+			defer mux.Unlock()
+			if len(fired) != len(c.expected) {
+				t.Fatalf("Expected hooks %v to be fired, got %v", c.expected, fired)
+			}
+			for i := range fired {
+				if fired[i] != c.expected[i] {
+					t.Errorf("Expected hooks %v to be fired, got %v", c.expected, fired)
+				}
+			}
+		})
+	}
+}
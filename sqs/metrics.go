@@ -0,0 +1,43 @@
+package sqs
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/metrics"
+)
+
+// WithMetrics makes the `Server` report metrics about the messages it
+// handles and the SQS API calls it makes to r, e.g. a Recorder from
+// package metrics/prometheus.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(s *Server) error {
+		if r == nil {
+			return errors.New("metrics recorder must not be nil")
+		}
+
+		s.metrics = r
+
+		return nil
+	}
+}
+
+// recorder returns the metrics.Recorder of the Server,
+// or metrics.Nop if it has none.
+func (s *Server) recorder() metrics.Recorder {
+	if s.metrics == nil {
+		return metrics.Nop{}
+	}
+
+	return s.metrics
+}
+
+// queueLabel returns the name of the Server's queue, used to label metrics.
+func (s *Server) queueLabel() string {
+	return queueNameFromURL(s.QueueURL)
+}
+
+// observeAPICall records an SQS API call started at start which returned err.
+func (s *Server) observeAPICall(operation string, start time.Time, err error) {
+	s.recorder().ObserveAPICall(operation, time.Since(start), err)
+}
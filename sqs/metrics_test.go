@@ -0,0 +1,84 @@
+package sqs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/metrics"
+)
+
+// countingRecorder is a metrics.Recorder counting received, processed,
+// deleted and expired messages.
+type countingRecorder struct {
+	metrics.Nop
+
+	mux       sync.Mutex
+	received  int
+	processed int
+	deleted   int
+	expired   int
+	apiCalls  map[string]int
+}
+
+func (r *countingRecorder) ObserveReceive(queue string, n int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.received += n
+}
+
+func (r *countingRecorder) ObserveProcessed(queue string, d time.Duration, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.processed++
+}
+
+func (r *countingRecorder) ObserveDelete(queue string, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.deleted++
+}
+
+func (r *countingRecorder) ObserveExpired(queue string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.expired++
+}
+
+func (r *countingRecorder) ObserveAPICall(operation string, d time.Duration, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.apiCalls[operation]++
+}
+
+// Tests that a Server configured with WithMetrics reports the messages
+// it handles and its API calls.
+func TestServer_WithMetrics(t *testing.T) {
+	msgs := newSQSMessages(3)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	rec := &countingRecorder{apiCalls: map[string]int{}}
+	if err := WithMetrics(rec)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	go srv.Serve(context.Background(), &SimpleReceiver{t: t})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+	srv.Shutdown(ctx)
+
+	rec.mux.Lock()
+	defer rec.mux.Unlock()
+	if rec.received != 3 || rec.processed != 3 || rec.deleted != 3 {
+		t.Errorf("Expected 3 messages received, processed and deleted, got %d, %d and %d", rec.received, rec.processed, rec.deleted)
+	}
+	if rec.apiCalls["ReceiveMessage"] == 0 || rec.apiCalls["DeleteMessage"] != 3 {
+		t.Errorf("Unexpected API calls %v", rec.apiCalls)
+	}
+}
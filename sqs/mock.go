@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sync"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 )
@@ -20,7 +23,27 @@ type mockSQSAPI struct {
 	dmChan chan struct{} // each time a message is deleted a struct is written to this channel
 	rmChan chan struct{} // each time a message is requeued, a struct is wrtten to this channel
 	recIdx int           // total number of messages received
-	t      *testing.T
+	mux    sync.Mutex    // guards recIdx, receiveErrs, receiveInputs, batchSizes, sent, purgeErrs and purges
+
+	queueAttributes map[string]string // attributes the queue was created with
+	receiveErrs     []error           // errors returned by the next calls to ReceiveMessage
+	receiveInputs   []*sqs.ReceiveMessageInput
+	batchSizes      []int // number of entries of each batch request
+	sent            []*sqs.SendMessageInput
+	attributesErr   error   // returned by GetQueueAttributesWithContext when set
+	purgeErrs       []error // errors returned by the next calls to PurgeQueue
+	purges          int     // number of PurgeQueue calls
+	t               *testing.T
+}
+
+// SendMessageWithContext records the sent message.
+func (s *mockSQSAPI) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.sent = append(s.sent, input)
+
+	return &sqs.SendMessageOutput{MessageId: aws.String(fmt.Sprintf("sent%d", len(s.sent)))}, nil
 }
 
 // DeleteMessage finds Message in SQS queue with the matching ReceiptHandle and
@@ -38,9 +61,49 @@ func (s *mockSQSAPI) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMe
 	return nil, errors.New(sqs.ErrCodeReceiptHandleIsInvalid)
 }
 
+// DeleteMessageBatch deletes each entry as DeleteMessage would, returning
+// entries with an invalid receipt handle as failed.
+func (s *mockSQSAPI) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	s.mux.Lock()
+	s.batchSizes = append(s.batchSizes, len(input.Entries))
+	s.mux.Unlock()
+
+	resp := &sqs.DeleteMessageBatchOutput{}
+	for _, e := range input.Entries {
+		_, err := s.DeleteMessage(&sqs.DeleteMessageInput{
+			QueueUrl:      input.QueueUrl,
+			ReceiptHandle: e.ReceiptHandle,
+		})
+		if err != nil {
+			resp.Failed = append(resp.Failed, &sqs.BatchResultErrorEntry{
+				Code:        aws.String(sqs.ErrCodeReceiptHandleIsInvalid),
+				Id:          e.Id,
+				SenderFault: aws.Bool(true),
+			})
+			continue
+		}
+
+		resp.Successful = append(resp.Successful, &sqs.DeleteMessageBatchResultEntry{Id: e.Id})
+	}
+
+	return resp, nil
+}
+
 // ReceiveMessage retrieves 0 or more messages (up to the maximum specified).
 // If there are no more messages to return, then it will return a list of 0.
+// If receiveErrs is not empty, its first error is returned instead.
 func (s *mockSQSAPI) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.receiveInputs = append(s.receiveInputs, input)
+
+	if len(s.receiveErrs) > 0 {
+		err := s.receiveErrs[0]
+		s.receiveErrs = s.receiveErrs[1:]
+		return nil, err
+	}
+
 	oldIdx := s.recIdx
 	newIdx := int(math.Min(
 		float64(s.recIdx+int(*input.MaxNumberOfMessages)),
@@ -51,6 +114,16 @@ func (s *mockSQSAPI) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.Receiv
 	return &sqs.ReceiveMessageOutput{Messages: s.Queue[oldIdx:newIdx]}, nil
 }
 
+// ReceiveMessageWithContext calls ReceiveMessage.
+func (s *mockSQSAPI) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	return s.ReceiveMessage(input)
+}
+
+// DeleteMessageWithContext calls DeleteMessage.
+func (s *mockSQSAPI) DeleteMessageWithContext(ctx aws.Context, input *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	return s.DeleteMessage(input)
+}
+
 // ChangeMessageVisibility mocks the SQS functionality to force a message to
 // be requeued.
 func (s *mockSQSAPI) ChangeMessageVisibility(*sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
@@ -58,6 +131,96 @@ func (s *mockSQSAPI) ChangeMessageVisibility(*sqs.ChangeMessageVisibilityInput)
 	return &sqs.ChangeMessageVisibilityOutput{}, nil
 }
 
+// GetQueueUrl returns a fake URL built from the queue name and
+// owner account ID.
+func (s *mockSQSAPI) GetQueueUrl(input *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+	owner := aws.StringValue(input.QueueOwnerAWSAccountId)
+	if owner == "" {
+		owner = "000000000000"
+	}
+
+	return &sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String(fmt.Sprintf("https://myqueue.com/%s/%s", owner, *input.QueueName)),
+	}, nil
+}
+
+// CreateQueue returns a fake URL built from the queue name, recording
+// the attributes the queue was created with.
+func (s *mockSQSAPI) CreateQueue(input *sqs.CreateQueueInput) (*sqs.CreateQueueOutput, error) {
+	s.queueAttributes = aws.StringValueMap(input.Attributes)
+
+	return &sqs.CreateQueueOutput{
+		QueueUrl: aws.String(fmt.Sprintf("https://myqueue.com/000000000000/%s", *input.QueueName)),
+	}, nil
+}
+
+// GetQueueAttributes returns the number of messages which have not been
+// received yet as the ApproximateNumberOfMessages of the queue, no messages
+// in flight or delayed, and its VisibilityTimeout.
+func (s *mockSQSAPI) GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	visibilityTimeout := "30"
+	if v, ok := s.queueAttributes[sqs.QueueAttributeNameVisibilityTimeout]; ok {
+		visibilityTimeout = v
+	}
+
+	return &sqs.GetQueueAttributesOutput{
+		Attributes: map[string]*string{
+			sqs.QueueAttributeNameApproximateNumberOfMessages:           aws.String(fmt.Sprint(len(s.Queue) - s.recIdx)),
+			sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: aws.String("0"),
+			sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    aws.String("0"),
+			sqs.QueueAttributeNameVisibilityTimeout:                     aws.String(visibilityTimeout),
+		},
+	}, nil
+}
+
+// GetQueueAttributesWithContext returns attributesErr if it is set,
+// or calls GetQueueAttributes.
+func (s *mockSQSAPI) GetQueueAttributesWithContext(ctx aws.Context, input *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	if s.attributesErr != nil {
+		return nil, s.attributesErr
+	}
+
+	return s.GetQueueAttributes(input)
+}
+
+// PurgeQueueWithContext returns the next error of purgeErrs, if any.
+func (s *mockSQSAPI) PurgeQueueWithContext(ctx aws.Context, input *sqs.PurgeQueueInput, opts ...request.Option) (*sqs.PurgeQueueOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.purges++
+	if len(s.purgeErrs) > 0 {
+		err := s.purgeErrs[0]
+		s.purgeErrs = s.purgeErrs[1:]
+		return nil, err
+	}
+
+	return &sqs.PurgeQueueOutput{}, nil
+}
+
+// ChangeMessageVisibilityBatch requeues each entry as ChangeMessageVisibility
+// would.
+func (s *mockSQSAPI) ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	s.mux.Lock()
+	s.batchSizes = append(s.batchSizes, len(input.Entries))
+	s.mux.Unlock()
+
+	resp := &sqs.ChangeMessageVisibilityBatchOutput{}
+	for _, e := range input.Entries {
+		s.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          input.QueueUrl,
+			ReceiptHandle:     e.ReceiptHandle,
+			VisibilityTimeout: e.VisibilityTimeout,
+		})
+		resp.Successful = append(resp.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: e.Id})
+	}
+
+	return resp, nil
+}
+
 // WaitForAllDeletes listens to dmChan until the number of writes to the channel
 // is equal to the total number of messages that were queued. If the provided
 // context times out then an error will be returned which includes the number
@@ -103,7 +266,7 @@ func newMockServer(concurrency int, mockSQS *mockSQSAPI) *Server {
 	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
 
 	srv := &Server{
-		maxConcurrentReceives: make(chan struct{}, concurrency),
+		maxConcurrentReceives: newSemaphore(concurrency),
 		receiverCtx:           receiverCtx,
 		receiverCancelFunc:    receiverCancelFunc,
 		serverCtx:             serverCtx,
@@ -111,6 +274,11 @@ func newMockServer(concurrency int, mockSQS *mockSQSAPI) *Server {
 		QueueURL:              "https://myqueue.com",
 		Svc:                   mockSQS,
 		retryTimeout:          100,
+		maxMessages:           defaultMaxMessages,
+		waitTimeSeconds:       defaultWaitTimeSeconds,
+		pollers:               1,
+		attributeNames:        []*string{aws.String(sqs.QueueAttributeNameAll)},
+		messageAttributeNames: []*string{aws.String(sqs.QueueAttributeNameAll)},
 	}
 
 	return srv
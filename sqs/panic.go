@@ -0,0 +1,73 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// PanicPolicy determines what a Server does once it recovered from
+// a panicking Receiver.
+type PanicPolicy int
+
+const (
+	// PanicRecover treats the panic as a receive failure: the visibility of
+	// the message is changed so that it is retried. This is the default.
+	PanicRecover PanicPolicy = iota
+
+	// PanicRepanic treats the panic as a receive failure, then panics again
+	// with the same value, which crashes the process.
+	PanicRepanic
+)
+
+// PanicError is the error a panicking Receiver is treated as returning.
+type PanicError struct {
+	// Value is the value the Receiver panicked with.
+	Value interface{}
+	// Stack is the stack trace of the goroutine which panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("receiver panic: %v", e.Value)
+}
+
+// WithPanicPolicy sets what the `Server` does once it recovered from a
+// panicking Receiver. Panics are always recovered first, so that the
+// message is retried and its concurrency slot is released.
+func WithPanicPolicy(p PanicPolicy) Option {
+	return func(s *Server) error {
+		if p != PanicRecover && p != PanicRepanic {
+			return fmt.Errorf("invalid panic policy: %d", p)
+		}
+
+		s.panicPolicy = p
+
+		return nil
+	}
+}
+
+// callReceiver calls Receive on `r`, converting a panic into a *PanicError.
+func (s *Server) callReceiver(ctx context.Context, r msg.Receiver, m *msg.Message) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			stack := debug.Stack()
+			s.logf(logger.Error, "Receiver panic: %v\n%s", v, stack)
+
+			err = &PanicError{Value: v, Stack: stack}
+		}
+	}()
+
+	return r.Receive(ctx, m)
+}
+
+// repanic panics again with the value of err if it is a *PanicError
+// and the Server's panic policy is PanicRepanic.
+func (s *Server) repanic(err error) {
+	if panicErr, ok := err.(*PanicError); ok && s.panicPolicy == PanicRepanic {
+		panic(panicErr.Value)
+	}
+}
@@ -0,0 +1,66 @@
+package sqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that a panicking receiver is treated as a failure and does not
+// leak its concurrency slot.
+func TestServer_RecoversReceiverPanic(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		panic("boom")
+	})
+
+	go func() {
+		if err := srv.Serve(context.Background(), r); err != msg.ErrServerClosed {
+			t.Errorf("server died %s", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForVisibilityTimeouts(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if err := srv.Shutdown(ctx); err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+}
+
+func TestServer_CallReceiver(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		panic("boom")
+	})
+
+	err := srv.callReceiver(context.Background(), r, &msg.Message{})
+	panicErr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("Expected a *PanicError, got %v", err)
+	}
+	if panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Errorf("Expected panic value and stack to be set, got %v", panicErr)
+	}
+
+	// PanicRecover must not panic again
+	srv.repanic(err)
+
+	if err := WithPanicPolicy(PanicRepanic)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer func() {
+		if v := recover(); v != "boom" {
+			t.Errorf("Expected repanic with boom, got %v", v)
+		}
+	}()
+	srv.repanic(err)
+}
@@ -0,0 +1,65 @@
+package sqs
+
+import (
+	"context"
+
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// Pause stops the Server from requesting new messages until Resume is
+// called, without shutting it down. Messages which were already received
+// keep being processed, as are the messages returned by a ReceiveMessage
+// call in flight when Pause is called.
+//
+// This allows draining downstream dependencies (e.g. during database
+// maintenance) without restarting the process.
+func (s *Server) Pause() {
+	s.pauseMux.Lock()
+	defer s.pauseMux.Unlock()
+
+	if s.resumeCh == nil {
+		s.logf(logger.Info, "pausing server for queue %s", s.QueueURL)
+		s.resumeCh = make(chan struct{})
+	}
+}
+
+// Resume restarts requesting messages after a call to Pause.
+// It is a no-op if the Server is not paused.
+func (s *Server) Resume() {
+	s.pauseMux.Lock()
+	defer s.pauseMux.Unlock()
+
+	if s.resumeCh != nil {
+		s.logf(logger.Info, "resuming server for queue %s", s.QueueURL)
+		close(s.resumeCh)
+		s.resumeCh = nil
+	}
+}
+
+// Paused reports whether the Server is paused.
+func (s *Server) Paused() bool {
+	s.pauseMux.Lock()
+	defer s.pauseMux.Unlock()
+
+	return s.resumeCh != nil
+}
+
+// waitWhilePaused blocks while the Server is paused, until it is resumed
+// or ctx is canceled. It reports whether it blocked, in which case the
+// caller should check whether ctx was canceled before polling.
+func (s *Server) waitWhilePaused(ctx context.Context) bool {
+	s.pauseMux.Lock()
+	resumeCh := s.resumeCh
+	s.pauseMux.Unlock()
+
+	if resumeCh == nil {
+		return false
+	}
+
+	select {
+	case <-resumeCh:
+	case <-ctx.Done():
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+package sqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that a paused Server does not receive messages until it is resumed.
+func TestServer_PauseResume(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	srv.Pause()
+	if !srv.Paused() {
+		t.Fatalf("Expected server to be paused")
+	}
+
+	received := make(chan struct{}, 1)
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received <- struct{}{}
+		return nil
+	})
+
+	go func() {
+		if err := srv.Serve(context.Background(), r); err != msg.ErrServerClosed {
+			t.Logf("server died %s", err)
+		}
+	}()
+
+	select {
+	case <-received:
+		t.Fatalf("Expected paused server not to receive messages")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	srv.Resume()
+	if srv.Paused() {
+		t.Fatalf("Expected server to be resumed")
+	}
+
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected resumed server to receive messages")
+	}
+}
+
+// Tests that a paused Server can be shut down.
+func TestServer_ShutdownWhilePaused(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(1), t))
+	srv.Pause()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(context.Background(), &SimpleReceiver{t: t})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != msg.ErrServerClosed {
+			t.Errorf("Expected Serve to return ErrServerClosed, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected Serve to return after Shutdown")
+	}
+}
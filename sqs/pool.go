@@ -0,0 +1,110 @@
+package sqs
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// maxPooledBufferSize is the capacity above which buffers are not put back
+// in bufferPool, so that a few oversized messages do not keep large buffers
+// alive. Base64-encoded messages of MaxMessageSize fit below it.
+const maxPooledBufferSize = 2 * MaxMessageSize
+
+// bufferPool holds the buffers of closed MessageWriters, reused by new
+// ones so that high-throughput publishers do not allocate and grow a new
+// buffer for every message.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+// getBuffer returns an empty buffer from bufferPool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer resets buf and puts it back in bufferPool. buf must not be
+// used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// WithMessagePooling makes the `Server` reuse the msg.Message passed to
+// its receiver, with its attributes, once Receive returned, to cut
+// allocations at high volume. Receivers must not retain the message, its
+// body or its attributes after returning, e.g. by processing them in
+// another goroutine.
+func WithMessagePooling() Option {
+	return func(s *Server) error {
+		s.poolMessages = true
+
+		return nil
+	}
+}
+
+// receivedMessage is a msg.Message received from SQS, along with its
+// attributes and the reader of its body, allocated together.
+type receivedMessage struct {
+	msg   msg.Message
+	attrs msg.Attributes
+	body  strings.Reader
+}
+
+// messagePool holds the messages of Servers configured with
+// WithMessagePooling.
+var messagePool = sync.Pool{
+	New: func() interface{} {
+		return &receivedMessage{attrs: msg.Attributes{}}
+	},
+}
+
+// newMessage returns the message passed to receivers for sqsMsg, whose
+// body is read from the body of sqsMsg without being copied.
+func (s *Server) newMessage(sqsMsg *sqs.Message) *receivedMessage {
+	var m *receivedMessage
+	if s.poolMessages {
+		m = messagePool.Get().(*receivedMessage)
+	} else {
+		m = &receivedMessage{attrs: msg.Attributes{}}
+	}
+
+	// set the sqs attributes first
+	// and the custom message attributes after
+	// as they may override the regular attributes
+	s.convertToAttrs(m.attrs, sqsMsg.Attributes)
+	s.convertToMsgAttrs(m.attrs, sqsMsg.MessageAttributes)
+
+	m.body.Reset(aws.StringValue(sqsMsg.Body))
+	m.msg = msg.Message{Attributes: m.attrs, Body: &m.body}
+
+	return m
+}
+
+// releaseMessage puts `m` back in messagePool if the Server pools
+// messages. `m` must not be used afterwards.
+func (s *Server) releaseMessage(m *receivedMessage) {
+	if !s.poolMessages {
+		return
+	}
+
+	// receivers may have replaced the attributes and body of the message,
+	// so only those allocated by newMessage are reset
+	for k := range m.attrs {
+		delete(m.attrs, k)
+	}
+	m.body.Reset("")
+	m.msg = msg.Message{}
+
+	messagePool.Put(m)
+}
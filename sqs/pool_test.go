@@ -0,0 +1,66 @@
+package sqs
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that a Server configured with WithMessagePooling reuses messages
+// without leaking the body or attributes of a previous message.
+func TestServer_WithMessagePooling(t *testing.T) {
+	msgs := newSQSMessages(3)
+	(*msgs)[0].MessageAttributes["Tenant"] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String("acme"),
+	}
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+	if err := WithMessagePooling()(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var mux sync.Mutex
+	bodies := map[string]string{}
+	tenants := map[string]string{}
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, err := ioutil.ReadAll(m.Body)
+		if err != nil {
+			return err
+		}
+
+		id := MessageIDFromContext(ctx)
+		mux.Lock()
+		bodies[id] = string(body)
+		tenants[id] = m.Attributes.Get("Tenant")
+		mux.Unlock()
+
+		return nil
+	})
+
+	go srv.Serve(context.Background(), r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	for _, m := range *msgs {
+		id := aws.StringValue(m.MessageId)
+		if bodies[id] != aws.StringValue(m.Body) {
+			t.Errorf("Expected body %q for message %s, got %q", aws.StringValue(m.Body), id, bodies[id])
+		}
+	}
+	if tenants["msg0"] != "acme" || tenants["msg1"] != "" || tenants["msg2"] != "" {
+		t.Errorf("Expected only msg0 to have a Tenant attribute, got %v", tenants)
+	}
+}
@@ -0,0 +1,184 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// PriorityQueue is a queue consumed by a weighted PriorityServer.
+type PriorityQueue struct {
+	// Server consumes the queue. Its concurrency, retry, receive, receive
+	// error and receiver deadline options apply to every message received
+	// from the queue. Its pollers, idle backoff, autoscaling and pausing
+	// do not: the queue is polled by the PriorityServer, which decides when
+	// it is long polled.
+	Server msg.Server
+
+	// Weight is the number of ReceiveMessage calls made to the queue in
+	// each polling round, as long as it keeps returning messages.
+	Weight int
+}
+
+// PriorityServer is a msg.Server which consumes messages from several
+// SQS queues, favoring some of them over the others.
+//
+// Only the first (highest priority) queue is long polled, and only once
+// a whole polling round returned no messages, so that an empty queue
+// never delays the others.
+type PriorityServer struct {
+	servers  []*Server
+	weights  []int
+	weighted bool
+	failures []int // consecutive failed ReceiveMessage calls to each queue
+
+	serverCtx        context.Context    // context used to control the life of the PriorityServer
+	serverCancelFunc context.CancelFunc // CancelFunc to signal the server should stop requesting messages
+}
+
+// NewPriorityServer returns a PriorityServer which drains its queues in
+// strict priority order: the queue of servers[i] is only polled once the
+// queues of every server before it returned no messages.
+//
+// The servers must have been created with NewServer, see PriorityQueue for
+// the options which apply; Serve should only be called on the
+// PriorityServer, not on the individual servers.
+func NewPriorityServer(servers ...msg.Server) (msg.Server, error) {
+	queues := make([]PriorityQueue, len(servers))
+	for i, srv := range servers {
+		queues[i] = PriorityQueue{Server: srv, Weight: 1}
+	}
+
+	return newPriorityServer(false, queues)
+}
+
+// NewWeightedServer returns a PriorityServer which polls every queue in
+// turn, making up to Weight consecutive ReceiveMessage calls to each one,
+// so that queues with a higher weight are consumed more often without
+// starving the others.
+func NewWeightedServer(queues ...PriorityQueue) (msg.Server, error) {
+	return newPriorityServer(true, queues)
+}
+
+func newPriorityServer(weighted bool, queues []PriorityQueue) (*PriorityServer, error) {
+	if len(queues) == 0 {
+		return nil, errors.New("at least one queue must be provided")
+	}
+
+	serverCtx, serverCancelFunc := context.WithCancel(context.Background())
+
+	p := &PriorityServer{
+		servers:          make([]*Server, len(queues)),
+		weights:          make([]int, len(queues)),
+		weighted:         weighted,
+		failures:         make([]int, len(queues)),
+		serverCtx:        serverCtx,
+		serverCancelFunc: serverCancelFunc,
+	}
+
+	for i, q := range queues {
+		srv, ok := q.Server.(*Server)
+		if !ok {
+			return nil, fmt.Errorf("queue %d: server must be an *sqs.Server, got %T", i, q.Server)
+		}
+
+		if q.Weight < 1 {
+			return nil, fmt.Errorf("queue %d: invalid weight: %d. Weight must be at least 1", i, q.Weight)
+		}
+
+		p.servers[i] = srv
+		p.weights[i] = q.Weight
+	}
+
+	return p, nil
+}
+
+// Serve continuously receives messages from the PriorityServer's queues
+// and calls Receive on `r`. Serve is blocking and will not return until
+// Shutdown is called on the PriorityServer, or a ReceiveMessage call
+// failed and the receive error policy of its Server does not retry it,
+// see WithReceiveErrorPolicy.
+func (p *PriorityServer) Serve(ctx context.Context, r msg.Receiver) error {
+	receivers, done, err := serveGroup(p.servers, r)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	idle := false
+
+	for {
+		select {
+		case <-p.serverCtx.Done():
+			return msg.ErrServerClosed
+
+		default:
+			n, err := p.poll(receivers, idle)
+			if err != nil {
+				return err
+			}
+
+			idle = n == 0
+		}
+	}
+}
+
+// poll runs a single polling round and returns the number of messages
+// dispatched, messages from the queue of p.servers[i] being dispatched
+// to receivers[i]. When idle is true, the first queue is long polled.
+// A queue whose ReceiveMessage call failed is skipped for the round once
+// its Server waited to retry it, or the error is returned.
+func (p *PriorityServer) poll(receivers []msg.Receiver, idle bool) (int, error) {
+	n := 0
+
+	for i, srv := range p.servers {
+		for j := 0; j < p.weights[i]; j++ {
+			var waitTimeSeconds int64
+			if idle && i == 0 && j == 0 {
+				waitTimeSeconds = srv.waitTimeSeconds
+			}
+
+			messages, err := srv.receive(p.serverCtx, waitTimeSeconds, "")
+			if err == msg.ErrServerClosed {
+				return n, err
+			}
+			if err != nil {
+				p.failures[i]++
+				if !srv.waitAfterReceiveError(p.serverCtx, p.failures[i]) {
+					return n, err
+				}
+
+				break
+			}
+			p.failures[i] = 0
+
+			receivedAt := time.Now()
+			for _, m := range messages {
+				srv.dispatch(receivers[i], m, receivedAt)
+			}
+			n += len(messages)
+
+			if len(messages) == 0 {
+				break
+			}
+
+			// restart from the highest priority queue
+			if !p.weighted {
+				return n, nil
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Shutdown stops the receipt of new messages and shuts down every
+// underlying Server, waiting for their routines to complete or the passed
+// in ctx to be canceled. msg.ErrServerClosed will be returned upon a clean
+// shutdown. Otherwise, the first error returned by a Server is returned.
+func (p *PriorityServer) Shutdown(ctx context.Context) error {
+	return shutdownGroup(ctx, p.serverCancelFunc, p.servers)
+}
@@ -0,0 +1,137 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that a strict PriorityServer only polls the low priority queue
+// once the high priority queue is empty.
+func TestPriorityServer_Strict(t *testing.T) {
+	high := newMockSQSAPI(newSQSMessages(3), t)
+	low := newMockSQSAPI(newSQSMessages(3), t)
+
+	srv, err := NewPriorityServer(newMockServer(10, high), newMockServer(10, low))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	p := srv.(*PriorityServer)
+	r := []msg.Receiver{&SimpleReceiver{t: t}, &SimpleReceiver{t: t}}
+
+	if n, err := p.poll(r, false); err != nil || n != 3 {
+		t.Fatalf("Expected 3 messages from the high priority queue, got %d (%v)", n, err)
+	}
+	if low.recIdx != 0 {
+		t.Errorf("Expected low priority queue not to be polled, received %d", low.recIdx)
+	}
+
+	if n, err := p.poll(r, false); err != nil || n != 3 {
+		t.Fatalf("Expected 3 messages from the low priority queue, got %d (%v)", n, err)
+	}
+	if low.recIdx != 3 {
+		t.Errorf("Expected low priority queue to be drained, received %d", low.recIdx)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+}
+
+// Tests that a weighted PriorityServer polls queues proportionally
+// to their weight.
+func TestPriorityServer_Weighted(t *testing.T) {
+	high := newMockSQSAPI(newSQSMessages(30), t)
+	low := newMockSQSAPI(newSQSMessages(30), t)
+
+	highSrv, lowSrv := newMockServer(30, high), newMockServer(30, low)
+	highSrv.maxMessages, lowSrv.maxMessages = 1, 1
+
+	srv, err := NewWeightedServer(
+		PriorityQueue{Server: highSrv, Weight: 3},
+		PriorityQueue{Server: lowSrv, Weight: 1},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	p := srv.(*PriorityServer)
+
+	r := []msg.Receiver{&SimpleReceiver{t: t}, &SimpleReceiver{t: t}}
+	if _, err := p.poll(r, false); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if high.recIdx != 3 || low.recIdx != 1 {
+		t.Errorf("Expected 3 high and 1 low priority messages, got %d and %d", high.recIdx, low.recIdx)
+	}
+}
+
+func TestNewWeightedServer_ErrorOnInvalidWeight(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if _, err := NewWeightedServer(PriorityQueue{Server: srv}); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+}
+
+// Tests that a PriorityServer retries failed ReceiveMessage calls according
+// to the receive error policy of their Server.
+func TestPriorityServer_ReceiveErrorPolicy(t *testing.T) {
+	high := newMockSQSAPI(newSQSMessages(3), t)
+	high.receiveErrs = []error{errors.New("network blip")}
+	highSrv := newMockServer(10, high)
+	if err := WithReceiveErrorPolicy(0, ExponentialBackoff(time.Millisecond, time.Millisecond))(highSrv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	srv, err := NewPriorityServer(highSrv, newMockServer(10, newMockSQSAPI(newSQSMessages(0), t)))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	go srv.Serve(context.Background(), &SimpleReceiver{t: t})
+	defer srv.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := high.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// Tests that the receivers of a PriorityServer are given a deadline when
+// its Servers are configured WithReceiverDeadline.
+func TestPriorityServer_ReceiverDeadline(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(1), t)
+	mockSQS.queueAttributes = map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "60"}
+	inner := newMockServer(1, mockSQS)
+	if err := WithReceiverDeadline(10 * time.Second)(inner); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	srv, err := NewPriorityServer(inner)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	deadlines := make(chan bool, 1)
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case ok := <-deadlines:
+		if !ok {
+			t.Errorf("Expected the receiver context to have a deadline")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected message to be received")
+	}
+}
@@ -0,0 +1,129 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// PublishRetryPolicy configures how MessageWriters of a Topic retry sending
+// a message which failed, on top of the retries of the AWS SDK, which only
+// cover a single API call. See WithTopicPublishRetries.
+type PublishRetryPolicy struct {
+	// MaxAttempts is the maximum number of times a message is sent,
+	// including the first attempt.
+	MaxAttempts int
+	// Backoff computes the delay before the next attempt, given the number
+	// of attempts made so far, e.g. FullJitter(ExponentialBackoff(...)).
+	// Attempts are made without delay when it is nil.
+	Backoff BackoffFunc
+	// Retryable reports whether an attempt which failed with err is
+	// retried; IsRetryablePublishError when nil.
+	Retryable func(err error) bool
+}
+
+// DefaultPublishRetryPolicy makes up to 5 attempts, waiting a random delay
+// of up to 100ms, doubling on every attempt up to 5s, between attempts.
+var DefaultPublishRetryPolicy = PublishRetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     FullJitter(ExponentialBackoff(100*time.Millisecond, 5*time.Second)),
+}
+
+// WithTopicPublishRetries makes MessageWriters of the `Topic` retry sending
+// a message whose SendMessage call, or entry of a SendMessageBatch call,
+// failed with a retryable error according to policy `p`, e.g. while SQS is
+// throttling the producer. Close returns the error of the last attempt.
+//
+// Retries stop as soon as the context of the MessageWriter is done. Retrying
+// a message sent to a standard queue may deliver it twice, e.g. if the
+// response of a successful call was lost; messages sent to a FIFO queue are
+// deduplicated by their MessageDeduplicationId.
+func WithTopicPublishRetries(p PublishRetryPolicy) TopicOption {
+	return func(t *Topic) error {
+		if p.MaxAttempts < 1 {
+			return errors.New("max attempts must be positive")
+		}
+
+		t.retryPolicy = &p
+
+		return nil
+	}
+}
+
+// IsRetryablePublishError reports whether sending a message which failed
+// with err may succeed if retried: when SQS throttled the request or failed
+// with a server error, or the request could not reach SQS. It returns false
+// for client errors, e.g. a missing queue or invalid attributes, and when
+// the context of the call is done.
+func IsRetryablePublishError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && (reqErr.StatusCode() >= 500 || reqErr.StatusCode() == 429) {
+		return true
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "InternalError", "ServiceUnavailable":
+			// The codes of the failed entries of a SendMessageBatch
+			// call, which carry no status code.
+			return true
+		}
+		return request.IsErrorThrottle(awsErr) || request.IsErrorRetryable(awsErr)
+	}
+
+	// The SQS client wraps the errors of requests in an awserr.Error,
+	// others come from a custom client and are not known to be transient.
+	return false
+}
+
+// retryable reports whether an attempt which failed with err is retried.
+func (p *PublishRetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return IsRetryablePublishError(err)
+}
+
+// sendWithRetries calls attempt until it succeeds, fails with an error the
+// retry policy of the MessageWriter does not retry, the policy runs out of
+// attempts, or ctx is done, and returns the error of the last attempt.
+func (w *MessageWriter) sendWithRetries(ctx context.Context, attempt func() error) error {
+	p := w.retryPolicy
+	if p == nil {
+		return attempt()
+	}
+
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+
+		var delay time.Duration
+		if p.Backoff != nil {
+			delay = p.Backoff(n)
+		}
+		w.logf(logger.Debug, "retrying sending to sqs in %s after attempt %d failed: %s", delay, n, err)
+
+		if ctx.Err() != nil {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
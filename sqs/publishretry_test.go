@@ -0,0 +1,119 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// failingSQSAPI fails the first len(errs) SendMessage calls with errs.
+type failingSQSAPI struct {
+	sqsiface.SQSAPI
+
+	errs  []error
+	calls int
+}
+
+func (s *failingSQSAPI) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return nil, s.errs[s.calls-1]
+	}
+
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestWithTopicPublishRetries(t *testing.T) {
+	throttled := awserr.New("RequestThrottled", "slow down", nil)
+	denied := awserr.NewRequestFailure(awserr.New("AccessDenied", "access denied", nil), 403, "")
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds after retryable errors", []error{throttled, throttled}, 3, nil},
+		{"gives up after max attempts", []error{throttled, throttled, throttled, throttled}, 3, throttled},
+		{"does not retry client errors", []error{denied}, 1, denied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &failingSQSAPI{errs: tt.errs}
+			topic := &Topic{Svc: svc, QueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"}
+			policy := PublishRetryPolicy{MaxAttempts: 3, Backoff: ExponentialBackoff(time.Millisecond, 10*time.Millisecond)}
+			if err := WithTopicPublishRetries(policy)(topic); err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			w := topic.NewWriter(context.Background())
+			w.Write([]byte("hello"))
+			if err := w.Close(); err != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if svc.calls != tt.wantCalls {
+				t.Errorf("Expected %d SendMessage calls, got %d", tt.wantCalls, svc.calls)
+			}
+		})
+	}
+}
+
+// Tests that retries stop once the context of the MessageWriter is done.
+func TestWithTopicPublishRetries_ContextDone(t *testing.T) {
+	throttled := awserr.New("RequestThrottled", "slow down", nil)
+	svc := &failingSQSAPI{errs: []error{throttled, throttled}}
+	topic := &Topic{Svc: svc, QueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"}
+	policy := PublishRetryPolicy{MaxAttempts: 3, Backoff: ExponentialBackoff(time.Hour, time.Hour)}
+	if err := WithTopicPublishRetries(policy)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	w := topic.NewWriter(ctx)
+	w.Write([]byte("hello"))
+	if err := w.Close(); err != throttled {
+		t.Errorf("Expected error %v, got %v", throttled, err)
+	}
+	if svc.calls != 1 {
+		t.Errorf("Expected 1 SendMessage call, got %d", svc.calls)
+	}
+}
+
+func TestWithTopicPublishRetries_InvalidPolicy(t *testing.T) {
+	if err := WithTopicPublishRetries(PublishRetryPolicy{})(&Topic{}); err == nil {
+		t.Error("Expected an error for a policy without attempts")
+	}
+}
+
+func TestIsRetryablePublishError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{context.Canceled, false},
+		{awserr.New("RequestThrottled", "slow down", nil), true},
+		{awserr.New("InternalError", "internal error", nil), true},
+		{awserr.New(request.ErrCodeRequestError, "send request failed", errors.New("connection reset")), true},
+		{awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "unavailable", nil), 503, ""), true},
+		{awserr.NewRequestFailure(awserr.New("AWS.SimpleQueueService.NonExistentQueue", "no queue", nil), 400, ""), false},
+		{awserr.New(sqs.ErrCodeInvalidMessageContents, "invalid", nil), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryablePublishError(tt.err); got != tt.want {
+			t.Errorf("IsRetryablePublishError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
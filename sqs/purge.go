@@ -0,0 +1,50 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// purgeRetryInterval is how long Purge waits before calling PurgeQueue
+// again, while a queue purged in the last 60 seconds cannot be purged.
+const purgeRetryInterval = 5 * time.Second
+
+// Purge deletes every message of the Server's queue, e.g. to reset a test
+// environment or drop a backlog of poison messages during an incident.
+//
+// SQS allows one PurgeQueue call per queue every 60 seconds. If the queue
+// was purged more recently, Purge waits and tries again until the call
+// succeeds or `ctx` is done, in which case the error matches
+// ErrPurgeInProgress. Messages are deleted by SQS in the minute following
+// the call, including those sent in the meantime.
+func (s *Server) Purge(ctx context.Context) error {
+	for {
+		start := time.Now()
+		_, err := s.Svc.PurgeQueueWithContext(ctx, &sqs.PurgeQueueInput{
+			QueueUrl: aws.String(s.QueueURL),
+		})
+		s.observeAPICall("PurgeQueue", start, err)
+		if err == nil {
+			s.logf(logger.Warn, "purged queue %s", s.QueueURL)
+
+			return nil
+		}
+
+		var awsErr awserr.Error
+		if !errors.As(err, &awsErr) || awsErr.Code() != sqs.ErrCodePurgeQueueInProgress {
+			return &OpError{Op: "PurgeQueue", Queue: s.QueueURL, Err: err}
+		}
+
+		s.logf(logger.Info, "queue %s was purged recently, purging again in %s", s.QueueURL, purgeRetryInterval)
+		s.sleep(ctx, purgeRetryInterval)
+		if ctx.Err() != nil {
+			return &OpError{Op: "PurgeQueue", Queue: s.QueueURL, Kind: ErrPurgeInProgress, Err: err}
+		}
+	}
+}
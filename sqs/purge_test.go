@@ -0,0 +1,53 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/clock"
+)
+
+// Tests that Purge waits for the cooldown of a previous purge to end,
+// and gives up once its context is done.
+func TestServer_Purge(t *testing.T) {
+	inProgress := awserr.New(sqs.ErrCodePurgeQueueInProgress, "purge in progress", nil)
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	mockSQS.purgeErrs = []error{inProgress, inProgress}
+	srv := newMockServer(1, mockSQS)
+	fake := clock.NewFake(time.Now())
+	if err := WithClock(fake)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- srv.Purge(context.Background()) }()
+	for i := 0; i < 2; i++ {
+		fake.WaitForTimers(1)
+		fake.Advance(purgeRetryInterval)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if mockSQS.purges != 3 {
+		t.Errorf("Expected 3 PurgeQueue calls, got %d", mockSQS.purges)
+	}
+
+	mockSQS.purgeErrs = []error{inProgress}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- srv.Purge(ctx) }()
+	fake.WaitForTimers(1)
+	cancel()
+	if err := <-done; !errors.Is(err, ErrPurgeInProgress) {
+		t.Errorf("Expected ErrPurgeInProgress, got %v", err)
+	}
+
+	denied := awserr.New("AccessDenied", "access denied", nil)
+	mockSQS.purgeErrs = []error{denied}
+	if err := srv.Purge(context.Background()); !errors.Is(err, denied) {
+		t.Errorf("Expected %v, got %v", denied, err)
+	}
+}
@@ -0,0 +1,95 @@
+package sqs
+
+import (
+	"errors"
+	"net/url"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// resolveQueue returns the URL of the queue used by a Server or Topic.
+//
+// If ensureAttributes is not nil, the queue (called name, or named after
+// queueURL) is created with those attributes if it does not already exist.
+// Otherwise, if name is set, its URL is resolved using GetQueueUrl.
+// In any other case queueURL is returned as is.
+func resolveQueue(svc sqsiface.SQSAPI, queueURL, name, ownerAccountID string, ensureAttributes map[string]string) (string, error) {
+	if ensureAttributes != nil {
+		if name == "" {
+			name = queueNameFromURL(queueURL)
+		}
+
+		u, err := createQueue(svc, name, ensureAttributes)
+		if err != nil {
+			return "", &OpError{Op: "CreateQueue", Queue: name, Kind: ErrQueueNotResolved, Err: err}
+		}
+
+		return u, nil
+	}
+
+	if name != "" {
+		u, err := getQueueURL(svc, name, ownerAccountID)
+		if err != nil {
+			return "", &OpError{Op: "GetQueueUrl", Queue: name, Kind: ErrQueueNotResolved, Err: err}
+		}
+
+		return u, nil
+	}
+
+	return queueURL, nil
+}
+
+// getQueueURL resolves the URL of the queue called name using GetQueueUrl.
+// ownerAccountID may be set to resolve a queue owned by another AWS account.
+func getQueueURL(svc sqsiface.SQSAPI, name, ownerAccountID string) (string, error) {
+	params := &sqs.GetQueueUrlInput{
+		QueueName: aws.String(name),
+	}
+	if ownerAccountID != "" {
+		params.QueueOwnerAWSAccountId = aws.String(ownerAccountID)
+	}
+
+	resp, err := svc.GetQueueUrl(params)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(resp.QueueUrl), nil
+}
+
+// createQueue creates the queue called name with the given attributes and
+// returns its URL. CreateQueue is idempotent: if the queue already exists
+// with the same attributes, its URL is returned.
+func createQueue(svc sqsiface.SQSAPI, name string, attributes map[string]string) (string, error) {
+	if name == "" {
+		return "", errors.New("queue name must not be empty")
+	}
+
+	params := &sqs.CreateQueueInput{
+		QueueName: aws.String(name),
+	}
+	if len(attributes) > 0 {
+		params.Attributes = aws.StringMap(attributes)
+	}
+
+	resp, err := svc.CreateQueue(params)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(resp.QueueUrl), nil
+}
+
+// queueNameFromURL returns the name of a queue from its URL,
+// e.g. "jobs" for https://sqs.us-west-2.amazonaws.com/123456789012/jobs.
+func queueNameFromURL(queueURL string) string {
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Path == "" || u.Path == "/" {
+		return ""
+	}
+
+	return path.Base(u.Path)
+}
@@ -0,0 +1,496 @@
+package sqs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+func TestGetQueueURL(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+
+	cases := []struct {
+		name, owner, expected string
+	}{
+		{"jobs", "", "https://myqueue.com/000000000000/jobs"},
+		{"jobs", "123456789012", "https://myqueue.com/123456789012/jobs"},
+	}
+
+	for _, c := range cases {
+		url, err := getQueueURL(mockSQS, c.name, c.owner)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if url != c.expected {
+			t.Errorf("Expected queue url to be %s, got %s", c.expected, url)
+		}
+	}
+}
+
+func TestWithQueueName(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithQueueName("jobs", "123456789012")(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if srv.queueName != "jobs" || srv.queueOwnerAccountID != "123456789012" {
+		t.Errorf("Expected queue name and owner to be set, got %q and %q", srv.queueName, srv.queueOwnerAccountID)
+	}
+
+	if err := WithQueueName("", "")(srv); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+}
+
+func TestResolveQueue(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+
+	cases := []struct {
+		name             string
+		queueURL         string
+		queueName        string
+		ensureAttributes map[string]string
+		expected         string
+	}{
+		{"url", "https://myqueue.com/000000000000/jobs", "", nil, "https://myqueue.com/000000000000/jobs"},
+		{"name", "", "jobs", nil, "https://myqueue.com/000000000000/jobs"},
+		{"ensure from name", "", "jobs", map[string]string{}, "https://myqueue.com/000000000000/jobs"},
+		{"ensure from url", "https://myqueue.com/000000000000/jobs", "", map[string]string{"VisibilityTimeout": "60"}, "https://myqueue.com/000000000000/jobs"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			url, err := resolveQueue(mockSQS, c.queueURL, c.queueName, "", c.ensureAttributes)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if url != c.expected {
+				t.Errorf("Expected queue url to be %s, got %s", c.expected, url)
+			}
+		})
+	}
+
+	if mockSQS.queueAttributes["VisibilityTimeout"] != "60" {
+		t.Errorf("Expected queue to be created with its attributes, got %v", mockSQS.queueAttributes)
+	}
+}
+
+func TestResolveQueue_ErrorWithoutName(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	if _, err := resolveQueue(mockSQS, "", "", "", map[string]string{}); !errors.Is(err, ErrQueueNotResolved) {
+		t.Errorf("Expected ErrQueueNotResolved, got %v", err)
+	}
+}
+
+// Tests that the client passed with WithClient and WithTopicClient is used,
+// including to resolve the queue URL.
+func TestWithClient(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+
+	srv, err := NewServer("", 1, 30, WithClient(mockSQS), WithQueueName("jobs", ""))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if s := srv.(*Server); s.Svc != mockSQS || s.QueueURL != "https://myqueue.com/000000000000/jobs" {
+		t.Errorf("Expected the client to be used, got %T and queue %s", s.Svc, s.QueueURL)
+	}
+
+	topic, err := NewTopic("", WithTopicClient(mockSQS), WithTopicQueueName("jobs", ""))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if tp := topic.(*Topic); tp.Svc != mockSQS || tp.QueueURL != "https://myqueue.com/000000000000/jobs" {
+		t.Errorf("Expected the client to be used, got %T and queue %s", tp.Svc, tp.QueueURL)
+	}
+
+	if _, err := NewServer("", 1, 30, WithClient(nil)); err == nil {
+		t.Errorf("Expected error for a nil client")
+	}
+}
+
+// Tests that the clients created with WithSession and WithTopicSession use
+// the configuration of the session, overridden by the configs passed.
+func TestWithSession(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+
+	srv, err := NewServer("https://sqs.eu-west-1.amazonaws.com/123456789012/jobs", 1, 30, WithSession(sess))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if region := aws.StringValue(srv.(*Server).Svc.(*sqs.SQS).Client.Config.Region); region != "eu-west-1" {
+		t.Errorf("Expected the region of the session, got %s", region)
+	}
+
+	topic, err := NewTopic("https://sqs.us-east-1.amazonaws.com/123456789012/jobs", WithTopicSession(sess, &aws.Config{Region: aws.String("us-east-1")}))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if region := aws.StringValue(topic.(*Topic).Svc.(*sqs.SQS).Client.Config.Region); region != "us-east-1" {
+		t.Errorf("Expected the region of the config, got %s", region)
+	}
+
+	if _, err := NewServer("", 1, 30, WithSession(nil)); err == nil {
+		t.Errorf("Expected error for a nil session")
+	}
+}
+
+// useSharedCredentialsFile makes the default credential chain read
+// credentials whose access key ID is "fromfile" from a shared credentials
+// file, and returns a function restoring the environment.
+func useSharedCredentialsFile(t *testing.T) func() {
+	f, err := ioutil.TempFile("", "credentials")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	fmt.Fprint(f, "[default]\naws_access_key_id = fromfile\naws_secret_access_key = secret\n")
+	f.Close()
+
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", f.Name())
+
+	return func() {
+		os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+		os.Remove(f.Name())
+	}
+}
+
+// Tests that the Server and Topic read credentials with the default
+// credential chain, unless configured to only read them from the environment.
+func TestCredentials(t *testing.T) {
+	defer useSharedCredentialsFile(t)()
+
+	queueURL := "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"
+	newClient := map[string]func(env bool) (sqsiface.SQSAPI, error){
+		"server": func(env bool) (sqsiface.SQSAPI, error) {
+			var opts []Option
+			if env {
+				opts = append(opts, WithEnvCredentials())
+			}
+			srv, err := NewServer(queueURL, 1, 30, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return srv.(*Server).Svc, nil
+		},
+		"topic": func(env bool) (sqsiface.SQSAPI, error) {
+			var opts []TopicOption
+			if env {
+				opts = append(opts, WithTopicEnvCredentials())
+			}
+			topic, err := NewTopic(queueURL, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return topic.(*Topic).Svc, nil
+		},
+	}
+
+	for name, f := range newClient {
+		t.Run(name, func(t *testing.T) {
+			svc, err := f(false)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			creds, err := svc.(*sqs.SQS).Client.Config.Credentials.Get()
+			if err != nil || creds.AccessKeyID != "fromfile" {
+				t.Errorf("Expected credentials from the shared credentials file, got %v, %v", creds.AccessKeyID, err)
+			}
+
+			svc, err = f(true)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if _, err := svc.(*sqs.SQS).Client.Config.Credentials.Get(); err == nil {
+				t.Errorf("Expected no credentials to be found in the environment")
+			}
+		})
+	}
+}
+
+// newSTSServer returns a fake STS endpoint which records the AssumeRole
+// requests it receives and returns credentials whose access key ID is
+// "assumed".
+func newSTSServer(t *testing.T, requests *[]url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Unexpected error %s", err)
+		}
+		*requests = append(*requests, r.PostForm)
+
+		fmt.Fprint(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>assumed</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>2100-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`)
+	}))
+}
+
+// Tests that WithAssumeRole and WithTopicAssumeRole assume the role with
+// the external ID.
+func TestWithAssumeRole(t *testing.T) {
+	var requests []url.Values
+	sts := newSTSServer(t, &requests)
+	defer sts.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(sts.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	roleARN := "arn:aws:iam::210987654321:role/consumer"
+
+	srv, err := NewServer("https://sqs.us-west-2.amazonaws.com/210987654321/jobs", 1, 30, WithSession(sess), WithAssumeRole(roleARN, "external"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	topic, err := NewTopic("https://sqs.us-west-2.amazonaws.com/210987654321/jobs", WithTopicSession(sess), WithTopicAssumeRole(roleARN, ""))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for _, svc := range []sqsiface.SQSAPI{srv.(*Server).Svc, topic.(*Topic).Svc} {
+		creds, err := svc.(*sqs.SQS).Client.Config.Credentials.Get()
+		if err != nil || creds.AccessKeyID != "assumed" {
+			t.Errorf("Expected assumed credentials, got %v, %v", creds.AccessKeyID, err)
+		}
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 AssumeRole requests, got %d", len(requests))
+	}
+	if requests[0].Get("RoleArn") != roleARN || requests[0].Get("ExternalId") != "external" {
+		t.Errorf("Expected the role to be assumed with the external ID, got %v", requests[0])
+	}
+	if _, ok := requests[1]["ExternalId"]; ok {
+		t.Errorf("Expected no external ID, got %v", requests[1])
+	}
+}
+
+// Tests that the Server and Topic assume the role in AWS_ROLE_ARN with the
+// token in AWS_WEB_IDENTITY_TOKEN_FILE.
+func TestWebIdentityCredentials(t *testing.T) {
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	os.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/consumer")
+	os.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/nonexistent/token")
+	defer os.Unsetenv("AWS_ROLE_ARN")
+	defer os.Unsetenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+
+	queueURL := "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"
+	srv, err := NewServer(queueURL, 1, 30)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	topic, err := NewTopic(queueURL)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	// the token cannot be read, which shows the web identity provider is used
+	for _, svc := range []sqsiface.SQSAPI{srv.(*Server).Svc, topic.(*Topic).Svc} {
+		_, err := svc.(*sqs.SQS).Client.Config.Credentials.Get()
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != stscreds.ErrCodeWebIdentity {
+			t.Errorf("Expected a %s error, got %v", stscreds.ErrCodeWebIdentity, err)
+		}
+	}
+}
+
+// Tests that WithRegion, WithEndpoint, WithTopicRegion and WithTopicEndpoint
+// override the environment.
+func TestWithRegionAndEndpoint(t *testing.T) {
+	os.Setenv("AWS_REGION", "us-east-1")
+	os.Setenv("SQS_ENDPOINT", "http://localhost:4566")
+	defer os.Unsetenv("AWS_REGION")
+	defer os.Unsetenv("SQS_ENDPOINT")
+
+	queueURL := "https://sqs.eu-west-1.amazonaws.com/123456789012/jobs"
+	srv, err := NewServer(queueURL, 1, 30, WithRegion("eu-west-1"), WithEndpoint("http://localhost:9324"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	topic, err := NewTopic(queueURL, WithTopicRegion("eu-west-1"), WithTopicEndpoint("http://localhost:9324"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for _, svc := range []sqsiface.SQSAPI{srv.(*Server).Svc, topic.(*Topic).Svc} {
+		c := svc.(*sqs.SQS).Client
+		if region := aws.StringValue(c.Config.Region); region != "eu-west-1" {
+			t.Errorf("Expected region eu-west-1, got %s", region)
+		}
+		if c.Endpoint != "http://localhost:9324" {
+			t.Errorf("Expected endpoint http://localhost:9324, got %s", c.Endpoint)
+		}
+	}
+
+	if _, err := NewServer(queueURL, 1, 30, WithRegion("")); err == nil {
+		t.Errorf("Expected error for an empty region")
+	}
+	if _, err := NewTopic(queueURL, WithTopicEndpoint("")); err == nil {
+		t.Errorf("Expected error for an empty endpoint")
+	}
+}
+
+// Tests that WithHTTPClient and WithTopicHTTPClient set the HTTP client of
+// the SQS client.
+func TestWithHTTPClient(t *testing.T) {
+	client := &http.Client{Timeout: time.Minute}
+	queueURL := "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"
+
+	srv, err := NewServer(queueURL, 1, 30, WithHTTPClient(client))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	topic, err := NewTopic(queueURL, WithTopicHTTPClient(client))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for _, svc := range []sqsiface.SQSAPI{srv.(*Server).Svc, topic.(*Topic).Svc} {
+		if c := svc.(*sqs.SQS).Client.Config.HTTPClient; c != client {
+			t.Errorf("Expected the HTTP client to be used, got %v", c)
+		}
+	}
+
+	if _, err := NewServer(queueURL, 1, 30, WithHTTPClient(nil)); err == nil {
+		t.Errorf("Expected error for a nil HTTP client")
+	}
+}
+
+// Tests that the FIPS and dual-stack options resolve the matching endpoints.
+func TestFIPSAndDualStackEndpoints(t *testing.T) {
+	os.Setenv("AWS_REGION", "us-east-1")
+	defer os.Unsetenv("AWS_REGION")
+
+	queueURL := "https://sqs.us-east-1.amazonaws.com/123456789012/jobs"
+	cases := []struct {
+		name     string
+		srvOpt   Option
+		topicOpt TopicOption
+		expected string
+	}{
+		{"fips", WithFIPSEndpoint(), WithTopicFIPSEndpoint(), "https://sqs-fips.us-east-1.amazonaws.com"},
+		{"dual-stack", WithDualStackEndpoint(), WithTopicDualStackEndpoint(), "https://sqs.us-east-1.api.aws"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv, err := NewServer(queueURL, 1, 30, c.srvOpt)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			topic, err := NewTopic(queueURL, c.topicOpt)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			for _, svc := range []sqsiface.SQSAPI{srv.(*Server).Svc, topic.(*Topic).Svc} {
+				if endpoint := svc.(*sqs.SQS).Client.Endpoint; endpoint != c.expected {
+					t.Errorf("Expected endpoint %s, got %s", c.expected, endpoint)
+				}
+			}
+		})
+	}
+}
+
+// useSharedConfigFiles makes the SDK read a "dev" profile, with credentials
+// whose access key ID is "dev" and the eu-central-1 region, from temporary
+// shared config and credentials files, and returns a function restoring
+// the environment.
+func useSharedConfigFiles(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "aws")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	configFile, credentialsFile := dir+"/config", dir+"/credentials"
+	if err := ioutil.WriteFile(configFile, []byte("[profile dev]\nregion = eu-central-1\n"), 0600); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := ioutil.WriteFile(credentialsFile, []byte("[dev]\naws_access_key_id = dev\naws_secret_access_key = secret\n"), 0600); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_REGION", "AWS_PROFILE", "AWS_SDK_LOAD_CONFIG"} {
+		os.Unsetenv(name)
+	}
+	os.Setenv("AWS_CONFIG_FILE", configFile)
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+
+	return func() {
+		os.Unsetenv("AWS_CONFIG_FILE")
+		os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+		os.RemoveAll(dir)
+	}
+}
+
+// Tests that the Server and Topic use the credentials and region of the
+// profile passed to WithProfile and WithTopicProfile, or of AWS_PROFILE
+// when AWS_SDK_LOAD_CONFIG is set.
+func TestProfile(t *testing.T) {
+	defer useSharedConfigFiles(t)()
+
+	queueURL := "https://sqs.eu-central-1.amazonaws.com/123456789012/jobs"
+	newClients := func(srvOpts []Option, topicOpts []TopicOption) []sqsiface.SQSAPI {
+		srv, err := NewServer(queueURL, 1, 30, srvOpts...)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		topic, err := NewTopic(queueURL, topicOpts...)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		return []sqsiface.SQSAPI{srv.(*Server).Svc, topic.(*Topic).Svc}
+	}
+	assertProfile := func(t *testing.T, clients []sqsiface.SQSAPI) {
+		for _, svc := range clients {
+			c := svc.(*sqs.SQS).Client.Config
+			if region := aws.StringValue(c.Region); region != "eu-central-1" {
+				t.Errorf("Expected the region of the profile, got %s", region)
+			}
+			creds, err := c.Credentials.Get()
+			if err != nil || creds.AccessKeyID != "dev" {
+				t.Errorf("Expected the credentials of the profile, got %v, %v", creds.AccessKeyID, err)
+			}
+		}
+	}
+
+	t.Run("option", func(t *testing.T) {
+		assertProfile(t, newClients([]Option{WithProfile("dev")}, []TopicOption{WithTopicProfile("dev")}))
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		os.Setenv("AWS_PROFILE", "dev")
+		os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
+		defer os.Unsetenv("AWS_PROFILE")
+		defer os.Unsetenv("AWS_SDK_LOAD_CONFIG")
+
+		assertProfile(t, newClients(nil, nil))
+	})
+
+	if _, err := NewServer(queueURL, 1, 30, WithProfile("")); err == nil {
+		t.Errorf("Expected error for an empty profile")
+	}
+}
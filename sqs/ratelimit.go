@@ -0,0 +1,108 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// WithTopicRateLimit limits MessageWriters of the `Topic` to sending
+// `perSecond` messages per second on average, in bursts of up to `burst`
+// messages, e.g. so that a bulk backfill stays within the throughput quota
+// of a FIFO queue, or does not overwhelm its consumers. Every attempt at
+// sending a message counts against the limit, including retries.
+//
+// Close blocks until the message can be sent, or returns the error of the
+// context of the MessageWriter once it is done. MessageWriters of a Topic
+// sending messages in the background, see WithTopicAsyncSend, block once
+// the queue of messages waiting to be sent is full instead.
+func WithTopicRateLimit(perSecond float64, burst int) TopicOption {
+	return func(t *Topic) error {
+		if perSecond <= 0 {
+			return errors.New("rate must be positive")
+		}
+		if burst < 1 {
+			return errors.New("burst must be positive")
+		}
+
+		t.limiter = newTokenBucket(perSecond, burst)
+
+		return nil
+	}
+}
+
+// tokenBucket is a token bucket rate limiter: it holds up to burst tokens,
+// refilled at rate tokens per second, and every message takes one.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mux    sync.Mutex
+	tokens float64   // available tokens; negative when reserved by waiting callers
+	last   time.Time // when tokens was last refilled
+}
+
+// newTokenBucket returns a full tokenBucket.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token, blocking until one is available or ctx is done, in
+// which case the error of ctx is returned. Callers are served in the order
+// they called wait.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay := b.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token, possibly borrowing it from the future, and returns
+// how long to wait until it is actually available.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns the token taken by a reservation which was not used.
+func (b *tokenBucket) cancel() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.tokens++
+}
@@ -0,0 +1,74 @@
+package sqs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Tests that a burst of messages is sent immediately, and that the next
+// ones wait for the rate limiter.
+func TestWithTopicRateLimit(t *testing.T) {
+	svc := &failingSQSAPI{}
+	topic := &Topic{Svc: svc, QueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"}
+	if err := WithTopicRateLimit(20, 3)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		w := topic.NewWriter(context.Background())
+		w.Write([]byte("hello"))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	// The 2 messages past the burst wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected sending to take at least 90ms, took %s", elapsed)
+	}
+	if svc.calls != 5 {
+		t.Errorf("Expected 5 SendMessage calls, got %d", svc.calls)
+	}
+}
+
+// Tests that a writer waiting for the rate limiter returns the error of its
+// context once it is done, without sending the message.
+func TestWithTopicRateLimit_ContextDone(t *testing.T) {
+	svc := &failingSQSAPI{}
+	topic := &Topic{Svc: svc, QueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"}
+	if err := WithTopicRateLimit(0.01, 1)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("first"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	w = topic.NewWriter(ctx)
+	w.Write([]byte("second"))
+	if err := w.Close(); err != context.DeadlineExceeded {
+		t.Errorf("Expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+	if svc.calls != 1 {
+		t.Errorf("Expected 1 SendMessage call, got %d", svc.calls)
+	}
+	if tokens := topic.limiter.tokens; tokens < -0.01 {
+		t.Errorf("Expected the token of the canceled writer to be returned, got %v tokens", tokens)
+	}
+}
+
+func TestWithTopicRateLimit_Invalid(t *testing.T) {
+	if err := WithTopicRateLimit(0, 1)(&Topic{}); err == nil {
+		t.Error("Expected an error for a zero rate")
+	}
+	if err := WithTopicRateLimit(1, 0)(&Topic{}); err == nil {
+		t.Error("Expected an error for a zero burst")
+	}
+}
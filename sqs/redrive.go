@@ -0,0 +1,213 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// redriveWaitTimeSeconds is the long poll duration of the ReceiveMessage
+// calls made by Redrive, which stops at the first empty one.
+const redriveWaitTimeSeconds = 2
+
+// redriveOptions configure Redrive.
+type redriveOptions struct {
+	rate        float64                 // messages moved per second; 0 is unlimited
+	filter      func(*sqs.Message) bool // messages to move; nil moves all
+	maxMessages int                     // messages moved before returning; 0 is unlimited
+}
+
+// RedriveOption is the signature that modifies a call to Redrive.
+type RedriveOption func(*redriveOptions) error
+
+// WithRedriveRate limits Redrive to moving `perSecond` messages per second,
+// so that redriving a large dead-letter queue does not overwhelm consumers.
+func WithRedriveRate(perSecond float64) RedriveOption {
+	return func(o *redriveOptions) error {
+		if perSecond <= 0 {
+			return fmt.Errorf("invalid redrive rate: %v. Must be positive", perSecond)
+		}
+
+		o.rate = perSecond
+
+		return nil
+	}
+}
+
+// WithRedriveFilter makes Redrive move only the messages for which `filter`
+// returns true. Other messages are left in the source queue, and become
+// visible again after its visibility timeout.
+func WithRedriveFilter(filter func(*sqs.Message) bool) RedriveOption {
+	return func(o *redriveOptions) error {
+		if filter == nil {
+			return errors.New("redrive filter must not be nil")
+		}
+
+		o.filter = filter
+
+		return nil
+	}
+}
+
+// WithRedriveMaxMessages makes Redrive return after moving `n` messages.
+func WithRedriveMaxMessages(n int) RedriveOption {
+	return func(o *redriveOptions) error {
+		if n < 1 {
+			return fmt.Errorf("invalid max messages: %d. Must be at least 1", n)
+		}
+
+		o.maxMessages = n
+
+		return nil
+	}
+}
+
+// Redrive moves the messages of the queue at sourceQueueURL, typically a
+// dead-letter queue, to the queue at destQueueURL, typically the queue it
+// is the dead-letter queue of. Each message is sent with its body and
+// message attributes, then deleted from the source queue.
+//
+// Redrive returns the number of messages moved once the source queue
+// has no more visible messages, ctx is done, or a call to SQS failed.
+//
+// For queues whose redrive policy is configured in SQS, StartRedriveTask
+// moves messages server-side instead.
+func Redrive(ctx context.Context, svc sqsiface.SQSAPI, sourceQueueURL, destQueueURL string, opts ...RedriveOption) (int, error) {
+	o := &redriveOptions{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return 0, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	var interval time.Duration
+	if o.rate > 0 {
+		interval = time.Duration(float64(time.Second) / o.rate)
+	}
+
+	moved := 0
+	next := time.Now()
+
+	for {
+		resp, err := svc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(sourceQueueURL),
+			MaxNumberOfMessages:   aws.Int64(defaultMaxMessages),
+			WaitTimeSeconds:       aws.Int64(redriveWaitTimeSeconds),
+			AttributeNames:        aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+			MessageAttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+		})
+		if err != nil {
+			return moved, &OpError{Op: "ReceiveMessage", Queue: sourceQueueURL, Kind: ErrReceiveFailed, Err: err}
+		}
+		if len(resp.Messages) == 0 {
+			return moved, nil
+		}
+
+		for _, m := range resp.Messages {
+			if o.filter != nil && !o.filter(m) {
+				continue
+			}
+
+			if interval > 0 {
+				if err := sleepUntil(ctx, next); err != nil {
+					return moved, err
+				}
+				next = time.Now().Add(interval)
+			}
+
+			if err := redriveMessage(ctx, svc, m, sourceQueueURL, destQueueURL); err != nil {
+				return moved, err
+			}
+
+			moved++
+			if o.maxMessages > 0 && moved >= o.maxMessages {
+				return moved, nil
+			}
+		}
+	}
+}
+
+// redriveMessage sends m to the queue at destQueueURL,
+// then deletes it from the queue at sourceQueueURL.
+func redriveMessage(ctx context.Context, svc sqsiface.SQSAPI, m *sqs.Message, sourceQueueURL, destQueueURL string) error {
+	params := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(destQueueURL),
+		MessageBody: m.Body,
+	}
+	if len(m.MessageAttributes) > 0 {
+		params.MessageAttributes = m.MessageAttributes
+	}
+	if header, ok := m.Attributes[sqs.MessageSystemAttributeNameAwstraceHeader]; ok {
+		params.MessageSystemAttributes = map[string]*sqs.MessageSystemAttributeValue{
+			sqs.MessageSystemAttributeNameForSendsAwstraceHeader: {DataType: aws.String("String"), StringValue: header},
+		}
+	}
+
+	// messages of FIFO queues keep their group and deduplication ID
+	params.MessageGroupId = m.Attributes[sqs.MessageSystemAttributeNameMessageGroupId]
+	params.MessageDeduplicationId = m.Attributes[sqs.MessageSystemAttributeNameMessageDeduplicationId]
+
+	if _, err := svc.SendMessageWithContext(ctx, params); err != nil {
+		return &OpError{Op: "SendMessage", Queue: destQueueURL, Err: err}
+	}
+
+	_, err := svc.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(sourceQueueURL),
+		ReceiptHandle: m.ReceiptHandle,
+	})
+	if err != nil {
+		return &OpError{Op: "DeleteMessage", Queue: sourceQueueURL, Err: err}
+	}
+
+	return nil
+}
+
+// sleepUntil blocks until t or until ctx is done, in which case
+// it returns the error of ctx.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartRedriveTask starts a server-side move of the messages of the
+// dead-letter queue with the ARN sourceQueueARN back to the queue with the
+// ARN destQueueARN, or to their original queues if destQueueARN is empty,
+// using the StartMessageMoveTask API. maxPerSecond limits the number of
+// messages moved per second, or is left to SQS if 0.
+//
+// It returns the handle of the task, which can be used to cancel it.
+func StartRedriveTask(ctx context.Context, svc sqsiface.SQSAPI, sourceQueueARN, destQueueARN string, maxPerSecond int64) (string, error) {
+	params := &sqs.StartMessageMoveTaskInput{
+		SourceArn: aws.String(sourceQueueARN),
+	}
+	if destQueueARN != "" {
+		params.DestinationArn = aws.String(destQueueARN)
+	}
+	if maxPerSecond > 0 {
+		params.MaxNumberOfMessagesPerSecond = aws.Int64(maxPerSecond)
+	}
+
+	resp, err := svc.StartMessageMoveTaskWithContext(ctx, params)
+	if err != nil {
+		return "", &OpError{Op: "StartMessageMoveTask", Queue: sourceQueueARN, Err: err}
+	}
+
+	return aws.StringValue(resp.TaskHandle), nil
+}
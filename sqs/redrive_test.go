@@ -0,0 +1,57 @@
+package sqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Tests that Redrive moves the messages matching its filter,
+// at the configured rate.
+func TestRedrive(t *testing.T) {
+	msgs := newSQSMessages(5)
+	mockSQS := newMockSQSAPI(msgs, t)
+
+	filter := func(m *sqs.Message) bool {
+		return aws.StringValue(m.MessageId) != "msg2"
+	}
+
+	start := time.Now()
+	moved, err := Redrive(context.Background(), mockSQS, "https://myqueue.com/000000000000/dlq", "https://myqueue.com/000000000000/jobs",
+		WithRedriveFilter(filter), WithRedriveRate(50))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if moved != 4 || len(mockSQS.sent) != 4 || len(mockSQS.dmChan) != 4 {
+		t.Errorf("Expected 4 messages to be sent and deleted, got %d moved, %d sent and %d deleted", moved, len(mockSQS.sent), len(mockSQS.dmChan))
+	}
+	for _, m := range mockSQS.sent {
+		if aws.StringValue(m.QueueUrl) != "https://myqueue.com/000000000000/jobs" {
+			t.Errorf("Unexpected destination %s", aws.StringValue(m.QueueUrl))
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("Expected moving 4 messages at 50/s to take at least 60ms, took %s", elapsed)
+	}
+}
+
+func TestRedrive_MaxMessages(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(5), t)
+
+	moved, err := Redrive(context.Background(), mockSQS, "https://myqueue.com/000000000000/dlq", "https://myqueue.com/000000000000/jobs",
+		WithRedriveMaxMessages(2))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if moved != 2 {
+		t.Errorf("Expected 2 messages to be moved, got %d", moved)
+	}
+
+	if _, err := Redrive(context.Background(), mockSQS, "", "", WithRedriveRate(0)); err == nil {
+		t.Errorf("Expected error for a rate of 0")
+	}
+}
@@ -0,0 +1,136 @@
+package sqs
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// DeliverAtAttribute is the message attribute holding when a message
+// scheduled with MessageWriter.SetDeliverAt is delivered, in RFC 3339
+// format.
+const DeliverAtAttribute = "Deliver-At"
+
+// SetDeliverAt schedules the delivery of the message at `t`, which may be
+// later than the 15 minutes SQS can delay a message by. The message is sent
+// with the maximum delay up to `t`, and its DeliverAtAttribute set to `t`,
+// so that a Server created with WithScheduledDelivery sends it again until
+// `t`, rather than passing it to its receiver.
+//
+// FIFO queues do not support it, as they do not support delays on
+// individual messages.
+func (w *MessageWriter) SetDeliverAt(t time.Time) {
+	w.deliverAt = t
+}
+
+// applyDeliverAt sets the attribute and delay of a message scheduled with
+// SetDeliverAt.
+func (w *MessageWriter) applyDeliverAt() {
+	if w.deliverAt.IsZero() {
+		return
+	}
+
+	w.Attributes().Set(DeliverAtAttribute, w.deliverAt.UTC().Format(time.RFC3339Nano))
+	w.SetDelay(time.Until(w.deliverAt))
+}
+
+// WithScheduledDelivery makes the `Server` hold back the messages whose
+// DeliverAtAttribute is in the future, see MessageWriter.SetDeliverAt:
+// instead of being passed to the receiver, they are sent to the queue again
+// with the maximum delay up to their delivery time, then deleted.
+//
+// Messages whose DeliverAtAttribute cannot be parsed are delivered. Messages
+// are sent again with the message attributes they were received with, so
+// only those requested with WithMessageAttributeNames are kept. FIFO queues
+// are not supported.
+func WithScheduledDelivery() Option {
+	return func(s *Server) error {
+		s.scheduledDelivery = true
+
+		return nil
+	}
+}
+
+// errScheduledDeliveryFIFO is returned by NewServer when scheduled delivery
+// is enabled for a FIFO queue.
+var errScheduledDeliveryFIFO = errors.New("scheduled delivery is not supported by FIFO queues")
+
+// timeAttribute returns the time held by the message attribute `name` of
+// sqsMsg, in RFC 3339 format, or the zero time if it is missing or invalid.
+func (s *Server) timeAttribute(sqsMsg *sqs.Message, name string) time.Time {
+	v, ok := sqsMsg.MessageAttributes[name]
+	if !ok || v == nil {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, aws.StringValue(v.StringValue))
+	if err != nil {
+		s.logf(logger.Warn, "ignoring invalid %s attribute of message %s: %s", name, aws.StringValue(sqsMsg.MessageId), err)
+
+		return time.Time{}
+	}
+
+	return t
+}
+
+// holdBack sends sqsMsg to the queue again, delayed up to its delivery time,
+// and deletes it, if scheduled delivery is enabled and it is not due yet.
+// It reports whether sqsMsg was held back, in which case it must not be
+// passed to the receiver. Messages which cannot be sent again are left to
+// be received again after their visibility timeout, and the error is
+// returned.
+func (s *Server) holdBack(sqsMsg *sqs.Message, info MessageInfo) (bool, error) {
+	if !s.scheduledDelivery {
+		return false, nil
+	}
+
+	remaining := s.timeAttribute(sqsMsg, DeliverAtAttribute).Sub(s.getClock().Now())
+	if remaining <= 0 {
+		return false, nil
+	}
+
+	// delays are rounded up, so that messages due in less than a second
+	// are not received again straight away
+	delay := remaining
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	start := time.Now()
+	_, err := s.Svc.SendMessageWithContext(s.receiverCtx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(s.QueueURL),
+		MessageBody:       sqsMsg.Body,
+		MessageAttributes: sqsMsg.MessageAttributes,
+		DelaySeconds:      aws.Int64(int64(math.Ceil(delay.Seconds()))),
+	})
+	s.observeAPICall("SendMessage", start, err)
+	if err != nil {
+		s.logf(logger.Error, "cannot reschedule message %s: %s", info.MessageID, err)
+
+		return true, err
+	}
+
+	s.logf(logger.Trace, "rescheduled message %s, due in %s", info.MessageID, remaining)
+	s.deleteMessage(sqsMsg.ReceiptHandle, nil)
+
+	return true, nil
+}
+
+// receiveMessageAttributeNames returns the message attributes to request on
+// ReceiveMessage calls, adding those the Server needs when they were not
+// requested through WithMessageAttributeNames.
+func (s *Server) receiveMessageAttributeNames() []*string {
+	names := s.messageAttributeNames
+	if s.messageExpiry && !containsAttributeName(names, ExpiresAtAttribute) {
+		names = append(names[:len(names):len(names)], aws.String(ExpiresAtAttribute))
+	}
+	if s.scheduledDelivery && !containsAttributeName(names, DeliverAtAttribute) {
+		names = append(names[:len(names):len(names)], aws.String(DeliverAtAttribute))
+	}
+
+	return names
+}
@@ -0,0 +1,118 @@
+package sqs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/clock"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+func TestMessageWriter_SetDeliverAt(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: mockSQS}
+
+	deliverAt := time.Now().Add(time.Hour)
+	w := topic.NewWriter(context.Background())
+	w.(*MessageWriter).SetDeliverAt(deliverAt)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	sent := mockSQS.sent[0]
+	if d := aws.Int64Value(sent.DelaySeconds); d != 900 {
+		t.Errorf("Expected a delay of 900 seconds, got %d", d)
+	}
+	v := sent.MessageAttributes[DeliverAtAttribute]
+	if v == nil {
+		t.Fatalf("Expected the %s attribute to be set", DeliverAtAttribute)
+	}
+	if at, err := time.Parse(time.RFC3339Nano, aws.StringValue(v.StringValue)); err != nil || !at.Equal(deliverAt) {
+		t.Errorf("Expected %s to be %s, got %s", DeliverAtAttribute, deliverAt, aws.StringValue(v.StringValue))
+	}
+}
+
+// Tests that messages due in less than a second are sent again with a
+// delay, rather than being received again straight away.
+func TestServer_WithScheduledDelivery_SubSecond(t *testing.T) {
+	now := time.Now()
+	msgs := newSQSMessages(1)
+	(*msgs)[0].MessageAttributes[DeliverAtAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(now.Add(500 * time.Millisecond).UTC().Format(time.RFC3339Nano)),
+	}
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+	fake := clock.NewFake(now)
+	if err := WithClock(fake)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := WithScheduledDelivery()(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	held, err := srv.holdBack((*msgs)[0], MessageInfo{MessageID: "msg0"})
+	if !held || err != nil {
+		t.Fatalf("Expected the message to be held back, got %v (%v)", held, err)
+	}
+	if d := aws.Int64Value(mockSQS.sent[0].DelaySeconds); d != 1 {
+		t.Errorf("Expected a delay of 1 second, got %d", d)
+	}
+}
+
+// Tests that messages which are not due yet are sent again and deleted,
+// rather than passed to the receiver.
+func TestServer_WithScheduledDelivery(t *testing.T) {
+	msgs := newSQSMessages(2)
+	for i, at := range []time.Time{time.Now().Add(time.Hour), time.Now().Add(-time.Minute)} {
+		(*msgs)[i].MessageAttributes[DeliverAtAttribute] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(at.UTC().Format(time.RFC3339Nano)),
+		}
+	}
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+	if err := WithScheduledDelivery()(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var received int32
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		if id := MessageIDFromContext(ctx); id != "msg1" {
+			t.Errorf("Expected only msg1 to be delivered, got %s", id)
+		}
+		atomic.AddInt32(&received, 1)
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if n := atomic.LoadInt32(&received); n != 1 {
+		t.Errorf("Expected 1 message to be delivered, got %d", n)
+	}
+
+	mockSQS.mux.Lock()
+	defer mockSQS.mux.Unlock()
+	if len(mockSQS.sent) != 1 {
+		t.Fatalf("Expected 1 message to be rescheduled, got %d", len(mockSQS.sent))
+	}
+	sent := mockSQS.sent[0]
+	if aws.StringValue(sent.MessageBody) != "this is a test 0" {
+		t.Errorf("Unexpected body %s", aws.StringValue(sent.MessageBody))
+	}
+	if d := aws.Int64Value(sent.DelaySeconds); d != 900 {
+		t.Errorf("Expected a delay of 900 seconds, got %d", d)
+	}
+	if sent.MessageAttributes[DeliverAtAttribute] == nil {
+		t.Errorf("Expected the %s attribute to be kept", DeliverAtAttribute)
+	}
+}
@@ -0,0 +1,67 @@
+package sqs
+
+import "sync"
+
+// semaphore limits the number of concurrent message processing routines.
+// Unlike a buffered channel, its limit can be changed while it is in use.
+type semaphore struct {
+	mux   sync.Mutex
+	cond  *sync.Cond
+	limit int // maximum number of slots which can be acquired
+	count int // number of slots currently acquired
+}
+
+// newSemaphore returns a semaphore allowing `limit` concurrent routines.
+func newSemaphore(limit int) *semaphore {
+	s := &semaphore{limit: limit}
+	s.cond = sync.NewCond(&s.mux)
+
+	return s
+}
+
+// acquire blocks until a slot is available and takes it.
+func (s *semaphore) acquire() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for s.count >= s.limit {
+		s.cond.Wait()
+	}
+	s.count++
+}
+
+// release gives back a slot taken by acquire.
+func (s *semaphore) release() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.count--
+	s.cond.Broadcast()
+}
+
+// setLimit changes the number of slots. When lowered, routines holding
+// slots above the new limit are not interrupted, but no slot is handed out
+// until enough of them have been released.
+func (s *semaphore) setLimit(limit int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.limit = limit
+	s.cond.Broadcast()
+}
+
+// getLimit returns the number of slots.
+func (s *semaphore) getLimit() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.limit
+}
+
+// len returns the number of slots currently acquired.
+func (s *semaphore) len() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.count
+}
@@ -0,0 +1,64 @@
+package sqs
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that raising the limit of a semaphore unblocks waiting routines.
+func TestSemaphore_SetLimit(t *testing.T) {
+	sem := newSemaphore(1)
+	sem.acquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		sem.acquire()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Expected acquire to block when the semaphore is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sem.setLimit(2)
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected acquire to succeed after raising the limit")
+	}
+
+	if sem.len() != 2 {
+		t.Errorf("Expected 2 slots acquired, got %d", sem.len())
+	}
+}
+
+// Tests that lowering the limit of a semaphore blocks new routines until
+// enough slots are released.
+func TestSemaphore_LowerLimit(t *testing.T) {
+	sem := newSemaphore(2)
+	sem.acquire()
+	sem.acquire()
+	sem.setLimit(1)
+
+	acquired := make(chan struct{})
+	go func() {
+		sem.acquire()
+		close(acquired)
+	}()
+
+	sem.release()
+	select {
+	case <-acquired:
+		t.Fatalf("Expected acquire to block until the count drops below the new limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sem.release()
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected acquire to succeed after releasing slots")
+	}
+}
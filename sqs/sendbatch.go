@@ -0,0 +1,170 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+)
+
+// maxBatchBytes is the maximum total size of the messages of a
+// SendMessageBatch call.
+const maxBatchBytes = MaxMessageSize
+
+// WithTopicBatchSend makes MessageWriters of the `Topic` send their messages
+// with SendMessageBatch calls of up to 10 messages, instead of a SendMessage
+// call each, reducing the number of API calls of producers sending many
+// messages concurrently.
+//
+// Close blocks until the message is sent: messages are sent once 10 of them
+// are pending, or their total size reaches the limit of SQS, or
+// `flushInterval` after the first pending message was closed. It returns the
+// error of the batch call, or an awserr.Error with the code and message of
+// the entry of the message if it failed, as SendMessage would.
+func WithTopicBatchSend(flushInterval time.Duration) TopicOption {
+	return func(t *Topic) error {
+		if flushInterval <= 0 {
+			return errors.New("flush interval must be positive")
+		}
+
+		t.batcher = &sendBatcher{topic: t, interval: flushInterval}
+
+		return nil
+	}
+}
+
+// sendEntry is a message sent through a sendBatcher.
+type sendEntry struct {
+	input *sqs.SendMessageBatchRequestEntry
+	size  int
+	done  chan error // receives the result of the sending of the entry
+}
+
+// sendBatcher accumulates messages and sends them with SendMessageBatch
+// calls, from the goroutine closing the message completing a batch, or from
+// a timer once the flush interval elapsed.
+type sendBatcher struct {
+	topic    *Topic
+	interval time.Duration
+
+	mux     sync.Mutex
+	entries []*sendEntry
+	size    int         // total size of entries
+	timer   *time.Timer // flushes entries once the interval elapsed; nil when there are none
+}
+
+// send queues the message `params` to be sent with the next
+// SendMessageBatch call, and waits for the result of the call or ctx to be
+// done.
+func (b *sendBatcher) send(ctx context.Context, params *sqs.SendMessageInput) error {
+	e := &sendEntry{
+		input: &sqs.SendMessageBatchRequestEntry{
+			MessageBody:             params.MessageBody,
+			MessageAttributes:       params.MessageAttributes,
+			MessageSystemAttributes: params.MessageSystemAttributes,
+			DelaySeconds:            params.DelaySeconds,
+			MessageGroupId:          params.MessageGroupId,
+			MessageDeduplicationId:  params.MessageDeduplicationId,
+		},
+		size: messageSize(params),
+		done: make(chan error, 1),
+	}
+
+	b.mux.Lock()
+	var full []*sendEntry // entries to send from this goroutine
+	if b.size+e.size > maxBatchBytes {
+		full = b.take()
+	}
+	b.entries = append(b.entries, e)
+	b.size += e.size
+	if len(b.entries) == maxBatchSize {
+		full = b.take()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flushPending)
+	}
+	b.mux.Unlock()
+
+	if full != nil {
+		b.flush(full)
+	}
+
+	select {
+	case err := <-e.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// take returns the pending entries, and resets the batcher. It must be
+// called with b.mux held.
+func (b *sendBatcher) take() []*sendEntry {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	entries := b.entries
+	b.entries, b.size = nil, 0
+
+	return entries
+}
+
+// flushPending flushes the pending entries, once the flush interval elapsed.
+func (b *sendBatcher) flushPending() {
+	b.mux.Lock()
+	entries := b.take()
+	b.mux.Unlock()
+
+	if len(entries) > 0 {
+		b.flush(entries)
+	}
+}
+
+// flush sends `entries` with a single SendMessageBatch call, and sends the
+// result of each entry to its done channel.
+func (b *sendBatcher) flush(entries []*sendEntry) {
+	t := b.topic
+	input := &sqs.SendMessageBatchInput{QueueUrl: aws.String(t.QueueURL)}
+	byID := make(map[string]*sendEntry, len(entries))
+	for i, e := range entries {
+		id := strconv.Itoa(i)
+		e.input.Id = aws.String(id)
+		input.Entries = append(input.Entries, e.input)
+		byID[id] = e
+	}
+
+	t.logf(logger.Trace, "sending batch of %d messages to sqs", len(entries))
+	start := time.Now()
+	out, err := t.Svc.SendMessageBatchWithContext(context.Background(), input)
+	if t.metrics != nil {
+		t.metrics.ObserveAPICall("SendMessageBatch", time.Since(start), err)
+	}
+	if err != nil {
+		for _, e := range entries {
+			b.finish(e, err)
+		}
+		return
+	}
+
+	for _, f := range out.Failed {
+		if e, ok := byID[aws.StringValue(f.Id)]; ok {
+			b.finish(e, awserr.New(aws.StringValue(f.Code), aws.StringValue(f.Message), nil))
+			delete(byID, aws.StringValue(f.Id))
+		}
+	}
+	for _, e := range byID {
+		b.finish(e, nil)
+	}
+}
+
+// finish reports the result `err` of the sending of `e`.
+func (b *sendBatcher) finish(e *sendEntry, err error) {
+	e.done <- err
+}
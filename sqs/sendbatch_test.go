@@ -0,0 +1,91 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// batchSQSAPI records SendMessageBatch calls, failing the entries whose
+// body is "fail".
+type batchSQSAPI struct {
+	sqsiface.SQSAPI
+
+	mux     sync.Mutex
+	batches []*sqs.SendMessageBatchInput
+}
+
+func (s *batchSQSAPI) SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.batches = append(s.batches, input)
+
+	out := &sqs.SendMessageBatchOutput{}
+	for _, e := range input.Entries {
+		if aws.StringValue(e.MessageBody) == "fail" {
+			out.Failed = append(out.Failed, &sqs.BatchResultErrorEntry{
+				Id:      e.Id,
+				Code:    aws.String("InvalidMessageContents"),
+				Message: aws.String("invalid message"),
+			})
+		}
+	}
+	return out, nil
+}
+
+// Tests that messages are sent in batches of up to 10, and that the failure
+// of an entry is only returned by the Close of its MessageWriter.
+func TestWithTopicBatchSend(t *testing.T) {
+	svc := &batchSQSAPI{}
+	topic := &Topic{Svc: svc, QueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/jobs"}
+	if err := WithTopicBatchSend(50 * time.Millisecond)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	errs := make([]error, 25)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := topic.NewWriter(context.Background())
+			w.Attributes().Set("Tenant", "acme")
+			if i == 7 {
+				w.Write([]byte("fail"))
+			} else {
+				w.Write([]byte("hello"))
+			}
+			errs[i] = w.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		var aerr awserr.Error
+		if i == 7 && (!errors.As(err, &aerr) || aerr.Code() != "InvalidMessageContents") {
+			t.Errorf("Expected the error of the entry for message %d, got %v", i, err)
+		} else if i != 7 && err != nil {
+			t.Errorf("Unexpected error %v for message %d", err, i)
+		}
+	}
+
+	if len(svc.batches) != 3 {
+		t.Fatalf("Expected 3 SendMessageBatch calls, got %d", len(svc.batches))
+	}
+	for _, b := range svc.batches {
+		if len(b.Entries) > maxBatchSize {
+			t.Errorf("Expected at most %d messages per batch, got %d", maxBatchSize, len(b.Entries))
+		}
+		if aws.StringValue(b.Entries[0].MessageAttributes["Tenant"].StringValue) != "acme" {
+			t.Errorf("Expected the attributes to be sent")
+		}
+	}
+}
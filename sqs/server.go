@@ -1,24 +1,32 @@
 package sqs
 
 import (
-	"bytes"
 	"context"
 	crand "crypto/rand"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"log"
 	"math/rand"
+	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/hdtradeservices/go-aws-msg/clock"
+	"github.com/hdtradeservices/go-aws-msg/internal/awssession"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/metrics"
 	msg "github.com/hdtradeservices/go-msg"
 	"github.com/zerofox-oss/go-aws-msg/retryer"
 )
@@ -52,9 +60,76 @@ type Server struct {
 	// Concrete instance of SQSAPI
 	Svc sqsiface.SQSAPI
 
-	maxConcurrentReceives chan struct{} // The maximum number of message processing routines allowed
-	retryTimeout          int64         // Visbility Timeout for a message when a receiver fails
+	maxConcurrentReceives *semaphore // The maximum number of message processing routines allowed
+	retryTimeout          int64      // Visbility Timeout for a message when a receiver fails
 	retryJitter           int64
+	maxMessages           int64 // The maximum number of messages to request per ReceiveMessage call
+	waitTimeSeconds       int64 // The duration of the ReceiveMessage long poll
+
+	attributeNames        []*string // SQS system attributes requested on each ReceiveMessage call
+	systemAttributePrefix string    // prefix added to system attributes when converted to msg.Attributes
+	messageAttributeNames []*string // message attributes requested on each ReceiveMessage call
+
+	heartbeatInterval          time.Duration // how often in-flight messages have their visibility extended; 0 disables it
+	heartbeatVisibilityTimeout int64         // Visibility Timeout set on each heartbeat
+
+	poolMessages bool // whether the messages passed to receivers are reused, see WithMessagePooling
+
+	scheduledDelivery bool // whether messages are held back until their DeliverAtAttribute, see WithScheduledDelivery
+	messageExpiry     bool // whether messages past their ExpiresAtAttribute are deleted, see WithMessageExpiry
+
+	backoffFunc BackoffFunc // computes the Visibility Timeout of failed messages from their receive count
+
+	queueName           string // name of the queue whose URL is resolved by NewServer
+	queueOwnerAccountID string // AWS account owning the queue called queueName
+
+	ensureQueueAttributes map[string]string // attributes of the queue created by NewServer if it does not exist
+
+	receiveErrorBackoff BackoffFunc // delay before retrying a failed ReceiveMessage call; nil makes Serve return
+	maxReceiveFailures  int         // consecutive ReceiveMessage failures after which Serve returns; 0 retries forever
+
+	idleBackoff BackoffFunc // delay before polling again after consecutive empty receives
+	pollers     int         // number of concurrent ReceiveMessage loops
+
+	receiverDeadline       bool          // whether Receive contexts have a deadline before the visibility timeout expires
+	deadlineMargin         time.Duration // how long before the visibility timeout expires Receive contexts are canceled
+	queueVisibilityTimeout time.Duration // visibility timeout of the queue, loaded by Serve for receiver deadlines
+
+	panicPolicy PanicPolicy // what to do once a panicking receiver was recovered
+
+	deadLetterTopic       msg.Topic // where poison messages are forwarded; nil disables it
+	deadLetterMaxReceives int       // receive count after which messages are forwarded to deadLetterTopic
+
+	logger  logger.Logger    // where the Server logs; logger.Default when nil
+	metrics metrics.Recorder // where the Server reports metrics; metrics.Nop when nil
+
+	cloudWatch cloudwatchiface.CloudWatchAPI // reads queue metrics published to CloudWatch; may be nil
+
+	middleware []func(msg.Receiver) msg.Receiver // decorators wrapping the receiver passed to Serve
+	unwrapSNS  bool                              // whether SNS notification envelopes are unwrapped before the middleware
+	verifySNS  EnvelopeVerifier                  // verifies SNS notification envelopes before they are unwrapped; may be nil
+	hooks      Hooks                             // callbacks fired for each message
+	groups     *groupSequencer                   // orders the messages of each group of a FIFO queue; nil otherwise
+
+	receiveAttemptIDs bool        // whether ReceiveMessage calls to a FIFO queue set a ReceiveRequestAttemptId
+	autoscaler        *autoscaler // scales the number of active pollers with the queue depth
+
+	deleteBatcher     *batcher // batches DeleteMessage calls when set
+	visibilityBatcher *batcher // batches ChangeMessageVisibility calls of failed messages when set
+
+	deleteBatchInterval     time.Duration // flush interval of deleteBatcher, see WithBatchDelete
+	visibilityBatchInterval time.Duration // flush interval of visibilityBatcher, see WithBatchVisibilityChange
+
+	routines            sync.WaitGroup // pollers and receivers of the Server, waited for by Shutdown
+	shutdownGracePeriod time.Duration  // how long Shutdown waits for canceled receivers once its context is done
+	clock               clock.Clock    // times backoffs, retries and shutdowns; clock.Real when nil
+
+	serving  int32 // number of running Serve calls, used by health checks
+	statsMux sync.Mutex
+	stats    Stats // activity of the Server, returned by Stats
+
+	pauseMux sync.Mutex
+	resumeCh chan struct{} // closed by Resume; nil when the server is not paused
 
 	receiverCtx        context.Context    // context used to control the life of receivers
 	receiverCancelFunc context.CancelFunc // CancelFunc for all receiver routines
@@ -73,7 +148,7 @@ func (s *Server) convertToMsgAttrs(attr msg.Attributes, awsAttrs map[string]*sqs
 // convertToAttrs creates msg.Attributes from sqs.Attributes.
 func (s *Server) convertToAttrs(attr msg.Attributes, attrs map[string]*string) {
 	for k, v := range attrs {
-		attr.Set(k, *v)
+		attr.Set(s.systemAttributePrefix+k, *v)
 	}
 }
 
@@ -81,87 +156,392 @@ func (s *Server) convertToAttrs(attr msg.Attributes, attrs map[string]*string) {
 // and calls Receive on `r`. Serve is blocking and will not return until
 // Shutdown is called on the Server.
 //
-// NewServer should be used prior to running Serve.
+// NewServer should be used prior to running Serve. Once Shutdown was
+// called, Serve returns msg.ErrServerClosed immediately.
 func (s *Server) Serve(ctx context.Context, r msg.Receiver) error {
+	if s.serverCtx.Err() != nil {
+		return msg.ErrServerClosed
+	}
+
+	atomic.AddInt32(&s.serving, 1)
+	defer atomic.AddInt32(&s.serving, -1)
+
+	r = s.wrapReceiver(r)
+
+	// pollCtx stops every poller as soon as one of them fails
+	pollCtx, cancel := context.WithCancel(s.serverCtx)
+	defer cancel()
+
+	if err := s.loadVisibilityTimeout(); err != nil {
+		return err
+	}
+
+	if s.autoscaler != nil {
+		go s.autoscaler.run(pollCtx, s)
+	}
+
+	errs := make(chan error, s.pollers)
+	s.routines.Add(s.pollers)
+	for i := 0; i < s.pollers; i++ {
+		go func(i int) {
+			defer s.routines.Done()
+
+			err := s.poll(pollCtx, i, r)
+			if err != msg.ErrServerClosed {
+				cancel()
+			}
+
+			errs <- err
+		}(i)
+	}
+
+	var err error
+	for i := 0; i < s.pollers; i++ {
+		if pollErr := <-errs; err == nil || err == msg.ErrServerClosed {
+			err = pollErr
+		}
+	}
+
+	return err
+}
+
+// poll continuously receives messages from the queue and dispatches them
+// to `r` until ctx is canceled, in which case msg.ErrServerClosed is
+// returned, or a ReceiveMessage call fails. `i` is the index of the poller,
+// used to determine whether it is active when autoscaling.
+func (s *Server) poll(ctx context.Context, i int, r msg.Receiver) error {
+	failures := 0   // number of consecutive failed ReceiveMessage calls
+	empty := 0      // number of consecutive ReceiveMessage calls which returned no messages
+	attemptID := "" // ReceiveRequestAttemptId of the ReceiveMessage call, reused after failures
+
 	for {
 		select {
-		case <-s.serverCtx.Done():
-			close(s.maxConcurrentReceives)
-
+		case <-ctx.Done():
 			return msg.ErrServerClosed
 
 		default:
-			resp, err := s.Svc.ReceiveMessage(&sqs.ReceiveMessageInput{
-				MaxNumberOfMessages:   aws.Int64(10),
-				WaitTimeSeconds:       aws.Int64(20),
-				QueueUrl:              aws.String(s.QueueURL),
-				AttributeNames:        []*string{aws.String("All")},
-				MessageAttributeNames: []*string{aws.String("All")},
-			})
-			if err != nil {
-				log.Printf("[ERROR] Could not read from SQS: %s", err.Error())
+			if s.waitWhilePaused(ctx) {
+				continue
+			}
 
-				return err
+			if s.autoscaler != nil && s.autoscaler.waitForActivation(ctx, i) {
+				continue
+			}
+
+			if s.receiveAttemptIDs && attemptID == "" {
+				attemptID = newReceiveAttemptID()
 			}
 
-			for _, m := range resp.Messages {
-				if m.MessageId != nil {
-					log.Printf("[TRACE] Received SQS Message: %s\n", *m.MessageId)
+			messages, err := s.receive(ctx, s.waitTimeSeconds, attemptID)
+			receivedAt := time.Now()
+			if err == msg.ErrServerClosed {
+				return err
+			}
+			if err != nil {
+				failures++
+				if !s.waitAfterReceiveError(ctx, failures) {
+					return err
 				}
 
-				// Take a slot from the buffered channel
-				s.maxConcurrentReceives <- struct{}{}
-
-				go func(sqsMsg *sqs.Message) {
-					defer func() {
-						<-s.maxConcurrentReceives
-					}()
-
-					// set the sqs attributes first
-					// and the custom message attributes after
-					// as they may override the regular attributes
-
-					attrs := msg.Attributes{}
-					s.convertToAttrs(attrs, sqsMsg.Attributes)
-					s.convertToMsgAttrs(attrs, sqsMsg.MessageAttributes)
-
-					m := &msg.Message{
-						Attributes: attrs,
-						Body:       bytes.NewBufferString(*sqsMsg.Body),
-					}
-
-					if err := r.Receive(s.receiverCtx, m); err != nil {
-						log.Printf("[ERROR] Receiver error: %s; will retry after visibility timeout", err.Error())
-
-						params := &sqs.ChangeMessageVisibilityInput{
-							QueueUrl:          aws.String(s.QueueURL),
-							ReceiptHandle:     sqsMsg.ReceiptHandle,
-							VisibilityTimeout: aws.Int64(getVisiblityTimeout(s.retryTimeout, s.retryJitter)),
-						}
-						if _, err := s.Svc.ChangeMessageVisibility(params); err != nil {
-							log.Printf("[ERROR] cannot change message visibility %s", err)
-						}
-
-						throttleErr, ok := err.(ErrThrottleServer)
-						if ok {
-							log.Printf("[TRACE] throttling received, sleeping for: %s", throttleErr.Duration.String())
-
-							time.Sleep(throttleErr.Duration)
-						}
-						return
-					}
-
-					_, err = s.Svc.DeleteMessage(&sqs.DeleteMessageInput{
-						QueueUrl:      aws.String(s.QueueURL),
-						ReceiptHandle: sqsMsg.ReceiptHandle,
-					})
-
-					if err != nil {
-						log.Printf("[ERROR] Delete message: %s", err.Error())
-					}
-				}(m)
+				continue
+			}
+			failures = 0
+			attemptID = ""
+
+			for _, m := range messages {
+				s.dispatch(r, m, receivedAt)
+			}
+
+			if len(messages) > 0 {
+				empty = 0
+			} else {
+				empty++
+				s.waitWhileIdle(ctx, empty)
+			}
+		}
+	}
+}
+
+// wrapReceiver wraps `r` with the Server's middleware, the first middleware
+// being the outermost, and with SNSEnvelopeDecoder when SNS envelopes are
+// unwrapped.
+func (s *Server) wrapReceiver(r msg.Receiver) msg.Receiver {
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		r = s.middleware[i](r)
+	}
+	if s.unwrapSNS {
+		r = snsEnvelopeDecoder(r, s.verifySNS)
+	}
+
+	return r
+}
+
+// receive makes a single ReceiveMessage call, long polling for up to
+// waitTimeSeconds. attemptID is set as its ReceiveRequestAttemptId,
+// unless it is empty. The call is interrupted once ctx is canceled,
+// in which case msg.ErrServerClosed is returned.
+func (s *Server) receive(ctx context.Context, waitTimeSeconds int64, attemptID string) ([]*sqs.Message, error) {
+	params := &sqs.ReceiveMessageInput{
+		MaxNumberOfMessages:   aws.Int64(s.maxMessages),
+		WaitTimeSeconds:       aws.Int64(waitTimeSeconds),
+		QueueUrl:              aws.String(s.QueueURL),
+		AttributeNames:        s.receiveAttributeNames(),
+		MessageAttributeNames: s.receiveMessageAttributeNames(),
+	}
+	if attemptID != "" {
+		params.ReceiveRequestAttemptId = aws.String(attemptID)
+	}
+
+	start := time.Now()
+	resp, err := s.Svc.ReceiveMessageWithContext(ctx, params)
+	if err != nil && ctx.Err() != nil {
+		return nil, msg.ErrServerClosed
+	}
+	s.observeAPICall("ReceiveMessage", start, err)
+	if err != nil {
+		s.logf(logger.Error, "Could not read from SQS: %s", err.Error())
+
+		return nil, &OpError{Op: "ReceiveMessage", Queue: s.QueueURL, Kind: ErrReceiveFailed, Err: err}
+	}
+
+	s.recorder().ObserveReceive(s.queueLabel(), len(resp.Messages))
+	s.updateStats(func(stats *Stats) {
+		stats.Received += int64(len(resp.Messages))
+		stats.LastReceive = time.Now()
+	})
+
+	return resp.Messages, nil
+}
+
+// waitAfterReceiveError sleeps before retrying a failed ReceiveMessage call,
+// according to the Server's receive error policy. It returns false when
+// Serve should give up instead, after `failures` consecutive failures.
+func (s *Server) waitAfterReceiveError(ctx context.Context, failures int) bool {
+	if s.receiveErrorBackoff == nil {
+		return false
+	}
+
+	if s.maxReceiveFailures > 0 && failures >= s.maxReceiveFailures {
+		s.logf(logger.Error, "giving up after %d consecutive receive failures", failures)
+
+		return false
+	}
+
+	delay := s.receiveErrorBackoff(failures)
+	s.logf(logger.Warn, "receive failed %d consecutive times, retrying in %s", failures, delay)
+
+	s.sleep(ctx, delay)
+
+	return true
+}
+
+// waitWhileIdle sleeps before polling an empty queue again, after `empty`
+// consecutive ReceiveMessage calls returned no messages, according to the
+// Server's idle backoff.
+func (s *Server) waitWhileIdle(ctx context.Context, empty int) {
+	if s.idleBackoff == nil || empty == 0 {
+		return
+	}
+
+	s.sleep(ctx, s.idleBackoff(empty))
+}
+
+// sleep pauses the current goroutine for at least the duration d,
+// or until ctx is canceled.
+func (s *Server) sleep(ctx context.Context, d time.Duration) {
+	timer := s.getClock().NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+	case <-ctx.Done():
+	}
+}
+
+// getClock returns the Clock of the Server, clock.Real by default.
+func (s *Server) getClock() clock.Clock {
+	if s.clock == nil {
+		return clock.Real
+	}
+
+	return s.clock
+}
+
+// dispatch waits for a free concurrency slot and processes sqsMsg,
+// received at receivedAt, in its own goroutine. Messages of a FIFO queue
+// are processed after the previous message of their group.
+func (s *Server) dispatch(r msg.Receiver, sqsMsg *sqs.Message, receivedAt time.Time) {
+	if sqsMsg.MessageId != nil {
+		s.logf(logger.Trace, "Received SQS Message: %s", *sqsMsg.MessageId)
+	}
+
+	// Take a concurrency slot
+	s.maxConcurrentReceives.acquire()
+	s.recorder().AddInFlight(s.queueLabel(), 1)
+
+	// dispatch is called by a routine already counted by s.routines,
+	// so that Shutdown cannot stop waiting before this Add
+	s.routines.Add(1)
+
+	group := messageGroupID(sqsMsg)
+	if s.groups == nil || group == "" {
+		go func() {
+			defer s.routines.Done()
+			defer s.maxConcurrentReceives.release()
+			defer s.recorder().AddInFlight(s.queueLabel(), -1)
+
+			s.handleMessage(r, sqsMsg, receivedAt)
+		}()
+
+		return
+	}
+
+	prev, turn := s.groups.next(group)
+	go func() {
+		defer s.routines.Done()
+		defer s.maxConcurrentReceives.release()
+		defer s.recorder().AddInFlight(s.queueLabel(), -1)
+
+		failed := true
+		defer func() { s.groups.finish(group, turn, failed) }()
+
+		if prev != nil {
+			<-prev.done
+
+			// processing a message after a failed one of the same group would
+			// break its ordering, so it is made visible again to be received
+			// after the failed one
+			if prev.failed {
+				s.changeMessageVisibility(sqsMsg.ReceiptHandle, 0)
+				return
 			}
 		}
+
+		failed = !s.handleMessage(r, sqsMsg, receivedAt)
+	}()
+}
+
+// handleMessage calls Receive on `r` with the message converted from sqsMsg,
+// then deletes it on success or changes its visibility on failure. It reports
+// whether the message was settled, rather than left to be received again.
+func (s *Server) handleMessage(r msg.Receiver, sqsMsg *sqs.Message, receivedAt time.Time) bool {
+	received := s.newMessage(sqsMsg)
+	defer s.releaseMessage(received)
+	m := &received.msg
+
+	info := s.messageInfo(sqsMsg, receivedAt)
+	if s.expire(sqsMsg, info) {
+		return true
+	}
+	if held, err := s.holdBack(sqsMsg, info); held {
+		return err == nil
+	}
+	s.hooks.fire(s.hooks.OnReceive, info)
+
+	if s.shouldDeadLetter(sqsMsg, false) && s.deadLetter(sqsMsg, nil) {
+		return true
+	}
+
+	stopHeartbeat := func() {}
+	if s.heartbeatInterval > 0 {
+		stopHeartbeat = s.startHeartbeat(sqsMsg.ReceiptHandle)
+	}
+
+	start := time.Now()
+	ctx, cancel := s.receiverContext(receivedAt)
+	ctx = contextWithMessageTraceHeader(ctx, sqsMsg)
+	ctx = ContextWithMessageID(ctx, info.MessageID)
+	acker := &Acker{}
+	ctx = contextWithAcker(ctx, acker)
+	err := s.callReceiver(ctx, r, m)
+	cancel()
+	stopHeartbeat()
+
+	outcome, delay := acker.result()
+	switch {
+	case outcome == ackAck:
+		err = nil
+	case outcome == ackDefault && errors.Is(err, ErrSkipMessage):
+		outcome = ackDiscard
+	}
+
+	info.Duration = time.Since(start)
+	if outcome == ackDiscard {
+		s.recorder().ObserveSkipped(s.queueLabel(), info.Duration)
+		s.updateStats(func(stats *Stats) { stats.Skipped++ })
+	} else {
+		s.recorder().ObserveProcessed(s.queueLabel(), info.Duration, err)
+		s.updateStats(func(stats *Stats) {
+			if err != nil {
+				stats.Failed++
+			} else {
+				stats.Succeeded++
+			}
+		})
+	}
+
+	switch outcome {
+	case ackDiscard:
+		if err != nil {
+			s.logf(logger.Info, "skipping message %s: %s", info.MessageID, err)
+		} else {
+			s.logf(logger.Info, "skipping message %s", info.MessageID)
+		}
+
+		s.deleteMessage(sqsMsg.ReceiptHandle, s.deleted(info))
+		s.repanic(err)
+		return true
+
+	case ackNack:
+		if err != nil {
+			info.Err = err
+			s.hooks.fire(s.hooks.OnError, info)
+		}
+
+		s.changeMessageVisibility(sqsMsg.ReceiptHandle, delayVisibilityTimeout(delay))
+		s.repanic(err)
+		return false
+	}
+
+	if err != nil {
+		s.logf(logger.Error, "Receiver error: %s; will retry after visibility timeout", err.Error())
+
+		info.Err = err
+		s.hooks.fire(s.hooks.OnError, info)
+
+		deadLettered := s.shouldDeadLetter(sqsMsg, true) && s.deadLetter(sqsMsg, err)
+		if !deadLettered {
+			s.changeMessageVisibility(sqsMsg.ReceiptHandle, s.retryVisibilityTimeout(sqsMsg, err))
+		}
+		s.repanic(err)
+
+		throttleErr, ok := err.(ErrThrottleServer)
+		if ok {
+			s.logf(logger.Trace, "throttling received, sleeping for: %s", throttleErr.Duration.String())
+
+			s.getClock().Sleep(throttleErr.Duration)
+		}
+		return deadLettered
+	}
+
+	s.hooks.fire(s.hooks.OnProcessed, info)
+
+	s.deleteMessage(sqsMsg.ReceiptHandle, s.deleted(info))
+
+	return true
+}
+
+// deleted returns the callback reporting the deletion of the message
+// described by info.
+func (s *Server) deleted(info MessageInfo) func(error) {
+	return func(err error) {
+		s.recorder().ObserveDelete(s.queueLabel(), err)
+		if err == nil {
+			s.updateStats(func(stats *Stats) { stats.Deleted++ })
+		}
+
+		info.Err = err
+		s.hooks.fire(s.hooks.OnDelete, info)
 	}
 }
 
@@ -175,12 +555,20 @@ func getVisiblityTimeout(retryTimeout int64, retryJitter int64) int64 {
 	return int64(rand.Intn(int(maxRetry-minRetry)+1) + int(minRetry))
 }
 
-const shutdownPollInterval = 500 * time.Millisecond
+// defaultMaxMessages is the number of messages requested per ReceiveMessage
+// call, which is also the maximum allowed by SQS.
+const defaultMaxMessages = 10
+
+// defaultWaitTimeSeconds is the long poll duration of ReceiveMessage calls,
+// which is also the maximum allowed by SQS.
+const defaultWaitTimeSeconds = 20
 
 // Shutdown stops the receipt of new messages and waits for routines
 // to complete or the passed in ctx to be canceled. msg.ErrServerClosed
-// will be returned upon a clean shutdown. Otherwise, the passed ctx's
-// Error will be returned.
+// will be returned upon a clean shutdown. Otherwise, an *OpError matching
+// ErrShutdownTimeout and wrapping the passed ctx's Error will be returned,
+// once the contexts of the receivers were canceled and the grace period set
+// with WithShutdownGracePeriod expired.
 func (s *Server) Shutdown(ctx context.Context) error {
 	if ctx == nil {
 		panic("context not set")
@@ -188,21 +576,68 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 	s.serverCancelFunc()
 
-	ticker := time.NewTicker(shutdownPollInterval)
-	defer ticker.Stop()
+	done := make(chan struct{})
+	go func() {
+		s.routines.Wait()
+		close(done)
+	}()
 
-	for {
-		select {
-		case <-ctx.Done():
-			s.receiverCancelFunc()
+	select {
+	case <-ctx.Done():
+		s.receiverCancelFunc()
+		s.waitForGracePeriod(done)
+		s.closeBatchers()
 
-			return ctx.Err()
-		case <-ticker.C:
-			if len(s.maxConcurrentReceives) == 0 {
-				return msg.ErrServerClosed
-			}
-		}
+		return &OpError{Op: "Shutdown", Queue: s.QueueURL, Kind: ErrShutdownTimeout, Err: ctx.Err()}
+	case <-done:
+		s.closeBatchers()
+
+		return msg.ErrServerClosed
+	}
+}
+
+// SystemAttributePrefix is prepended to the names of SQS system attributes
+// (ApproximateReceiveCount, SentTimestamp, etc.) when they are merged into
+// msg.Attributes by a Server configured with WithSystemAttributes.
+const SystemAttributePrefix = "SQS-"
+
+// waitForGracePeriod waits for done to be closed, for up to
+// the shutdown grace period of the Server.
+func (s *Server) waitForGracePeriod(done <-chan struct{}) {
+	if s.shutdownGracePeriod <= 0 {
+		return
+	}
+
+	timer := s.getClock().NewTimer(s.shutdownGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C():
+		s.logf(logger.Warn, "shutdown grace period of %s expired before every receiver returned", s.shutdownGracePeriod)
+	}
+}
+
+// SetConcurrency changes the maximum number of messages processed
+// concurrently. It is safe to call while the Server is serving, e.g. from an
+// admin endpoint, to throttle or boost processing without a restart.
+//
+// When lowering the concurrency, messages already being processed are not
+// interrupted, but no new message is processed until the number of
+// in-flight messages drops below `n`.
+func (s *Server) SetConcurrency(n int) {
+	// It makes no sense to have a concurrency of less than 1.
+	if n < 1 {
+		s.logf(logger.Warn, "Requesting concurrency of %d, this makes no sense, setting to 1", n)
+		n = 1
 	}
+
+	s.maxConcurrentReceives.setLimit(n)
+}
+
+// Concurrency returns the maximum number of messages processed concurrently.
+func (s *Server) Concurrency() int {
+	return s.maxConcurrentReceives.getLimit()
 }
 
 // Option is the signature that modifies a `Server` to set some configuration
@@ -211,32 +646,50 @@ type Option func(*Server) error
 // NewServer creates and initializes a new Server using queueURL to a SQS queue
 // `cl` represents the number of concurrent message receives (10 msgs each).
 //
-// AWS credentials (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY) are assumed to be set
-// as environment variables.
+// If the queue is a FIFO queue (its name ends with ".fifo"), messages sharing
+// the same MessageGroupId are processed one at a time, in order, while
+// messages of different groups are processed concurrently.
+//
+// AWS credentials are resolved with the default credential chain of the SDK:
+// environment variables, shared credentials file, web identity token, then
+// ECS task role or EC2 instance profile. See WithEnvCredentials to only use
+// environment variables.
+//
+// On EKS with IAM Roles for Service Accounts, the role in AWS_ROLE_ARN is
+// assumed with the token in AWS_WEB_IDENTITY_TOKEN_FILE, and the temporary
+// credentials are refreshed a few minutes before they expire.
+//
+// The profile in AWS_PROFILE is used, and its region too when the shared
+// config file is loaded with AWS_SDK_LOAD_CONFIG, see WithProfile. Otherwise,
+// the region defaults to us-west-2.
 //
 // SQS_ENDPOINT can be set as an environment variable in order to
-// override the aws.Client's Configured Endpoint
+// override the aws.Client's Configured Endpoint. WithRegion and WithEndpoint
+// override AWS_REGION and SQS_ENDPOINT for a single Server.
 func NewServer(queueURL string, cl int, retryTimeout int64, opts ...Option) (msg.Server, error) {
 	// It makes no sense to have a concurrency of less than 1.
 	if cl < 1 {
-		log.Printf("[WARN] Requesting concurrency of %d, this makes no sense, setting to 1\n", cl)
+		logger.Default.Logf(logger.Warn, "Requesting concurrency of %d, this makes no sense, setting to 1", cl)
 		cl = 1
 	}
 
-	sess, err := session.NewSession()
+	sess, err := awssession.New(aws.Config{}, "")
 	if err != nil {
 		return nil, err
 	}
 
 	conf := &aws.Config{
-		Credentials: credentials.NewCredentials(&credentials.EnvProvider{}),
-		Region:      aws.String("us-west-2"),
 		Retryer: retryer.DefaultRetryer{
 			Retryer: client.DefaultRetryer{NumMaxRetries: 7},
 			Delay:   2 * time.Second,
 		},
 	}
 
+	// the region of the shared config file is used if it is loaded
+	if aws.StringValue(sess.Config.Region) == "" {
+		conf.Region = aws.String("us-west-2")
+	}
+
 	// http://docs.aws.amazon.com/sdk-for-go/api/aws/client/#Config
 	if r := os.Getenv("AWS_REGION"); r != "" {
 		conf.Region = aws.String(r)
@@ -255,8 +708,13 @@ func NewServer(queueURL string, cl int, retryTimeout int64, opts ...Option) (msg
 	srv := &Server{
 		Svc:                   svc,
 		retryTimeout:          retryTimeout,
+		maxMessages:           defaultMaxMessages,
+		waitTimeSeconds:       defaultWaitTimeSeconds,
+		pollers:               1,
+		attributeNames:        []*string{aws.String(sqs.QueueAttributeNameAll)},
+		messageAttributeNames: []*string{aws.String(sqs.QueueAttributeNameAll)},
 		QueueURL:              queueURL,
-		maxConcurrentReceives: make(chan struct{}, cl),
+		maxConcurrentReceives: newSemaphore(cl),
 		serverCtx:             serverCtx,
 		serverCancelFunc:      serverCancelFunc,
 		receiverCtx:           receiverCtx,
@@ -270,6 +728,28 @@ func NewServer(queueURL string, cl int, retryTimeout int64, opts ...Option) (msg
 		}
 	}
 
+	// the SQS client waits on the clock between retries
+	if client, ok := srv.Svc.(*sqs.SQS); ok && srv.clock != nil {
+		client.Config.SleepDelay = srv.clock.Sleep
+	}
+
+	srv.QueueURL, err = resolveQueue(srv.Svc, srv.QueueURL, srv.queueName, srv.queueOwnerAccountID, srv.ensureQueueAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if isFIFOQueue(srv.QueueURL) && srv.scheduledDelivery {
+		return nil, errScheduledDeliveryFIFO
+	}
+
+	if isFIFOQueue(srv.QueueURL) {
+		srv.groups = newGroupSequencer()
+	} else {
+		srv.receiveAttemptIDs = false
+	}
+
+	srv.startBatchers()
+
 	return srv, nil
 }
 
@@ -282,6 +762,215 @@ func getConf(s *Server) (*aws.Config, error) {
 	return &svc.Client.Config, nil
 }
 
+// WithClient makes the `Server` use `svc` instead of the SQS client built by
+// NewServer from the environment, e.g. to share a client configured by the
+// application, or to use a fake in tests. Options modifying the client, like
+// WithRetries, must be passed before it or not at all.
+func WithClient(svc sqsiface.SQSAPI) Option {
+	return func(s *Server) error {
+		if svc == nil {
+			return errors.New("client must not be nil")
+		}
+
+		s.Svc = svc
+
+		return nil
+	}
+}
+
+// WithSession makes the `Server` use an SQS client created from `sess`,
+// e.g. shared with the rest of the application, instead of the session and
+// configuration NewServer creates from the environment. `cfgs` override the
+// configuration of `sess` for the SQS client only, e.g. its Region.
+//
+// Unlike the client created by NewServer, it does not retry on credential
+// errors unless WithRetries is passed after it.
+func WithSession(sess *session.Session, cfgs ...*aws.Config) Option {
+	return func(s *Server) error {
+		if sess == nil {
+			return errors.New("session must not be nil")
+		}
+
+		s.session = sess
+		s.Svc = sqs.New(sess, cfgs...)
+
+		return nil
+	}
+}
+
+// WithEnvCredentials makes the `Server` only read AWS credentials from the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables, instead
+// of using the default credential chain.
+func WithEnvCredentials() Option {
+	return func(s *Server) error {
+		c, err := getConf(s)
+		if err != nil {
+			return err
+		}
+
+		c.Credentials = credentials.NewCredentials(&credentials.EnvProvider{})
+		s.Svc = sqs.New(s.session, c)
+
+		return nil
+	}
+}
+
+// WithProfile makes the `Server` use the credentials and region of the named
+// profile of the shared config and credentials files, e.g. ~/.aws/config,
+// instead of the profile in AWS_PROFILE, so that exporting AWS keys is not
+// needed to develop against real queues.
+func WithProfile(name string) Option {
+	return func(s *Server) error {
+		if name == "" {
+			return errors.New("profile must not be empty")
+		}
+
+		c, err := getConf(s)
+		if err != nil {
+			return err
+		}
+
+		sess, err := awssession.New(aws.Config{}, name)
+		if err != nil {
+			return err
+		}
+
+		c.Credentials = sess.Config.Credentials
+		if region := aws.StringValue(sess.Config.Region); region != "" {
+			c.Region = aws.String(region)
+		}
+		s.session = sess
+		s.Svc = sqs.New(sess, c)
+
+		return nil
+	}
+}
+
+// WithRegion makes the `Server` call SQS in the AWS `region`, instead of the
+// one set by the AWS_REGION environment variable, or us-west-2.
+func WithRegion(region string) Option {
+	return func(s *Server) error {
+		if region == "" {
+			return errors.New("region must not be empty")
+		}
+
+		c, err := getConf(s)
+		if err != nil {
+			return err
+		}
+
+		c.Region = aws.String(region)
+		s.Svc = sqs.New(s.session, c)
+
+		return nil
+	}
+}
+
+// WithEndpoint makes the `Server` call SQS at `url`, instead of the one set
+// by the SQS_ENDPOINT environment variable or the endpoint of its region,
+// e.g. to use a local SQS implementation.
+func WithEndpoint(url string) Option {
+	return func(s *Server) error {
+		if url == "" {
+			return errors.New("endpoint must not be empty")
+		}
+
+		c, err := getConf(s)
+		if err != nil {
+			return err
+		}
+
+		c.Endpoint = aws.String(url)
+		s.Svc = sqs.New(s.session, c)
+
+		return nil
+	}
+}
+
+// WithFIPSEndpoint makes the `Server` call the FIPS 140-2 compliant SQS
+// endpoint of its region, e.g. as required in GovCloud.
+func WithFIPSEndpoint() Option {
+	return func(s *Server) error {
+		c, err := getConf(s)
+		if err != nil {
+			return err
+		}
+
+		c.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+		s.Svc = sqs.New(s.session, c)
+
+		return nil
+	}
+}
+
+// WithDualStackEndpoint makes the `Server` call the dual-stack SQS endpoint
+// of its region, which is reachable over both IPv4 and IPv6, e.g. from an
+// IPv6-only VPC.
+func WithDualStackEndpoint() Option {
+	return func(s *Server) error {
+		c, err := getConf(s)
+		if err != nil {
+			return err
+		}
+
+		c.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+		s.Svc = sqs.New(s.session, c)
+
+		return nil
+	}
+}
+
+// WithHTTPClient makes the SQS client of the `Server` send its requests with
+// `client`, e.g. to configure connection pooling, dial timeouts or proxies.
+// The Timeout of `client`, if set, must exceed the wait time of the long
+// polling ReceiveMessage requests, see WithWaitTimeSeconds.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Server) error {
+		if client == nil {
+			return errors.New("http client must not be nil")
+		}
+
+		c, err := getConf(s)
+		if err != nil {
+			return err
+		}
+
+		c.HTTPClient = client
+		s.Svc = sqs.New(s.session, c)
+
+		return nil
+	}
+}
+
+// WithAssumeRole makes the `Server` assume the IAM role `roleARN` with STS,
+// e.g. to consume from a queue owned by another AWS account. The credentials
+// of the client are used to assume the role, and the temporary credentials
+// are refreshed before they expire. `externalID` may be left empty if the
+// role does not require one.
+func WithAssumeRole(roleARN, externalID string) Option {
+	return func(s *Server) error {
+		c, err := getConf(s)
+		if err != nil {
+			return err
+		}
+
+		c.Credentials = assumeRoleCredentials(s.session, c.Credentials, roleARN, externalID)
+		s.Svc = sqs.New(s.session, c)
+
+		return nil
+	}
+}
+
+// assumeRoleCredentials returns credentials assuming `roleARN` using
+// `creds`, with an STS client created from `sess`.
+func assumeRoleCredentials(sess *session.Session, creds *credentials.Credentials, roleARN, externalID string) *credentials.Credentials {
+	return stscreds.NewCredentials(sess.Copy(&aws.Config{Credentials: creds}), roleARN, func(p *stscreds.AssumeRoleProvider) {
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+}
+
 // WithCustomRetryer sets a custom `Retryer` to use on the SQS client.
 func WithCustomRetryer(r request.Retryer) Option {
 	return func(s *Server) error {
@@ -338,3 +1027,244 @@ func WithRetryJitter(retryJitter int64) Option {
 		return nil
 	}
 }
+
+// WithMaxMessages sets the maximum number of messages requested from SQS
+// on each ReceiveMessage call. SQS allows between 1 and 10 (the default).
+// Lowering this is useful when receivers are slow, to avoid fetching
+// messages which cannot be processed before their visibility timeout.
+func WithMaxMessages(n int64) Option {
+	return func(s *Server) error {
+		if n < 1 || n > defaultMaxMessages {
+			return fmt.Errorf("invalid max messages: %d. Must be between 1 and %d", n, defaultMaxMessages)
+		}
+
+		s.maxMessages = n
+
+		return nil
+	}
+}
+
+// WithWaitTimeSeconds sets the duration, in seconds, that each ReceiveMessage
+// call waits for messages to arrive before returning. SQS allows between
+// 0 (short polling) and 20 (the default).
+//
+// Shorter waits make Shutdown more responsive at the cost of more API calls.
+func WithWaitTimeSeconds(seconds int64) Option {
+	return func(s *Server) error {
+		if seconds < 0 || seconds > defaultWaitTimeSeconds {
+			return fmt.Errorf("invalid wait time: %d. Must be between 0 and %d", seconds, defaultWaitTimeSeconds)
+		}
+
+		s.waitTimeSeconds = seconds
+
+		return nil
+	}
+}
+
+// WithSystemAttributes sets the SQS system attributes (ApproximateReceiveCount,
+// SentTimestamp, SequenceNumber, etc.) requested on each ReceiveMessage call.
+// If no names are given, all system attributes are requested.
+//
+// The attributes are merged into msg.Attributes with their name prefixed by
+// SystemAttributePrefix, e.g. "SQS-ApproximateReceiveCount", so they cannot
+// be confused with message attributes set by publishers.
+func WithSystemAttributes(names ...string) Option {
+	return func(s *Server) error {
+		if len(names) == 0 {
+			names = []string{sqs.QueueAttributeNameAll}
+		}
+
+		s.attributeNames = aws.StringSlice(names)
+		s.systemAttributePrefix = SystemAttributePrefix
+
+		return nil
+	}
+}
+
+// WithMessageAttributeNames limits the message attributes requested on each
+// ReceiveMessage call to the given names; by default all are requested.
+// Names may end with ".*" to request every attribute sharing a prefix,
+// e.g. "Trace.*".
+func WithMessageAttributeNames(names ...string) Option {
+	return func(s *Server) error {
+		if len(names) == 0 {
+			return errors.New("at least one message attribute name must be provided")
+		}
+
+		s.messageAttributeNames = aws.StringSlice(names)
+
+		return nil
+	}
+}
+
+// WithQueueName makes NewServer resolve the URL of the queue called `name`
+// using GetQueueUrl, instead of using the queueURL it was passed.
+// ownerAccountID may be set to consume a queue owned by another AWS account,
+// or left empty.
+func WithQueueName(name, ownerAccountID string) Option {
+	return func(s *Server) error {
+		if name == "" {
+			return errors.New("queue name must not be empty")
+		}
+
+		s.queueName = name
+		s.queueOwnerAccountID = ownerAccountID
+
+		return nil
+	}
+}
+
+// WithEnsureQueue makes NewServer create the queue, with the given
+// attributes (e.g. VisibilityTimeout), if it does not already exist.
+// The queue is named after the queueURL passed to NewServer, or the name
+// set with WithQueueName.
+//
+// This is mostly useful for local development and ephemeral environments.
+func WithEnsureQueue(attributes map[string]string) Option {
+	return func(s *Server) error {
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+
+		s.ensureQueueAttributes = attributes
+
+		return nil
+	}
+}
+
+// WithReceiveErrorPolicy makes Serve retry failed ReceiveMessage calls,
+// e.g. on network errors or throttling, instead of returning the error.
+// Retries are delayed by `backoff` (see ExponentialBackoff and FullJitter),
+// given the number of consecutive failures so far. Serve gives up and
+// returns the error after `maxFailures` consecutive failures, or retries
+// forever when `maxFailures` is 0.
+func WithReceiveErrorPolicy(maxFailures int, backoff BackoffFunc) Option {
+	return func(s *Server) error {
+		if maxFailures < 0 {
+			return fmt.Errorf("invalid max failures: %d. Must not be negative", maxFailures)
+		}
+
+		if backoff == nil {
+			return errors.New("backoff func must not be nil")
+		}
+
+		s.maxReceiveFailures = maxFailures
+		s.receiveErrorBackoff = backoff
+
+		return nil
+	}
+}
+
+// WithIdleBackoff makes the `Server` wait between polls of an empty queue,
+// which significantly reduces the number of API calls made for mostly idle
+// queues. After `n` consecutive ReceiveMessage calls returned no messages,
+// the Server waits for backoff(n) before polling again, e.g. using
+// ExponentialBackoff(time.Second, time.Minute). The delay is reset as soon
+// as a message is received.
+//
+// The delay is in addition to the long poll duration (see WithWaitTimeSeconds).
+func WithIdleBackoff(backoff BackoffFunc) Option {
+	return func(s *Server) error {
+		if backoff == nil {
+			return errors.New("backoff func must not be nil")
+		}
+
+		s.idleBackoff = backoff
+
+		return nil
+	}
+}
+
+// WithPollers sets the number of goroutines concurrently calling
+// ReceiveMessage, all sharing the Server's concurrency limit. A single
+// poller (the default) receives at most 10 messages per round-trip, which
+// may not be enough to drain high-volume queues.
+func WithPollers(n int) Option {
+	return func(s *Server) error {
+		if n < 1 {
+			return fmt.Errorf("invalid number of pollers: %d. Must be at least 1", n)
+		}
+
+		s.pollers = n
+
+		return nil
+	}
+}
+
+// WithShutdownGracePeriod makes Shutdown wait for up to `d` once its context
+// is done, after canceling the contexts of the receivers still running, so
+// that the messages they processed are still deleted, or made visible again,
+// rather than received again once their visibility timeout expires. Pending
+// batched calls are flushed after the grace period.
+func WithShutdownGracePeriod(d time.Duration) Option {
+	return func(s *Server) error {
+		if d < 0 {
+			return fmt.Errorf("invalid shutdown grace period: %s. Must not be negative", d)
+		}
+
+		s.shutdownGracePeriod = d
+
+		return nil
+	}
+}
+
+// WithClock makes the `Server` wait on `c` instead of the time package for
+// its receive error and idle backoffs, throttling, shutdown grace period and
+// the retries of its SQS client, including the credential error delays of
+// the retryer, so that tests can advance a clock.Fake instead of sleeping.
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) error {
+		if c == nil {
+			return errors.New("clock must not be nil")
+		}
+
+		s.clock = c
+
+		return nil
+	}
+}
+
+// WithMiddleware wraps the receiver passed to Serve with the given
+// decorators (e.g. logging, metrics, tracing or decompression), so they
+// don't need to be wired at every call site. The first middleware is the
+// outermost: it is called first and sees the result of all the others.
+//
+// Decorators from go-msg, such as base64.Decoder, can be used as is.
+func WithMiddleware(middleware ...func(msg.Receiver) msg.Receiver) Option {
+	return func(s *Server) error {
+		for i, mw := range middleware {
+			if mw == nil {
+				return fmt.Errorf("middleware %d must not be nil", i)
+			}
+		}
+
+		s.middleware = append(s.middleware, middleware...)
+
+		return nil
+	}
+}
+
+// WithLogger sets the Logger the `Server` logs to, instead of logger.Default,
+// which silences TRACE and DEBUG messages. Use logger.Std to see them, or
+// logger.Nop to discard logs entirely.
+func WithLogger(l logger.Logger) Option {
+	return func(s *Server) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+
+		s.logger = l
+
+		return nil
+	}
+}
+
+// logf logs a message at level to the Logger of the Server.
+func (s *Server) logf(level logger.Level, format string, args ...interface{}) {
+	l := s.logger
+	if l == nil {
+		l = logger.Default
+	}
+
+	l.Logf(level, format, args...)
+}
@@ -13,7 +13,11 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/clock"
+	"github.com/hdtradeservices/go-aws-msg/logger"
 	msg "github.com/hdtradeservices/go-msg"
 )
 
@@ -131,8 +135,9 @@ func TestServer_Serve_retries(t *testing.T) {
 
 			r := &SimpleReceiver{t: t}
 			err = srv.Serve(context.Background(), r)
-			if strings.Index(err.Error(), "InvalidClientTokenId: The security token included in the request is invalid") != 0 {
-				t.Errorf("Expected error message to start with `InvalidClientTokenId: The security token included in the request is invalid`, was `%s`", err.Error())
+			var awsErr awserr.Error
+			if !errors.Is(err, ErrReceiveFailed) || !errors.As(err, &awsErr) || awsErr.Code() != "InvalidClientTokenId" {
+				t.Errorf("Expected ErrReceiveFailed wrapping an InvalidClientTokenId error, was `%s`", err.Error())
 			}
 
 			t.Logf("retries: %v", retries)
@@ -268,8 +273,125 @@ func TestServer_ShutdownHard(t *testing.T) {
 	}()
 
 	err := srv.Shutdown(ctx)
-	if err != context.DeadlineExceeded {
-		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	if !errors.Is(err, ErrShutdownTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected ErrShutdownTimeout wrapping context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// Tests that srv.Shutdown() waits for in-flight receivers, and returns as
+// soon as they are done.
+func TestServer_ShutdownWaitsForReceivers(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		close(started)
+		<-release
+		return nil
+	}))
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Expected Shutdown to wait for the receiver, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	released := time.Now()
+	close(release)
+
+	if err := <-shutdown; err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+	if d := time.Since(released); d > time.Second {
+		t.Errorf("Expected Shutdown to return as soon as the receiver returned, took %s", d)
+	}
+	if len(mockSQS.dmChan) != 1 {
+		t.Errorf("Expected the message to be deleted before Shutdown returned")
+	}
+
+	if err := srv.Serve(context.Background(), &SimpleReceiver{t: t}); err != msg.ErrServerClosed {
+		t.Errorf("Expected Serve to return ErrServerClosed after Shutdown, got %v", err)
+	}
+}
+
+// longPollingSQSAPI is a mockSQSAPI whose ReceiveMessage calls long poll
+// until their context is canceled once its queue has been received.
+type longPollingSQSAPI struct {
+	*mockSQSAPI
+}
+
+func (s longPollingSQSAPI) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	resp, err := s.mockSQSAPI.ReceiveMessageWithContext(ctx, input, opts...)
+	if err != nil || len(resp.Messages) > 0 {
+		return resp, err
+	}
+
+	<-ctx.Done()
+
+	return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
+// Tests that srv.Shutdown() interrupts the ReceiveMessage long poll.
+func TestServer_ShutdownCancelsLongPoll(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+	srv.Svc = longPollingSQSAPI{mockSQS}
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(context.Background(), &SimpleReceiver{t: t}) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if err := srv.Shutdown(ctx); err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+	if err := <-served; err != msg.ErrServerClosed {
+		t.Errorf("Expected Serve to return ErrServerClosed, got %v", err)
+	}
+}
+
+// Tests that messages processed by receivers canceled by a Shutdown timeout
+// are still deleted during the grace period.
+func TestServer_WithShutdownGracePeriod(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+	if err := WithShutdownGracePeriod(time.Second)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	started := make(chan struct{})
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond) // finish up the work
+		return nil
+	}))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, ErrShutdownTimeout) {
+		t.Errorf("Expected ErrShutdownTimeout, got %v", err)
+	}
+	if len(mockSQS.dmChan) != 1 {
+		t.Errorf("Expected the message to be deleted before Shutdown returned")
+	}
+
+	if err := WithShutdownGracePeriod(-time.Second)(srv); err == nil {
+		t.Errorf("Expected error for a negative grace period")
 	}
 }
 
@@ -332,3 +454,399 @@ func TestGetVisiblityTimeout_InvalidJitter(t *testing.T) {
 		t.Errorf("val should be in the interval %d±%d", retryTimeout, jitter)
 	}
 }
+
+func TestWithMaxMessages(t *testing.T) {
+	cases := []struct {
+		n     int64
+		valid bool
+	}{
+		{1, true},
+		{10, true},
+		{0, false},
+		{11, false},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprint(c.n), func(t *testing.T) {
+			srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+			err := WithMaxMessages(c.n)(srv)
+			if c.valid && err != nil {
+				t.Errorf("Unexpected error %s", err)
+			}
+			if !c.valid && err == nil {
+				t.Errorf("Expected error, received nil")
+			}
+			if c.valid && srv.maxMessages != c.n {
+				t.Errorf("Expected maxMessages to be %d, got %d", c.n, srv.maxMessages)
+			}
+		})
+	}
+}
+
+func TestWithWaitTimeSeconds(t *testing.T) {
+	cases := []struct {
+		seconds int64
+		valid   bool
+	}{
+		{0, true},
+		{20, true},
+		{-1, false},
+		{21, false},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprint(c.seconds), func(t *testing.T) {
+			srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+			err := WithWaitTimeSeconds(c.seconds)(srv)
+			if c.valid && err != nil {
+				t.Errorf("Unexpected error %s", err)
+			}
+			if !c.valid && err == nil {
+				t.Errorf("Expected error, received nil")
+			}
+			if c.valid && srv.waitTimeSeconds != c.seconds {
+				t.Errorf("Expected waitTimeSeconds to be %d, got %d", c.seconds, srv.waitTimeSeconds)
+			}
+		})
+	}
+}
+
+// Test that system attributes are prefixed when WithSystemAttributes is set.
+func TestWithSystemAttributes(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithSystemAttributes(sqs.MessageSystemAttributeNameApproximateReceiveCount)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(srv.attributeNames) != 1 || *srv.attributeNames[0] != sqs.MessageSystemAttributeNameApproximateReceiveCount {
+		t.Errorf("Expected attributeNames to be [ApproximateReceiveCount], got %v", aws.StringValueSlice(srv.attributeNames))
+	}
+
+	attrs := msg.Attributes{}
+	srv.convertToAttrs(attrs, map[string]*string{
+		sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String("3"),
+	})
+	if v := attrs.Get("SQS-ApproximateReceiveCount"); v != "3" {
+		t.Errorf("Expected SQS-ApproximateReceiveCount to be 3, got %q", v)
+	}
+	if v := attrs.Get("ApproximateReceiveCount"); v != "" {
+		t.Errorf("Expected unprefixed attribute to be unset, got %q", v)
+	}
+}
+
+func TestWithMessageAttributeNames(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithMessageAttributeNames("Content-Type", "Trace.*")(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	names := aws.StringValueSlice(srv.messageAttributeNames)
+	if len(names) != 2 || names[0] != "Content-Type" || names[1] != "Trace.*" {
+		t.Errorf("Expected messageAttributeNames to be [Content-Type Trace.*], got %v", names)
+	}
+
+	if err := WithMessageAttributeNames()(srv); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+}
+
+// Tests that the visibility of a message is extended while its receiver
+// is still running when a heartbeat is configured.
+func TestServer_Heartbeat(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	// leave room for extensions made before the heartbeat is stopped
+	mockSQS.rmChan = make(chan struct{}, 100)
+	srv := newMockServer(1, mockSQS)
+	if err := WithHeartbeat(10*time.Millisecond, 30)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	extended := make(chan bool, 1)
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		select {
+		case <-mockSQS.rmChan:
+			extended <- true
+		case <-time.After(2 * time.Second):
+			extended <- false
+		}
+		return nil
+	})
+
+	go func() {
+		if err := srv.Serve(context.Background(), r); err != msg.ErrServerClosed {
+			t.Logf("server died %s", err)
+		}
+	}()
+	defer srv.Shutdown(context.Background())
+
+	if !<-extended {
+		t.Errorf("Expected message visibility to be extended while receiving")
+	}
+}
+
+func TestWithHeartbeat_ErrorOnInvalidInterval(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithHeartbeat(0, 30)(srv); err == nil {
+		t.Errorf("Expected error for zero interval, received nil")
+	}
+	if err := WithHeartbeat(30*time.Second, 30)(srv); err == nil {
+		t.Errorf("Expected error for interval longer than the visibility timeout, received nil")
+	}
+	if err := WithHeartbeat(time.Second, 0)(srv); err == nil {
+		t.Errorf("Expected error for invalid visibility timeout, received nil")
+	}
+}
+
+// Tests that Serve keeps receiving messages after transient receive errors
+// when a receive error policy is set.
+func TestServer_ServeRetriesReceiveErrors(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	mockSQS.receiveErrs = []error{errors.New("network blip"), errors.New("throttled")}
+	srv := newMockServer(1, mockSQS)
+	if err := WithReceiveErrorPolicy(3, ExponentialBackoff(time.Millisecond, 10*time.Millisecond))(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	go func() {
+		r := &SimpleReceiver{t: t}
+		if err := srv.Serve(context.Background(), r); err != msg.ErrServerClosed {
+			t.Errorf("server died %s", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Errorf(err.Error())
+	}
+	srv.Shutdown(ctx)
+}
+
+// Tests that a Server with a fake clock waits for it to be advanced before
+// retrying a failed ReceiveMessage call.
+func TestServer_WithClock(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(1), t)
+	mockSQS.receiveErrs = []error{errors.New("network blip")}
+	srv := newMockServer(1, mockSQS)
+	fake := clock.NewFake(time.Now())
+	if err := WithClock(fake)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := WithReceiveErrorPolicy(3, ExponentialBackoff(time.Hour, time.Hour))(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	go srv.Serve(context.Background(), &SimpleReceiver{t: t})
+
+	fake.WaitForTimers(1)
+	mockSQS.mux.Lock()
+	receives := len(mockSQS.receiveInputs)
+	mockSQS.mux.Unlock()
+	if receives != 1 {
+		t.Errorf("Expected the Server to wait before receiving again, got %d receives", receives)
+	}
+
+	fake.Advance(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Errorf(err.Error())
+	}
+	srv.Shutdown(ctx)
+}
+
+// Tests that Serve gives up after too many consecutive receive errors.
+func TestServer_ServeGivesUpAfterMaxReceiveFailures(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	mockSQS.receiveErrs = []error{errors.New("1"), errors.New("2"), errors.New("3")}
+	srv := newMockServer(1, mockSQS)
+	if err := WithReceiveErrorPolicy(2, FullJitter(ExponentialBackoff(time.Millisecond, 10*time.Millisecond)))(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	err := srv.Serve(context.Background(), &SimpleReceiver{t: t})
+	var opErr *OpError
+	if !errors.Is(err, ErrReceiveFailed) || !errors.As(err, &opErr) || opErr.Err.Error() != "2" {
+		t.Errorf("Expected Serve to return the second error, got %v", err)
+	}
+}
+
+// Tests that the Server backs off polling an empty queue.
+func TestServer_IdleBackoff(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	srv := newMockServer(1, mockSQS)
+
+	var delays []int
+	backoff := func(empty int) time.Duration {
+		delays = append(delays, empty)
+		if empty == 3 {
+			srv.serverCancelFunc()
+		}
+		return time.Millisecond
+	}
+	if err := WithIdleBackoff(backoff)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if err := srv.Serve(context.Background(), &SimpleReceiver{t: t}); err != msg.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+
+	if len(delays) != 3 || delays[0] != 1 || delays[1] != 2 || delays[2] != 3 {
+		t.Errorf("Expected backoff to be called with 1, 2, 3 consecutive empty receives, got %v", delays)
+	}
+}
+
+// Tests that a Server with many pollers processes every message.
+func TestServer_Pollers(t *testing.T) {
+	msgs := newSQSMessages(100)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(10, mockSQS)
+	srv.maxMessages = 1
+	if err := WithPollers(4)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	go func() {
+		r := &SimpleReceiver{t: t}
+		if err := srv.Serve(context.Background(), r); err != msg.ErrServerClosed {
+			t.Errorf("server died %s", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Errorf(err.Error())
+	}
+	srv.Shutdown(ctx)
+}
+
+// Tests that a failing poller stops the others and its error is returned.
+func TestServer_PollersStopOnError(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	mockSQS.receiveErrs = []error{errors.New("receive failed")}
+	srv := newMockServer(1, mockSQS)
+	srv.waitTimeSeconds = 0
+	if err := WithPollers(3)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	err := srv.Serve(context.Background(), &SimpleReceiver{t: t})
+	if !errors.Is(err, ErrReceiveFailed) || errors.Unwrap(err).Error() != "receive failed" {
+		t.Errorf("Expected Serve to return the receive error, got %v", err)
+	}
+}
+
+func TestWithPollers_ErrorOnInvalidPollers(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithPollers(0)(srv); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+}
+
+func TestServer_SetConcurrency(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+
+	srv.SetConcurrency(20)
+	if srv.Concurrency() != 20 {
+		t.Errorf("Expected concurrency to be 20, got %d", srv.Concurrency())
+	}
+
+	srv.SetConcurrency(0)
+	if srv.Concurrency() != 1 {
+		t.Errorf("Expected concurrency to be 1, got %d", srv.Concurrency())
+	}
+}
+
+// Tests that middleware wraps the receiver in order, the first being
+// the outermost.
+func TestServer_WithMiddleware(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+
+	var calls []string
+	mw := func(name string) func(msg.Receiver) msg.Receiver {
+		return func(next msg.Receiver) msg.Receiver {
+			return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+				calls = append(calls, name)
+				return next.Receive(ctx, m)
+			})
+		}
+	}
+	if err := WithMiddleware(mw("first"), mw("second"))(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	r := srv.wrapReceiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		calls = append(calls, "receiver")
+		return nil
+	}))
+	if err := r.Receive(context.Background(), &msg.Message{}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if strings.Join(calls, ",") != "first,second,receiver" {
+		t.Errorf("Expected calls to be first,second,receiver, got %v", calls)
+	}
+}
+
+// Tests that a Server configured with WithLogger logs receiver errors to it.
+func TestServer_WithLogger(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	logged := make(chan string, 10)
+	l := logger.Func(func(level logger.Level, format string, args ...interface{}) {
+		if level == logger.Error {
+			logged <- fmt.Sprintf(format, args...)
+		}
+	})
+
+	if err := WithLogger(l)(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := WithLogger(nil)(srv); err == nil {
+		t.Errorf("Expected a nil logger to be rejected")
+	}
+
+	go srv.Serve(context.Background(), &FailingReceiver{t: t})
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case line := <-logged:
+		if !strings.Contains(line, "Receiver error") {
+			t.Errorf("Unexpected log %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the receiver error to be logged")
+	}
+}
+
+// Tests that receivers can read the MessageId of their message from
+// their context.
+func TestServer_MessageIDFromContext(t *testing.T) {
+	msgs := newSQSMessages(1)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	ids := make(chan string, 1)
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		ids <- MessageIDFromContext(ctx)
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case id := <-ids:
+		if id != "msg0" {
+			t.Errorf("Expected MessageId msg0, got %q", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the message to be received")
+	}
+
+	if id := MessageIDFromContext(context.Background()); id != "" {
+		t.Errorf("Expected no MessageId, got %q", id)
+	}
+}
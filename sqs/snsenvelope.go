@@ -0,0 +1,126 @@
+package sqs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// snsEnvelope is the JSON notification SNS delivers to the queues subscribed
+// to a topic without raw message delivery.
+type snsEnvelope struct {
+	Type              string
+	TopicArn          string
+	Message           *string
+	MessageAttributes map[string]struct {
+		Type  string
+		Value string
+	}
+}
+
+// EnvelopeVerifier verifies that an SNS notification envelope was signed by
+// SNS, e.g. an sns.Verifier.
+type EnvelopeVerifier interface {
+	Verify(envelope []byte) error
+}
+
+// WithSNSEnvelopeUnwrapping makes the `Server` unwrap messages delivered by
+// SNS to a queue subscribed to a topic without raw message delivery, before
+// passing them to its middleware and receiver. See SNSEnvelopeDecoder.
+func WithSNSEnvelopeUnwrapping() Option {
+	return func(s *Server) error {
+		s.unwrapSNS = true
+
+		return nil
+	}
+}
+
+// WithSNSEnvelopeVerification makes the `Server` unwrap SNS notification
+// envelopes, as WithSNSEnvelopeUnwrapping, once `v` verified their
+// signature. Envelopes which cannot be verified, and messages which are not
+// SNS notification envelopes, are not received and an error is returned, so
+// that they are retried, then sent to the dead-letter queue if any.
+func WithSNSEnvelopeVerification(v EnvelopeVerifier) Option {
+	return func(s *Server) error {
+		if v == nil {
+			return errors.New("verifier must not be nil")
+		}
+
+		s.unwrapSNS = true
+		s.verifySNS = v
+
+		return nil
+	}
+}
+
+// SNSEnvelopeDecoder wraps a msg.Receiver with the unwrapping of SNS
+// notification envelopes: the body of these messages is replaced by the
+// published message, and the message attributes of the notification are set
+// as attributes of the message. Other messages are received as is.
+//
+// Binary attributes are set to their base64-encoded value.
+func SNSEnvelopeDecoder(next msg.Receiver) msg.Receiver {
+	return snsEnvelopeDecoder(next, nil)
+}
+
+// VerifiedSNSEnvelopeDecoder wraps a msg.Receiver with the unwrapping of SNS
+// notification envelopes, as SNSEnvelopeDecoder, once `v` verified their
+// signature. Envelopes which cannot be verified are not received and the
+// error is returned. Other messages are not received either, and an error
+// matching ErrNotSNSEnvelope is returned, so that messages cannot skip
+// verification by not being shaped like an envelope.
+func VerifiedSNSEnvelopeDecoder(next msg.Receiver, v EnvelopeVerifier) msg.Receiver {
+	return snsEnvelopeDecoder(next, v)
+}
+
+// snsEnvelopeDecoder is SNSEnvelopeDecoder, verifying envelopes with
+// `verifier` unless it is nil.
+func snsEnvelopeDecoder(next msg.Receiver, verifier EnvelopeVerifier) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, err := ioutil.ReadAll(m.Body)
+		if err != nil {
+			return err
+		}
+		m.Body = bytes.NewReader(body)
+
+		trimmed := bytes.TrimSpace(body)
+		if len(trimmed) == 0 || trimmed[0] != '{' {
+			return receiveUnwrapped(ctx, next, m, verifier)
+		}
+
+		var env snsEnvelope
+		if err := json.Unmarshal(trimmed, &env); err != nil ||
+			env.Type != "Notification" || env.TopicArn == "" || env.Message == nil {
+			return receiveUnwrapped(ctx, next, m, verifier)
+		}
+
+		if verifier != nil {
+			if err := verifier.Verify(trimmed); err != nil {
+				return fmt.Errorf("cannot verify sns envelope: %w", err)
+			}
+		}
+
+		for k, v := range env.MessageAttributes {
+			m.Attributes.Set(k, v.Value)
+		}
+		m.Body = strings.NewReader(*env.Message)
+
+		return next.Receive(ctx, m)
+	})
+}
+
+// receiveUnwrapped passes `m`, which is not an SNS notification envelope,
+// to `next`, unless envelopes must be verified.
+func receiveUnwrapped(ctx context.Context, next msg.Receiver, m *msg.Message, verifier EnvelopeVerifier) error {
+	if verifier != nil {
+		return fmt.Errorf("cannot verify message: %w", ErrNotSNSEnvelope)
+	}
+
+	return next.Receive(ctx, m)
+}
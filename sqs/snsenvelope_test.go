@@ -0,0 +1,117 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that SNS notifications are unwrapped, before the base64 decoding of
+// their message, and that other messages are received as is.
+func TestWithSNSEnvelopeUnwrapping(t *testing.T) {
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	for _, opt := range []Option{WithBase64Decoding(), WithSNSEnvelopeUnwrapping()} {
+		if err := opt(srv); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	envelope := `{
+		"Type": "Notification",
+		"MessageId": "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		"TopicArn": "arn:aws:sns:us-west-2:123456789012:orders",
+		"Message": "aGVsbG8=",
+		"Timestamp": "2012-05-02T00:54:06.655Z",
+		"MessageAttributes": {
+			"Content-Transfer-Encoding": {"Type": "String", "Value": "base64"},
+			"Tenant": {"Type": "String", "Value": "acme"}
+		}
+	}`
+
+	cases := []struct {
+		body, expectedBody, expectedTenant string
+	}{
+		{envelope, "hello", "acme"},
+		{`{"Type": "Order", "Message": "raw"}`, `{"Type": "Order", "Message": "raw"}`, ""},
+		{"plain text", "plain text", ""},
+	}
+
+	for _, c := range cases {
+		var received *msg.Message
+		var body string
+		r := srv.wrapReceiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			b, err := ioutil.ReadAll(m.Body)
+			received, body = m, string(b)
+			return err
+		}))
+
+		m := &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(c.body)}
+		if err := r.Receive(context.Background(), m); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if body != c.expectedBody {
+			t.Errorf("Expected body %q, got %q", c.expectedBody, body)
+		}
+		if tenant := received.Attributes.Get("Tenant"); tenant != c.expectedTenant {
+			t.Errorf("Expected Tenant %q, got %q", c.expectedTenant, tenant)
+		}
+	}
+}
+
+// verifierFunc is an EnvelopeVerifier calling itself.
+type verifierFunc func([]byte) error
+
+func (f verifierFunc) Verify(envelope []byte) error {
+	return f(envelope)
+}
+
+// Tests that SNS notifications are only unwrapped once verified.
+func TestWithSNSEnvelopeVerification(t *testing.T) {
+	errForged := errors.New("forged")
+	srv := newMockServer(1, newMockSQSAPI(newSQSMessages(0), t))
+	if err := WithSNSEnvelopeVerification(verifierFunc(func(envelope []byte) error {
+		if strings.Contains(string(envelope), "forged") {
+			return errForged
+		}
+		return nil
+	}))(srv); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var received string
+	r := srv.wrapReceiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b, err := ioutil.ReadAll(m.Body)
+		received = string(b)
+		return err
+	}))
+
+	envelope := `{"Type":"Notification","TopicArn":"arn:aws:sns:us-west-2:123456789012:orders","Message":"%s"}`
+	m := &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(fmt.Sprintf(envelope, "hello"))}
+	if err := r.Receive(context.Background(), m); err != nil || received != "hello" {
+		t.Errorf("Expected the verified envelope to be unwrapped, got %q, %v", received, err)
+	}
+
+	received = ""
+	m = &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(fmt.Sprintf(envelope, "forged"))}
+	if err := r.Receive(context.Background(), m); !errors.Is(err, errForged) || received != "" {
+		t.Errorf("Expected the forged envelope to be rejected, got %q, %v", received, err)
+	}
+
+	// messages which are not envelopes cannot skip verification
+	for _, body := range []string{
+		"hello",
+		`{"Message":"hello"}`,
+		`{"Type":"SubscriptionConfirmation","TopicArn":"arn:aws:sns:us-west-2:123456789012:orders","Message":"hello"}`,
+		`{"Type":"Notification"`,
+	} {
+		m = &msg.Message{Attributes: msg.Attributes{}, Body: strings.NewReader(body)}
+		if err := r.Receive(context.Background(), m); !errors.Is(err, ErrNotSNSEnvelope) || received != "" {
+			t.Errorf("Expected %q to be rejected, got %q, %v", body, received, err)
+		}
+	}
+}
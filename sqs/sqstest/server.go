@@ -0,0 +1,22 @@
+package sqstest
+
+import (
+	msgsqs "github.com/hdtradeservices/go-aws-msg/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// NewServer returns an sqs.Server receiving messages from the queue
+// `queueURL` of `s`, created by sqs.NewServer with `opts`.
+func NewServer(s *SQS, queueURL string, concurrency int, retryTimeout int64, opts ...msgsqs.Option) (msg.Server, error) {
+	opts = append([]msgsqs.Option{msgsqs.WithClient(s)}, opts...)
+
+	return msgsqs.NewServer(queueURL, concurrency, retryTimeout, opts...)
+}
+
+// NewTopic returns an sqs.Topic sending messages to the queue `queueURL` of
+// `s`, created by sqs.NewTopic with `opts`.
+func NewTopic(s *SQS, queueURL string, opts ...msgsqs.TopicOption) (msg.Topic, error) {
+	opts = append([]msgsqs.TopicOption{msgsqs.WithTopicClient(s)}, opts...)
+
+	return msgsqs.NewTopic(queueURL, opts...)
+}
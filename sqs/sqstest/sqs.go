@@ -0,0 +1,918 @@
+// Package sqstest provides an in-memory SQS for testing receivers and
+// publishers without LocalStack or hand-rolled mocks.
+//
+// SQS implements sqsiface.SQSAPI, modeling the visibility timeout and delay
+// of messages, and the ordering and deduplication of FIFO queues. NewServer
+// and NewTopic return an sqs.Server and sqs.Topic using it:
+//
+//	fake := sqstest.New()
+//	queueURL := fake.NewQueue("jobs", nil)
+//
+//	topic, _ := sqstest.NewTopic(fake, queueURL)
+//	srv, _ := sqstest.NewServer(fake, queueURL, 1, 30)
+//	go srv.Serve(ctx, receiver)
+//
+// Time passes for the messages of an SQS as it does for the test, and can be
+// advanced with Advance, e.g. to make a failed message visible again without
+// waiting for its visibility timeout.
+package sqstest
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+const (
+	// Region is the region of the queues of an SQS.
+	Region = "us-east-1"
+	// AccountID is the AWS account owning the queues of an SQS.
+	AccountID = "000000000000"
+
+	// defaultVisibilityTimeout is the VisibilityTimeout of queues created
+	// without it, in seconds.
+	defaultVisibilityTimeout = 30
+
+	// maxDelaySeconds is the maximum delay of a message, in seconds.
+	maxDelaySeconds = 900
+
+	// maxBatchEntries is the maximum number of entries of batch requests.
+	maxBatchEntries = 10
+
+	// deduplicationInterval is how long the deduplication ID of a message
+	// sent to a FIFO queue prevents messages with the same ID to be sent.
+	deduplicationInterval = 5 * time.Minute
+)
+
+// SQS is an in-memory sqsiface.SQSAPI. Its methods not implementing the
+// queue and message operations used by an sqs.Server and sqs.Topic panic.
+//
+// The zero value is not usable, SQS must be created with New.
+type SQS struct {
+	sqsiface.SQSAPI
+
+	mux     sync.Mutex
+	queues  map[string]*queue // queues by URL
+	offset  time.Duration     // added to the time by Advance
+	changed chan struct{}     // closed, then replaced, when messages may become available
+	ids     int64             // generates message IDs and receipt handles
+}
+
+// New returns an SQS without queues.
+func New() *SQS {
+	return &SQS{
+		queues:  make(map[string]*queue),
+		changed: make(chan struct{}),
+	}
+}
+
+// queue is a queue of an SQS.
+type queue struct {
+	name       string
+	attributes map[string]string
+	fifo       bool
+	messages   []*message          // in the order they were sent
+	dedupIDs   map[string]*dedupID // deduplication IDs of FIFO queues
+	handles    map[string]*message // messages by receipt handle
+	sequence   int64               // last sequence number of FIFO queues
+}
+
+// dedupID is the deduplication ID of a message sent to a FIFO queue.
+type dedupID struct {
+	messageID string
+	expires   time.Time
+}
+
+// message is a message of a queue.
+type message struct {
+	id               string
+	body             string
+	attributes       map[string]*sqs.MessageAttributeValue
+	systemAttributes map[string]*sqs.MessageSystemAttributeValue
+	groupID          string
+	deduplicationID  string
+	sequenceNumber   string
+	sentAt           time.Time
+	visibleAt        time.Time // time the message is delayed or in flight until
+	firstReceivedAt  time.Time
+	receiveCount     int64
+	receiptHandle    string // handle of the last receive, "" until received
+}
+
+// NewQueue creates the queue `name`, e.g. "jobs" or "jobs.fifo", with
+// `attributes`, and returns its URL. It returns the URL of the queue if it
+// exists.
+func (s *SQS) NewQueue(name string, attributes map[string]string) string {
+	out, err := s.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: aws.StringMap(attributes),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return aws.StringValue(out.QueueUrl)
+}
+
+// Len returns the number of messages of the queue `queueURL` which were not
+// deleted, including the delayed and in flight messages.
+func (s *SQS) Len(queueURL string) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, ok := s.queues[queueURL]
+	if !ok {
+		return 0
+	}
+
+	return len(q.messages)
+}
+
+// Advance advances the time of the SQS by `d`, making the messages delayed
+// or in flight until then available.
+func (s *SQS) Advance(d time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.offset += d
+	s.notify()
+}
+
+// now returns the time of the SQS.
+func (s *SQS) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// notify wakes up the ReceiveMessage calls waiting for messages.
+func (s *SQS) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// nextID returns a new unique ID.
+func (s *SQS) nextID() string {
+	s.ids++
+
+	return fmt.Sprintf("%08d-0000-4000-8000-%012d", s.ids, s.ids)
+}
+
+// queue returns the queue `queueURL`, or a QueueDoesNotExist error.
+func (s *SQS) queue(queueURL *string) (*queue, error) {
+	q, ok := s.queues[aws.StringValue(queueURL)]
+	if !ok {
+		return nil, awserr.New(sqs.ErrCodeQueueDoesNotExist, "The specified queue does not exist.", nil)
+	}
+
+	return q, nil
+}
+
+// queueURL returns the URL of the queue `name`.
+func queueURL(name string) string {
+	return fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", Region, AccountID, name)
+}
+
+// invalidParameter returns an InvalidParameterValue error.
+func invalidParameter(format string, args ...interface{}) error {
+	return awserr.New("InvalidParameterValue", fmt.Sprintf(format, args...), nil)
+}
+
+// intAttribute returns the attribute `name` of `q` as an int64, or `def`.
+func (q *queue) intAttribute(name string, def int64) int64 {
+	if v, err := strconv.ParseInt(q.attributes[name], 10, 64); err == nil {
+		return v
+	}
+
+	return def
+}
+
+// CreateQueue creates a queue, or returns the URL of the queue if it exists
+// with the same attributes. Queues whose name ends with ".fifo" are FIFO
+// queues, even without the FifoQueue attribute.
+func (s *SQS) CreateQueue(input *sqs.CreateQueueInput) (*sqs.CreateQueueOutput, error) {
+	return s.CreateQueueWithContext(context.Background(), input)
+}
+
+// CreateQueueWithContext is CreateQueue with a context.
+func (s *SQS) CreateQueueWithContext(ctx aws.Context, input *sqs.CreateQueueInput, opts ...request.Option) (*sqs.CreateQueueOutput, error) {
+	name := aws.StringValue(input.QueueName)
+	attributes := aws.StringValueMap(input.Attributes)
+
+	fifo := strings.HasSuffix(name, ".fifo")
+	if name == "" || (attributes[sqs.QueueAttributeNameFifoQueue] == "true" && !fifo) {
+		return nil, invalidParameter("Invalid queue name %q", name)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	url := queueURL(name)
+	if q, ok := s.queues[url]; ok {
+		for k, v := range attributes {
+			if q.attributes[k] != v {
+				return nil, awserr.New(sqs.ErrCodeQueueNameExists, "A queue already exists with the same name and a different value for attribute "+k, nil)
+			}
+		}
+		return &sqs.CreateQueueOutput{QueueUrl: aws.String(url)}, nil
+	}
+
+	q := &queue{
+		name:       name,
+		attributes: map[string]string{sqs.QueueAttributeNameVisibilityTimeout: strconv.Itoa(defaultVisibilityTimeout)},
+		fifo:       fifo,
+		dedupIDs:   make(map[string]*dedupID),
+		handles:    make(map[string]*message),
+	}
+	for k, v := range attributes {
+		q.attributes[k] = v
+	}
+	if fifo {
+		q.attributes[sqs.QueueAttributeNameFifoQueue] = "true"
+	}
+	q.attributes[sqs.QueueAttributeNameQueueArn] = fmt.Sprintf("arn:aws:sqs:%s:%s:%s", Region, AccountID, name)
+	s.queues[url] = q
+
+	return &sqs.CreateQueueOutput{QueueUrl: aws.String(url)}, nil
+}
+
+// GetQueueUrl returns the URL of a queue.
+func (s *SQS) GetQueueUrl(input *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+	return s.GetQueueUrlWithContext(context.Background(), input)
+}
+
+// GetQueueUrlWithContext is GetQueueUrl with a context.
+func (s *SQS) GetQueueUrlWithContext(ctx aws.Context, input *sqs.GetQueueUrlInput, opts ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	url := queueURL(aws.StringValue(input.QueueName))
+	if _, err := s.queue(&url); err != nil {
+		return nil, err
+	}
+
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String(url)}, nil
+}
+
+// GetQueueAttributes returns the attributes of a queue, including the
+// approximate number of its messages.
+func (s *SQS) GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	return s.GetQueueAttributesWithContext(context.Background(), input)
+}
+
+// GetQueueAttributesWithContext is GetQueueAttributes with a context.
+func (s *SQS) GetQueueAttributesWithContext(ctx aws.Context, input *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	var visible, inFlight, delayed int
+	now := s.now()
+	for _, m := range q.messages {
+		switch {
+		case !m.visibleAt.After(now):
+			visible++
+		case m.receiptHandle != "":
+			inFlight++
+		default:
+			delayed++
+		}
+	}
+
+	attributes := map[string]string{
+		sqs.QueueAttributeNameApproximateNumberOfMessages:           strconv.Itoa(visible),
+		sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: strconv.Itoa(inFlight),
+		sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    strconv.Itoa(delayed),
+	}
+	for k, v := range q.attributes {
+		attributes[k] = v
+	}
+
+	out := &sqs.GetQueueAttributesOutput{Attributes: make(map[string]*string)}
+	for _, name := range input.AttributeNames {
+		for k, v := range attributes {
+			if *name == sqs.QueueAttributeNameAll || *name == k {
+				out.Attributes[k] = aws.String(v)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// SetQueueAttributes sets attributes of a queue.
+func (s *SQS) SetQueueAttributes(input *sqs.SetQueueAttributesInput) (*sqs.SetQueueAttributesOutput, error) {
+	return s.SetQueueAttributesWithContext(context.Background(), input)
+}
+
+// SetQueueAttributesWithContext is SetQueueAttributes with a context.
+func (s *SQS) SetQueueAttributesWithContext(ctx aws.Context, input *sqs.SetQueueAttributesInput, opts ...request.Option) (*sqs.SetQueueAttributesOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range input.Attributes {
+		q.attributes[k] = aws.StringValue(v)
+	}
+
+	return &sqs.SetQueueAttributesOutput{}, nil
+}
+
+// PurgeQueue deletes every message of a queue.
+func (s *SQS) PurgeQueue(input *sqs.PurgeQueueInput) (*sqs.PurgeQueueOutput, error) {
+	return s.PurgeQueueWithContext(context.Background(), input)
+}
+
+// PurgeQueueWithContext is PurgeQueue with a context.
+func (s *SQS) PurgeQueueWithContext(ctx aws.Context, input *sqs.PurgeQueueInput, opts ...request.Option) (*sqs.PurgeQueueOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	q.messages = nil
+	q.handles = make(map[string]*message)
+
+	return &sqs.PurgeQueueOutput{}, nil
+}
+
+// queueNames returns the names of the queues of `s`, sorted.
+func (s *SQS) queueNames() []string {
+	var names []string
+	for _, q := range s.queues {
+		names = append(names, q.name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ListQueues lists the queues whose name starts with QueueNamePrefix.
+func (s *SQS) ListQueues(input *sqs.ListQueuesInput) (*sqs.ListQueuesOutput, error) {
+	return s.ListQueuesWithContext(context.Background(), input)
+}
+
+// ListQueuesWithContext is ListQueues with a context.
+func (s *SQS) ListQueuesWithContext(ctx aws.Context, input *sqs.ListQueuesInput, opts ...request.Option) (*sqs.ListQueuesOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	out := &sqs.ListQueuesOutput{}
+	for _, name := range s.queueNames() {
+		if strings.HasPrefix(name, aws.StringValue(input.QueueNamePrefix)) {
+			out.QueueUrls = append(out.QueueUrls, aws.String(queueURL(name)))
+		}
+	}
+
+	return out, nil
+}
+
+// DeleteQueue deletes a queue and its messages.
+func (s *SQS) DeleteQueue(input *sqs.DeleteQueueInput) (*sqs.DeleteQueueOutput, error) {
+	return s.DeleteQueueWithContext(context.Background(), input)
+}
+
+// DeleteQueueWithContext is DeleteQueue with a context.
+func (s *SQS) DeleteQueueWithContext(ctx aws.Context, input *sqs.DeleteQueueInput, opts ...request.Option) (*sqs.DeleteQueueOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, err := s.queue(input.QueueUrl); err != nil {
+		return nil, err
+	}
+	delete(s.queues, aws.StringValue(input.QueueUrl))
+
+	return &sqs.DeleteQueueOutput{}, nil
+}
+
+// SendMessage sends a message to a queue.
+func (s *SQS) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	return s.SendMessageWithContext(context.Background(), input)
+}
+
+// SendMessageWithContext is SendMessage with a context.
+func (s *SQS) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := s.send(q, &sqs.SendMessageBatchRequestEntry{
+		MessageBody:             input.MessageBody,
+		MessageAttributes:       input.MessageAttributes,
+		MessageSystemAttributes: input.MessageSystemAttributes,
+		DelaySeconds:            input.DelaySeconds,
+		MessageGroupId:          input.MessageGroupId,
+		MessageDeduplicationId:  input.MessageDeduplicationId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.SendMessageOutput{
+		MessageId:        aws.String(m.id),
+		MD5OfMessageBody: aws.String(md5Hex(m.body)),
+		SequenceNumber:   optionalString(m.sequenceNumber),
+	}, nil
+}
+
+// SendMessageBatch sends up to 10 messages to a queue.
+func (s *SQS) SendMessageBatch(input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+	return s.SendMessageBatchWithContext(context.Background(), input)
+}
+
+// SendMessageBatchWithContext is SendMessageBatch with a context.
+func (s *SQS) SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(input.Entries))
+	for i, e := range input.Entries {
+		ids[i] = e.Id
+	}
+	if err := checkBatch(ids); err != nil {
+		return nil, err
+	}
+
+	out := &sqs.SendMessageBatchOutput{}
+	for _, e := range input.Entries {
+		m, err := s.send(q, e)
+		if err != nil {
+			out.Failed = append(out.Failed, batchError(e.Id, err))
+			continue
+		}
+
+		out.Successful = append(out.Successful, &sqs.SendMessageBatchResultEntry{
+			Id:               e.Id,
+			MessageId:        aws.String(m.id),
+			MD5OfMessageBody: aws.String(md5Hex(m.body)),
+			SequenceNumber:   optionalString(m.sequenceNumber),
+		})
+	}
+
+	return out, nil
+}
+
+// send adds the message of `e` to `q`, returning it, or the message it
+// duplicates.
+func (s *SQS) send(q *queue, e *sqs.SendMessageBatchRequestEntry) (*message, error) {
+	body := aws.StringValue(e.MessageBody)
+	if body == "" {
+		return nil, awserr.New("MissingParameter", "The request must contain the parameter MessageBody.", nil)
+	}
+
+	size := len(body)
+	for k, v := range e.MessageAttributes {
+		size += len(k) + len(aws.StringValue(v.DataType)) + len(aws.StringValue(v.StringValue)) + len(v.BinaryValue)
+	}
+	if max := q.intAttribute(sqs.QueueAttributeNameMaximumMessageSize, 262144); int64(size) > max {
+		return nil, invalidParameter("One or more parameters are invalid. Reason: Message must be shorter than %d bytes.", max)
+	}
+
+	delay := q.intAttribute(sqs.QueueAttributeNameDelaySeconds, 0)
+	if e.DelaySeconds != nil {
+		if q.fifo {
+			return nil, invalidParameter("Value %d for parameter DelaySeconds is invalid. Reason: The request include parameter that is not valid for this queue type.", *e.DelaySeconds)
+		}
+		if delay = *e.DelaySeconds; delay < 0 || delay > maxDelaySeconds {
+			return nil, invalidParameter("Value %d for parameter DelaySeconds is invalid. Reason: must be between 0 and %d, if provided.", delay, maxDelaySeconds)
+		}
+	}
+
+	now := s.now()
+	m := &message{
+		id:               s.nextID(),
+		body:             body,
+		attributes:       e.MessageAttributes,
+		systemAttributes: e.MessageSystemAttributes,
+		sentAt:           now,
+		visibleAt:        now.Add(time.Duration(delay) * time.Second),
+	}
+
+	if q.fifo {
+		m.groupID = aws.StringValue(e.MessageGroupId)
+		if m.groupID == "" {
+			return nil, awserr.New("MissingParameter", "The request must contain the parameter MessageGroupId.", nil)
+		}
+
+		m.deduplicationID = aws.StringValue(e.MessageDeduplicationId)
+		if m.deduplicationID == "" {
+			if q.attributes[sqs.QueueAttributeNameContentBasedDeduplication] != "true" {
+				return nil, invalidParameter("The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+			}
+			sum := sha256.Sum256([]byte(body))
+			m.deduplicationID = hex.EncodeToString(sum[:])
+		}
+
+		if d, ok := q.dedupIDs[m.deduplicationID]; ok && now.Before(d.expires) {
+			return &message{id: d.messageID, body: body}, nil
+		}
+		q.dedupIDs[m.deduplicationID] = &dedupID{messageID: m.id, expires: now.Add(deduplicationInterval)}
+
+		q.sequence++
+		m.sequenceNumber = fmt.Sprintf("%020d", q.sequence)
+	}
+
+	q.messages = append(q.messages, m)
+	s.notify()
+
+	return m, nil
+}
+
+// ReceiveMessage receives up to MaxNumberOfMessages visible messages from a
+// queue, waiting up to WaitTimeSeconds for messages to be available.
+func (s *SQS) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	return s.ReceiveMessageWithContext(context.Background(), input)
+}
+
+// ReceiveMessageWithContext is ReceiveMessage with a context. It returns a
+// request.CanceledErrorCode error once ctx is done.
+func (s *SQS) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	max := aws.Int64Value(input.MaxNumberOfMessages)
+	if max == 0 {
+		max = 1
+	}
+	if max < 1 || max > maxBatchEntries {
+		return nil, invalidParameter("Value %d for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and %d, if provided.", max, maxBatchEntries)
+	}
+
+	deadline := time.Now().Add(time.Duration(aws.Int64Value(input.WaitTimeSeconds)) * time.Second)
+	for {
+		s.mux.Lock()
+		q, err := s.queue(input.QueueUrl)
+		if err != nil {
+			s.mux.Unlock()
+			return nil, err
+		}
+
+		messages, next := s.receive(q, input, max)
+		untilNext := next.Sub(s.now())
+		changed := s.changed
+		s.mux.Unlock()
+
+		wait := time.Until(deadline)
+		if len(messages) > 0 || wait <= 0 {
+			return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+		}
+		if !next.IsZero() && untilNext < wait {
+			wait = untilNext
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+		case <-changed:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+// receive receives up to `max` visible messages from `q`. When none is, it
+// returns the time the next message becomes visible, or the zero time.
+//
+// The messages of a group of a FIFO queue are received in order: they are
+// not received while a previous message of the group is in flight.
+func (s *SQS) receive(q *queue, input *sqs.ReceiveMessageInput, max int64) ([]*sqs.Message, time.Time) {
+	now := s.now()
+	visibility := q.intAttribute(sqs.QueueAttributeNameVisibilityTimeout, defaultVisibilityTimeout)
+	if input.VisibilityTimeout != nil {
+		visibility = *input.VisibilityTimeout
+	}
+
+	var received []*sqs.Message
+	var next time.Time
+	blocked := make(map[string]bool)
+	for _, m := range q.messages {
+		if int64(len(received)) == max {
+			break
+		}
+		if q.fifo && blocked[m.groupID] {
+			continue
+		}
+
+		if m.visibleAt.After(now) {
+			if next.IsZero() || m.visibleAt.Before(next) {
+				next = m.visibleAt
+			}
+			blocked[m.groupID] = true
+			continue
+		}
+
+		m.receiveCount++
+		if m.firstReceivedAt.IsZero() {
+			m.firstReceivedAt = now
+		}
+		m.visibleAt = now.Add(time.Duration(visibility) * time.Second)
+		m.receiptHandle = "handle-" + s.nextID()
+		q.handles[m.receiptHandle] = m
+
+		received = append(received, m.toSQS(input))
+	}
+
+	return received, next
+}
+
+// toSQS returns `m` as received by `input`.
+func (m *message) toSQS(input *sqs.ReceiveMessageInput) *sqs.Message {
+	out := &sqs.Message{
+		MessageId:     aws.String(m.id),
+		ReceiptHandle: aws.String(m.receiptHandle),
+		Body:          aws.String(m.body),
+		MD5OfBody:     aws.String(md5Hex(m.body)),
+	}
+
+	system := map[string]string{
+		sqs.MessageSystemAttributeNameApproximateReceiveCount:          strconv.FormatInt(m.receiveCount, 10),
+		sqs.MessageSystemAttributeNameSentTimestamp:                    strconv.FormatInt(m.sentAt.UnixNano()/int64(time.Millisecond), 10),
+		sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp: strconv.FormatInt(m.firstReceivedAt.UnixNano()/int64(time.Millisecond), 10),
+		sqs.MessageSystemAttributeNameSenderId:                         AccountID,
+	}
+	if m.groupID != "" {
+		system[sqs.MessageSystemAttributeNameMessageGroupId] = m.groupID
+		system[sqs.MessageSystemAttributeNameMessageDeduplicationId] = m.deduplicationID
+		system[sqs.MessageSystemAttributeNameSequenceNumber] = m.sequenceNumber
+	}
+	if v, ok := m.systemAttributes[sqs.MessageSystemAttributeNameForSendsAwstraceHeader]; ok {
+		system[sqs.MessageSystemAttributeNameAwstraceHeader] = aws.StringValue(v.StringValue)
+	}
+	for k, v := range system {
+		if matchName(input.AttributeNames, k) {
+			if out.Attributes == nil {
+				out.Attributes = make(map[string]*string)
+			}
+			out.Attributes[k] = aws.String(v)
+		}
+	}
+
+	for k, v := range m.attributes {
+		if matchName(input.MessageAttributeNames, k) {
+			if out.MessageAttributes == nil {
+				out.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+			}
+			out.MessageAttributes[k] = v
+		}
+	}
+
+	return out
+}
+
+// matchName reports whether the attribute `name` is requested by `names`:
+// "All", ".*", the name or a prefix followed by ".*".
+func matchName(names []*string, name string) bool {
+	for _, n := range names {
+		switch pattern := aws.StringValue(n); {
+		case pattern == sqs.QueueAttributeNameAll || pattern == ".*" || pattern == name:
+			return true
+		case strings.HasSuffix(pattern, ".*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")):
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeleteMessage deletes a received message.
+func (s *SQS) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	return s.DeleteMessageWithContext(context.Background(), input)
+}
+
+// DeleteMessageWithContext is DeleteMessage with a context.
+func (s *SQS) DeleteMessageWithContext(ctx aws.Context, input *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.delete(q, input.ReceiptHandle); err != nil {
+		return nil, err
+	}
+
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// DeleteMessageBatch deletes up to 10 received messages.
+func (s *SQS) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	return s.DeleteMessageBatchWithContext(context.Background(), input)
+}
+
+// DeleteMessageBatchWithContext is DeleteMessageBatch with a context.
+func (s *SQS) DeleteMessageBatchWithContext(ctx aws.Context, input *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(input.Entries))
+	for i, e := range input.Entries {
+		ids[i] = e.Id
+	}
+	if err := checkBatch(ids); err != nil {
+		return nil, err
+	}
+
+	out := &sqs.DeleteMessageBatchOutput{}
+	for _, e := range input.Entries {
+		if err := s.delete(q, e.ReceiptHandle); err != nil {
+			out.Failed = append(out.Failed, batchError(e.Id, err))
+			continue
+		}
+		out.Successful = append(out.Successful, &sqs.DeleteMessageBatchResultEntry{Id: e.Id})
+	}
+
+	return out, nil
+}
+
+// delete deletes the message received with `handle`. Deleting a message
+// which was already deleted succeeds.
+func (s *SQS) delete(q *queue, handle *string) error {
+	m, ok := q.handles[aws.StringValue(handle)]
+	if !ok {
+		return awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, "The input receipt handle is invalid.", nil)
+	}
+
+	for i, other := range q.messages {
+		if other == m {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+	for h, other := range q.handles {
+		if other == m {
+			delete(q.handles, h)
+		}
+	}
+
+	// the following messages of its group may be received
+	s.notify()
+
+	return nil
+}
+
+// ChangeMessageVisibility changes the visibility timeout of a message in
+// flight.
+func (s *SQS) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return s.ChangeMessageVisibilityWithContext(context.Background(), input)
+}
+
+// ChangeMessageVisibilityWithContext is ChangeMessageVisibility with a
+// context.
+func (s *SQS) ChangeMessageVisibilityWithContext(ctx aws.Context, input *sqs.ChangeMessageVisibilityInput, opts ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.changeVisibility(q, input.ReceiptHandle, aws.Int64Value(input.VisibilityTimeout)); err != nil {
+		return nil, err
+	}
+
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+// ChangeMessageVisibilityBatch changes the visibility timeout of up to 10
+// messages in flight.
+func (s *SQS) ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	return s.ChangeMessageVisibilityBatchWithContext(context.Background(), input)
+}
+
+// ChangeMessageVisibilityBatchWithContext is ChangeMessageVisibilityBatch
+// with a context.
+func (s *SQS) ChangeMessageVisibilityBatchWithContext(ctx aws.Context, input *sqs.ChangeMessageVisibilityBatchInput, opts ...request.Option) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(input.Entries))
+	for i, e := range input.Entries {
+		ids[i] = e.Id
+	}
+	if err := checkBatch(ids); err != nil {
+		return nil, err
+	}
+
+	out := &sqs.ChangeMessageVisibilityBatchOutput{}
+	for _, e := range input.Entries {
+		if err := s.changeVisibility(q, e.ReceiptHandle, aws.Int64Value(e.VisibilityTimeout)); err != nil {
+			out.Failed = append(out.Failed, batchError(e.Id, err))
+			continue
+		}
+		out.Successful = append(out.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: e.Id})
+	}
+
+	return out, nil
+}
+
+// changeVisibility makes the message in flight received with `handle`
+// visible after `timeout` seconds.
+func (s *SQS) changeVisibility(q *queue, handle *string, timeout int64) error {
+	m, ok := q.handles[aws.StringValue(handle)]
+	if !ok {
+		return awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, "The input receipt handle is invalid.", nil)
+	}
+	if timeout < 0 || timeout > 43200 {
+		return invalidParameter("Value %d for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200.", timeout)
+	}
+
+	now := s.now()
+	if m.receiptHandle != aws.StringValue(handle) || !m.visibleAt.After(now) {
+		return awserr.New(sqs.ErrCodeMessageNotInflight, "The message referred to is not in flight.", nil)
+	}
+	m.visibleAt = now.Add(time.Duration(timeout) * time.Second)
+	s.notify()
+
+	return nil
+}
+
+// checkBatch returns an error if the entries of a batch request with
+// `ids` are empty, too many, or do not have distinct IDs.
+func checkBatch(ids []*string) error {
+	switch {
+	case len(ids) == 0:
+		return awserr.New(sqs.ErrCodeEmptyBatchRequest, "There should be at least one entry in the request.", nil)
+	case len(ids) > maxBatchEntries:
+		return awserr.New(sqs.ErrCodeTooManyEntriesInBatchRequest, fmt.Sprintf("Maximum number of entries per request are %d. You have sent %d.", maxBatchEntries, len(ids)), nil)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[aws.StringValue(id)] {
+			return awserr.New(sqs.ErrCodeBatchEntryIdsNotDistinct, "Id "+aws.StringValue(id)+" repeated.", nil)
+		}
+		seen[aws.StringValue(id)] = true
+	}
+
+	return nil
+}
+
+// batchError returns the error of the entry `id` of a batch request.
+func batchError(id *string, err error) *sqs.BatchResultErrorEntry {
+	code, message := "InternalError", err.Error()
+	if aerr, ok := err.(awserr.Error); ok {
+		code, message = aerr.Code(), aerr.Message()
+	}
+
+	return &sqs.BatchResultErrorEntry{
+		Id:          id,
+		Code:        aws.String(code),
+		Message:     aws.String(message),
+		SenderFault: aws.Bool(true),
+	}
+}
+
+// md5Hex returns the hex-encoded MD5 digest of `s`.
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// optionalString returns a pointer to `s`, or nil if it is empty.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return aws.String(s)
+}
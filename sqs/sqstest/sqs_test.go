@@ -0,0 +1,260 @@
+package sqstest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	msgsqs "github.com/hdtradeservices/go-aws-msg/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// send sends `body` to the queue `queueURL` of `s` with `group`, if set.
+func send(t *testing.T, s *SQS, queueURL, body, group string) string {
+	input := &sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String(body)}
+	if group != "" {
+		input.MessageGroupId = aws.String(group)
+	}
+
+	out, err := s.SendMessage(input)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return aws.StringValue(out.MessageId)
+}
+
+// receive receives up to `max` messages from the queue `queueURL` of `s`
+// without waiting, returning their bodies and receipt handles.
+func receive(t *testing.T, s *SQS, queueURL string, max int64) ([]string, []*string) {
+	out, err := s.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: aws.Int64(max),
+		AttributeNames:      aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var bodies []string
+	var handles []*string
+	for _, m := range out.Messages {
+		bodies = append(bodies, aws.StringValue(m.Body))
+		handles = append(handles, m.ReceiptHandle)
+	}
+	return bodies, handles
+}
+
+// Tests that received messages are invisible until their visibility timeout
+// expires, or is changed, and that deleted messages are not received again.
+func TestSQS_VisibilityTimeout(t *testing.T) {
+	s := New()
+	queueURL := s.NewQueue("jobs", map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "60"})
+	send(t, s, queueURL, "hello", "")
+
+	if bodies, _ := receive(t, s, queueURL, 10); len(bodies) != 1 {
+		t.Fatalf("Expected the message to be received, got %v", bodies)
+	}
+	if bodies, _ := receive(t, s, queueURL, 10); len(bodies) != 0 {
+		t.Fatalf("Expected the message to be in flight, got %v", bodies)
+	}
+
+	s.Advance(time.Minute)
+	out, err := s.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: aws.StringSlice([]string{sqs.MessageSystemAttributeNameApproximateReceiveCount}),
+	})
+	if err != nil || len(out.Messages) != 1 {
+		t.Fatalf("Expected the message to be received again, got %v, %v", out, err)
+	}
+	if count := aws.StringValue(out.Messages[0].Attributes["ApproximateReceiveCount"]); count != "2" {
+		t.Errorf("Expected the message to be received twice, got %s", count)
+	}
+
+	handle := out.Messages[0].ReceiptHandle
+	if _, err := s.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl: aws.String(queueURL), ReceiptHandle: handle, VisibilityTimeout: aws.Int64(0),
+	}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	_, handles := receive(t, s, queueURL, 10)
+	if len(handles) != 1 {
+		t.Fatalf("Expected the message to be visible again")
+	}
+	if _, err := s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: handles[0]}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if s.Len(queueURL) != 0 {
+		t.Errorf("Expected the message to be deleted")
+	}
+
+	_, err = s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: aws.String("unknown")})
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != sqs.ErrCodeReceiptHandleIsInvalid {
+		t.Errorf("Expected ReceiptHandleIsInvalid, got %v", err)
+	}
+}
+
+// Tests that delayed messages are received once their delay expired.
+func TestSQS_Delay(t *testing.T) {
+	s := New()
+	queueURL := s.NewQueue("jobs", nil)
+
+	if _, err := s.SendMessage(&sqs.SendMessageInput{
+		QueueUrl: aws.String(queueURL), MessageBody: aws.String("later"), DelaySeconds: aws.Int64(120),
+	}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	attrs, _ := s.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed}),
+	})
+	if delayed := aws.StringValue(attrs.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed]); delayed != "1" {
+		t.Errorf("Expected 1 delayed message, got %s", delayed)
+	}
+
+	if bodies, _ := receive(t, s, queueURL, 10); len(bodies) != 0 {
+		t.Fatalf("Expected the message to be delayed, got %v", bodies)
+	}
+	s.Advance(2 * time.Minute)
+	if bodies, _ := receive(t, s, queueURL, 10); len(bodies) != 1 {
+		t.Fatalf("Expected the message to be received after its delay, got %v", bodies)
+	}
+}
+
+// Tests that the messages of a group of a FIFO queue are received in order,
+// one at a time, and that duplicates are not sent.
+func TestSQS_FIFO(t *testing.T) {
+	s := New()
+	queueURL := s.NewQueue("jobs.fifo", map[string]string{sqs.QueueAttributeNameContentBasedDeduplication: "true"})
+
+	id := send(t, s, queueURL, "a1", "a")
+	send(t, s, queueURL, "a2", "a")
+	send(t, s, queueURL, "b1", "b")
+	if send(t, s, queueURL, "a1", "a") != id || s.Len(queueURL) != 3 {
+		t.Errorf("Expected the duplicate not to be sent")
+	}
+
+	bodies, handles := receive(t, s, queueURL, 1)
+	if strings.Join(bodies, ",") != "a1" {
+		t.Fatalf("Expected a1 to be received, got %v", bodies)
+	}
+	if bodies, _ := receive(t, s, queueURL, 10); strings.Join(bodies, ",") != "b1" {
+		t.Fatalf("Expected group a to be blocked while a1 is in flight, got %v", bodies)
+	}
+
+	s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: handles[0]})
+	if bodies, _ := receive(t, s, queueURL, 10); strings.Join(bodies, ",") != "a2" {
+		t.Fatalf("Expected a2 to be received once a1 was deleted, got %v", bodies)
+	}
+
+	_, err := s.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("x")})
+	if err == nil {
+		t.Errorf("Expected messages without group to be rejected")
+	}
+	_, err = s.SendMessage(&sqs.SendMessageInput{
+		QueueUrl: aws.String(queueURL), MessageBody: aws.String("x"), MessageGroupId: aws.String("a"), DelaySeconds: aws.Int64(1),
+	})
+	if err == nil {
+		t.Errorf("Expected messages with a delay to be rejected")
+	}
+}
+
+// Tests that ReceiveMessage waits for messages to be sent, until its
+// context is canceled.
+func TestSQS_LongPolling(t *testing.T) {
+	s := New()
+	queueURL := s.NewQueue("jobs", nil)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		send(t, s, queueURL, "hello", "")
+	}()
+
+	input := &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), WaitTimeSeconds: aws.Int64(5)}
+	out, err := s.ReceiveMessageWithContext(context.Background(), input)
+	if err != nil || len(out.Messages) != 1 {
+		t.Fatalf("Expected the message to be received, got %v, %v", out, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = s.ReceiveMessageWithContext(ctx, input)
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != request.CanceledErrorCode {
+		t.Errorf("Expected a canceled request, got %v", err)
+	}
+}
+
+// Tests that messages published with NewTopic are received by a NewServer,
+// and retried after their retry timeout when the receiver fails.
+func TestNewServer(t *testing.T) {
+	s := New()
+	queueURL := s.NewQueue("jobs", nil)
+
+	topic, err := NewTopic(s, queueURL)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	for _, body := range []string{"first", "second"} {
+		w := topic.NewWriter(context.Background())
+		w.Attributes().Set("Tenant", "acme")
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	srv, err := NewServer(s, queueURL, 2, 1, msgsqs.WithLogger(logger.Nop))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var mux sync.Mutex
+	var bodies []string
+	failed := false
+	done := make(chan struct{})
+	go srv.Serve(context.Background(), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b, _ := ioutil.ReadAll(m.Body)
+
+		mux.Lock()
+		defer mux.Unlock()
+		if m.Attributes.Get("Tenant") != "acme" {
+			t.Errorf("Expected the attributes to be received, got %v", m.Attributes)
+		}
+		if string(b) == "second" && !failed {
+			failed = true
+			return errors.New("failed")
+		}
+		bodies = append(bodies, string(b))
+		if len(bodies) == 2 {
+			close(done)
+		}
+		return nil
+	}))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out after receiving %v", bodies)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+
+	sort.Strings(bodies)
+	if strings.Join(bodies, ",") != "first,second" || s.Len(queueURL) != 0 {
+		t.Errorf("Expected both messages to be processed and deleted, got %v and %d left", bodies, s.Len(queueURL))
+	}
+}
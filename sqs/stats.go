@@ -0,0 +1,40 @@
+package sqs
+
+import "time"
+
+// Stats is a snapshot of the activity of a Server since it was created.
+type Stats struct {
+	Received  int64 // messages received from the queue
+	Succeeded int64 // messages for which Receive returned nil
+	Failed    int64 // messages for which Receive returned an error
+	Skipped   int64 // messages discarded by Receive, see ErrSkipMessage
+	Deleted   int64 // processed messages deleted from the queue
+	Expired   int64 // messages deleted unprocessed, see WithMessageExpiry
+
+	InFlight int // messages being processed
+
+	// LastReceive is when the last successful ReceiveMessage call returned,
+	// whether or not it returned messages. It is zero until the first one.
+	LastReceive time.Time
+}
+
+// Stats returns a snapshot of the activity of the Server, so that
+// applications can surface the health of their consumer without an
+// external metrics system.
+func (s *Server) Stats() Stats {
+	s.statsMux.Lock()
+	stats := s.stats
+	s.statsMux.Unlock()
+
+	stats.InFlight = s.maxConcurrentReceives.len()
+
+	return stats
+}
+
+// updateStats calls update with the stats of the Server, under lock.
+func (s *Server) updateStats(update func(*Stats)) {
+	s.statsMux.Lock()
+	defer s.statsMux.Unlock()
+
+	update(&s.stats)
+}
@@ -0,0 +1,49 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that Stats counts received, succeeded, failed and deleted messages.
+func TestServer_Stats(t *testing.T) {
+	msgs := newSQSMessages(3)
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+
+	if stats := srv.Stats(); stats != (Stats{}) {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, _ := ioutil.ReadAll(m.Body)
+		if string(body) == "this is a test 0" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	go srv.Serve(context.Background(), r)
+	defer srv.Shutdown(context.Background())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := srv.Stats()
+		if stats.Deleted == 2 && stats.Failed == 1 {
+			if stats.Received != 3 || stats.Succeeded != 2 || stats.LastReceive.IsZero() {
+				t.Errorf("Unexpected stats %+v", stats)
+			}
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 2 deleted and 1 failed messages, got %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -3,18 +3,28 @@ package sqs
 import (
 	"bytes"
 	"context"
-	"log"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"math"
+	"net/http"
+	"net/textproto"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/hdtradeservices/go-aws-msg/internal/awssession"
+	"github.com/hdtradeservices/go-aws-msg/logger"
+	"github.com/hdtradeservices/go-aws-msg/metrics"
 	msg "github.com/hdtradeservices/go-msg"
 )
 
@@ -22,18 +32,42 @@ import (
 type Topic struct {
 	QueueURL string
 	Svc      sqsiface.SQSAPI
+
+	queueName           string // name of the queue whose URL is resolved by NewTopic
+	queueOwnerAccountID string // AWS account owning the queue called queueName
+
+	ensureQueueAttributes map[string]string // attributes of the queue created by NewTopic if it does not exist
+	logger                logger.Logger     // where MessageWriters log; logger.Default when nil
+	metrics               metrics.Recorder  // where MessageWriters report metrics; none when nil
+	contentDeduplication  bool              // whether MessageWriters hash messages into their MessageDeduplicationId
+	binaryEncoding        bool              // whether MessageWriters base64-encode bodies SQS cannot carry
+	defaultAttributes     msg.Attributes    // attributes every message is created with
+	defaultDelaySeconds   int64             // delay of every message, unless set with SetDelay
+	batcher               *sendBatcher      // sends the messages of MessageWriters in batches when set
+	async                 *asyncSender      // sends the messages of MessageWriters in the background when set
+	session               *session.Session
+
+	// retryPolicy is how MessageWriters retry failed sends; no retries when nil.
+	retryPolicy *PublishRetryPolicy
+
+	// limiter limits the rate at which MessageWriters send; unlimited when nil.
+	limiter *tokenBucket
 }
 
+// TopicOption is the signature that modifies a `Topic` to set some configuration
+type TopicOption func(*Topic) error
+
 // NewTopic returns an sqs.Topic with fully configured SQSAPI
-func NewTopic(queueURL string) (msg.Topic, error) {
-	sess, err := session.NewSession()
+//
+// AWS credentials are resolved with the default credential chain of the SDK,
+// see NewServer. See WithTopicEnvCredentials to only use environment variables.
+func NewTopic(queueURL string, opts ...TopicOption) (msg.Topic, error) {
+	sess, err := awssession.New(aws.Config{}, "")
 	if err != nil {
 		return nil, err
 	}
 
-	conf := &aws.Config{
-		Credentials: credentials.NewCredentials(&credentials.EnvProvider{}),
-	}
+	conf := &aws.Config{}
 
 	// http://docs.aws.amazon.com/sdk-for-go/api/aws/client/#Config
 	if r := os.Getenv("AWS_REGION"); r != "" {
@@ -43,29 +77,394 @@ func NewTopic(queueURL string) (msg.Topic, error) {
 		conf.Endpoint = aws.String(url)
 	}
 
-	return &Topic{
+	t := &Topic{
 		QueueURL: queueURL,
 		Svc:      sqs.New(sess, conf),
-	}, nil
+		session:  sess,
+	}
+
+	for _, opt := range opts {
+		if err = opt(t); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	t.QueueURL, err = resolveQueue(t.Svc, t.QueueURL, t.queueName, t.queueOwnerAccountID, t.ensureQueueAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.defaultDelaySeconds > 0 && isFIFOQueue(t.QueueURL) {
+		return nil, fmt.Errorf("cannot set default delay: %s", ErrDelayNotSupported)
+	}
+
+	return t, nil
+}
+
+// WithTopicClient makes the `Topic` use `svc` instead of the SQS client built
+// by NewTopic from the environment, e.g. to share a client configured by the
+// application, or to use a fake in tests.
+func WithTopicClient(svc sqsiface.SQSAPI) TopicOption {
+	return func(t *Topic) error {
+		if svc == nil {
+			return errors.New("client must not be nil")
+		}
+
+		t.Svc = svc
+
+		return nil
+	}
+}
+
+// WithTopicSession makes the `Topic` use an SQS client created from `sess`,
+// e.g. shared with the rest of the application, instead of the session and
+// configuration NewTopic creates from the environment. `cfgs` override the
+// configuration of `sess` for the SQS client only, e.g. its Region.
+func WithTopicSession(sess *session.Session, cfgs ...*aws.Config) TopicOption {
+	return func(t *Topic) error {
+		if sess == nil {
+			return errors.New("session must not be nil")
+		}
+
+		t.session = sess
+		t.Svc = sqs.New(sess, cfgs...)
+
+		return nil
+	}
+}
+
+// WithTopicEnvCredentials makes the `Topic` only read AWS credentials from
+// the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables,
+// instead of using the default credential chain.
+func WithTopicEnvCredentials() TopicOption {
+	return func(t *Topic) error {
+		svc, ok := t.Svc.(*sqs.SQS)
+		if !ok {
+			return errors.New("svc could not be casted to a SQS client")
+		}
+
+		c := svc.Client.Config
+		c.Credentials = credentials.NewCredentials(&credentials.EnvProvider{})
+		t.Svc = sqs.New(t.session, &c)
+
+		return nil
+	}
+}
+
+// WithTopicProfile makes the `Topic` use the credentials and region of the
+// named profile of the shared config and credentials files, see WithProfile.
+func WithTopicProfile(name string) TopicOption {
+	return func(t *Topic) error {
+		if name == "" {
+			return errors.New("profile must not be empty")
+		}
+
+		svc, ok := t.Svc.(*sqs.SQS)
+		if !ok {
+			return errors.New("svc could not be casted to a SQS client")
+		}
+
+		sess, err := awssession.New(aws.Config{}, name)
+		if err != nil {
+			return err
+		}
+
+		c := svc.Client.Config
+		c.Credentials = sess.Config.Credentials
+		if region := aws.StringValue(sess.Config.Region); region != "" {
+			c.Region = aws.String(region)
+		}
+		t.session = sess
+		t.Svc = sqs.New(sess, &c)
+
+		return nil
+	}
+}
+
+// WithTopicRegion makes the `Topic` call SQS in the AWS `region`, instead of
+// the one set by the AWS_REGION environment variable.
+func WithTopicRegion(region string) TopicOption {
+	return func(t *Topic) error {
+		if region == "" {
+			return errors.New("region must not be empty")
+		}
+
+		svc, ok := t.Svc.(*sqs.SQS)
+		if !ok {
+			return errors.New("svc could not be casted to a SQS client")
+		}
+
+		c := svc.Client.Config
+		c.Region = aws.String(region)
+		t.Svc = sqs.New(t.session, &c)
+
+		return nil
+	}
+}
+
+// WithTopicEndpoint makes the `Topic` call SQS at `url`, instead of the one
+// set by the SQS_ENDPOINT environment variable or the endpoint of its region,
+// e.g. to use a local SQS implementation.
+func WithTopicEndpoint(url string) TopicOption {
+	return func(t *Topic) error {
+		if url == "" {
+			return errors.New("endpoint must not be empty")
+		}
+
+		svc, ok := t.Svc.(*sqs.SQS)
+		if !ok {
+			return errors.New("svc could not be casted to a SQS client")
+		}
+
+		c := svc.Client.Config
+		c.Endpoint = aws.String(url)
+		t.Svc = sqs.New(t.session, &c)
+
+		return nil
+	}
+}
+
+// WithTopicFIPSEndpoint makes the `Topic` call the FIPS 140-2 compliant SQS
+// endpoint of its region, e.g. as required in GovCloud.
+func WithTopicFIPSEndpoint() TopicOption {
+	return func(t *Topic) error {
+		svc, ok := t.Svc.(*sqs.SQS)
+		if !ok {
+			return errors.New("svc could not be casted to a SQS client")
+		}
+
+		c := svc.Client.Config
+		c.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+		t.Svc = sqs.New(t.session, &c)
+
+		return nil
+	}
+}
+
+// WithTopicDualStackEndpoint makes the `Topic` call the dual-stack SQS
+// endpoint of its region, which is reachable over both IPv4 and IPv6, e.g.
+// from an IPv6-only VPC.
+func WithTopicDualStackEndpoint() TopicOption {
+	return func(t *Topic) error {
+		svc, ok := t.Svc.(*sqs.SQS)
+		if !ok {
+			return errors.New("svc could not be casted to a SQS client")
+		}
+
+		c := svc.Client.Config
+		c.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+		t.Svc = sqs.New(t.session, &c)
+
+		return nil
+	}
+}
+
+// WithTopicHTTPClient makes the SQS client of the `Topic` send its requests
+// with `client`, e.g. to configure connection pooling, dial timeouts or
+// proxies.
+func WithTopicHTTPClient(client *http.Client) TopicOption {
+	return func(t *Topic) error {
+		if client == nil {
+			return errors.New("http client must not be nil")
+		}
+
+		svc, ok := t.Svc.(*sqs.SQS)
+		if !ok {
+			return errors.New("svc could not be casted to a SQS client")
+		}
+
+		c := svc.Client.Config
+		c.HTTPClient = client
+		t.Svc = sqs.New(t.session, &c)
+
+		return nil
+	}
+}
+
+// WithTopicAssumeRole makes the `Topic` assume the IAM role `roleARN` with
+// STS, e.g. to publish to a queue owned by another AWS account. The
+// credentials of the client are used to assume the role, and the temporary
+// credentials are refreshed before they expire. `externalID` may be left
+// empty if the role does not require one.
+func WithTopicAssumeRole(roleARN, externalID string) TopicOption {
+	return func(t *Topic) error {
+		svc, ok := t.Svc.(*sqs.SQS)
+		if !ok {
+			return errors.New("svc could not be casted to a SQS client")
+		}
+
+		c := svc.Client.Config
+		c.Credentials = assumeRoleCredentials(t.session, c.Credentials, roleARN, externalID)
+		t.Svc = sqs.New(t.session, &c)
+
+		return nil
+	}
+}
+
+// WithTopicQueueName makes NewTopic resolve the URL of the queue called
+// `name` using GetQueueUrl, instead of using the queueURL it was passed.
+// ownerAccountID may be set to publish to a queue owned by another AWS
+// account, or left empty.
+func WithTopicQueueName(name, ownerAccountID string) TopicOption {
+	return func(t *Topic) error {
+		if name == "" {
+			return errors.New("queue name must not be empty")
+		}
+
+		t.queueName = name
+		t.queueOwnerAccountID = ownerAccountID
+
+		return nil
+	}
+}
+
+// WithTopicEnsureQueue makes NewTopic create the queue, with the given
+// attributes, if it does not already exist. The queue is named after the
+// queueURL passed to NewTopic, or the name set with WithTopicQueueName.
+func WithTopicEnsureQueue(attributes map[string]string) TopicOption {
+	return func(t *Topic) error {
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+
+		t.ensureQueueAttributes = attributes
+
+		return nil
+	}
+}
+
+// WithTopicLogger sets the Logger MessageWriters of the `Topic` log to,
+// instead of logger.Default, which silences TRACE and DEBUG messages.
+func WithTopicLogger(l logger.Logger) TopicOption {
+	return func(t *Topic) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+
+		t.logger = l
+
+		return nil
+	}
+}
+
+// WithTopicMetrics makes MessageWriters of the `Topic` report metrics about
+// the messages they publish and their SendMessage calls to r.
+func WithTopicMetrics(r metrics.Recorder) TopicOption {
+	return func(t *Topic) error {
+		if r == nil {
+			return errors.New("metrics recorder must not be nil")
+		}
+
+		t.metrics = r
+
+		return nil
+	}
+}
+
+// WithTopicContentDeduplication makes MessageWriters of the `Topic` set the
+// MessageDeduplicationId of messages sent to a FIFO queue, unless set with
+// SetDeduplicationID, to the SHA-256 of their body and attributes. Unlike
+// content-based deduplication enabled on the queue, attributes are included.
+func WithTopicContentDeduplication() TopicOption {
+	return func(t *Topic) error {
+		t.contentDeduplication = true
+
+		return nil
+	}
+}
+
+// WithTopicDefaultAttributes makes MessageWriters of the `Topic` create
+// every message with a copy of `attrs`, e.g. the name of the service, its
+// environment and the version of the schema of the messages. They can be
+// overridden for a message through MessageWriter.Attributes.
+func WithTopicDefaultAttributes(attrs map[string][]string) TopicOption {
+	return func(t *Topic) error {
+		if len(attrs) == 0 {
+			return errors.New("default attributes must not be empty")
+		}
+
+		t.defaultAttributes = msg.Attributes{}
+		copyAttributes(t.defaultAttributes, attrs)
+
+		return nil
+	}
+}
+
+// WithTopicDefaultDelay makes MessageWriters of the `Topic` delay the
+// delivery of every message by `delay`, unless another delay is set with
+// MessageWriter.SetDelay, e.g. for intentionally delayed processing. The
+// delay must be between 0 and 900 seconds, and is rounded down to the
+// second. FIFO queues do not support it, their delay is set on the queue.
+func WithTopicDefaultDelay(delay time.Duration) TopicOption {
+	return func(t *Topic) error {
+		if delay < 0 || delay > maxDelay {
+			return fmt.Errorf("invalid default delay %s: %w", delay, ErrDelayOutOfRange)
+		}
+
+		t.defaultDelaySeconds = int64(delay.Seconds())
+
+		return nil
+	}
+}
+
+// maxDelay is the maximum delay of an SQS message.
+const maxDelay = 900 * time.Second
+
+// copyAttributes copies the attributes `src` to `dst`, canonicalizing
+// their names as msg.Attributes.Set does.
+func copyAttributes(dst msg.Attributes, src map[string][]string) {
+	for k, v := range src {
+		dst[textproto.CanonicalMIMEHeaderKey(k)] = append([]string(nil), v...)
+	}
 }
 
 // NewWriter returns a new sqs.MessageWriter
+//
+// Its buffer is taken from a pool shared by every Topic, and put back once
+// it is closed, so that publishing many messages does not allocate a new
+// buffer for each of them. Its attributes are only allocated once they are
+// accessed, unless the Topic has default attributes.
 func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
-	return &MessageWriter{
-		attributes: make(map[string][]string),
-		buf:        &bytes.Buffer{},
-		ctx:        ctx,
-		queueURL:   t.QueueURL,
-		sqsClient:  t.Svc,
+	w := &MessageWriter{
+		buf:       getBuffer(),
+		ctx:       ctx,
+		queueURL:  t.QueueURL,
+		sqsClient: t.Svc,
+		logger:    t.logger,
+		metrics:   t.metrics,
+
+		delaySeconds:         t.defaultDelaySeconds,
+		contentDeduplication: t.contentDeduplication,
+		binaryEncoding:       t.binaryEncoding,
+		batcher:              t.batcher,
+		async:                t.async,
+		retryPolicy:          t.retryPolicy,
+		limiter:              t.limiter,
+	}
+
+	if len(t.defaultAttributes) > 0 {
+		copyAttributes(*w.Attributes(), t.defaultAttributes)
 	}
+
+	return w
+}
+
+// logf logs a message at level to the Logger of the Topic.
+func (t *Topic) logf(level logger.Level, format string, args ...interface{}) {
+	l := t.logger
+	if l == nil {
+		l = logger.Default
+	}
+
+	l.Logf(level, format, args...)
 }
 
 // MessageWriter writes data to a SQS Queue.
 type MessageWriter struct {
 	msg.MessageWriter
 
-	attributes msg.Attributes
-	buf        *bytes.Buffer
+	attributes msg.Attributes // allocated by Attributes
+	buf        *bytes.Buffer  // taken from bufferPool; put back by Close
 	ctx        context.Context
 	closed     bool
 	mux        sync.Mutex
@@ -73,15 +472,59 @@ type MessageWriter struct {
 	// delaySeconds is a length of time to delay the SQS message.
 	delaySeconds int64
 
+	// deliverAt is when the message is delivered, if scheduled with
+	// SetDeliverAt.
+	deliverAt time.Time
+
+	// groupID and deduplicationID are the MessageGroupId and
+	// MessageDeduplicationId of a message sent to a FIFO queue.
+	groupID         string
+	deduplicationID string
+
+	// systemAttributes are the message system attributes of the message,
+	// e.g. AWSTraceHeader.
+	systemAttributes map[string]string
+
+	// contentDeduplication is whether deduplicationID defaults
+	// to the hash of the message.
+	contentDeduplication bool
+
+	// binaryEncoding is whether bodies which are not valid SQS message
+	// bodies are base64-encoded.
+	binaryEncoding bool
+
 	// sqsClient is the SQS interface
 	sqsClient sqsiface.SQSAPI
 
+	// batcher sends the message with a SendMessageBatch call when set.
+	batcher *sendBatcher
+
+	// async sends the message in the background when set.
+	async *asyncSender
+
+	// retryPolicy is how failed sends of the message are retried;
+	// they are not when nil.
+	retryPolicy *PublishRetryPolicy
+
+	// limiter limits the rate at which the message is sent when set.
+	limiter *tokenBucket
+
 	// queueURL is the URL to the queue.
 	queueURL string
+
+	// logger is where the MessageWriter logs; logger.Default when nil.
+	logger logger.Logger
+
+	// metrics is where the MessageWriter reports metrics; none when nil.
+	metrics metrics.Recorder
 }
 
 // Attributes returns the msg.Attributes associated with the MessageWriter
 func (w *MessageWriter) Attributes() *msg.Attributes {
+	if w.attributes == nil {
+		w.attributes = msg.Attributes{}
+	}
+
 	return &w.attributes
 }
 
@@ -98,6 +541,21 @@ func (w *MessageWriter) Write(p []byte) (int, error) {
 	return w.buf.Write(p)
 }
 
+// discard closes the MessageWriter without sending its message, putting
+// its buffer back in the pool.
+func (w *MessageWriter) discard() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	putBuffer(w.buf)
+	w.buf = nil
+}
+
 // Close converts it's buffered data and attributes to an SQS message
 // and publishes it to a queue.
 //
@@ -111,27 +569,176 @@ func (w *MessageWriter) Close() error {
 	}
 	w.closed = true
 
+	// the body is copied to params, so the buffer can be reused
+	// whether or not the message is sent. The copy is deliberate:
+	// SQSAPI implementations, such as sqstest, may keep the body after
+	// the message was sent, so it must not share the memory of a pooled
+	// buffer
+	defer func() {
+		putBuffer(w.buf)
+		w.buf = nil
+	}()
+
+	if w.binaryEncoding && !isValidBody(w.buf.Bytes()) {
+		w.encodeBody()
+	}
+	w.applyDeliverAt()
+
 	params := &sqs.SendMessageInput{
-		DelaySeconds: aws.Int64(w.delaySeconds),
-		MessageBody:  aws.String(w.buf.String()),
-		QueueUrl:     aws.String(w.queueURL),
+		MessageBody: aws.String(w.buf.String()),
+		QueueUrl:    aws.String(w.queueURL),
+	}
+
+	if isFIFOQueue(w.queueURL) {
+		if w.groupID == "" {
+			return ErrMissingMessageGroupID
+		}
+		if w.delaySeconds > 0 {
+			return ErrDelayNotSupported
+		}
+
+		params.MessageGroupId = aws.String(w.groupID)
+		if w.deduplicationID == "" && w.contentDeduplication {
+			w.deduplicationID = contentDeduplicationID(w.buf.Bytes(), w.attributes)
+		}
+		if w.deduplicationID != "" {
+			params.MessageDeduplicationId = aws.String(w.deduplicationID)
+		}
+	} else {
+		params.DelaySeconds = aws.Int64(w.delaySeconds)
 	}
 
-	if len(*w.Attributes()) > 0 {
-		params.MessageAttributes = buildSQSAttributes(w.Attributes())
+	if len(w.attributes) > 0 {
+		params.MessageAttributes = buildSQSAttributes(&w.attributes)
+	}
+	params.MessageSystemAttributes = w.buildSystemAttributes()
+
+	if size := messageSize(params); size > MaxMessageSize {
+		return &MessageTooLargeError{Size: size, MaxSize: MaxMessageSize}
+	}
+
+	if w.async != nil {
+		return w.async.enqueue(w, params)
+	}
+
+	return w.send(w.ctx, params)
+}
+
+// send sends the message `params`, through the batcher of the MessageWriter
+// if it has one, retrying according to its retry policy and waiting for its
+// rate limiter.
+func (w *MessageWriter) send(ctx context.Context, params *sqs.SendMessageInput) error {
+	err := w.sendWithRetries(ctx, func() error {
+		if w.limiter != nil {
+			if err := w.limiter.wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		if w.batcher != nil {
+			return w.batcher.send(ctx, params)
+		}
+
+		w.logf(logger.Trace, "writing %d bytes to sqs queue %s", len(aws.StringValue(params.MessageBody)), w.queueURL)
+		start := time.Now()
+		_, err := w.sqsClient.SendMessageWithContext(ctx, params)
+		if w.metrics != nil {
+			w.metrics.ObserveAPICall("SendMessage", time.Since(start), err)
+		}
+
+		return err
+	})
+
+	if w.metrics != nil {
+		w.metrics.ObservePublish(queueNameFromURL(w.queueURL), err)
 	}
 
-	log.Printf("[TRACE] writing to sqs: %v", params)
-	_, err := w.sqsClient.SendMessageWithContext(w.ctx, params)
 	return err
 }
 
+// logf logs a message at level to the Logger of the MessageWriter.
+func (w *MessageWriter) logf(level logger.Level, format string, args ...interface{}) {
+	l := w.logger
+	if l == nil {
+		l = logger.Default
+	}
+
+	l.Logf(level, format, args...)
+}
+
 // SetDelay sets a delay on the Message.
-// The delay must be between 0 and 900 seconds, according to the aws sdk.
+// The delay must be between 0 and 900 seconds, according to the aws sdk;
+// delays outside of that range are silently clamped to it, see
+// SetDelayStrict to reject them instead.
+// FIFO queues do not support delays on individual messages, so Close
+// returns ErrDelayNotSupported if a delay was set on one.
 func (w *MessageWriter) SetDelay(delay time.Duration) {
 	w.delaySeconds = int64(math.Min(math.Max(delay.Seconds(), 0), 900))
 }
 
+// SetDelayStrict sets a delay on the Message like SetDelay, but returns an
+// error matching ErrDelayOutOfRange, leaving the delay unchanged, when it is
+// not between 0 and 900 seconds, so that a message meant to be delivered
+// later is not delivered early without notice.
+func (w *MessageWriter) SetDelayStrict(delay time.Duration) error {
+	if delay < 0 || delay > maxDelay {
+		return fmt.Errorf("cannot set delay %s: %w", delay, ErrDelayOutOfRange)
+	}
+
+	w.SetDelay(delay)
+
+	return nil
+}
+
+// SetMessageGroupID sets the MessageGroupId of a message sent to a FIFO
+// queue, which is required. Messages of the same group are delivered in the
+// order they were sent. It is ignored by standard queues.
+func (w *MessageWriter) SetMessageGroupID(id string) {
+	w.groupID = id
+}
+
+// SetDeduplicationID sets the MessageDeduplicationId of a message sent to a
+// FIFO queue: messages sent with the same ID within 5 minutes are only
+// delivered once. It is required unless content-based deduplication is
+// enabled on the queue. It is ignored by standard queues.
+func (w *MessageWriter) SetDeduplicationID(id string) {
+	w.deduplicationID = id
+}
+
+// MaxMessageSize is the maximum size, in bytes, of the body and attributes
+// of an SQS message.
+const MaxMessageSize = 256 * 1024
+
+// messageSize returns the size of a message as counted by SQS against
+// MaxMessageSize: the size of its body, and of the name, data type and
+// value of each of its attributes.
+func messageSize(params *sqs.SendMessageInput) int {
+	size := len(aws.StringValue(params.MessageBody))
+	for name, v := range params.MessageAttributes {
+		size += len(name) + len(aws.StringValue(v.DataType)) + len(aws.StringValue(v.StringValue)) + len(v.BinaryValue)
+	}
+
+	return size
+}
+
+// contentDeduplicationID returns the hex-encoded SHA-256 of body and attrs,
+// whose keys are sorted so that the ID does not depend on their order.
+func contentDeduplicationID(body []byte, attrs msg.Attributes) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	h.Write(body)
+	for _, k := range keys {
+		fmt.Fprintf(h, "\x00%s=%s", k, strings.Join(attrs[k], ","))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // buildSNSAttributes converts msg.Attributes into SQS message attributes.
 // uses csv encoding to use AWS's String datatype
 func buildSQSAttributes(a *msg.Attributes) map[string]*sqs.MessageAttributeValue {
@@ -1,8 +1,13 @@
 package sqs
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	msg "github.com/hdtradeservices/go-msg"
 )
 
 func TestSetDelay(t *testing.T) {
@@ -28,3 +33,219 @@ func TestSetDelay(t *testing.T) {
 		})
 	}
 }
+
+// Tests that messages sent to a FIFO queue carry their group and
+// deduplication IDs, and are rejected without a group or with a delay.
+func TestMessageWriter_FIFO(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs.fifo", Svc: mockSQS}
+
+	w := topic.NewWriter(context.Background()).(*MessageWriter)
+	w.SetMessageGroupID("tenant-1")
+	w.SetDeduplicationID("order-42")
+	w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	sent := mockSQS.sent[0]
+	if aws.StringValue(sent.MessageGroupId) != "tenant-1" || aws.StringValue(sent.MessageDeduplicationId) != "order-42" {
+		t.Errorf("Unexpected group %v and deduplication %v IDs", sent.MessageGroupId, sent.MessageDeduplicationId)
+	}
+	if sent.DelaySeconds != nil {
+		t.Errorf("Expected no delay to be sent, got %d", aws.Int64Value(sent.DelaySeconds))
+	}
+
+	w = topic.NewWriter(context.Background()).(*MessageWriter)
+	if err := w.Close(); !errors.Is(err, ErrMissingMessageGroupID) {
+		t.Errorf("Expected ErrMissingMessageGroupID, got %v", err)
+	}
+
+	w = topic.NewWriter(context.Background()).(*MessageWriter)
+	w.SetMessageGroupID("tenant-1")
+	w.SetDelay(time.Minute)
+	if err := w.Close(); !errors.Is(err, ErrDelayNotSupported) {
+		t.Errorf("Expected ErrDelayNotSupported, got %v", err)
+	}
+
+	if len(mockSQS.sent) != 1 {
+		t.Errorf("Expected 1 message to be sent, got %d", len(mockSQS.sent))
+	}
+}
+
+// Tests that WithTopicContentDeduplication derives the deduplication ID
+// from the body and attributes, unless it is set explicitly.
+func TestTopic_WithTopicContentDeduplication(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs.fifo", Svc: mockSQS}
+	if err := WithTopicContentDeduplication()(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	send := func(body, tenant, dedupID string) string {
+		w := topic.NewWriter(context.Background()).(*MessageWriter)
+		w.SetMessageGroupID("group")
+		w.SetDeduplicationID(dedupID)
+		w.Attributes().Set("Tenant", tenant)
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+
+		return aws.StringValue(mockSQS.sent[len(mockSQS.sent)-1].MessageDeduplicationId)
+	}
+
+	id := send("hello", "acme", "")
+	if len(id) != 64 {
+		t.Errorf("Expected a SHA-256 deduplication ID, got %q", id)
+	}
+	if send("hello", "acme", "") != id {
+		t.Errorf("Expected identical messages to have the same deduplication ID")
+	}
+	if send("hello", "globex", "") == id || send("bye", "acme", "") == id {
+		t.Errorf("Expected different messages to have different deduplication IDs")
+	}
+	if got := send("hello", "acme", "explicit"); got != "explicit" {
+		t.Errorf("Expected the explicit deduplication ID to be kept, got %q", got)
+	}
+}
+
+// Tests that MessageWriter.Close rejects messages larger than
+// MaxMessageSize, counting their attributes, without sending them.
+func TestMessageWriter_MessageTooLarge(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: mockSQS}
+
+	send := func(bodySize int) error {
+		w := topic.NewWriter(context.Background())
+		w.Attributes().Set("Tenant", "acme") // 6 + 6 + 4 bytes
+		w.Write(make([]byte, bodySize))
+		return w.Close()
+	}
+
+	if err := send(MaxMessageSize - 16); err != nil {
+		t.Errorf("Expected a message of the maximum size to be sent, got %v", err)
+	}
+
+	err := send(MaxMessageSize - 15)
+	var tooLarge *MessageTooLargeError
+	if !errors.Is(err, ErrMessageTooLarge) || !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected a MessageTooLargeError, got %v", err)
+	}
+	if tooLarge.Size != MaxMessageSize+1 || tooLarge.MaxSize != MaxMessageSize {
+		t.Errorf("Unexpected sizes in %v", tooLarge)
+	}
+
+	if len(mockSQS.sent) != 1 {
+		t.Errorf("Expected 1 message to be sent, got %d", len(mockSQS.sent))
+	}
+}
+
+// Tests that the buffers of closed MessageWriters are reused without
+// leaking the body of a previous message, or changing the bodies already
+// sent, which the SQSAPI may keep.
+func TestMessageWriter_ReusesBuffers(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: mockSQS}
+
+	for _, body := range []string{"a longer first message", "short"} {
+		w := topic.NewWriter(context.Background())
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+
+		if _, err := w.Write([]byte(body)); err != msg.ErrClosedMessageWriter {
+			t.Errorf("Expected ErrClosedMessageWriter, got %v", err)
+		}
+	}
+
+	for i, want := range []string{"a longer first message", "short"} {
+		if got := aws.StringValue(mockSQS.sent[i].MessageBody); got != want {
+			t.Errorf("Expected body %q, got %q", want, got)
+		}
+		if mockSQS.sent[i].MessageAttributes != nil {
+			t.Errorf("Expected no attributes, got %v", mockSQS.sent[i].MessageAttributes)
+		}
+	}
+}
+
+// Tests that WithTopicDefaultAttributes sets the default attributes on
+// every message, unless they are overridden.
+func TestTopic_WithTopicDefaultAttributes(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: mockSQS}
+	defaults := map[string][]string{"service": {"billing"}, "Schema-Version": {"2"}}
+	if err := WithTopicDefaultAttributes(defaults)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for _, service := range []string{"", "shipping"} {
+		w := topic.NewWriter(context.Background())
+		if service != "" {
+			w.Attributes().Set("Service", service)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	for i, want := range []string{"billing", "shipping"} {
+		attrs := mockSQS.sent[i].MessageAttributes
+		if v := aws.StringValue(attrs["Service"].StringValue); v != want {
+			t.Errorf("Expected attribute Service to be %q, got %q", want, v)
+		}
+		if v := aws.StringValue(attrs["Schema-Version"].StringValue); v != "2" {
+			t.Errorf("Expected attribute Schema-Version to be %q, got %q", "2", v)
+		}
+	}
+}
+
+// Tests that WithTopicDefaultDelay delays every message, unless another
+// delay is set with SetDelay.
+func TestTopic_WithTopicDefaultDelay(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: mockSQS}
+	if err := WithTopicDefaultDelay(5 * time.Minute)(topic); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	w := topic.NewWriter(context.Background())
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	w = topic.NewWriter(context.Background())
+	w.(*MessageWriter).SetDelay(0)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for i, want := range []int64{300, 0} {
+		if d := aws.Int64Value(mockSQS.sent[i].DelaySeconds); d != want {
+			t.Errorf("Expected a delay of %d seconds, got %d", want, d)
+		}
+	}
+
+	for _, d := range []time.Duration{-time.Second, 901 * time.Second} {
+		if err := WithTopicDefaultDelay(d)(topic); err == nil {
+			t.Errorf("Expected error for delay %s, received nil", d)
+		}
+	}
+}
+
+func TestSetDelayStrict(t *testing.T) {
+	w := &MessageWriter{}
+	if err := w.SetDelayStrict(900 * time.Second); err != nil || w.delaySeconds != 900 {
+		t.Fatalf("Expected delay to be set to 900, got %d (%v)", w.delaySeconds, err)
+	}
+
+	for _, d := range []time.Duration{-time.Second, 14*time.Minute + 61*time.Second} {
+		if err := w.SetDelayStrict(d); !errors.Is(err, ErrDelayOutOfRange) {
+			t.Errorf("Expected ErrDelayOutOfRange for delay %s, got %v", d, err)
+		}
+		if w.delaySeconds != 900 {
+			t.Errorf("Expected delay to be left unchanged, got %d", w.delaySeconds)
+		}
+	}
+}
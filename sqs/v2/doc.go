@@ -0,0 +1,9 @@
+// Package sqs implements msg.Server and msg.Topic for Amazon SQS on top of
+// the AWS SDK for Go v2.
+//
+// It is a separate module from github.com/hdtradeservices/go-aws-msg/sqs,
+// which is built on the AWS SDK for Go v1, and offers the same msg.Server
+// and msg.Topic surface: a Server created with NewServer receives messages
+// from a queue, deletes them once they were processed successfully, and
+// makes them visible again after retryTimeout seconds otherwise.
+package sqs
@@ -0,0 +1,85 @@
+package sqs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// mockSQSAPI is a fake SQS client serving the messages of Queue, and
+// recording the messages deleted, requeued and sent.
+type mockSQSAPI struct {
+	mux      sync.Mutex
+	Queue    []types.Message
+	deleted  []string // receipt handles of deleted messages
+	requeued []string // receipt handles of messages whose visibility changed
+	sent     []*sqs.SendMessageInput
+	total    int           // number of messages initially in Queue
+	done     chan struct{} // closed once every message of Queue was deleted or requeued
+}
+
+func newMockSQSAPI(bodies ...string) *mockSQSAPI {
+	m := &mockSQSAPI{done: make(chan struct{}), total: len(bodies)}
+	for i, b := range bodies {
+		m.Queue = append(m.Queue, types.Message{
+			Body:              aws.String(b),
+			ReceiptHandle:     aws.String(b),
+			MessageAttributes: map[string]types.MessageAttributeValue{"Index": {DataType: aws.String("String"), StringValue: aws.String(string(rune('0' + i)))}},
+		})
+	}
+	return m
+}
+
+func (m *mockSQSAPI) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	m.mux.Lock()
+	n := int(params.MaxNumberOfMessages)
+	if n > len(m.Queue) {
+		n = len(m.Queue)
+	}
+	messages := m.Queue[:n]
+	m.Queue = m.Queue[n:]
+	m.mux.Unlock()
+
+	if len(messages) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (m *mockSQSAPI) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.deleted = append(m.deleted, aws.ToString(params.ReceiptHandle))
+	m.settled()
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (m *mockSQSAPI) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.requeued = append(m.requeued, aws.ToString(params.ReceiptHandle))
+	m.settled()
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (m *mockSQSAPI) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.sent = append(m.sent, params)
+	return &sqs.SendMessageOutput{MessageId: aws.String("sent")}, nil
+}
+
+// settled closes done once every message was deleted or requeued.
+// It must be called with mux held.
+func (m *mockSQSAPI) settled() {
+	if len(m.deleted)+len(m.requeued) == m.total {
+		close(m.done)
+	}
+}
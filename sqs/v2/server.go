@@ -0,0 +1,263 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+const (
+	defaultMaxMessages     = 10
+	defaultWaitTimeSeconds = 20
+)
+
+// ReceiveAPI is the subset of the SQS client used by a Server.
+type ReceiveAPI interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Server represents a msg.Server for receiving messages
+// from an AWS SQS Queue.
+type Server struct {
+	// AWS QueueURL
+	QueueURL string
+	// Concrete instance of the SQS client
+	Svc ReceiveAPI
+
+	maxConcurrentReceives chan struct{} // The maximum number of message processing routines allowed
+	retryTimeout          int32         // Visibility Timeout for a message when a receiver fails
+	maxMessages           int32         // Maximum number of messages received at once
+	waitTimeSeconds       int32         // Long polling wait time of ReceiveMessage calls
+
+	receiverCtx        context.Context    // context used to control the life of receivers
+	receiverCancelFunc context.CancelFunc // CancelFunc for all receiver routines
+	serverCtx          context.Context    // context used to control the life of the Server
+	serverCancelFunc   context.CancelFunc // CancelFunc to signal the server should stop requesting messages
+	routines           sync.WaitGroup     // running receivers
+}
+
+// Option is the signature that modifies a `Server` to set some configuration
+type Option func(*Server) error
+
+// NewServer creates and initializes a new Server using queueURL to a SQS
+// queue. `cl` represents the number of concurrent message receives (10
+// messages with 1 concurrency means 1 message processed at a time), and
+// `retryTimeout` is the visibility timeout, in seconds, of messages whose
+// processing failed.
+//
+// The SQS client is created from the shared AWS configuration, loaded with
+// config.LoadDefaultConfig, unless WithClient or WithConfig is passed.
+func NewServer(queueURL string, cl int, retryTimeout int32, opts ...Option) (msg.Server, error) {
+	// It makes no sense to have a concurrency of less than 1.
+	if cl < 1 {
+		log.Printf("[WARN] Requesting concurrency of %d, this makes no sense, setting to 1", cl)
+		cl = 1
+	}
+
+	serverCtx, serverCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	srv := &Server{
+		QueueURL:              queueURL,
+		maxConcurrentReceives: make(chan struct{}, cl),
+		retryTimeout:          retryTimeout,
+		maxMessages:           defaultMaxMessages,
+		waitTimeSeconds:       defaultWaitTimeSeconds,
+		serverCtx:             serverCtx,
+		serverCancelFunc:      serverCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+	}
+
+	for _, opt := range opts {
+		if err := opt(srv); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	if srv.Svc == nil {
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		srv.Svc = sqs.NewFromConfig(cfg)
+	}
+
+	return srv, nil
+}
+
+// WithClient makes the `Server` use `svc` instead of the SQS client created
+// from the shared AWS configuration, e.g. to share a client configured by
+// the application, or to use a fake in tests.
+func WithClient(svc ReceiveAPI) Option {
+	return func(s *Server) error {
+		if svc == nil {
+			return errors.New("client must not be nil")
+		}
+
+		s.Svc = svc
+
+		return nil
+	}
+}
+
+// WithConfig makes the `Server` create its SQS client from `cfg`, e.g.
+// loaded by the application with config.LoadDefaultConfig and a region or
+// profile of its own. `optFns` customize the SQS client only.
+func WithConfig(cfg aws.Config, optFns ...func(*sqs.Options)) Option {
+	return func(s *Server) error {
+		s.Svc = sqs.NewFromConfig(cfg, optFns...)
+
+		return nil
+	}
+}
+
+// WithMaxMessages sets the maximum number of messages received by each
+// ReceiveMessage call, between 1 and 10.
+func WithMaxMessages(n int32) Option {
+	return func(s *Server) error {
+		if n < 1 || n > 10 {
+			return fmt.Errorf("invalid max messages: %d. Must be between 1 and 10", n)
+		}
+
+		s.maxMessages = n
+
+		return nil
+	}
+}
+
+// WithWaitTimeSeconds sets the long polling wait time of ReceiveMessage
+// calls, between 0 and 20 seconds.
+func WithWaitTimeSeconds(seconds int32) Option {
+	return func(s *Server) error {
+		if seconds < 0 || seconds > 20 {
+			return fmt.Errorf("invalid wait time: %d. Must be between 0 and 20", seconds)
+		}
+
+		s.waitTimeSeconds = seconds
+
+		return nil
+	}
+}
+
+// Serve continuously receives messages from an SQS queue, creates a message,
+// and calls Receive on `r`. Serve is blocking and will not return until
+// Shutdown is called on the Server, in which case msg.ErrServerClosed is
+// returned, or a ReceiveMessage call fails.
+func (s *Server) Serve(ctx context.Context, r msg.Receiver) error {
+	s.routines.Add(1)
+	defer s.routines.Done()
+
+	for {
+		if s.serverCtx.Err() != nil {
+			return msg.ErrServerClosed
+		}
+
+		resp, err := s.Svc.ReceiveMessage(s.serverCtx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(s.QueueURL),
+			MaxNumberOfMessages:         s.maxMessages,
+			WaitTimeSeconds:             s.waitTimeSeconds,
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+			MessageAttributeNames:       []string{"All"},
+		})
+		if err != nil {
+			if s.serverCtx.Err() != nil {
+				return msg.ErrServerClosed
+			}
+			return err
+		}
+
+		for _, m := range resp.Messages {
+			s.dispatch(r, m)
+		}
+	}
+}
+
+// dispatch processes `sqsMsg` with `r` in a new routine, once fewer than
+// the maximum number of concurrent receives are running.
+func (s *Server) dispatch(r msg.Receiver, sqsMsg types.Message) {
+	s.maxConcurrentReceives <- struct{}{}
+	s.routines.Add(1)
+
+	go func() {
+		defer func() {
+			<-s.maxConcurrentReceives
+			s.routines.Done()
+		}()
+
+		s.handleMessage(r, sqsMsg)
+	}()
+}
+
+// handleMessage calls `r` with `sqsMsg`, then deletes it if it was processed
+// successfully, or changes its visibility timeout to retryTimeout otherwise.
+func (s *Server) handleMessage(r msg.Receiver, sqsMsg types.Message) {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       strings.NewReader(aws.ToString(sqsMsg.Body)),
+	}
+	for k, v := range sqsMsg.Attributes {
+		m.Attributes.Set(k, v)
+	}
+	for k, v := range sqsMsg.MessageAttributes {
+		m.Attributes.Set(k, aws.ToString(v.StringValue))
+	}
+
+	if err := r.Receive(s.receiverCtx, m); err != nil {
+		log.Printf("[ERROR] Receiver error: %s; will retry after visibility timeout", err)
+
+		if _, err := s.Svc.ChangeMessageVisibility(context.Background(), &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(s.QueueURL),
+			ReceiptHandle:     sqsMsg.ReceiptHandle,
+			VisibilityTimeout: s.retryTimeout,
+		}); err != nil {
+			log.Printf("[ERROR] cannot change message visibility %s", err)
+		}
+
+		return
+	}
+
+	if _, err := s.Svc.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(s.QueueURL),
+		ReceiptHandle: sqsMsg.ReceiptHandle,
+	}); err != nil {
+		log.Printf("[ERROR] Delete message: %s", err)
+	}
+}
+
+// Shutdown stops the receipt of new messages and waits for routines
+// to complete or the passed in ctx to be canceled. msg.ErrServerClosed
+// will be returned upon a clean shutdown. Otherwise, the passed ctx's
+// Error will be returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("context not set")
+	}
+
+	s.serverCancelFunc()
+
+	done := make(chan struct{})
+	go func() {
+		s.routines.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return msg.ErrServerClosed
+	case <-ctx.Done():
+		s.receiverCancelFunc()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,87 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that the Server deletes the messages processed successfully and
+// requeues the others, then shuts down cleanly.
+func TestServer_ServeAndShutdown(t *testing.T) {
+	mockSQS := newMockSQSAPI("ok 1", "fail", "ok 2")
+	srv, err := NewServer("https://sqs.us-west-2.amazonaws.com/123456789012/jobs", 2, 30, WithClient(mockSQS))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var mux sync.Mutex
+	indexes := map[string]string{}
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, err := ioutil.ReadAll(m.Body)
+		if err != nil {
+			return err
+		}
+
+		mux.Lock()
+		indexes[string(body)] = m.Attributes.Get("Index")
+		mux.Unlock()
+
+		if string(body) == "fail" {
+			return errors.New("cannot process message")
+		}
+		return nil
+	})
+
+	serveErr := make(chan error)
+	go func() { serveErr <- srv.Serve(context.Background(), r) }()
+
+	select {
+	case <-mockSQS.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for messages to be processed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != msg.ErrServerClosed {
+		t.Errorf("Expected msg.ErrServerClosed from Shutdown, got %v", err)
+	}
+	if err := <-serveErr; err != msg.ErrServerClosed {
+		t.Errorf("Expected msg.ErrServerClosed from Serve, got %v", err)
+	}
+
+	sort.Strings(mockSQS.deleted)
+	if len(mockSQS.deleted) != 2 || mockSQS.deleted[0] != "ok 1" || mockSQS.deleted[1] != "ok 2" {
+		t.Errorf("Expected the successful messages to be deleted, got %v", mockSQS.deleted)
+	}
+	if len(mockSQS.requeued) != 1 || mockSQS.requeued[0] != "fail" {
+		t.Errorf("Expected the failed message to be requeued, got %v", mockSQS.requeued)
+	}
+	if indexes["ok 2"] != "2" {
+		t.Errorf("Expected message attributes to be set, got %v", indexes)
+	}
+}
+
+func TestNewServer_InvalidOptions(t *testing.T) {
+	mockSQS := newMockSQSAPI()
+
+	cases := map[string]Option{
+		"nil client":        WithClient(nil),
+		"max messages":      WithMaxMessages(11),
+		"wait time seconds": WithWaitTimeSeconds(21),
+	}
+	for name, opt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewServer("https://myqueue.com", 1, 30, WithClient(mockSQS), opt); err == nil {
+				t.Errorf("Expected error, received nil")
+			}
+		})
+	}
+}
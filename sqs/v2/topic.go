@@ -0,0 +1,199 @@
+package sqs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// SendAPI is the subset of the SQS client used by a Topic.
+type SendAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// Topic configures and manages the SQS client for sqs.MessageWriter
+type Topic struct {
+	QueueURL string
+	Svc      SendAPI
+}
+
+// TopicOption is the signature that modifies a `Topic` to set some configuration
+type TopicOption func(*Topic) error
+
+// NewTopic returns an sqs.Topic publishing to the queue at queueURL.
+//
+// The SQS client is created from the shared AWS configuration, loaded with
+// config.LoadDefaultConfig, unless WithTopicClient or WithTopicConfig is
+// passed.
+func NewTopic(queueURL string, opts ...TopicOption) (msg.Topic, error) {
+	t := &Topic{QueueURL: queueURL}
+
+	for _, opt := range opts {
+		if err := opt(t); err != nil {
+			return nil, fmt.Errorf("cannot set option: %s", err)
+		}
+	}
+
+	if t.Svc == nil {
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		t.Svc = sqs.NewFromConfig(cfg)
+	}
+
+	return t, nil
+}
+
+// WithTopicClient makes the `Topic` use `svc` instead of the SQS client
+// created from the shared AWS configuration, e.g. to share a client
+// configured by the application, or to use a fake in tests.
+func WithTopicClient(svc SendAPI) TopicOption {
+	return func(t *Topic) error {
+		if svc == nil {
+			return errors.New("client must not be nil")
+		}
+
+		t.Svc = svc
+
+		return nil
+	}
+}
+
+// WithTopicConfig makes the `Topic` create its SQS client from `cfg`.
+// `optFns` customize the SQS client only.
+func WithTopicConfig(cfg aws.Config, optFns ...func(*sqs.Options)) TopicOption {
+	return func(t *Topic) error {
+		t.Svc = sqs.NewFromConfig(cfg, optFns...)
+
+		return nil
+	}
+}
+
+// NewWriter returns a new sqs.MessageWriter
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+		ctx:        ctx,
+		queueURL:   t.QueueURL,
+		sqsClient:  t.Svc,
+	}
+}
+
+// MessageWriter writes data to a SQS Queue.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	attributes msg.Attributes
+	buf        *bytes.Buffer
+	ctx        context.Context
+	closed     bool
+	mux        sync.Mutex
+
+	// delaySeconds is a length of time to delay the SQS message.
+	delaySeconds int32
+
+	// groupID and deduplicationID are the MessageGroupId and
+	// MessageDeduplicationId of a message sent to a FIFO queue.
+	groupID         string
+	deduplicationID string
+
+	// sqsClient is the SQS interface
+	sqsClient SendAPI
+
+	// queueURL is the URL to the queue.
+	queueURL string
+}
+
+// Attributes returns the msg.Attributes associated with the MessageWriter
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// Write writes data to the MessageWriter's internal buffer.
+//
+// Once a MessageWriter is closed, it cannot be used again.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
+
+// Close converts it's buffered data and attributes to an SQS message
+// and publishes it to a queue.
+//
+// Once a MessageWriter is closed, it cannot be used again.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	params := &sqs.SendMessageInput{
+		MessageBody:  aws.String(w.buf.String()),
+		QueueUrl:     aws.String(w.queueURL),
+		DelaySeconds: w.delaySeconds,
+	}
+	if w.groupID != "" {
+		params.MessageGroupId = aws.String(w.groupID)
+	}
+	if w.deduplicationID != "" {
+		params.MessageDeduplicationId = aws.String(w.deduplicationID)
+	}
+
+	if len(w.attributes) > 0 {
+		params.MessageAttributes = buildSQSAttributes(&w.attributes)
+	}
+
+	_, err := w.sqsClient.SendMessage(w.ctx, params)
+	return err
+}
+
+// SetDelay allows setting a delay on the message, up to 15 minutes.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.delaySeconds = int32(delay.Seconds())
+}
+
+// SetMessageGroupID sets the MessageGroupId of the message, required
+// when publishing to a FIFO queue.
+func (w *MessageWriter) SetMessageGroupID(id string) {
+	w.groupID = id
+}
+
+// SetDeduplicationID sets the MessageDeduplicationId of the message
+// published to a FIFO queue.
+func (w *MessageWriter) SetDeduplicationID(id string) {
+	w.deduplicationID = id
+}
+
+// buildSQSAttributes converts msg.Attributes into SQS message attributes.
+// Multiple values of an attribute are joined by commas.
+func buildSQSAttributes(a *msg.Attributes) map[string]types.MessageAttributeValue {
+	attrs := make(map[string]types.MessageAttributeValue)
+
+	for k, v := range *a {
+		attrs[k] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(strings.Join(v, ",")),
+		}
+	}
+	return attrs
+}
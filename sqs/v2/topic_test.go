@@ -0,0 +1,53 @@
+package sqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that MessageWriter.Close sends the body, attributes and settings
+// of the message.
+func TestMessageWriter_Close(t *testing.T) {
+	mockSQS := newMockSQSAPI()
+	topic, err := NewTopic("https://sqs.us-west-2.amazonaws.com/123456789012/jobs.fifo", WithTopicClient(mockSQS))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	w := topic.NewWriter(context.Background())
+	w.Attributes().Set("Tenant", "acme")
+	w.(*MessageWriter).SetMessageGroupID("group")
+	w.(*MessageWriter).SetDeduplicationID("dedup")
+	w.(*MessageWriter).SetDelay(time.Minute)
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if len(mockSQS.sent) != 1 {
+		t.Fatalf("Expected 1 message to be sent, got %d", len(mockSQS.sent))
+	}
+	in := mockSQS.sent[0]
+	if aws.ToString(in.MessageBody) != "hello" || aws.ToString(in.QueueUrl) != "https://sqs.us-west-2.amazonaws.com/123456789012/jobs.fifo" {
+		t.Errorf("Unexpected body or queue: %s, %s", aws.ToString(in.MessageBody), aws.ToString(in.QueueUrl))
+	}
+	if aws.ToString(in.MessageAttributes["Tenant"].StringValue) != "acme" {
+		t.Errorf("Expected attribute Tenant to be acme, got %v", in.MessageAttributes)
+	}
+	if aws.ToString(in.MessageGroupId) != "group" || aws.ToString(in.MessageDeduplicationId) != "dedup" || in.DelaySeconds != 60 {
+		t.Errorf("Unexpected FIFO settings or delay: %v", in)
+	}
+
+	if _, err := w.Write([]byte("again")); err != msg.ErrClosedMessageWriter {
+		t.Errorf("Expected msg.ErrClosedMessageWriter from Write, got %v", err)
+	}
+	if err := w.Close(); err != msg.ErrClosedMessageWriter {
+		t.Errorf("Expected msg.ErrClosedMessageWriter from Close, got %v", err)
+	}
+}
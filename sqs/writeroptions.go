@@ -0,0 +1,119 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hdtradeservices/go-aws-msg/internal/unwrap"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// WriterOption is the signature that modifies a MessageWriter created by
+// NewWriterWithOptions.
+type WriterOption func(*MessageWriter) error
+
+// WithWriterDelay delays the delivery of the message by `delay`, see
+// MessageWriter.SetDelayStrict: delays which are not between 0 and 900
+// seconds are rejected, rather than clamped.
+func WithWriterDelay(delay time.Duration) WriterOption {
+	return func(w *MessageWriter) error {
+		return w.SetDelayStrict(delay)
+	}
+}
+
+// WithWriterDeliverAt schedules the delivery of the message at `t`, see
+// MessageWriter.SetDeliverAt.
+func WithWriterDeliverAt(t time.Time) WriterOption {
+	return func(w *MessageWriter) error {
+		w.SetDeliverAt(t)
+
+		return nil
+	}
+}
+
+// WithWriterExpiresAt makes the message expire at `t`, see
+// MessageWriter.SetExpiresAt.
+func WithWriterExpiresAt(t time.Time) WriterOption {
+	return func(w *MessageWriter) error {
+		w.SetExpiresAt(t)
+
+		return nil
+	}
+}
+
+// WithWriterMessageGroupID sets the MessageGroupId of a message sent to a
+// FIFO queue, see MessageWriter.SetMessageGroupID.
+func WithWriterMessageGroupID(id string) WriterOption {
+	return func(w *MessageWriter) error {
+		w.SetMessageGroupID(id)
+
+		return nil
+	}
+}
+
+// WithWriterDeduplicationID sets the MessageDeduplicationId of a message
+// sent to a FIFO queue, see MessageWriter.SetDeduplicationID.
+func WithWriterDeduplicationID(id string) WriterOption {
+	return func(w *MessageWriter) error {
+		w.SetDeduplicationID(id)
+
+		return nil
+	}
+}
+
+// WithWriterAttributes sets the initial attributes of the message to a copy
+// of `attrs`. They can still be changed through MessageWriter.Attributes.
+func WithWriterAttributes(attrs msg.Attributes) WriterOption {
+	return func(w *MessageWriter) error {
+		copyAttributes(*w.Attributes(), attrs)
+
+		return nil
+	}
+}
+
+// WithWriterTraceHeader sets the AWSTraceHeader system attribute of the
+// message, see MessageWriter.SetTraceHeader.
+func WithWriterTraceHeader(header string) WriterOption {
+	return func(w *MessageWriter) error {
+		w.SetTraceHeader(header)
+
+		return nil
+	}
+}
+
+// NewWriterWithOptions returns a new MessageWriter of `t` configured by
+// `opts`, so that callers holding a msg.Topic, e.g. returned by NewTopic,
+// can set the delay, FIFO IDs and attributes of a message without asserting
+// the type of its writer.
+//
+// `t` must be a Topic, or a msg.Topic whose writers wrap the writers of a
+// Topic and return them from an Unwrap method. An error is returned
+// otherwise, or if an option cannot be set.
+func NewWriterWithOptions(ctx context.Context, t msg.Topic, opts ...WriterOption) (msg.MessageWriter, error) {
+	w := t.NewWriter(ctx)
+
+	mw, ok := unwrapWriter(w)
+	if !ok {
+		return nil, fmt.Errorf("unsupported MessageWriter %T", w)
+	}
+
+	for _, opt := range opts {
+		if err := opt(mw); err != nil {
+			mw.discard()
+			return nil, fmt.Errorf("cannot set option: %w", err)
+		}
+	}
+
+	return w, nil
+}
+
+// unwrapWriter returns the *MessageWriter `w` is, or wraps.
+func unwrapWriter(w msg.MessageWriter) (*MessageWriter, bool) {
+	mw, ok := unwrap.Find(w, func(w msg.MessageWriter) bool {
+		_, ok := w.(*MessageWriter)
+		return ok
+	}).(*MessageWriter)
+
+	return mw, ok
+}
@@ -0,0 +1,97 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Tests that the options passed to NewWriterWithOptions are applied to the
+// message sent.
+func TestNewWriterWithOptions(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: mockSQS}
+
+	attrs := msg.Attributes{}
+	attrs.Set("Service", "billing")
+
+	w, err := NewWriterWithOptions(context.Background(), topic,
+		WithWriterDelay(time.Minute),
+		WithWriterAttributes(attrs),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	w.Attributes().Set("Event", "created")
+	w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	sent := mockSQS.sent[0]
+	if d := aws.Int64Value(sent.DelaySeconds); d != 60 {
+		t.Errorf("Expected a delay of 60 seconds, got %d", d)
+	}
+	for name, want := range map[string]string{"Service": "billing", "Event": "created"} {
+		if v := sent.MessageAttributes[name]; v == nil || aws.StringValue(v.StringValue) != want {
+			t.Errorf("Expected attribute %s to be %q, got %v", name, want, v)
+		}
+	}
+	if len(attrs) != 1 {
+		t.Errorf("Expected the attributes passed to be left unchanged, got %v", attrs)
+	}
+
+	fifo := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs.fifo", Svc: mockSQS}
+	w, err = NewWriterWithOptions(context.Background(), fifo,
+		WithWriterMessageGroupID("tenant-1"),
+		WithWriterDeduplicationID("order-42"),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	sent = mockSQS.sent[1]
+	if aws.StringValue(sent.MessageGroupId) != "tenant-1" || aws.StringValue(sent.MessageDeduplicationId) != "order-42" {
+		t.Errorf("Unexpected group %v and deduplication %v IDs", sent.MessageGroupId, sent.MessageDeduplicationId)
+	}
+}
+
+// Tests that NewWriterWithOptions rejects out-of-range delays and writers
+// it cannot configure.
+func TestNewWriterWithOptions_Errors(t *testing.T) {
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/jobs", Svc: newMockSQSAPI(newSQSMessages(0), t)}
+	for _, d := range []time.Duration{-time.Second, 901 * time.Second} {
+		if _, err := NewWriterWithOptions(context.Background(), topic, WithWriterDelay(d)); !errors.Is(err, ErrDelayOutOfRange) {
+			t.Errorf("Expected ErrDelayOutOfRange for delay %s, got %v", d, err)
+		}
+	}
+
+	var w msg.MessageWriter
+	spy := msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		w = topic.NewWriter(ctx)
+		return w
+	})
+	if _, err := NewWriterWithOptions(context.Background(), spy, WithWriterDelay(-time.Second)); err == nil {
+		t.Fatalf("Expected error, received nil")
+	}
+	if mw := w.(*MessageWriter); mw.buf != nil {
+		t.Errorf("Expected the buffer of the discarded writer to be put back")
+	}
+	if err := w.Close(); err != msg.ErrClosedMessageWriter {
+		t.Errorf("Expected the discarded writer to be closed, got %v", err)
+	}
+
+	other := msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &struct{ msg.MessageWriter }{}
+	})
+	if _, err := NewWriterWithOptions(context.Background(), other); err == nil {
+		t.Errorf("Expected error, received nil")
+	}
+}
@@ -0,0 +1,89 @@
+package sqs
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// traceHeaderKey is the context key of X-Ray trace headers.
+type traceHeaderKey struct{}
+
+// ContextWithTraceHeader returns a copy of ctx carrying the X-Ray trace
+// header, e.g. "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1".
+//
+// MessageWriters created with such a context send the header as the
+// AWSTraceHeader system attribute of their message, so that the message
+// flow shows up in X-Ray service maps.
+func ContextWithTraceHeader(ctx context.Context, header string) context.Context {
+	return context.WithValue(ctx, traceHeaderKey{}, header)
+}
+
+// TraceHeaderFromContext returns the X-Ray trace header carried by ctx,
+// or "" if it has none.
+//
+// The context passed to Receive by a Server carries the AWSTraceHeader
+// system attribute of the message, if it was requested (see
+// WithSystemAttributes), so that a receiver publishing messages with
+// this context propagates the trace.
+func TraceHeaderFromContext(ctx context.Context) string {
+	header, _ := ctx.Value(traceHeaderKey{}).(string)
+
+	return header
+}
+
+// contextWithMessageTraceHeader returns a copy of ctx carrying the X-Ray
+// trace header of sqsMsg, or ctx if it has none.
+func contextWithMessageTraceHeader(ctx context.Context, sqsMsg *sqs.Message) context.Context {
+	header := aws.StringValue(sqsMsg.Attributes[sqs.MessageSystemAttributeNameAwstraceHeader])
+	if header == "" {
+		return ctx
+	}
+
+	return ContextWithTraceHeader(ctx, header)
+}
+
+// SetSystemAttribute sets the message system attribute `name` of the
+// message, which SQS keeps apart from its message attributes. AWSTraceHeader
+// is the only one SQS supports when sending messages, see SetTraceHeader.
+func (w *MessageWriter) SetSystemAttribute(name, value string) {
+	if w.systemAttributes == nil {
+		w.systemAttributes = make(map[string]string)
+	}
+
+	w.systemAttributes[name] = value
+}
+
+// SetTraceHeader sets the AWSTraceHeader system attribute of the message to
+// the X-Ray trace header, instead of the one carried by the context of the
+// MessageWriter, see ContextWithTraceHeader.
+func (w *MessageWriter) SetTraceHeader(header string) {
+	w.SetSystemAttribute(sqs.MessageSystemAttributeNameForSendsAwstraceHeader, header)
+}
+
+// buildSystemAttributes returns the message system attributes of the
+// message: the X-Ray trace header carried by its context, overridden by
+// those set with SetSystemAttribute. It returns nil if there are none.
+func (w *MessageWriter) buildSystemAttributes() map[string]*sqs.MessageSystemAttributeValue {
+	attrs := make(map[string]*sqs.MessageSystemAttributeValue, len(w.systemAttributes)+1)
+
+	if header := TraceHeaderFromContext(w.ctx); header != "" {
+		attrs[sqs.MessageSystemAttributeNameForSendsAwstraceHeader] = &sqs.MessageSystemAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(header),
+		}
+	}
+	for name, value := range w.systemAttributes {
+		attrs[name] = &sqs.MessageSystemAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	return attrs
+}
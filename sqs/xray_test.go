@@ -0,0 +1,99 @@
+package sqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+const testTraceHeader = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+
+// Tests that the X-Ray trace header of a received message is passed to the
+// receiver context, and sent with the messages it publishes.
+func TestServer_PropagatesTraceHeader(t *testing.T) {
+	msgs := newSQSMessages(1)
+	(*msgs)[0].Attributes = map[string]*string{
+		sqs.MessageSystemAttributeNameAwstraceHeader: aws.String(testTraceHeader),
+	}
+	mockSQS := newMockSQSAPI(msgs, t)
+	srv := newMockServer(1, mockSQS)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/out", Svc: mockSQS}
+
+	headers := make(chan string, 1)
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		headers <- TraceHeaderFromContext(ctx)
+
+		w := topic.NewWriter(ctx)
+		w.Write([]byte("forwarded"))
+		return w.Close()
+	})
+
+	go srv.Serve(context.Background(), r)
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case h := <-headers:
+		if h != testTraceHeader {
+			t.Errorf("Expected trace header %s in the receiver context, got %q", testTraceHeader, h)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the message to be received")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mockSQS.WaitForAllDeletes(ctx); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	mockSQS.mux.Lock()
+	defer mockSQS.mux.Unlock()
+	if len(mockSQS.sent) != 1 {
+		t.Fatalf("Expected 1 message to be sent, got %d", len(mockSQS.sent))
+	}
+	attr := mockSQS.sent[0].MessageSystemAttributes[sqs.MessageSystemAttributeNameForSendsAwstraceHeader]
+	if attr == nil || aws.StringValue(attr.StringValue) != testTraceHeader {
+		t.Errorf("Expected the trace header to be sent, got %v", mockSQS.sent[0].MessageSystemAttributes)
+	}
+}
+
+// Tests that messages are sent without system attributes
+// when the context carries no trace header.
+func TestMessageWriter_WithoutTraceHeader(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/out", Svc: mockSQS}
+
+	w := topic.NewWriter(context.Background())
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if mockSQS.sent[0].MessageSystemAttributes != nil {
+		t.Errorf("Expected no system attributes, got %v", mockSQS.sent[0].MessageSystemAttributes)
+	}
+}
+
+// Tests that the trace header set on a MessageWriter is sent instead of the
+// one carried by its context.
+func TestMessageWriter_SetTraceHeader(t *testing.T) {
+	mockSQS := newMockSQSAPI(newSQSMessages(0), t)
+	topic := &Topic{QueueURL: "https://myqueue.com/000000000000/out", Svc: mockSQS}
+
+	ctx := ContextWithTraceHeader(context.Background(), "Root=1-context")
+	w, err := NewWriterWithOptions(ctx, topic, WithWriterTraceHeader("Root=1-explicit"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	attrs := mockSQS.sent[0].MessageSystemAttributes
+	if v := attrs[sqs.MessageSystemAttributeNameForSendsAwstraceHeader]; v == nil || aws.StringValue(v.StringValue) != "Root=1-explicit" {
+		t.Errorf("Expected the explicit trace header to be sent, got %v", attrs)
+	}
+}
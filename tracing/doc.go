@@ -0,0 +1,24 @@
+/*
+Package tracing provides decorators which trace the messages consumed by a
+Server and published by a Topic with OpenTelemetry, propagating the trace
+context through message attributes so that traces span SQS and SNS hops.
+
+Topic starts a producer span around each message sent, and injects its
+context in the attributes of the message. Receiver extracts the context from
+the attributes of received messages, and starts a consumer span around
+Receive which is available from the context passed to the receiver.
+
+Using the Topic:
+
+	topic, _ := sqs.NewTopic(queueURL)
+	topic = tracing.Topic(topic)
+
+Using the Receiver, with a Server:
+
+	srv, _ := sqs.NewServer(queueURL, 10, 30, sqs.WithMiddleware(tracing.Middleware()))
+
+Spans are created with the global TracerProvider, and the context is
+propagated in the W3C Trace Context format, unless configured otherwise
+with WithTracerProvider and WithPropagator.
+*/
+package tracing
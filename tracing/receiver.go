@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+
+	msg "github.com/hdtradeservices/go-msg"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Receiver wraps another msg.Receiver, extracting the trace context of the
+// message from its attributes and starting a consumer span around Receive.
+// The span is a child of the span which published the message, if any.
+func Receiver(next msg.Receiver, opts ...Option) msg.Receiver {
+	o := newOptions("msg.Receiver", opts)
+	tracer := o.tracer()
+
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		if m.Attributes != nil {
+			ctx = o.propagator.Extract(ctx, Carrier(m.Attributes))
+		}
+
+		ctx, span := tracer.Start(ctx, o.spanName,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", o.system),
+				attribute.String("messaging.operation", "process"),
+			),
+		)
+		defer span.End()
+
+		err := next.Receive(ctx, m)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return err
+	})
+}
+
+// Middleware returns a function wrapping receivers with Receiver,
+// to be used with sqs.WithMiddleware.
+func Middleware(opts ...Option) func(msg.Receiver) msg.Receiver {
+	return func(next msg.Receiver) msg.Receiver {
+		return Receiver(next, opts...)
+	}
+}
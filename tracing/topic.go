@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	msg "github.com/hdtradeservices/go-msg"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Topic wraps a msg.Topic, starting a producer span around the sending of
+// each message on Close, and injecting its context in the attributes of the
+// message. The span is a child of the span in the context passed to
+// NewWriter, if any.
+func Topic(next msg.Topic, opts ...Option) msg.Topic {
+	o := newOptions("msg.MessageWriter", opts)
+
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &tracingWriter{
+			MessageWriter: next.NewWriter(ctx),
+			ctx:           ctx,
+			options:       o,
+		}
+	})
+}
+
+// tracingWriter is the msg.MessageWriter of a tracing Topic.
+type tracingWriter struct {
+	msg.MessageWriter
+
+	ctx     context.Context
+	options *options
+}
+
+// Close starts a producer span, injects its context in the attributes of
+// the message and closes the wrapped MessageWriter.
+func (w *tracingWriter) Close() error {
+	ctx, span := w.options.tracer().Start(w.ctx, w.options.spanName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", w.options.system),
+			attribute.String("messaging.operation", "publish"),
+		),
+	)
+	defer span.End()
+
+	w.options.propagator.Inject(ctx, Carrier(*w.Attributes()))
+
+	err := w.MessageWriter.Close()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// SetDelay sets a delay on the message if the wrapped MessageWriter
+// supports it, e.g. an sqs.MessageWriter.
+func (w *tracingWriter) SetDelay(delay time.Duration) {
+	if d, ok := w.MessageWriter.(interface{ SetDelay(time.Duration) }); ok {
+		d.SetDelay(delay)
+	}
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	msg "github.com/hdtradeservices/go-msg"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the tracer of this package.
+const instrumentationName = "github.com/hdtradeservices/go-aws-msg/tracing"
+
+// options configure the decorators of this package.
+type options struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	spanName       string
+	system         string
+}
+
+// Option is the signature that modifies the decorators of this package.
+type Option func(*options)
+
+// WithTracerProvider sets the TracerProvider used to create spans,
+// instead of the global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithPropagator sets the propagator used to inject and extract the trace
+// context in message attributes, instead of W3C Trace Context.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = p
+	}
+}
+
+// WithSpanName sets the name of the spans, instead of
+// "msg.Receiver" for Receiver and "msg.MessageWriter" for Topic.
+func WithSpanName(name string) Option {
+	return func(o *options) {
+		o.spanName = name
+	}
+}
+
+// WithSystem sets the messaging.system attribute of the spans,
+// "aws_sqs" by default.
+func WithSystem(system string) Option {
+	return func(o *options) {
+		o.system = system
+	}
+}
+
+// newOptions returns the options with the given span name by default.
+func newOptions(spanName string, opts []Option) *options {
+	o := &options{
+		tracerProvider: otel.GetTracerProvider(),
+		propagator:     propagation.TraceContext{},
+		spanName:       spanName,
+		system:         "aws_sqs",
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// tracer returns the tracer of the decorators.
+func (o *options) tracer() trace.Tracer {
+	return o.tracerProvider.Tracer(instrumentationName)
+}
+
+// Carrier adapts msg.Attributes to a propagation.TextMapCarrier.
+type Carrier msg.Attributes
+
+// Get returns the value of the attribute key.
+func (c Carrier) Get(key string) string {
+	return msg.Attributes(c).Get(key)
+}
+
+// Set sets the attribute key to value.
+func (c Carrier) Set(key, value string) {
+	msg.Attributes(c).Set(key, value)
+}
+
+// Keys returns the keys of the attributes.
+func (c Carrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	msg "github.com/hdtradeservices/go-msg"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingWriter is a msg.MessageWriter recording the attributes
+// it was closed with.
+type recordingWriter struct {
+	bytes.Buffer
+
+	attributes msg.Attributes
+	closed     chan msg.Attributes
+}
+
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed <- w.attributes
+	return nil
+}
+
+// Tests that the trace context injected by Topic is extracted by Receiver,
+// so that the consumer span is a child of the producer span.
+func TestTopicAndReceiver_PropagateTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	closed := make(chan msg.Attributes, 1)
+	topic := Topic(msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &recordingWriter{attributes: msg.Attributes{}, closed: closed}
+	}), WithTracerProvider(tp))
+
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	attrs := <-closed
+	if attrs.Get("traceparent") == "" {
+		t.Fatalf("Expected traceparent attribute to be set, got %v", attrs)
+	}
+
+	var received trace.SpanContext
+	r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received = trace.SpanContextFromContext(ctx)
+		return errors.New("failed")
+	}), WithTracerProvider(tp))
+
+	if err := r.Receive(context.Background(), &msg.Message{Attributes: attrs, Body: &bytes.Buffer{}}); err == nil {
+		t.Errorf("Expected the receiver error to be returned")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	producer, consumer := spans[0], spans[1]
+	if producer.SpanKind() != trace.SpanKindProducer || consumer.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("Unexpected span kinds %s and %s", producer.SpanKind(), consumer.SpanKind())
+	}
+	if consumer.Parent().SpanID() != producer.SpanContext().SpanID() {
+		t.Errorf("Expected the consumer span to be a child of the producer span")
+	}
+	if received.TraceID() != producer.SpanContext().TraceID() {
+		t.Errorf("Expected the receiver context to carry the trace")
+	}
+	if len(consumer.Events()) != 1 {
+		t.Errorf("Expected the receiver error to be recorded")
+	}
+}
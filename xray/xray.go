@@ -0,0 +1,67 @@
+// Package xray integrates the SQS primitives with AWS X-Ray, starting a
+// segment for each message received by a Server and propagating the trace
+// header of segments to the messages published by a Topic.
+//
+// The trace header travels in the AWSTraceHeader system attribute of SQS
+// messages (see sqs.ContextWithTraceHeader), so that message flows show up
+// in X-Ray service maps:
+//
+//	srv, _ := sqs.NewServer(queueURL, 10, 30, sqs.WithMiddleware(xray.Middleware("worker")))
+//
+//	topic, _ := sqs.NewTopic(queueURL)
+//	topic = xray.Topic(topic)
+package xray
+
+import (
+	"context"
+
+	"github.com/aws/aws-xray-sdk-go/header"
+	awsxray "github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/hdtradeservices/go-aws-msg/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+// Receiver wraps another msg.Receiver, running each Receive in a new X-Ray
+// segment called name. The segment continues the trace of the message, if
+// it has an AWSTraceHeader system attribute, and is closed with the error
+// returned by Receive.
+//
+// The context passed to the receiver carries the segment, and its trace
+// header so that messages published with this context continue the trace.
+func Receiver(next msg.Receiver, name string) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		var seg *awsxray.Segment
+		if h := sqs.TraceHeaderFromContext(ctx); h != "" {
+			ctx, seg = awsxray.NewSegmentFromHeader(ctx, name, nil, header.FromString(h))
+		} else {
+			ctx, seg = awsxray.BeginSegment(ctx, name)
+		}
+
+		ctx = sqs.ContextWithTraceHeader(ctx, seg.DownstreamHeader().String())
+
+		err := next.Receive(ctx, m)
+		seg.Close(err)
+
+		return err
+	})
+}
+
+// Middleware returns a function wrapping receivers with Receiver,
+// to be used with sqs.WithMiddleware.
+func Middleware(name string) func(msg.Receiver) msg.Receiver {
+	return func(next msg.Receiver) msg.Receiver {
+		return Receiver(next, name)
+	}
+}
+
+// Topic wraps a msg.Topic, so that its messages carry the trace header of
+// the X-Ray segment in the context passed to NewWriter, if any.
+func Topic(next msg.Topic) msg.Topic {
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		if seg := awsxray.GetSegment(ctx); seg != nil {
+			ctx = sqs.ContextWithTraceHeader(ctx, seg.DownstreamHeader().String())
+		}
+
+		return next.NewWriter(ctx)
+	})
+}
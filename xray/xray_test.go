@@ -0,0 +1,66 @@
+package xray
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-xray-sdk-go/header"
+	awsxray "github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/hdtradeservices/go-aws-msg/sqs"
+	msg "github.com/hdtradeservices/go-msg"
+)
+
+const testTraceHeader = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+
+// Tests that the segment started by Receiver continues the trace of the
+// message, and that messages published from the receiver carry its header.
+func TestReceiverAndTopic(t *testing.T) {
+	var published context.Context
+	topic := Topic(msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		published = ctx
+		return nil
+	}))
+
+	var seg *awsxray.Segment
+	r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		seg = awsxray.GetSegment(ctx)
+		topic.NewWriter(ctx)
+		return nil
+	}), "worker")
+
+	ctx := sqs.ContextWithTraceHeader(context.Background(), testTraceHeader)
+	if err := r.Receive(ctx, &msg.Message{Attributes: msg.Attributes{}, Body: &bytes.Buffer{}}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if seg == nil {
+		t.Fatalf("Expected a segment in the receiver context")
+	}
+	if seg.TraceID != "1-5759e988-bd862e3fe1be46a994272793" || seg.ParentID != "53995c3f42cd8ad8" {
+		t.Errorf("Expected the segment to continue the trace, got trace %s and parent %s", seg.TraceID, seg.ParentID)
+	}
+
+	h := header.FromString(sqs.TraceHeaderFromContext(published))
+	if h.TraceID != seg.TraceID || h.ParentID != seg.ID {
+		t.Errorf("Expected the published header to point to the segment, got %s", sqs.TraceHeaderFromContext(published))
+	}
+}
+
+// Tests that Receiver starts a new trace for messages without trace header.
+func TestReceiver_NewTrace(t *testing.T) {
+	var traceHeader string
+	r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		traceHeader = sqs.TraceHeaderFromContext(ctx)
+		return nil
+	}), "worker")
+
+	if err := r.Receive(context.Background(), &msg.Message{Attributes: msg.Attributes{}, Body: &bytes.Buffer{}}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if !strings.HasPrefix(traceHeader, "Root=1-") {
+		t.Errorf("Expected a new trace header, got %q", traceHeader)
+	}
+}